@@ -0,0 +1,130 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// WithBatching 启用配额检查合并：CheckQuotaBatched 的请求先缓冲，达到 size 个（通常为 ApplicationConfig.BatchSize）
+// 或第一个请求等待 interval 后合并为一次请求发送，再把每个 profile 的响应分发给对应的调用方
+func WithBatching(size int, interval time.Duration) ClientOption {
+	return func(c *CentralClient) {
+		if size > 0 && interval > 0 {
+			c.batcher = &quotaBatcher{size: size, interval: interval}
+		}
+	}
+}
+
+// quotaBatcher 缓冲等待合并发送的配额检查
+type quotaBatcher struct {
+	mu         sync.Mutex
+	size       int
+	interval   time.Duration
+	pending    []batchedCheck
+	generation uint64 // 每取走一批加一，过期的定时器不会提前发送下一批
+}
+
+// batchedCheck 一个等待合并发送的配额检查
+type batchedCheck struct {
+	quota  common.ProfileQuota
+	result chan batchResult // 容量为 1，调用方放弃等待时发送不会阻塞
+}
+
+// batchResult 分发给单个调用方的结果
+type batchResult struct {
+	resp common.ProfileQuotaResponse
+	err  error
+}
+
+// CheckQuotaBatched 请求单个 profile 的配额，启用 WithBatching 时与其他调用合并发送
+// 合并的请求失败时所有等待的调用方都返回该错误；ctx 取消时立即返回，已缓冲的检查仍会随批次发送
+// 未启用合并时直接发送只包含这一个 profile 的请求
+func (c *CentralClient) CheckQuotaBatched(ctx context.Context, quota common.ProfileQuota) (common.ProfileQuotaResponse, error) {
+	if c.batcher == nil {
+		resp, err := c.CheckQuotaContext(ctx, []common.ProfileQuota{quota})
+		if err != nil {
+			return common.ProfileQuotaResponse{}, err
+		}
+		if len(resp.Quotas) != 1 {
+			return common.ProfileQuotaResponse{}, fmt.Errorf("unexpected quota response: %d quotas for 1 request", len(resp.Quotas))
+		}
+		return resp.Quotas[0], nil
+	}
+
+	check := batchedCheck{quota: quota, result: make(chan batchResult, 1)}
+	c.enqueueBatched(check)
+
+	select {
+	case result := <-check.result:
+		return result.resp, result.err
+	case <-ctx.Done():
+		return common.ProfileQuotaResponse{}, fmt.Errorf("batched quota check: %w", ctx.Err())
+	}
+}
+
+// enqueueBatched 缓冲一个检查，缓冲满时立即发送，第一个检查启动发送定时器
+func (c *CentralClient) enqueueBatched(check batchedCheck) {
+	b := c.batcher
+	b.mu.Lock()
+	b.pending = append(b.pending, check)
+	if len(b.pending) >= b.size {
+		batch := b.takeLocked()
+		b.mu.Unlock()
+		go c.flushBatch(batch)
+		return
+	}
+	if len(b.pending) == 1 {
+		generation := b.generation
+		time.AfterFunc(b.interval, func() { c.flushExpired(generation) })
+	}
+	b.mu.Unlock()
+}
+
+// flushExpired 定时器到期时发送缓冲的检查；这一批已经因为缓冲满而发送时忽略
+func (c *CentralClient) flushExpired(generation uint64) {
+	b := c.batcher
+	b.mu.Lock()
+	if b.generation != generation || len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	batch := b.takeLocked()
+	b.mu.Unlock()
+	c.flushBatch(batch)
+}
+
+// takeLocked 取走当前缓冲的检查；调用方必须持有锁
+func (b *quotaBatcher) takeLocked() []batchedCheck {
+	batch := b.pending
+	b.pending = nil
+	b.generation++
+	return batch
+}
+
+// flushBatch 把一批检查合并为一次请求发送，并按顺序把响应分发给每个调用方
+func (c *CentralClient) flushBatch(batch []batchedCheck) {
+	quotas := make([]common.ProfileQuota, len(batch))
+	for i, check := range batch {
+		quotas[i] = check.quota
+	}
+
+	resp, err := c.CheckQuotaContext(context.Background(), quotas)
+	switch {
+	case err != nil:
+	case resp.Refreshing:
+		err = fmt.Errorf("central is refreshing quotas, retry later")
+	case len(resp.Quotas) != len(batch):
+		err = fmt.Errorf("unexpected quota response: %d quotas for %d requests", len(resp.Quotas), len(batch))
+	}
+
+	for i, check := range batch {
+		if err != nil {
+			check.result <- batchResult{err: fmt.Errorf("batched quota check failed: %w", err)}
+			continue
+		}
+		check.result <- batchResult{resp: resp.Quotas[i]}
+	}
+}
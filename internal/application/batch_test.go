@@ -0,0 +1,138 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// batchCentral a central stub that grants each profile its Required and counts combined requests
+type batchCentral struct {
+	requests atomic.Int32
+	quotas   atomic.Int32
+	fail     atomic.Bool
+}
+
+func (c *batchCentral) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.requests.Add(1)
+	if c.fail.Load() {
+		http.Error(w, "central unavailable", http.StatusBadRequest)
+		return
+	}
+	var req common.QuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.quotas.Add(int32(len(req.Quotas)))
+	resp := common.QuotaResponse{RequestID: req.RequestID}
+	for _, quota := range req.Quotas {
+		resp.Quotas = append(resp.Quotas, common.ProfileQuotaResponse{ProfileID: quota.ProfileID, Granted: quota.Required, Required: quota.Required})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestCheckQuotaBatchedFansResponsesBackToCallers(t *testing.T) {
+	central := &batchCentral{}
+	server := httptest.NewServer(central)
+	defer server.Close()
+	client := NewCentralClient(server.URL, "node-1", WithBatching(10, 20*time.Millisecond))
+
+	const callers = 50
+	var wg sync.WaitGroup
+	for i := 1; i <= callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.CheckQuotaBatched(context.Background(), common.ProfileQuota{ProfileID: i, Required: int64(i)})
+			if err != nil {
+				t.Errorf("caller %d: %v", i, err)
+				return
+			}
+			if resp.ProfileID != i || resp.Granted != int64(i) {
+				t.Errorf("caller %d got %+v, want its own profile granted %d", i, resp, i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if quotas := central.quotas.Load(); quotas != callers {
+		t.Fatalf("central received %d quotas, want %d", quotas, callers)
+	}
+	if requests := central.requests.Load(); requests >= callers {
+		t.Fatalf("central received %d requests for %d callers, want them combined", requests, callers)
+	}
+}
+
+func TestCheckQuotaBatchedFlushesPartialBatchAfterInterval(t *testing.T) {
+	central := &batchCentral{}
+	server := httptest.NewServer(central)
+	defer server.Close()
+	client := NewCentralClient(server.URL, "node-1", WithBatching(100, 20*time.Millisecond))
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.CheckQuotaBatched(context.Background(), common.ProfileQuota{ProfileID: i, Required: 1}); err != nil {
+				t.Errorf("caller %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if requests, quotas := central.requests.Load(), central.quotas.Load(); requests != 1 || quotas != 3 {
+		t.Fatalf("central received %d requests with %d quotas, want 1 request with 3", requests, quotas)
+	}
+}
+
+func TestCheckQuotaBatchedFlushErrorFailsAllCallers(t *testing.T) {
+	central := &batchCentral{}
+	central.fail.Store(true)
+	server := httptest.NewServer(central)
+	defer server.Close()
+	client := NewCentralClient(server.URL, "node-1", WithBatching(5, time.Hour))
+
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.CheckQuotaBatched(context.Background(), common.ProfileQuota{ProfileID: i, Required: 1}); err != nil {
+				failed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := failed.Load(); got != 5 {
+		t.Fatalf("%d of 5 callers failed, want all of them", got)
+	}
+	if requests := central.requests.Load(); requests != 1 {
+		t.Fatalf("central received %d requests, want one combined request", requests)
+	}
+}
+
+func TestCheckQuotaBatchedHonorsContextCancellation(t *testing.T) {
+	central := &batchCentral{}
+	server := httptest.NewServer(central)
+	defer server.Close()
+	client := NewCentralClient(server.URL, "node-1", WithBatching(100, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.CheckQuotaBatched(ctx, common.ProfileQuota{ProfileID: 1, Required: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CheckQuotaBatched = %v, want context.DeadlineExceeded", err)
+	}
+}
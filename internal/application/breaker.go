@@ -0,0 +1,117 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// CircuitBreakerConfig 熔断器配置
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // 连续失败多少次后打开熔断器
+	Cooldown         time.Duration // 打开后经过多久进入半开状态，放行一个探测请求
+}
+
+// DefaultCircuitBreakerConfig 默认熔断策略：连续失败 5 次打开，30 秒后探测
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureThreshold: 5,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+// WithCircuitBreaker 启用熔断器，未设置的字段使用默认值
+// 中心节点持续不可用时，熔断器打开期间所有请求直接以 ErrCircuitOpen 失败，不再发送
+func WithCircuitBreaker(config CircuitBreakerConfig) ClientOption {
+	return func(c *CentralClient) {
+		defaults := DefaultCircuitBreakerConfig()
+		if config.FailureThreshold <= 0 {
+			config.FailureThreshold = defaults.FailureThreshold
+		}
+		if config.Cooldown <= 0 {
+			config.Cooldown = defaults.Cooldown
+		}
+		c.breaker = &circuitBreaker{config: config}
+	}
+}
+
+// ErrCircuitOpen 熔断器打开期间请求被直接拒绝
+// errors.Is(err, common.ErrNodeOffline) 为 true，且不可重试（见 IsRetryable）
+var ErrCircuitOpen error = circuitOpenError{}
+
+type circuitOpenError struct{}
+
+func (circuitOpenError) Error() string {
+	return "circuit breaker open: " + common.ErrNodeOffline.Error()
+}
+func (circuitOpenError) Unwrap() error     { return common.ErrNodeOffline }
+func (circuitOpenError) IsRetryable() bool { return false }
+
+// circuitState 熔断器状态
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // 正常放行
+	circuitOpen                         // 直接拒绝
+	circuitHalfOpen                     // 已放行一个探测请求，等待其结果
+)
+
+// circuitBreaker 按连续失败次数熔断的熔断器
+type circuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int       // 连续失败次数
+	openedAt time.Time // 最近一次打开的时间
+}
+
+// allow 判断是否放行请求；打开状态冷却结束后放行一个探测请求并进入半开状态
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.config.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// 探测请求还没有结果
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// record 记录请求结果：成功时关闭熔断器，失败次数达到阈值或探测失败时打开熔断器
+// 网络错误、超时和 5xx 计为失败，4xx 说明中心节点可用；调用方主动取消的请求不计入，
+// 被取消的探测请求让熔断器回到打开状态，下一个请求立即重新探测
+func (b *circuitBreaker) record(resp *http.Response, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		if b.state == circuitHalfOpen {
+			b.state = circuitOpen
+		}
+		return
+	}
+
+	if err == nil && resp.StatusCode < 500 {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
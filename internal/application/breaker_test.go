@@ -0,0 +1,112 @@
+package application
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// flakyCentral a central that answers with status while it is non-zero and
+// grants every request otherwise, counting the requests that reach it
+type flakyCentral struct {
+	status atomic.Int32
+	hits   atomic.Int32
+}
+
+func (f *flakyCentral) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.hits.Add(1)
+	if status := int(f.status.Load()); status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if r.URL.Path == "/api/v1/quota/check" {
+		grantRequired(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+var oneUnit = []common.ProfileQuota{{ProfileID: 1, Required: 1}}
+
+func TestCircuitBreakerOpensShortCircuitsAndCloses(t *testing.T) {
+	central := &flakyCentral{}
+	central.status.Store(http.StatusServiceUnavailable)
+	server := httptest.NewServer(central)
+	defer server.Close()
+
+	c := NewCentralClient(server.URL, "node-1", WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 3, Cooldown: 100 * time.Millisecond}))
+
+	for i := 0; i < 3; i++ {
+		var statusErr *StatusError
+		if _, err := c.CheckQuota(oneUnit); !errors.As(err, &statusErr) {
+			t.Fatalf("call %d: err = %v, want the server's 503", i, err)
+		}
+	}
+
+	// Open: both quota checks and status reports fail without reaching central
+	if _, err := c.CheckQuota(oneUnit); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, common.ErrNodeOffline) {
+		t.Fatalf("CheckQuota with the breaker open: err = %v, want ErrCircuitOpen wrapping ErrNodeOffline", err)
+	}
+	if err := c.ReportStatus(&common.Counter{}, 0, 0); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("ReportStatus with the breaker open: err = %v, want ErrCircuitOpen", err)
+	}
+	if hits := central.hits.Load(); hits != 3 {
+		t.Fatalf("central received %d requests, want only the 3 failures", hits)
+	}
+	if IsRetryable(ErrCircuitOpen) {
+		t.Fatal("ErrCircuitOpen is retryable")
+	}
+
+	// Half-open after the cooldown: a successful probe closes the breaker
+	central.status.Store(0)
+	time.Sleep(120 * time.Millisecond)
+	if _, err := c.CheckQuota(oneUnit); err != nil {
+		t.Fatalf("half-open probe: %v", err)
+	}
+	if err := c.ReportStatus(&common.Counter{}, 0, 0); err != nil {
+		t.Fatalf("ReportStatus after the breaker closed: %v", err)
+	}
+	if hits := central.hits.Load(); hits != 5 {
+		t.Fatalf("central received %d requests, want the probe and the report to get through", hits)
+	}
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+	central := &flakyCentral{}
+	central.status.Store(http.StatusBadGateway)
+	server := httptest.NewServer(central)
+	defer server.Close()
+
+	c := NewCentralClient(server.URL, "node-1", WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, Cooldown: 50 * time.Millisecond}))
+	c.CheckQuota(oneUnit)
+	time.Sleep(70 * time.Millisecond)
+
+	// The probe fails, so the breaker opens again for a full cooldown
+	if _, err := c.CheckQuota(oneUnit); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("no probe was let through after the cooldown")
+	}
+	if _, err := c.CheckQuota(oneUnit); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after a failed probe: err = %v, want ErrCircuitOpen", err)
+	}
+	if hits := central.hits.Load(); hits != 2 {
+		t.Fatalf("central received %d requests, want the failure and the probe", hits)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	central := &flakyCentral{}
+	central.status.Store(http.StatusBadRequest)
+	server := httptest.NewServer(central)
+	defer server.Close()
+
+	c := NewCentralClient(server.URL, "node-1", WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, Cooldown: time.Hour}))
+	for i := 0; i < 5; i++ {
+		if _, err := c.CheckQuota(oneUnit); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d: breaker opened on 400 responses", i)
+		}
+	}
+}
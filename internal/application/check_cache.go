@@ -0,0 +1,110 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// WithCachedChecks 启用配额检查缓存：ttl 内相同的 CheckQuota 直接返回上一次中心节点的响应，不发送请求；
+// 缓存项存在超过 ttl/2 后在后台刷新一次，超过 ttl 或没有缓存时同步请求中心节点
+// 缓存的响应（Cached 为 true）不是分配：其中的分配量是中心节点之前的决策，没有再次扣减，
+// 后台刷新获得的配额也会立即归还，只适用于能容忍过时数据的低延迟判断
+func WithCachedChecks(ttl time.Duration) ClientOption {
+	return func(c *CentralClient) {
+		if ttl > 0 {
+			c.checkCache = &checkCache{ttl: ttl, entries: make(map[string]*cachedCheck)}
+		}
+	}
+}
+
+// checkCache 按请求的 profile 配额列表缓存的响应
+type checkCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cachedCheck
+}
+
+// cachedCheck 单个缓存的响应
+type cachedCheck struct {
+	resp       common.QuotaResponse
+	fetchedAt  time.Time
+	refreshing bool // 后台刷新正在进行
+}
+
+// cachedCheckQuota 从缓存返回未过期的响应，缓存项存在超过 ttl/2 时触发一次后台刷新；否则同步请求并写入缓存
+func (c *CentralClient) cachedCheckQuota(ctx context.Context, quotas []common.ProfileQuota) (*common.QuotaResponse, error) {
+	key, err := json.Marshal(quotas)
+	if err != nil {
+		return c.checkQuotaRemote(ctx, quotas)
+	}
+
+	c.checkCache.mu.Lock()
+	entry, exists := c.checkCache.entries[string(key)]
+	if exists && time.Since(entry.fetchedAt) < c.checkCache.ttl {
+		resp := entry.resp
+		resp.Quotas = append([]common.ProfileQuotaResponse(nil), entry.resp.Quotas...)
+		resp.Cached = true
+		if time.Since(entry.fetchedAt) >= c.checkCache.ttl/2 && !entry.refreshing {
+			entry.refreshing = true
+			go c.refreshCachedCheck(string(key), quotas)
+		}
+		c.checkCache.mu.Unlock()
+		return &resp, nil
+	}
+	c.checkCache.mu.Unlock()
+
+	resp, err := c.checkQuotaRemote(ctx, quotas)
+	if err != nil {
+		return nil, err
+	}
+	c.storeCachedCheck(string(key), *resp)
+	return resp, nil
+}
+
+// refreshCachedCheck 后台刷新一个缓存项，失败时保留旧的响应直到过期
+// 刷新只为更新缓存的数据，中心节点为这次请求分配的配额立即归还
+func (c *CentralClient) refreshCachedCheck(key string, quotas []common.ProfileQuota) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	resp, err := c.checkQuotaRemote(ctx, quotas)
+	if err != nil {
+		c.logger.Warn("background refresh of cached quota check failed", "error", err)
+		c.checkCache.mu.Lock()
+		if entry, exists := c.checkCache.entries[key]; exists {
+			entry.refreshing = false
+		}
+		c.checkCache.mu.Unlock()
+		return
+	}
+
+	unused := make(map[int]int64)
+	for _, quota := range resp.Quotas {
+		if quota.Granted > 0 {
+			unused[quota.ProfileID] += quota.Granted
+		}
+	}
+	if len(unused) > 0 {
+		if err := c.Release(ctx, common.ReleaseRequest{NodeID: c.nodeID, Unused: unused}); err != nil {
+			c.logger.Warn("release quota from background refresh of cached quota check failed", "error", err)
+		}
+	}
+	c.storeCachedCheck(key, *resp)
+}
+
+// storeCachedCheck 写入缓存，同时清理已过期的缓存项，避免不再使用的请求组合一直占用内存
+func (c *CentralClient) storeCachedCheck(key string, resp common.QuotaResponse) {
+	c.checkCache.mu.Lock()
+	defer c.checkCache.mu.Unlock()
+
+	now := time.Now()
+	for cachedKey, entry := range c.checkCache.entries {
+		if now.Sub(entry.fetchedAt) >= c.checkCache.ttl {
+			delete(c.checkCache.entries, cachedKey)
+		}
+	}
+	c.checkCache.entries[key] = &cachedCheck{resp: resp, fetchedAt: now}
+}
@@ -0,0 +1,134 @@
+package application
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// cacheCentral a central stub that grants every check and records checks and releases
+type cacheCentral struct {
+	mu       sync.Mutex
+	checks   int
+	released map[int]int64
+}
+
+func (c *cacheCentral) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/quota/check", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		c.checks++
+		c.mu.Unlock()
+		grantRequired(w, r)
+	})
+	mux.HandleFunc("/api/v1/quota/release", func(w http.ResponseWriter, r *http.Request) {
+		var req common.ReleaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		for profileID, amount := range req.Unused {
+			c.released[profileID] += amount
+		}
+		c.mu.Unlock()
+	})
+	return mux
+}
+
+func (c *cacheCentral) counts() (int, map[int]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	released := make(map[int]int64, len(c.released))
+	for profileID, amount := range c.released {
+		released[profileID] = amount
+	}
+	return c.checks, released
+}
+
+func TestCachedChecksServeFromCacheAndRefreshOncePerTTL(t *testing.T) {
+	central := &cacheCentral{released: make(map[int]int64)}
+	server := httptest.NewServer(central.handler())
+	defer server.Close()
+
+	const ttl = 400 * time.Millisecond
+	client := NewCentralClient(server.URL, "node-1", WithCachedChecks(ttl))
+	quotas := []common.ProfileQuota{{ProfileID: 1, Required: 10}}
+
+	resp, err := client.CheckQuota(quotas)
+	if err != nil {
+		t.Fatalf("CheckQuota: %v", err)
+	}
+	if resp.Cached || resp.Quotas[0].Granted != 10 {
+		t.Fatalf("first check = %+v, want a fresh grant of 10", resp)
+	}
+
+	// ttl/2 之前命中缓存：不发送请求，也不刷新
+	resp, err = client.CheckQuota(quotas)
+	if err != nil {
+		t.Fatalf("CheckQuota: %v", err)
+	}
+	if !resp.Cached || resp.Quotas[0].Granted != 10 {
+		t.Fatalf("second check = %+v, want the cached response", resp)
+	}
+	if checks, _ := central.counts(); checks != 1 {
+		t.Fatalf("central saw %d checks within the ttl, want 1", checks)
+	}
+
+	// 超过 ttl/2 后多次命中只触发一次后台刷新，刷新获得的配额被归还
+	time.Sleep(ttl/2 + 20*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if resp, err := client.CheckQuota(quotas); err != nil || !resp.Cached {
+			t.Fatalf("check after ttl/2 = %+v, %v, want the cached response", resp, err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		checks, released := central.counts()
+		if checks == 2 && released[1] == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("central saw %d checks and released %v, want one background refresh whose 10 were released", checks, released)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 刷新后的缓存项重新计时，之后的命中不再刷新
+	if resp, err := client.CheckQuota(quotas); err != nil || !resp.Cached {
+		t.Fatalf("check after refresh = %+v, %v, want the cached response", resp, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if checks, _ := central.counts(); checks != 2 {
+		t.Fatalf("central saw %d checks after the refresh, want 2", checks)
+	}
+}
+
+func TestCachedChecksSweepExpiredEntries(t *testing.T) {
+	central := &cacheCentral{released: make(map[int]int64)}
+	server := httptest.NewServer(central.handler())
+	defer server.Close()
+
+	const ttl = 50 * time.Millisecond
+	client := NewCentralClient(server.URL, "node-1", WithCachedChecks(ttl))
+	for profileID := 1; profileID <= 3; profileID++ {
+		if _, err := client.CheckQuota([]common.ProfileQuota{{ProfileID: profileID, Required: 1}}); err != nil {
+			t.Fatalf("CheckQuota: %v", err)
+		}
+	}
+
+	time.Sleep(ttl)
+	if _, err := client.CheckQuota([]common.ProfileQuota{{ProfileID: 4, Required: 1}}); err != nil {
+		t.Fatalf("CheckQuota: %v", err)
+	}
+	client.checkCache.mu.Lock()
+	entries := len(client.checkCache.entries)
+	client.checkCache.mu.Unlock()
+	if entries != 1 {
+		t.Fatalf("cache holds %d entries, want only the fresh one after expired entries were swept", entries)
+	}
+}
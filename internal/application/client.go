@@ -3,38 +3,192 @@ package application
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"os"
 	"throttle_control/internal/common"
 	"time"
 )
 
 // CentralClient 中心节点客户端
 type CentralClient struct {
-	baseURL    string       // 中心节点地址
-	httpClient *http.Client // HTTP客户端
-	nodeID     string       // 本节点ID
+	baseURL    string          // 中心节点地址
+	httpClient *http.Client    // HTTP客户端
+	nodeID     string          // 本节点ID
+	retry      RetryConfig     // 重试退避策略
+	hedgeDelay time.Duration   // 配额请求对冲延迟，0 表示不对冲
+	timeout    time.Duration   // context 没有截止时间时的默认请求超时
+	breaker    *circuitBreaker // 熔断器，未启用时为 nil
+	checkCache *checkCache     // 配额检查缓存，未启用时为 nil
+	batcher    *quotaBatcher   // 配额检查合并，未启用时为 nil
+	tracer     common.Tracer   // 向中心节点传播追踪上下文，默认不追踪
+	logger     Logger          // 后台操作的日志输出，默认 slog.Default()
+}
+
+// defaultRequestTimeout 默认请求超时
+const defaultRequestTimeout = 5 * time.Second
+
+// CentralClient 实现节点使用的 common.Client 接口
+var _ common.Client = (*CentralClient)(nil)
+
+// RetryConfig 重试退避策略
+type RetryConfig struct {
+	BaseBackoff time.Duration // 第一次重试前的等待时间，之后按指数增长
+	MaxBackoff  time.Duration // 单次等待上限
+	Jitter      float64       // 随机抖动比例 [0, 1]，0 表示不抖动
+}
+
+// DefaultRetryConfig 默认重试策略：1 秒起步，上限 30 秒，不抖动
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		BaseBackoff: time.Second,
+		MaxBackoff:  30 * time.Second,
+	}
+}
+
+// ClientOption 客户端可选配置
+type ClientOption func(*CentralClient)
+
+// WithRetryConfig 设置重试退避策略，未设置的字段使用默认值
+func WithRetryConfig(config RetryConfig) ClientOption {
+	return func(c *CentralClient) {
+		defaults := DefaultRetryConfig()
+		if config.BaseBackoff <= 0 {
+			config.BaseBackoff = defaults.BaseBackoff
+		}
+		if config.MaxBackoff <= 0 {
+			config.MaxBackoff = defaults.MaxBackoff
+		}
+		config.Jitter = max(0, min(config.Jitter, 1))
+		c.retry = config
+	}
+}
+
+// WithRootCAs 使用指定的根证书池校验中心节点证书，未设置时使用系统证书池
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(c *CentralClient) {
+		c.tlsConfig().RootCAs = pool
+	}
+}
+
+// WithTLSConfig 使用指定的 TLS 配置连接中心节点，例如通过 Certificates 出示客户端证书（mTLS）
+// 会替换之前设置的 TLS 配置，与 WithRootCAs 同时使用时应放在它之前
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(c *CentralClient) {
+		c.httpClient.Transport.(*http.Transport).TLSClientConfig = config.Clone()
+	}
+}
+
+// WithHedging 启用配额请求对冲：第一次请求在 delay 内没有返回时，
+// 以相同的 RequestID 再发送一次，使用先返回的结果并取消另一个。
+// 中心节点需要启用请求去重，否则两个请求可能都会扣减配额
+func WithHedging(delay time.Duration) ClientOption {
+	return func(c *CentralClient) {
+		c.hedgeDelay = max(delay, 0)
+	}
+}
+
+// WithTimeout 设置请求的默认超时（context 没有截止时间时使用），默认 5 秒
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *CentralClient) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// WithTracer 在发往中心节点的请求头中注入请求 context 的追踪上下文，使中心节点的 span 成为调用方 span 的子 span
+func WithTracer(tracer common.Tracer) ClientOption {
+	return func(c *CentralClient) {
+		if tracer != nil {
+			c.tracer = tracer
+		}
+	}
+}
+
+// WithLogger 设置后台操作（如缓存刷新）的日志输出，为空时使用 slog.Default()
+func WithLogger(logger Logger) ClientOption {
+	return func(c *CentralClient) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// LoadCertPool 从 PEM 文件加载根证书池，配合 WithRootCAs 使用
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA file failed: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no valid certificates found in %s", caFile)
+	}
+	return pool, nil
 }
 
 // NewCentralClient 创建中心节点客户端
-func NewCentralClient(baseURL, nodeID string) *CentralClient {
-	return &CentralClient{
+func NewCentralClient(baseURL, nodeID string, opts ...ClientOption) *CentralClient {
+	c := &CentralClient{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
+			// 超时由每个请求的 context 控制，见 do
 			Transport: &http.Transport{
 				MaxIdleConns:       100,
 				IdleConnTimeout:    90 * time.Second,
 				DisableCompression: true,
 			},
 		},
-		nodeID: nodeID,
+		nodeID:  nodeID,
+		retry:   DefaultRetryConfig(),
+		timeout: defaultRequestTimeout,
+		tracer:  common.NoopTracer{},
+		logger:  slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	return c
 }
 
-// CheckQuota 请求配额
+// tlsConfig 返回传输层的 TLS 配置，不存在时创建
+func (c *CentralClient) tlsConfig() *tls.Config {
+	transport := c.httpClient.Transport.(*http.Transport)
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return transport.TLSClientConfig
+}
+
+// CheckQuota 请求配额；被速率限制的 profile 在 RetryAfter 中给出建议的重试间隔，
+// 所有 profile 都被限制时可用 resp.RetryAfter() 取得最早的重试时间
 func (c *CentralClient) CheckQuota(quotas []common.ProfileQuota) (*common.QuotaResponse, error) {
+	return c.CheckQuotaContext(context.Background(), quotas)
+}
+
+// CheckQuotaContext 请求配额，ctx 取消或超时时立即返回，错误包装 ctx 的错误（context.Canceled 或 context.DeadlineExceeded）
+// ctx 没有截止时间时使用客户端的默认超时；启用 WithCachedChecks 时可能直接返回缓存的响应
+func (c *CentralClient) CheckQuotaContext(ctx context.Context, quotas []common.ProfileQuota) (*common.QuotaResponse, error) {
+	if c.checkCache != nil {
+		return c.cachedCheckQuota(ctx, quotas)
+	}
+	return c.checkQuotaRemote(ctx, quotas)
+}
+
+// checkQuotaRemote 向中心节点发送配额检查，不经过缓存
+func (c *CentralClient) checkQuotaRemote(ctx context.Context, quotas []common.ProfileQuota) (*common.QuotaResponse, error) {
 	req := common.QuotaRequest{
 		NodeID:    c.nodeID,
 		RequestID: fmt.Sprintf("req-%d", time.Now().UnixNano()),
@@ -42,16 +196,97 @@ func (c *CentralClient) CheckQuota(quotas []common.ProfileQuota) (*common.QuotaR
 		Timestamp: time.Now(),
 	}
 
+	resp, err := c.RequestQuota(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RequestQuota 发送配额请求，ctx 取消时中止请求，实现 common.Client
+// 请求未设置 RequestID 时自动生成，便于中心节点去重
+func (c *CentralClient) RequestQuota(ctx context.Context, req common.QuotaRequest) (common.QuotaResponse, error) {
+	if req.RequestID == "" {
+		req.RequestID = fmt.Sprintf("req-%d", time.Now().UnixNano())
+	}
+	if req.Timestamp.IsZero() {
+		req.Timestamp = time.Now()
+	}
+
 	data, err := json.Marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request failed: %w", err)
+		return common.QuotaResponse{}, fmt.Errorf("marshal request failed: %w", err)
 	}
 
-	resp, err := c.httpClient.Post(
+	var resp *common.QuotaResponse
+	if c.hedgeDelay > 0 {
+		resp, err = c.hedgedCheck(ctx, data)
+	} else {
+		resp, err = c.postQuotaCheck(ctx, data)
+	}
+	if err != nil {
+		return common.QuotaResponse{}, err
+	}
+	return *resp, nil
+}
+
+// hedgedCheck 发送配额请求，超过对冲延迟未返回时再发送一次，返回先成功的结果
+// 两个请求都失败时返回最后一个错误
+func (c *CentralClient) hedgedCheck(parent context.Context, data []byte) (*common.QuotaResponse, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel() // 取消仍在进行的另一个请求
+
+	type result struct {
+		resp *common.QuotaResponse
+		err  error
+	}
+	results := make(chan result, 2)
+	send := func() {
+		resp, err := c.postQuotaCheck(ctx, data)
+		results <- result{resp, err}
+	}
+
+	go send()
+	pending := 1
+	hedge := time.NewTimer(c.hedgeDelay)
+	defer hedge.Stop()
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-hedge.C:
+			go send()
+			pending++
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.resp, nil
+			}
+			lastErr = r.err
+			if pending == 0 && hedge.Stop() {
+				// 第一次请求在对冲前就失败了，立即发送对冲请求
+				go send()
+				pending++
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// postQuotaCheck 发送一次配额请求
+func (c *CentralClient) postQuotaCheck(ctx context.Context, data []byte) (*common.QuotaResponse, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
 		fmt.Sprintf("%s/api/v1/quota/check", c.baseURL),
-		"application/json",
 		bytes.NewBuffer(data),
 	)
+	if err != nil {
+		return nil, fmt.Errorf("create request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -61,10 +296,8 @@ func (c *CentralClient) CheckQuota(quotas []common.ProfileQuota) (*common.QuotaR
 		var errorResp struct {
 			Error string `json:"error"`
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-		}
-		return nil, fmt.Errorf("server error: %s", errorResp.Error)
+		json.NewDecoder(resp.Body).Decode(&errorResp)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: errorResp.Error}
 	}
 
 	var quotaResp common.QuotaResponse
@@ -91,18 +324,117 @@ func (c *CentralClient) ReportStatus(counter *common.Counter, cpuUsage, memoryUs
 		return fmt.Errorf("marshal status failed: %w", err)
 	}
 
-	resp, err := c.httpClient.Post(
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/v1/status", c.baseURL), bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("create status request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("report status failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// Heartbeat 向中心节点报告本节点在线，不请求配额
+func (c *CentralClient) Heartbeat(ctx context.Context, nodeID string) error {
+	data, err := json.Marshal(common.NodeStatus{
+		NodeID:   nodeID,
+		State:    common.StateOnline,
+		LastSeen: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal heartbeat failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
 		fmt.Sprintf("%s/api/v1/status", c.baseURL),
-		"application/json",
 		bytes.NewBuffer(data),
 	)
 	if err != nil {
-		return fmt.Errorf("report status failed: %w", err)
+		return fmt.Errorf("create heartbeat request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("heartbeat failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// Handoff 通知中心节点将本节点的配额转交给其余活跃节点，中心节点确认后返回
+func (c *CentralClient) Handoff(ctx context.Context, nodeID string) error {
+	data, err := json.Marshal(map[string]string{"node_id": nodeID})
+	if err != nil {
+		return fmt.Errorf("marshal handoff failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("%s/api/v1/nodes/handoff", c.baseURL),
+		bytes.NewBuffer(data),
+	)
+	if err != nil {
+		return fmt.Errorf("create handoff request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("handoff failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// Release 将本节点未使用的配额归还给中心节点
+func (c *CentralClient) Release(ctx context.Context, release common.ReleaseRequest) error {
+	data, err := json.Marshal(release)
+	if err != nil {
+		return fmt.Errorf("marshal release failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("%s/api/v1/quota/release", c.baseURL),
+		bytes.NewBuffer(data),
+	)
+	if err != nil {
+		return fmt.Errorf("create release request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("release failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	return nil
@@ -110,38 +442,148 @@ func (c *CentralClient) ReportStatus(counter *common.Counter, cpuUsage, memoryUs
 
 // GetHealth 检查中心节点健康状态
 func (c *CentralClient) GetHealth() error {
-	resp, err := c.httpClient.Get(fmt.Sprintf("%s/health", c.baseURL))
+	return c.Health(context.Background())
+}
+
+// Health 检查中心节点健康状态，ctx 控制超时
+func (c *CentralClient) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/health", c.baseURL), nil)
+	if err != nil {
+		return fmt.Errorf("create health request failed: %w", err)
+	}
+
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("health check failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server unhealthy, status code: %d", resp.StatusCode)
+		return fmt.Errorf("server unhealthy: %w", &StatusError{StatusCode: resp.StatusCode})
 	}
 
 	return nil
 }
 
-// RetryWithBackoff 重试机制
+// do 发送请求，启用熔断器时先检查熔断器并记录结果
+func (c *CentralClient) do(req *http.Request) (*http.Response, error) {
+	c.tracer.Inject(req.Context(), req.Header)
+	if c.breaker == nil {
+		return c.send(req)
+	}
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := c.send(req)
+	c.breaker.record(resp, err)
+	return resp, err
+}
+
+// send 发送请求，请求的 context 没有截止时间时使用默认超时
+// 调用方可以通过 context 设置更长或更短的超时
+func (c *CentralClient) send(req *http.Request) (*http.Response, error) {
+	if _, hasDeadline := req.Context().Deadline(); hasDeadline {
+		return c.httpClient.Do(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), c.timeout)
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose 关闭响应体时释放请求的 context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// RetryWithBackoff 重试机制，遇到不可重试的错误（见 IsRetryable）时立即返回
 func (c *CentralClient) RetryWithBackoff(operation func() error, maxRetries int) error {
 	var err error
 	for i := 0; i < maxRetries; i++ {
 		if err = operation(); err == nil {
 			return nil
 		}
-
-		// 指数退避
-		backoff := time.Duration(1<<uint(i)) * time.Second
-		if backoff > 30*time.Second {
-			backoff = 30 * time.Second
+		if !IsRetryable(err) {
+			return fmt.Errorf("operation failed with terminal error: %w", err)
 		}
 
-		time.Sleep(backoff)
+		// 最后一次失败后无需等待
+		if i == maxRetries-1 {
+			break
+		}
+		time.Sleep(c.backoff(i))
 	}
 	return fmt.Errorf("operation failed after %d retries: %w", maxRetries, err)
 }
 
+// StatusError 中心节点返回了非 200 状态码
+type StatusError struct {
+	StatusCode int
+	Message    string // 中心节点返回的错误信息，可能为空
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("server error (%d): %s", e.StatusCode, e.Message)
+}
+
+// IsRetryable 超时、限流和服务端错误可以重试，其余 4xx（如请求无效、未认证）重试也不会成功
+func (e *StatusError) IsRetryable() bool {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout, e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.StatusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsRetryable 判断错误是否值得重试
+// 错误链中实现了 IsRetryable() bool 的错误以其结果为准，调用方主动取消的不重试，
+// 其余错误（如网络错误、超时）视为可重试
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var retryable interface{ IsRetryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.IsRetryable()
+	}
+	return true
+}
+
+// backoff 计算第 attempt 次失败后的等待时间（指数退避）
+func (c *CentralClient) backoff(attempt int) time.Duration {
+	backoff := c.retry.MaxBackoff
+	if attempt < 63 {
+		if d := c.retry.BaseBackoff << uint(attempt); d > 0 && d < backoff {
+			backoff = d
+		}
+	}
+
+	if c.retry.Jitter > 0 {
+		// 在 [1-jitter, 1+jitter] 范围内随机缩放，避免多个节点同时重试
+		factor := 1 - c.retry.Jitter + 2*c.retry.Jitter*rand.Float64()
+		backoff = time.Duration(float64(backoff) * factor)
+	}
+
+	return backoff
+}
+
 // Close 关闭客户端
 func (c *CentralClient) Close() {
 	c.httpClient.CloseIdleConnections()
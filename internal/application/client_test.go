@@ -0,0 +1,578 @@
+package application
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"throttle_control/internal/central"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// grantRequired a central quota check handler that grants every profile what it requires
+func grantRequired(w http.ResponseWriter, r *http.Request) {
+	var req common.QuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := common.QuotaResponse{RequestID: req.RequestID}
+	for _, quota := range req.Quotas {
+		resp.Quotas = append(resp.Quotas, common.ProfileQuotaResponse{ProfileID: quota.ProfileID, Granted: quota.Required, Required: quota.Required})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// serverCertPool returns a pool trusting the test server's self-signed certificate
+func serverCertPool(server *httptest.Server) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return pool
+}
+
+func TestBackoffScheduleWithCustomBaseAndCap(t *testing.T) {
+	c := NewCentralClient("http://central", "node-1", WithRetryConfig(RetryConfig{
+		BaseBackoff: 100 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}))
+
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for attempt, expected := range want {
+		if got := c.backoff(attempt); got != expected {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, expected)
+		}
+	}
+	if got := c.backoff(200); got != time.Second {
+		t.Errorf("backoff(200) = %v, want the cap despite shift overflow", got)
+	}
+}
+
+func TestBackoffDefaults(t *testing.T) {
+	c := NewCentralClient("http://central", "node-1", WithRetryConfig(RetryConfig{MaxBackoff: 4 * time.Second}))
+
+	if got := c.backoff(0); got != time.Second {
+		t.Errorf("backoff(0) = %v, want the default base of 1s", got)
+	}
+	if got := c.backoff(5); got != 4*time.Second {
+		t.Errorf("backoff(5) = %v, want the configured cap of 4s", got)
+	}
+}
+
+func TestBackoffJitterStaysInRange(t *testing.T) {
+	c := NewCentralClient("http://central", "node-1", WithRetryConfig(RetryConfig{
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+		Jitter:      0.2,
+	}))
+
+	for i := 0; i < 100; i++ {
+		if got := c.backoff(1); got < 1600*time.Millisecond || got > 2400*time.Millisecond {
+			t.Fatalf("backoff(1) = %v, want within 20%% of 2s", got)
+		}
+	}
+}
+
+func TestClientTrustsCustomRootCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(grantRequired))
+	defer server.Close()
+	quotas := []common.ProfileQuota{{ProfileID: 1, Required: 10}}
+
+	trusting := NewCentralClient(server.URL, "node-1", WithRootCAs(serverCertPool(server)))
+	resp, err := trusting.CheckQuota(quotas)
+	if err != nil {
+		t.Fatalf("CheckQuota with the server CA: %v", err)
+	}
+	if resp.Quotas[0].Granted != 10 {
+		t.Errorf("granted = %d, want 10", resp.Quotas[0].Granted)
+	}
+
+	untrusting := NewCentralClient(server.URL, "node-1")
+	if _, err := untrusting.CheckQuota(quotas); err == nil {
+		t.Error("CheckQuota without the server CA succeeded, want a certificate error")
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(grantRequired))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := LoadCertPool(caFile)
+	if err != nil {
+		t.Fatalf("LoadCertPool: %v", err)
+	}
+	client := NewCentralClient(server.URL, "node-1", WithRootCAs(pool))
+	if _, err := client.CheckQuota([]common.ProfileQuota{{ProfileID: 1, Required: 1}}); err != nil {
+		t.Errorf("CheckQuota with the loaded CA: %v", err)
+	}
+
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertPool(caFile); err == nil {
+		t.Error("LoadCertPool accepted a file without certificates")
+	}
+}
+
+func TestHedgedRequestBeatsSlowFirstAndDebitsOnce(t *testing.T) {
+	qm := central.NewQuotaManager(time.Hour, map[int]central.ProfileConfig{1: {TotalQuota: 100}},
+		central.WithIdempotency(central.IdempotencyConfig{TTL: time.Minute}))
+
+	var mu sync.Mutex
+	var requestIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req common.QuotaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requestIDs = append(requestIDs, req.RequestID)
+		first := len(requestIDs) == 1
+		mu.Unlock()
+
+		resp := qm.CheckQuota(req)
+		if first {
+			// The first attempt is slow after central has already processed it
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewCentralClient(server.URL, "node-1", WithHedging(50*time.Millisecond))
+	start := time.Now()
+	resp, err := c.RequestQuota(context.Background(), common.QuotaRequest{
+		NodeID: "node-1",
+		Quotas: []common.ProfileQuota{{ProfileID: 1, Required: 30}},
+	})
+	if err != nil {
+		t.Fatalf("RequestQuota: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("hedged request took %v, want the hedge to answer first", elapsed)
+	}
+	if len(resp.Quotas) != 1 || resp.Quotas[0].Granted != 30 {
+		t.Fatalf("response = %+v, want 30 granted", resp)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requestIDs) != 2 || requestIDs[0] != requestIDs[1] {
+		t.Fatalf("central saw request IDs %v, want the same ID twice", requestIDs)
+	}
+	status := qm.GetQuotaStatus()
+	profile := status["profiles"].(map[string]interface{})["profile_1"].(map[string]interface{})
+	if used := profile["used_quota"].(int64); used != 30 {
+		t.Fatalf("central used_quota = %d, want the hedged request debited once", used)
+	}
+}
+
+func TestRetryWithBackoffStopsOnTerminalError(t *testing.T) {
+	c := NewCentralClient("http://central", "node-1", WithRetryConfig(RetryConfig{
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}))
+
+	calls := 0
+	err := c.RetryWithBackoff(func() error {
+		calls++
+		return &StatusError{StatusCode: 400}
+	}, 5)
+	if err == nil || calls != 1 {
+		t.Fatalf("calls = %d, err = %v, want a single call and an error", calls, err)
+	}
+
+	calls = 0
+	err = c.RetryWithBackoff(func() error {
+		calls++
+		if calls < 3 {
+			return &StatusError{StatusCode: 503}
+		}
+		return nil
+	}, 5)
+	if err != nil || calls != 3 {
+		t.Fatalf("calls = %d, err = %v, want success on the third call", calls, err)
+	}
+
+	var statusErr *StatusError
+	err = c.RetryWithBackoff(func() error { return &StatusError{StatusCode: 502} }, 2)
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 502 {
+		t.Fatalf("err = %v, want the last StatusError wrapped", err)
+	}
+}
+
+func TestRetryWithBackoffAgainstCentralStatuses(t *testing.T) {
+	var mu sync.Mutex
+	var hits int
+	statuses := []int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		var status int
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		grantRequired(w, r)
+	}))
+	defer server.Close()
+
+	c := NewCentralClient(server.URL, "node-1", WithRetryConfig(RetryConfig{
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}))
+	check := func() error {
+		_, err := c.RequestQuota(context.Background(), common.QuotaRequest{
+			NodeID: "node-1",
+			Quotas: []common.ProfileQuota{{ProfileID: 1, Required: 1}},
+		})
+		return err
+	}
+	run := func(responses ...int) (int, error) {
+		mu.Lock()
+		hits, statuses = 0, responses
+		mu.Unlock()
+		err := c.RetryWithBackoff(check, 5)
+		mu.Lock()
+		defer mu.Unlock()
+		return hits, err
+	}
+
+	if calls, err := run(http.StatusBadRequest, http.StatusBadRequest); err == nil || calls != 1 {
+		t.Fatalf("400: calls = %d, err = %v, want a single call and an error", calls, err)
+	}
+	if calls, err := run(http.StatusUnauthorized); err == nil || calls != 1 {
+		t.Fatalf("401: calls = %d, err = %v, want a single call and an error", calls, err)
+	}
+	if calls, err := run(http.StatusServiceUnavailable, http.StatusServiceUnavailable); err != nil || calls != 3 {
+		t.Fatalf("503: calls = %d, err = %v, want success on the third call", calls, err)
+	}
+}
+
+func TestRequestQuotaHonorsContextCancellation(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewCentralClient(server.URL, "node-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := c.RequestQuota(ctx, common.QuotaRequest{
+		NodeID: "node-1",
+		Quotas: []common.ProfileQuota{{ProfileID: 1, Required: 1}},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("RequestQuota returned after %v, want promptly after cancellation", elapsed)
+	}
+	if IsRetryable(err) {
+		t.Fatal("a cancelled request is reported as retryable")
+	}
+}
+
+func TestNodeUsesCentralClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(grantRequired))
+	defer server.Close()
+
+	n := newTestNode(t, NewCentralClient(server.URL, "node-1"), NodeConfig{}, map[int]int64{1: 0})
+	n.refreshQuotas()
+	if at, err := n.LastRefreshStatus(); err != nil || at.IsZero() {
+		t.Fatalf("refresh through CentralClient: at %v, err %v", at, err)
+	}
+}
+
+func TestNodeRefreshesAgainstCentralServer(t *testing.T) {
+	addr := freeAddr(t)
+	server := central.NewServer(&central.ServerConfig{
+		Port:            addr,
+		RefreshInterval: time.Hour,
+		ProfileConfigs:  map[int]central.ProfileConfig{1: {TotalQuota: 1000}, 2: {TotalQuota: 1000}},
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	go server.Start()
+
+	n := newTestNode(t, NewCentralClient("http://"+addr, "node-1"), NodeConfig{TargetQuota: 100}, map[int]int64{1: 0, 2: 100})
+
+	// Wait for the server to listen
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		n.refreshQuotas()
+		if _, err = n.LastRefreshStatus(); err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("refresh against central: %v", err)
+	}
+	// Profile 1 was topped up to the target; profile 2 was already full and asked for nothing
+	for _, profileID := range []int{1, 2} {
+		if status, _ := n.ProfileStatus(profileID); status.Available != 100 {
+			t.Fatalf("profile %d available = %d after refresh, want 100", profileID, status.Available)
+		}
+	}
+
+	// Reserve spent during an outage is charged to the profile by the next refresh
+	n.mu.Lock()
+	n.localQuotas[1].emergencyUsed = 30
+	n.emergencyUsed = 30
+	n.mu.Unlock()
+	n.refreshQuotas()
+	if _, err := n.LastRefreshStatus(); err != nil {
+		t.Fatalf("refresh reporting the reserve: %v", err)
+	}
+	if status := n.GetStatus(); status.EmergencyUsed != 0 {
+		t.Fatalf("emergency used = %d after the refresh, want it reconciled", status.EmergencyUsed)
+	}
+
+	resp, err := http.Get("http://" + addr + "/api/v1/status?profiles=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status struct {
+		Profiles map[string]struct {
+			UsedQuota int64 `json:"used_quota"`
+		} `json:"profiles"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if used := status.Profiles["profile_1"].UsedQuota; used != 130 {
+		t.Fatalf("central used quota = %d, want the 100 granted plus the 30 reserve", used)
+	}
+}
+
+func TestCheckQuotaContextCancelledMidFlight(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewCentralClient(server.URL, "node-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		// Cancel once the request is being served, not before it is sent
+		<-arrived
+		cancel()
+	}()
+
+	start := time.Now()
+	resp, err := c.CheckQuotaContext(ctx, []common.ProfileQuota{{ProfileID: 1, Required: 1}})
+	if resp != nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("CheckQuotaContext = %v, %v, want a wrapped context.Canceled", resp, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("CheckQuotaContext returned after %v, want promptly after cancellation", elapsed)
+	}
+
+	// A deadline shorter than the server's response also returns promptly
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.CheckQuotaContext(ctx, []common.ProfileQuota{{ProfileID: 1, Required: 1}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a wrapped context.DeadlineExceeded", err)
+	}
+}
+
+// testCert is a certificate issued for a test together with its key
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// issueCert creates a certificate from template, signed by parent, or
+// self-signed if parent is nil
+func issueCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// freeAddr returns a loopback address that was free a moment ago
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestMutualTLSRejectsClientWithoutCertificate(t *testing.T) {
+	ca := issueCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "throttle test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := issueCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "central"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, ca)
+	clientCert := issueCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "node-1"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, ca)
+
+	dir := t.TempDir()
+	files := map[string][]byte{"ca.pem": ca.certPEM, "server.pem": serverCert.certPEM, "server-key.pem": serverCert.keyPEM}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addr := freeAddr(t)
+	server := central.NewServer(&central.ServerConfig{
+		Port:            addr,
+		RefreshInterval: time.Hour,
+		ProfileConfigs:  map[int]central.ProfileConfig{1: {TotalQuota: 100}},
+		TLSCertFile:     filepath.Join(dir, "server.pem"),
+		TLSKeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile:    filepath.Join(dir, "ca.pem"),
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	go server.Start()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	keyPair, err := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "https://" + addr
+	authenticated := NewCentralClient(url, "node-1", WithTLSConfig(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{keyPair}}))
+	anonymous := NewCentralClient(url, "node-1", WithTLSConfig(&tls.Config{RootCAs: roots}))
+	quotas := []common.ProfileQuota{{ProfileID: 1, Required: 10}}
+
+	// Wait for the server to listen
+	var resp *common.QuotaResponse
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if resp, err = authenticated.CheckQuota(quotas); err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("CheckQuota with a client certificate: %v", err)
+	}
+	if resp.Quotas[0].Granted != 10 {
+		t.Fatalf("granted = %d, want 10", resp.Quotas[0].Granted)
+	}
+
+	if _, err := anonymous.CheckQuota(quotas); err == nil {
+		t.Fatal("CheckQuota without a client certificate succeeded, want the handshake rejected")
+	}
+}
+
+func TestCheckQuotaSurfacesRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "3")
+		json.NewEncoder(w).Encode(common.QuotaResponse{Quotas: []common.ProfileQuotaResponse{
+			{ProfileID: 1, Required: 1, RateLimited: true, RetryAfter: 2500 * time.Millisecond},
+			{ProfileID: 2, Required: 1, RateLimited: true, RetryAfter: 4 * time.Second},
+		}})
+	}))
+	defer server.Close()
+
+	resp, err := NewCentralClient(server.URL, "node-1").CheckQuota([]common.ProfileQuota{{ProfileID: 1, Required: 1}, {ProfileID: 2, Required: 1}})
+	if err != nil {
+		t.Fatalf("CheckQuota: %v", err)
+	}
+	retryAfter, limited := resp.RetryAfter()
+	if !limited || retryAfter != 2500*time.Millisecond {
+		t.Fatalf("RetryAfter() = %v, %v, want the earliest 2.5s", retryAfter, limited)
+	}
+}
@@ -0,0 +1,15 @@
+package application
+
+import "log/slog"
+
+// Logger is the structured logger the node and the central client write to.
+// *slog.Logger satisfies it, and so does central's Logger, so both sides of a
+// deployment can share one.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+var _ Logger = (*slog.Logger)(nil)
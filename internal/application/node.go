@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
 	"sync"
 	"throttle_control/internal/common"
 	"time"
@@ -12,63 +15,219 @@ import (
 // Node represents an application node that manages local quotas
 type Node struct {
 	nodeID      string
-	client      *Client
+	client      common.Client
 	mu          sync.RWMutex
 	localQuotas map[int]*LocalQuota
 	config      NodeConfig
+	draining    bool
+
+	// Current refresh interval, adjusted after each refresh when adaptive
+	// refresh is enabled; guarded by mu
+	refreshInterval time.Duration
+
+	// Refresh outcome, guarded by mu
+	lastRefreshAt    time.Time
+	lastRefreshErr   error
+	refreshSuccesses int64
+	refreshFailures  int64
+
+	// Emergency reserve spent during a central outage, guarded by mu
+	emergencyUsed int64
+
+	// Shutdown coordination
+	stop      chan struct{}  // closed by Close to stop background loops
+	closeOnce sync.Once      // guards closing stop
+	loops     sync.WaitGroup // background loops
+	inflight  sync.WaitGroup // requests admitted before draining
 }
 
-// LocalQuota tracks local quota usage and rate limiting
+// LocalQuota tracks local quota usage and rate limiting. Each refresh starts
+// a new interval: what is left of the allocation carries over, topped up by
+// central's grant, and usage counts from zero again.
 type LocalQuota struct {
-	allocated   int64
-	used        int64
-	lastRefresh time.Time
-	rateLimiter RateLimiter
+	allocated     int64 // available at the start of the interval
+	used          int64 // used during the interval
+	emergencyUsed int64 // drawn from the node's emergency reserve, not yet reconciled
+	lastRefresh   time.Time
+	rateLimiter   common.RateLimiter
+
+	// Lowest allocated-used seen in the current refresh interval, and in the
+	// last completed one
+	headroom     int64
+	lastHeadroom int64
+	// allocated-used at the start of the current refresh interval
+	startHeadroom int64
 }
 
 // NodeConfig contains node configuration
 type NodeConfig struct {
 	RefreshInterval time.Duration
-	MaxRetries      int
-	Timeout         time.Duration
+	// MaxRetries is the number of attempts per refresh; a refresh always
+	// makes at least one
+	MaxRetries int
+	// TargetQuota is the local quota each profile keeps on hand: every
+	// refresh asks central to top the profile back up to it. Zero means
+	// defaultTargetQuota
+	TargetQuota int64
+	Timeout     time.Duration
+	// Per-operation timeouts for calls to central; zero means Timeout.
+	// A node on a WAN link may need a longer RefreshTimeout than heartbeats.
+	RefreshTimeout time.Duration
+	ReportTimeout  time.Duration
+	HealthTimeout  time.Duration
+	// EmergencyReserve is a node-local quota, shared by all profiles, that is
+	// spent only while central is unreachable and the regular quota is stale.
+	// Spent reserve is reported to central with the next successful refresh,
+	// which charges it to the profiles it was spent on.
+	EmergencyReserve int64
+	// Metrics receives the per-profile headroom at the end of each refresh
+	// interval; optional
+	Metrics MetricsSink
+	// AdaptiveRefresh varies the refresh interval with the node's consumption;
+	// nil keeps RefreshInterval fixed
+	AdaptiveRefresh *AdaptiveRefreshConfig
+	// FallbackMode decides admission while central is unreachable after
+	// MaxRetries
+	FallbackMode FallbackMode
+	// DegradedFraction is the share of the last-known allocation admitted in
+	// FallbackDegraded mode; zero means defaultDegradedFraction
+	DegradedFraction float64
+	// Logger receives refresh failures and central's warnings; nil means
+	// slog.Default()
+	Logger Logger
+}
+
+// FallbackMode is the admission policy while the last refresh failed
+type FallbackMode int
+
+const (
+	// FallbackEmergency keeps spending the last allocation until it goes
+	// stale, then spends the EmergencyReserve (default)
+	FallbackEmergency FallbackMode = iota
+	// FallbackDegraded caps admission to DegradedFraction of the last-known
+	// allocation
+	FallbackDegraded
+	// FallbackOpen admits every request that passes the local rate limiter
+	FallbackOpen
+	// FallbackClosed rejects every request
+	FallbackClosed
+)
+
+func (m FallbackMode) String() string {
+	switch m {
+	case FallbackDegraded:
+		return "degraded"
+	case FallbackOpen:
+		return "open"
+	case FallbackClosed:
+		return "closed"
+	default:
+		return "emergency"
+	}
+}
+
+// refreshRetryDelay is the wait between refresh attempts
+const refreshRetryDelay = time.Second
+
+// errRefreshNotAttempted is recorded when a refresh ends without calling central
+var errRefreshNotAttempted = errors.New("refresh made no attempt to reach central")
+
+// defaultTargetQuota is the local quota each profile is topped up to when
+// TargetQuota is unset
+const defaultTargetQuota = 100
+
+// defaultDegradedFraction is the share of the allocation admitted in
+// FallbackDegraded mode when DegradedFraction is unset
+const defaultDegradedFraction = 0.5
+
+// AdaptiveRefreshConfig bounds the adaptive refresh interval. A node that
+// consumed a large share of its headroom during an interval refreshes twice
+// as often, so it does not run dry before the next allocation; a node that
+// consumed almost nothing refreshes half as often, reducing load on central.
+type AdaptiveRefreshConfig struct {
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+// Share of the headroom consumed during an interval above which the node is
+// considered busy, and below which it is considered idle
+const (
+	busyConsumption = 0.5
+	idleConsumption = 0.1
+)
+
+// targetQuota returns the local quota each profile is topped up to
+func (c NodeConfig) targetQuota() int64 {
+	if c.TargetQuota > 0 {
+		return c.TargetQuota
+	}
+	return defaultTargetQuota
+}
+
+// logger returns the configured logger, or slog.Default()
+func (c NodeConfig) logger() Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
 }
 
+// timeout returns the override if set, otherwise the default Timeout
+func (c NodeConfig) timeout(override time.Duration) time.Duration {
+	if override > 0 {
+		return override
+	}
+	return c.Timeout
+}
+
+// MetricsSink receives node metrics. The central package's Prometheus and
+// StatsD sinks satisfy it.
+type MetricsSink interface {
+	SetGauge(name string, labels map[string]string, value float64)
+}
+
+// metricQuotaHeadroom is the lowest local quota headroom of a profile during
+// the last refresh interval
+const metricQuotaHeadroom = "throttle_node_quota_headroom"
+
 // NewNode creates a new application node
-func NewNode(nodeID string, client *Client, config NodeConfig) *Node {
+func NewNode(nodeID string, client common.Client, config NodeConfig) *Node {
 	n := &Node{
 		nodeID:      nodeID,
 		client:      client,
 		localQuotas: make(map[int]*LocalQuota),
 		config:      config,
+		stop:        make(chan struct{}),
 	}
+	n.refreshInterval = n.clampRefreshInterval(config.RefreshInterval)
 
 	// Start background quota refresh
+	n.loops.Add(1)
 	go n.startQuotaRefresh()
 
 	return n
 }
 
-// HandleRequest processes an incoming request with quota checking
+// HandleRequest processes an incoming request with quota checking.
+// Checks run under the read lock and the lock is released while the request is
+// processed; usage is committed under the write lock after re-validating the
+// quotas, since other requests may have consumed them in the meantime.
 func (n *Node) HandleRequest(req common.Request) (common.Response, error) {
 	n.mu.RLock()
-	defer n.mu.RUnlock()
-
-	// Check local quotas first
-	for profileID, quota := range req.Quotas {
-		localQuota, exists := n.localQuotas[profileID]
-		if !exists {
-			return common.Response{}, fmt.Errorf("profile %d not configured", profileID)
-		}
-
-		// Check rate limiting
-		if !localQuota.rateLimiter.Allow() {
-			return common.Response{}, common.ErrRateLimited
-		}
+	if n.draining {
+		n.mu.RUnlock()
+		return common.Response{}, common.ErrNodeOffline
+	}
+	n.inflight.Add(1)
+	defer n.inflight.Done()
 
-		// Check available quota
-		if localQuota.allocated-localQuota.used < quota.Required {
-			return common.Response{}, common.ErrQuotaExceeded
-		}
+	err := n.checkRateLocked(req)
+	if err == nil {
+		_, err = n.checkQuotaLocked(req)
+	}
+	n.mu.RUnlock()
+	if err != nil {
+		return common.Response{}, err
 	}
 
 	// Process request (simulated)
@@ -77,95 +236,504 @@ func (n *Node) HandleRequest(req common.Request) (common.Response, error) {
 	// Update usage
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	for profileID, quota := range req.Quotas {
-		n.localQuotas[profileID].used += quota.Required
+	granted, err := n.checkQuotaLocked(req)
+	if err != nil {
+		return common.Response{}, err
+	}
+	emergency := n.lastRefreshErr != nil && n.config.FallbackMode == FallbackEmergency
+	for profileID := range req.Quotas {
+		localQuota := n.localQuotas[profileID]
+		if emergency && localQuota.stale(n.refreshInterval) {
+			localQuota.emergencyUsed += granted[profileID]
+			n.emergencyUsed += granted[profileID]
+			continue
+		}
+		localQuota.used += granted[profileID]
+		localQuota.headroom = min(localQuota.headroom, localQuota.allocated-localQuota.used)
 	}
 
 	return common.Response{
 		RequestID: req.RequestID,
 		Status:    common.StatusOK,
+		Granted:   granted,
 	}, nil
 }
 
+// checkRateLocked applies the local rate limiters; caller must hold the lock
+func (n *Node) checkRateLocked(req common.Request) error {
+	for profileID := range req.Quotas {
+		localQuota, exists := n.localQuotas[profileID]
+		if !exists {
+			return fmt.Errorf("profile %d not configured", profileID)
+		}
+		if !localQuota.rateLimiter.Allow() {
+			return common.ErrRateLimited
+		}
+	}
+	return nil
+}
+
+// checkQuotaLocked verifies the request fits in the local quotas, adjusted
+// by the fallback mode during a central outage, and returns the amount each
+// profile would be granted. A shortfall fails the whole request unless the
+// quota sets PartialAllowed, in which case whatever is available is granted;
+// nothing available is still a denial. The emergency reserve is always
+// all-or-nothing. Caller must hold the lock
+func (n *Node) checkQuotaLocked(req common.Request) (map[int]int64, error) {
+	fallback, outage := n.config.FallbackMode, n.lastRefreshErr != nil
+	if outage && fallback == FallbackClosed {
+		return nil, common.ErrQuotaExceeded
+	}
+
+	granted := make(map[int]int64, len(req.Quotas))
+	var emergencyRequired int64
+	for profileID, quota := range req.Quotas {
+		localQuota, exists := n.localQuotas[profileID]
+		if !exists {
+			return nil, fmt.Errorf("profile %d not configured", profileID)
+		}
+
+		allocated := localQuota.allocated
+		if outage {
+			switch fallback {
+			case FallbackOpen:
+				granted[profileID] = quota.Required
+				continue
+			case FallbackDegraded:
+				allocated = int64(float64(allocated) * n.degradedFraction())
+			default:
+				// Central is unreachable and the allocation can no longer be trusted
+				if localQuota.stale(n.refreshInterval) {
+					emergencyRequired += quota.Required
+					granted[profileID] = quota.Required
+					continue
+				}
+			}
+		}
+
+		available := allocated - localQuota.used
+		switch {
+		case available >= quota.Required:
+			granted[profileID] = quota.Required
+		case quota.PartialAllowed && available > 0:
+			granted[profileID] = available
+		default:
+			return nil, common.ErrQuotaExceeded
+		}
+	}
+	if emergencyRequired > n.config.EmergencyReserve-n.emergencyUsed {
+		return nil, common.ErrQuotaExceeded
+	}
+	return granted, nil
+}
+
 // startQuotaRefresh periodically refreshes quotas from central server
 func (n *Node) startQuotaRefresh() {
-	ticker := time.NewTicker(n.config.RefreshInterval)
+	defer n.loops.Done()
+
+	ticker := time.NewTicker(n.currentRefreshInterval())
 	defer ticker.Stop()
 
-	for range ticker.C {
-		n.refreshQuotas()
+	for {
+		select {
+		case <-ticker.C:
+			n.refreshQuotas()
+			if n.config.AdaptiveRefresh != nil {
+				ticker.Reset(n.currentRefreshInterval())
+			}
+		case <-n.stop:
+			return
+		}
 	}
 }
 
 // refreshQuotas fetches and updates local quotas
 func (n *Node) refreshQuotas() {
-	ctx, cancel := context.WithTimeout(context.Background(), n.config.Timeout)
-	defer cancel()
-
 	req := common.QuotaRequest{
-		NodeID: n.nodeID,
-		Quotas: make(map[int]common.ProfileQuota),
+		NodeID:  n.nodeID,
+		Refresh: true,
 	}
 
-	// Build request with current profiles
+	// Build request with current profiles, asking for the top-up back to the
+	// target and reporting the emergency reserve spent since the last
+	// successful refresh so central can charge it. Profiles that are still
+	// full ask for nothing, which central accepts in a refresh
+	target := n.config.targetQuota()
 	n.mu.RLock()
-	for profileID := range n.localQuotas {
-		req.Quotas[profileID] = common.ProfileQuota{
+	for profileID, localQuota := range n.localQuotas {
+		req.Quotas = append(req.Quotas, common.ProfileQuota{
 			ProfileID: profileID,
-			Required:  0, // Just requesting quota refresh
+			Required:  max(target-localQuota.remaining(), 0),
+		})
+		if localQuota.emergencyUsed > 0 {
+			if req.Consumed == nil {
+				req.Consumed = make(map[int]int64)
+			}
+			req.Consumed[profileID] = localQuota.emergencyUsed
 		}
 	}
 	n.mu.RUnlock()
 
-	// Retry loop
+	// Central rejects empty quota requests; just report liveness instead
+	if len(req.Quotas) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), n.config.timeout(n.config.ReportTimeout))
+		defer cancel()
+		n.recordRefresh(n.client.Heartbeat(ctx, n.nodeID))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.timeout(n.config.RefreshTimeout))
+	defer cancel()
+
+	// Retry loop; a refresh that never reached central is a failure, not a
+	// success, so the status does not hide a node running on stale quota
+	attempts := max(1, n.config.MaxRetries)
 	var resp common.QuotaResponse
-	var err error
-	for i := 0; i < n.config.MaxRetries; i++ {
+	err := errRefreshNotAttempted
+	for i := 0; i < attempts; i++ {
+		if i > 0 && !n.waitRetry(ctx) {
+			break
+		}
 		resp, err = n.client.RequestQuota(ctx, req)
-		if err == nil {
+		if err == nil || !IsRetryable(err) {
 			break
 		}
-		time.Sleep(time.Second)
 	}
 
 	if err != nil {
-		// TODO: Log error and implement fallback strategy
+		n.config.logger().Warn("quota refresh failed, admitting in fallback mode",
+			"node_id", n.nodeID, "profiles", len(req.Quotas), "attempts", attempts, "fallback", n.config.FallbackMode.String(), "error", err)
+		n.recordRefresh(err)
 		return
 	}
 
 	// Update local quotas
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	n.recordRefreshLocked(nil)
+	for _, warning := range resp.Warnings {
+		n.config.logger().Warn("central warning",
+			"node_id", n.nodeID, "profile_id", warning.ProfileID, "code", warning.Code, "message", warning.Message)
+	}
 	for _, profileResp := range resp.Quotas {
+		if profileResp.NotFound {
+			// Central does not know the profile, stop requesting it; requests
+			// for it now fail as not configured instead of as quota exceeded
+			if _, exists := n.localQuotas[profileResp.ProfileID]; exists {
+				n.config.logger().Info("profile not found on central, dropping it", "node_id", n.nodeID, "profile_id", profileResp.ProfileID)
+				delete(n.localQuotas, profileResp.ProfileID)
+			}
+			continue
+		}
 		if localQuota, exists := n.localQuotas[profileResp.ProfileID]; exists {
-			localQuota.allocated = profileResp.Granted
+			localQuota.allocated = localQuota.remaining() + profileResp.Granted
+			localQuota.used = 0
 			localQuota.lastRefresh = time.Now()
 		}
 	}
+	if !resp.Frozen && !resp.DeadlineExceeded && !resp.Refreshing {
+		// Central processed the request and charged the reported reserve
+		n.reconcileEmergencyLocked(req.Consumed)
+	}
+	n.adaptRefreshIntervalLocked()
+	n.rollHeadroomLocked()
 }
 
-// GetStatus returns current node status
-func (n *Node) GetStatus() common.NodeStatus {
+// waitRetry waits before the next refresh attempt. It returns false if the
+// refresh deadline passes or the node is closed first
+func (n *Node) waitRetry(ctx context.Context) bool {
+	timer := time.NewTimer(refreshRetryDelay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-n.stop:
+		return false
+	}
+}
+
+// degradedFraction returns the share of the allocation admitted in
+// FallbackDegraded mode
+func (n *Node) degradedFraction() float64 {
+	if n.config.DegradedFraction > 0 {
+		return min(n.config.DegradedFraction, 1)
+	}
+	return defaultDegradedFraction
+}
+
+// currentRefreshInterval returns the interval until the next refresh
+func (n *Node) currentRefreshInterval() time.Duration {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.refreshInterval
+}
+
+// adaptRefreshIntervalLocked shortens the refresh interval if any profile
+// consumed a large share of its headroom during the interval that just ended,
+// and lengthens it if all were nearly idle; caller must hold the write lock
+func (n *Node) adaptRefreshIntervalLocked() {
+	if n.config.AdaptiveRefresh == nil {
+		return
+	}
+
+	var consumption float64
+	for _, localQuota := range n.localQuotas {
+		if localQuota.startHeadroom <= 0 {
+			continue
+		}
+		consumed := float64(localQuota.startHeadroom-localQuota.headroom) / float64(localQuota.startHeadroom)
+		consumption = max(consumption, consumed)
+	}
+
+	switch {
+	case consumption > busyConsumption:
+		n.refreshInterval = n.clampRefreshInterval(n.refreshInterval / 2)
+	case consumption < idleConsumption:
+		n.refreshInterval = n.clampRefreshInterval(n.refreshInterval * 2)
+	}
+}
+
+// clampRefreshInterval keeps the interval within the adaptive bounds
+func (n *Node) clampRefreshInterval(interval time.Duration) time.Duration {
+	bounds := n.config.AdaptiveRefresh
+	if bounds == nil {
+		return interval
+	}
+	if bounds.MinInterval > 0 {
+		interval = max(interval, bounds.MinInterval)
+	}
+	if bounds.MaxInterval > 0 {
+		interval = min(interval, bounds.MaxInterval)
+	}
+	return interval
+}
+
+// rollHeadroomLocked closes the current headroom interval, reports it and
+// starts the next one from the fresh allocation; caller must hold the write lock
+func (n *Node) rollHeadroomLocked() {
+	for profileID, localQuota := range n.localQuotas {
+		localQuota.lastHeadroom = localQuota.headroom
+		localQuota.headroom = localQuota.allocated - localQuota.used
+		localQuota.startHeadroom = localQuota.headroom
+		if n.config.Metrics != nil {
+			labels := map[string]string{"node": n.nodeID, "profile": strconv.Itoa(profileID)}
+			n.config.Metrics.SetGauge(metricQuotaHeadroom, labels, float64(localQuota.lastHeadroom))
+		}
+	}
+}
+
+// reconcileEmergencyLocked restores the reserve that central has charged,
+// which is what the refresh request reported; reserve spent while that
+// request was in flight stays pending for the next refresh. Caller must hold
+// the write lock
+func (n *Node) reconcileEmergencyLocked(charged map[int]int64) {
+	for profileID, amount := range charged {
+		n.emergencyUsed -= amount
+		if localQuota, exists := n.localQuotas[profileID]; exists {
+			localQuota.emergencyUsed -= amount
+		}
+	}
+}
+
+// recordRefresh stores the outcome of a refresh attempt
+func (n *Node) recordRefresh(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.recordRefreshLocked(err)
+}
+
+// recordRefreshLocked stores the outcome of a refresh attempt; caller must hold the write lock
+func (n *Node) recordRefreshLocked(err error) {
+	n.lastRefreshAt = time.Now()
+	n.lastRefreshErr = err
+	if err != nil {
+		n.refreshFailures++
+	} else {
+		n.refreshSuccesses++
+	}
+}
+
+// LastRefreshStatus returns the time of the last refresh attempt and its error,
+// which is nil if the refresh succeeded
+func (n *Node) LastRefreshStatus() (time.Time, error) {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
-	status := common.NodeStatus{
-		NodeID:      n.nodeID,
-		LastRefresh: time.Now(),
-		Quotas:      make(map[int]common.ProfileStatus),
+	return n.lastRefreshAt, n.lastRefreshErr
+}
+
+// Drain stops accepting requests and hands this node's allocation over to the
+// remaining nodes through central. It returns once central has confirmed the
+// handoff, so the node can exit without a temporary capacity dip.
+func (n *Node) Drain(ctx context.Context) error {
+	n.mu.Lock()
+	n.draining = true
+	n.mu.Unlock()
+
+	if err := n.client.Handoff(ctx, n.nodeID); err != nil {
+		return fmt.Errorf("handoff quota: %w", err)
 	}
 
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, quota := range n.localQuotas {
+		quota.allocated = 0
+		quota.used = 0
+	}
+
+	return nil
+}
+
+// Close shuts the node down: it stops accepting requests, waits for in-flight
+// requests to finish, returns unused quota to central and stops the background
+// loops, in that order. It blocks until done or ctx expires; the loops are
+// stopped even if an earlier step fails.
+func (n *Node) Close(ctx context.Context) error {
+	defer n.stopLoops(ctx)
+
+	n.mu.Lock()
+	n.draining = true
+	n.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		n.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return fmt.Errorf("drain requests: %w", ctx.Err())
+	}
+
+	release := common.ReleaseRequest{NodeID: n.nodeID, Unused: make(map[int]int64)}
+	n.mu.Lock()
 	for profileID, quota := range n.localQuotas {
-		status.Quotas[profileID] = common.ProfileStatus{
-			Allocated: quota.allocated,
-			Used:      quota.used,
-			Available: quota.allocated - quota.used,
+		if unused := quota.allocated - quota.used; unused > 0 {
+			release.Unused[profileID] = unused
 		}
 	}
+	n.mu.Unlock()
+
+	if len(release.Unused) > 0 {
+		if err := n.client.Release(ctx, release); err != nil {
+			return fmt.Errorf("release quota: %w", err)
+		}
+	}
+
+	n.mu.Lock()
+	for _, quota := range n.localQuotas {
+		quota.allocated = quota.used
+	}
+	n.mu.Unlock()
+
+	return nil
+}
+
+// stopLoops signals the background loops to exit and waits for them or ctx
+func (n *Node) stopLoops(ctx context.Context) {
+	n.closeOnce.Do(func() { close(n.stop) })
+
+	stopped := make(chan struct{})
+	go func() {
+		n.loops.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+	}
+}
+
+// GetStatus returns current node status
+func (n *Node) GetStatus() common.NodeQuotaStatus {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	status := common.NodeQuotaStatus{
+		NodeID:           n.nodeID,
+		LastRefresh:      n.lastRefreshAt,
+		RefreshSuccesses: n.refreshSuccesses,
+		RefreshFailures:  n.refreshFailures,
+		EmergencyUsed:    n.emergencyUsed,
+		RefreshInterval:  n.refreshInterval,
+		Quotas:           make(map[int]common.ProfileStatus),
+	}
+	if n.lastRefreshErr != nil {
+		status.LastRefreshError = n.lastRefreshErr.Error()
+		status.Fallback = n.config.FallbackMode.String()
+	}
+
+	for profileID, quota := range n.localQuotas {
+		status.Quotas[profileID] = quota.status()
+	}
 
 	return status
 }
 
+// Profiles returns the IDs of all configured profiles in ascending order
+func (n *Node) Profiles() []int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	profileIDs := make([]int, 0, len(n.localQuotas))
+	for profileID := range n.localQuotas {
+		profileIDs = append(profileIDs, profileID)
+	}
+	sort.Ints(profileIDs)
+
+	return profileIDs
+}
+
+// ProfileStatus returns the local quota status of a single profile.
+// The second result is false if the profile is not configured.
+func (n *Node) ProfileStatus(profileID int) (common.ProfileStatus, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	quota, exists := n.localQuotas[profileID]
+	if !exists {
+		return common.ProfileStatus{}, false
+	}
+
+	return quota.status(), true
+}
+
+// stale reports whether the quota has not been refreshed for two intervals
+func (q *LocalQuota) stale(refreshInterval time.Duration) bool {
+	return time.Since(q.lastRefresh) > refreshInterval*2
+}
+
+// remaining returns the allocation left in the current interval; caller must
+// hold the node lock
+func (q *LocalQuota) remaining() int64 {
+	return max(q.allocated-q.used, 0)
+}
+
+// status returns a snapshot of the quota usage; caller must hold the node lock
+func (q *LocalQuota) status() common.ProfileStatus {
+	return common.ProfileStatus{
+		Allocated:     q.allocated,
+		Used:          q.used,
+		Available:     q.allocated - q.used,
+		EmergencyUsed: q.emergencyUsed,
+		Headroom:      q.headroom,
+		LastHeadroom:  q.lastHeadroom,
+	}
+}
+
+// CheckCentral verifies central is reachable and healthy, bounded by HealthTimeout
+func (n *Node) CheckCentral() error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.timeout(n.config.HealthTimeout))
+	defer cancel()
+
+	return n.client.Health(ctx)
+}
+
 // HealthCheck performs node health verification
 func (n *Node) HealthCheck() error {
 	n.mu.RLock()
@@ -177,7 +745,7 @@ func (n *Node) HealthCheck() error {
 
 	// Check if any quotas haven't been refreshed recently
 	for _, quota := range n.localQuotas {
-		if time.Since(quota.lastRefresh) > n.config.RefreshInterval*2 {
+		if quota.stale(n.refreshInterval) {
 			return fmt.Errorf("quota refresh stale: last refresh %v", quota.lastRefresh)
 		}
 	}
@@ -0,0 +1,737 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// fakeClient a common.Client whose central responses are set by the test
+type fakeClient struct {
+	mu           sync.Mutex
+	requestQuota func(req common.QuotaRequest) (common.QuotaResponse, error)
+	requests     []common.QuotaRequest
+	heartbeats   int
+	handoffs     []string
+	releases     []common.ReleaseRequest
+	releaseErr   error
+	heartbeatErr error
+}
+
+func (c *fakeClient) RequestQuota(_ context.Context, req common.QuotaRequest) (common.QuotaResponse, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	requestQuota := c.requestQuota
+	c.mu.Unlock()
+
+	if requestQuota == nil {
+		return grantAll(req), nil
+	}
+	return requestQuota(req)
+}
+
+func (c *fakeClient) Handoff(_ context.Context, nodeID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handoffs = append(c.handoffs, nodeID)
+	return nil
+}
+
+func (c *fakeClient) Release(_ context.Context, req common.ReleaseRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.releases = append(c.releases, req)
+	return c.releaseErr
+}
+
+func (c *fakeClient) Heartbeat(context.Context, string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.heartbeats++
+	return c.heartbeatErr
+}
+
+func (c *fakeClient) Health(context.Context) error {
+	return nil
+}
+
+func (c *fakeClient) setRequestQuota(requestQuota func(req common.QuotaRequest) (common.QuotaResponse, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requestQuota = requestQuota
+}
+
+func (c *fakeClient) sentRequests() []common.QuotaRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]common.QuotaRequest(nil), c.requests...)
+}
+
+// grantAll answers a refresh by granting every profile the top-up it asked for
+func grantAll(req common.QuotaRequest) common.QuotaResponse {
+	resp := common.QuotaResponse{RequestID: req.RequestID}
+	for _, quota := range req.Quotas {
+		resp.Quotas = append(resp.Quotas, common.ProfileQuotaResponse{ProfileID: quota.ProfileID, Granted: quota.Required})
+	}
+	return resp
+}
+
+// allowAll a rate limiter that never limits
+type allowAll struct{}
+
+func (allowAll) Allow() bool { return true }
+
+// newTestNode creates a node whose background refresh never fires during the
+// test, with the given profiles freshly allocated
+func newTestNode(t *testing.T, client common.Client, config NodeConfig, allocated map[int]int64) *Node {
+	t.Helper()
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = time.Hour
+	}
+	if config.Timeout == 0 {
+		config.Timeout = time.Second
+	}
+	n := NewNode("node-1", client, config)
+	t.Cleanup(func() { n.stopLoops(context.Background()) })
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for profileID, amount := range allocated {
+		n.localQuotas[profileID] = &LocalQuota{
+			allocated:     amount,
+			lastRefresh:   time.Now(),
+			rateLimiter:   allowAll{},
+			headroom:      amount,
+			startHeadroom: amount,
+		}
+	}
+	return n
+}
+
+// request builds a node request for the given profile amounts
+func request(amounts map[int]int64) common.Request {
+	req := common.Request{RequestID: "req", NodeID: "node-1", Quotas: make(map[int]common.ProfileQuota)}
+	for profileID, amount := range amounts {
+		req.Quotas[profileID] = common.ProfileQuota{ProfileID: profileID, Required: amount}
+	}
+	return req
+}
+
+func TestNodeProfilesAndProfileStatus(t *testing.T) {
+	n := newTestNode(t, &fakeClient{}, NodeConfig{}, map[int]int64{3: 30, 1: 10, 2: 20})
+
+	profiles := n.Profiles()
+	if len(profiles) != 3 || profiles[0] != 1 || profiles[1] != 2 || profiles[2] != 3 {
+		t.Fatalf("Profiles() = %v, want [1 2 3]", profiles)
+	}
+
+	if _, err := n.HandleRequest(request(map[int]int64{2: 5})); err != nil {
+		t.Fatalf("HandleRequest: %v", err)
+	}
+
+	status, ok := n.ProfileStatus(2)
+	if !ok {
+		t.Fatal("ProfileStatus(2) not found")
+	}
+	if status.Allocated != 20 || status.Used != 5 || status.Available != 15 {
+		t.Errorf("ProfileStatus(2) = %+v, want allocated 20, used 5, available 15", status)
+	}
+	if status != n.GetStatus().Quotas[2] {
+		t.Errorf("ProfileStatus(2) = %+v, disagrees with GetStatus %+v", status, n.GetStatus().Quotas[2])
+	}
+
+	if _, ok := n.ProfileStatus(4); ok {
+		t.Error("ProfileStatus(4) found an unconfigured profile")
+	}
+}
+
+func TestLastRefreshStatusReportsFailure(t *testing.T) {
+	client := &fakeClient{}
+	n := newTestNode(t, client, NodeConfig{}, map[int]int64{1: 10})
+
+	if at, err := n.LastRefreshStatus(); !at.IsZero() || err != nil {
+		t.Fatalf("LastRefreshStatus() = %v, %v before any refresh, want zero time and nil", at, err)
+	}
+
+	outage := errors.New("central unreachable")
+	client.setRequestQuota(func(common.QuotaRequest) (common.QuotaResponse, error) {
+		return common.QuotaResponse{}, outage
+	})
+	n.refreshQuotas()
+
+	at, err := n.LastRefreshStatus()
+	if !errors.Is(err, outage) {
+		t.Fatalf("LastRefreshStatus() error = %v, want %v", err, outage)
+	}
+	if at.IsZero() {
+		t.Error("LastRefreshStatus() time is zero after a refresh attempt")
+	}
+	status := n.GetStatus()
+	if status.LastRefreshError != outage.Error() || status.RefreshFailures != 1 || status.RefreshSuccesses != 0 {
+		t.Errorf("GetStatus() = %+v, want one failure reporting %q", status, outage)
+	}
+
+	client.setRequestQuota(nil)
+	n.refreshQuotas()
+	if _, err := n.LastRefreshStatus(); err != nil {
+		t.Errorf("LastRefreshStatus() error = %v after a successful refresh, want nil", err)
+	}
+	if status := n.GetStatus(); status.LastRefreshError != "" || status.RefreshSuccesses != 1 {
+		t.Errorf("GetStatus() = %+v, want the success recorded", status)
+	}
+}
+
+func TestRefreshCountersWithZeroMaxRetries(t *testing.T) {
+	client := &fakeClient{}
+	n := newTestNode(t, client, NodeConfig{}, map[int]int64{1: 10})
+
+	n.refreshQuotas()
+	if status := n.GetStatus(); status.RefreshSuccesses != 1 || len(client.sentRequests()) != 1 {
+		t.Fatalf("successes = %d after %d requests, want one success backed by one request", status.RefreshSuccesses, len(client.sentRequests()))
+	}
+
+	client.setRequestQuota(func(common.QuotaRequest) (common.QuotaResponse, error) {
+		return common.QuotaResponse{}, errors.New("central unreachable")
+	})
+	n.refreshQuotas()
+	status := n.GetStatus()
+	if status.RefreshFailures != 1 || status.RefreshSuccesses != 1 || status.LastRefreshError == "" {
+		t.Fatalf("GetStatus() = %+v, want the failure recorded", status)
+	}
+}
+
+func TestRefreshDoesNotRetryTerminalErrors(t *testing.T) {
+	client := &fakeClient{}
+	client.setRequestQuota(func(common.QuotaRequest) (common.QuotaResponse, error) {
+		return common.QuotaResponse{}, &StatusError{StatusCode: http.StatusBadRequest, Message: "quotas cannot be empty"}
+	})
+	n := newTestNode(t, client, NodeConfig{MaxRetries: 3}, map[int]int64{1: 10})
+
+	n.refreshQuotas()
+	if sent := client.sentRequests(); len(sent) != 1 {
+		t.Fatalf("sent %d quota requests for a 400, want 1", len(sent))
+	}
+	var statusErr *StatusError
+	if _, err := n.LastRefreshStatus(); !errors.As(err, &statusErr) {
+		t.Fatalf("LastRefreshStatus() error = %v, want the StatusError", err)
+	}
+}
+
+func TestRefreshRetryStopsWhenNodeCloses(t *testing.T) {
+	client := &fakeClient{}
+	client.setRequestQuota(func(common.QuotaRequest) (common.QuotaResponse, error) {
+		return common.QuotaResponse{}, &StatusError{StatusCode: http.StatusServiceUnavailable}
+	})
+	n := newTestNode(t, client, NodeConfig{MaxRetries: 5, RefreshTimeout: time.Minute}, map[int]int64{1: 10})
+
+	done := make(chan struct{})
+	go func() {
+		n.refreshQuotas()
+		close(done)
+	}()
+	for deadline := time.Now().Add(time.Second); len(client.sentRequests()) == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	n.stopLoops(context.Background())
+
+	select {
+	case <-done:
+	case <-time.After(refreshRetryDelay / 2):
+		t.Fatal("refresh kept waiting to retry after the node was closed")
+	}
+	if sent := client.sentRequests(); len(sent) != 1 {
+		t.Fatalf("sent %d quota requests, want no retry after close", len(sent))
+	}
+}
+
+func TestRefreshLogsThroughConfiguredLogger(t *testing.T) {
+	var logs bytes.Buffer
+	client := &fakeClient{}
+	client.setRequestQuota(func(common.QuotaRequest) (common.QuotaResponse, error) {
+		return common.QuotaResponse{}, errors.New("central unreachable")
+	})
+	n := newTestNode(t, client, NodeConfig{Logger: slog.New(slog.NewTextHandler(&logs, nil))}, map[int]int64{1: 10})
+
+	n.refreshQuotas()
+	out := logs.String()
+	for _, want := range []string{"level=WARN", "quota refresh failed", "node_id=node-1", `error="central unreachable"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("log output %q does not contain %q", out, want)
+		}
+	}
+}
+
+func TestDrainHandsOffAndStopsAdmitting(t *testing.T) {
+	client := &fakeClient{}
+	n := newTestNode(t, client, NodeConfig{}, map[int]int64{1: 10})
+
+	if err := n.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if len(client.handoffs) != 1 || client.handoffs[0] != "node-1" {
+		t.Errorf("handoffs = %v, want one for node-1", client.handoffs)
+	}
+	if status, _ := n.ProfileStatus(1); status.Allocated != 0 {
+		t.Errorf("allocated = %d after drain, want 0", status.Allocated)
+	}
+	if _, err := n.HandleRequest(request(map[int]int64{1: 1})); !errors.Is(err, common.ErrNodeOffline) {
+		t.Errorf("HandleRequest after drain = %v, want ErrNodeOffline", err)
+	}
+}
+
+func TestEmergencyReserveDuringOutageIsReportedOnRecovery(t *testing.T) {
+	client := &fakeClient{}
+	client.setRequestQuota(func(common.QuotaRequest) (common.QuotaResponse, error) {
+		return common.QuotaResponse{}, errors.New("central unreachable")
+	})
+	n := newTestNode(t, client, NodeConfig{EmergencyReserve: 50}, map[int]int64{1: 10})
+	n.localQuotas[1].lastRefresh = time.Now().Add(-3 * time.Hour)
+
+	n.refreshQuotas()
+	if _, err := n.HandleRequest(request(map[int]int64{1: 30})); err != nil {
+		t.Fatalf("HandleRequest during outage: %v", err)
+	}
+	if _, err := n.HandleRequest(request(map[int]int64{1: 30})); !errors.Is(err, common.ErrQuotaExceeded) {
+		t.Fatalf("HandleRequest past the reserve = %v, want ErrQuotaExceeded", err)
+	}
+	if n.emergencyUsed != 30 || n.localQuotas[1].used != 0 {
+		t.Fatalf("emergencyUsed = %d, used = %d, want 30 and 0", n.emergencyUsed, n.localQuotas[1].used)
+	}
+
+	client.setRequestQuota(func(req common.QuotaRequest) (common.QuotaResponse, error) {
+		return grantAll(req), nil
+	})
+	n.refreshQuotas()
+
+	requests := client.sentRequests()
+	if consumed := requests[len(requests)-1].Consumed; consumed[1] != 30 {
+		t.Fatalf("refresh reported Consumed = %v, want 30 for profile 1", consumed)
+	}
+	if n.emergencyUsed != 0 || n.localQuotas[1].emergencyUsed != 0 {
+		t.Fatalf("reserve not restored after reconcile: node %d, profile %d", n.emergencyUsed, n.localQuotas[1].emergencyUsed)
+	}
+
+	// The reserve is reported once; the next refresh has nothing to report
+	n.refreshQuotas()
+	requests = client.sentRequests()
+	if consumed := requests[len(requests)-1].Consumed; consumed != nil {
+		t.Fatalf("second refresh reported Consumed = %v, want none", consumed)
+	}
+}
+
+func TestRefreshWithZeroMaxRetriesStillCallsCentral(t *testing.T) {
+	client := &fakeClient{}
+	client.setRequestQuota(func(common.QuotaRequest) (common.QuotaResponse, error) {
+		return common.QuotaResponse{}, errors.New("central unreachable")
+	})
+	n := newTestNode(t, client, NodeConfig{}, map[int]int64{1: 10})
+	n.localQuotas[1].emergencyUsed = 20
+	n.emergencyUsed = 20
+
+	n.refreshQuotas()
+	if sent := client.sentRequests(); len(sent) != 1 {
+		t.Fatalf("sent %d quota requests with MaxRetries unset, want 1", len(sent))
+	}
+	if _, err := n.LastRefreshStatus(); err == nil {
+		t.Fatal("failed refresh recorded as a success")
+	}
+	// Central was never charged, so the reserve stays pending
+	if n.emergencyUsed != 20 {
+		t.Fatalf("emergencyUsed = %d after a failed refresh, want 20 still pending", n.emergencyUsed)
+	}
+}
+
+func TestEmergencyReserveNotReconciledWhileCentralFrozen(t *testing.T) {
+	client := &fakeClient{}
+	n := newTestNode(t, client, NodeConfig{}, map[int]int64{1: 10})
+	n.localQuotas[1].emergencyUsed = 20
+	n.emergencyUsed = 20
+
+	client.setRequestQuota(func(req common.QuotaRequest) (common.QuotaResponse, error) {
+		resp := grantAll(req)
+		resp.Frozen = true
+		return resp, nil
+	})
+	n.refreshQuotas()
+
+	if n.emergencyUsed != 20 {
+		t.Fatalf("emergencyUsed = %d after a frozen refresh, want 20 still pending", n.emergencyUsed)
+	}
+}
+
+func TestCloseDrainsStopsRefreshAndReturnsQuota(t *testing.T) {
+	client := &fakeClient{}
+	n := newTestNode(t, client, NodeConfig{RefreshInterval: 10 * time.Millisecond}, map[int]int64{1: 100, 2: 50})
+
+	// Let the refresh loop run at least once so stopping it is observable
+	deadline := time.Now().Add(time.Second)
+	for len(client.sentRequests()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	inflight := make(chan error, 1)
+	go func() {
+		_, err := n.HandleRequest(request(map[int]int64{1: 30}))
+		inflight <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := n.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := <-inflight; err != nil {
+		t.Fatalf("in-flight request failed during drain: %v", err)
+	}
+
+	client.mu.Lock()
+	releases := append([]common.ReleaseRequest(nil), client.releases...)
+	client.mu.Unlock()
+	if len(releases) != 1 {
+		t.Fatalf("got %d releases, want 1", len(releases))
+	}
+	// The refresh loop topped each profile up to 100 before Close; 30 was used
+	if unused := releases[0].Unused; unused[1] != 70 || unused[2] != 100 {
+		t.Fatalf("released %v, want 70 for profile 1 and 100 for profile 2", unused)
+	}
+
+	refreshes := len(client.sentRequests())
+	time.Sleep(50 * time.Millisecond)
+	if got := len(client.sentRequests()); got != refreshes {
+		t.Fatalf("refresh loop sent %d more requests after Close", got-refreshes)
+	}
+	if _, err := n.HandleRequest(request(map[int]int64{1: 1})); !errors.Is(err, common.ErrNodeOffline) {
+		t.Fatalf("HandleRequest after Close = %v, want ErrNodeOffline", err)
+	}
+}
+
+func TestConcurrentHandleRequestNeverOvercommits(t *testing.T) {
+	n := newTestNode(t, &fakeClient{}, NodeConfig{}, map[int]int64{1: 50})
+
+	const concurrent = 100
+	var wg sync.WaitGroup
+	results := make(chan error, concurrent)
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := n.HandleRequest(request(map[int]int64{1: 1}))
+			results <- err
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("concurrent HandleRequest calls did not finish; lock ordering deadlock")
+	}
+	close(results)
+
+	var ok, exceeded int
+	for err := range results {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, common.ErrQuotaExceeded):
+			exceeded++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if ok != 50 || exceeded != concurrent-50 {
+		t.Fatalf("%d succeeded and %d exceeded, want 50 and %d", ok, exceeded, concurrent-50)
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if used := n.localQuotas[1].used; used != 50 {
+		t.Fatalf("used = %d, want exactly the allocation of 50", used)
+	}
+}
+
+// gaugeSink a MetricsSink that records the last value of each gauge
+type gaugeSink struct {
+	mu     sync.Mutex
+	gauges map[string]float64
+}
+
+func (s *gaugeSink) SetGauge(name string, labels map[string]string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gauges == nil {
+		s.gauges = make(map[string]float64)
+	}
+	s.gauges[name+"/"+labels["profile"]] = value
+}
+
+func (s *gaugeSink) gauge(name, profile string) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, exists := s.gauges[name+"/"+profile]
+	return value, exists
+}
+
+func TestHeadroomReportsLowLocalQuota(t *testing.T) {
+	sink := &gaugeSink{}
+	n := newTestNode(t, &fakeClient{}, NodeConfig{Metrics: sink}, map[int]int64{1: 100, 2: 100})
+
+	if _, err := n.HandleRequest(request(map[int]int64{1: 95, 2: 10})); err != nil {
+		t.Fatalf("HandleRequest: %v", err)
+	}
+	status := n.GetStatus()
+	if got := status.Quotas[1].Headroom; got != 5 {
+		t.Fatalf("busy profile headroom = %d, want 5", got)
+	}
+	if got := status.Quotas[2].Headroom; got != 90 {
+		t.Fatalf("idle profile headroom = %d, want 90", got)
+	}
+
+	// The refresh closes the interval: its minimum is kept as the last headroom and exported
+	n.refreshQuotas()
+	if status, _ := n.ProfileStatus(1); status.LastHeadroom != 5 {
+		t.Fatalf("last headroom = %d, want 5", status.LastHeadroom)
+	}
+	if value, ok := sink.gauge(metricQuotaHeadroom, "1"); !ok || value != 5 {
+		t.Fatalf("headroom gauge = %v (set %v), want 5", value, ok)
+	}
+	if value, _ := sink.gauge(metricQuotaHeadroom, "2"); value != 90 {
+		t.Fatalf("idle profile headroom gauge = %v, want 90", value)
+	}
+}
+
+func TestNodeWithoutProfilesSendsHeartbeatInsteadOfQuotaRequest(t *testing.T) {
+	client := &fakeClient{}
+	n := newTestNode(t, client, NodeConfig{}, nil)
+
+	n.refreshQuotas()
+	n.refreshQuotas()
+
+	if sent := client.sentRequests(); len(sent) != 0 {
+		t.Fatalf("sent %d quota requests, want none for a node without profiles", len(sent))
+	}
+	client.mu.Lock()
+	heartbeats := client.heartbeats
+	client.mu.Unlock()
+	if heartbeats != 2 {
+		t.Fatalf("heartbeats = %d, want one per refresh", heartbeats)
+	}
+	if at, err := n.LastRefreshStatus(); err != nil || at.IsZero() {
+		t.Fatalf("last refresh = %v, %v, want a successful liveness report", at, err)
+	}
+
+	// A failed heartbeat is reported like a failed refresh
+	client.mu.Lock()
+	client.heartbeatErr = errors.New("central unreachable")
+	client.mu.Unlock()
+	n.refreshQuotas()
+	if _, err := n.LastRefreshStatus(); err == nil {
+		t.Fatal("heartbeat failure not recorded")
+	}
+}
+
+// slowClient a fakeClient whose quota requests and heartbeats take delay
+// unless their context ends first
+type slowClient struct {
+	fakeClient
+	delay time.Duration
+}
+
+func (c *slowClient) wait(ctx context.Context) error {
+	select {
+	case <-time.After(c.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *slowClient) RequestQuota(ctx context.Context, req common.QuotaRequest) (common.QuotaResponse, error) {
+	if err := c.wait(ctx); err != nil {
+		return common.QuotaResponse{}, err
+	}
+	return c.fakeClient.RequestQuota(ctx, req)
+}
+
+func (c *slowClient) Heartbeat(ctx context.Context, nodeID string) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	return c.fakeClient.Heartbeat(ctx, nodeID)
+}
+
+func TestPerOperationTimeouts(t *testing.T) {
+	config := NodeConfig{Timeout: 50 * time.Millisecond, RefreshTimeout: time.Second}
+	client := &slowClient{delay: 150 * time.Millisecond}
+
+	// The refresh outlasts Timeout but stays within RefreshTimeout
+	n := newTestNode(t, client, config, map[int]int64{1: 0})
+	n.refreshQuotas()
+	if _, err := n.LastRefreshStatus(); err != nil {
+		t.Fatalf("refresh with a longer RefreshTimeout failed: %v", err)
+	}
+
+	// A node without profiles reports liveness, bounded by ReportTimeout,
+	// which defaults to Timeout
+	idle := newTestNode(t, client, config, nil)
+	idle.refreshQuotas()
+	if _, err := idle.LastRefreshStatus(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("heartbeat err = %v, want the shorter timeout to expire", err)
+	}
+}
+
+func TestAdaptiveRefreshBusyNodeRefreshesMoreOften(t *testing.T) {
+	adaptive := &AdaptiveRefreshConfig{MinInterval: 50 * time.Millisecond, MaxInterval: 800 * time.Millisecond}
+	const period = 1600 * time.Millisecond
+
+	// simulate runs the node through period, consuming perInterval of its
+	// 100 headroom before each refresh, and returns how often it refreshed
+	simulate := func(perInterval int64) (refreshes int, final time.Duration) {
+		client := &fakeClient{}
+		n := newTestNode(t, client, NodeConfig{RefreshInterval: 200 * time.Millisecond, AdaptiveRefresh: adaptive}, map[int]int64{1: 100})
+
+		for elapsed := time.Duration(0); elapsed < period; refreshes++ {
+			n.mu.Lock()
+			localQuota := n.localQuotas[1]
+			localQuota.used += perInterval
+			localQuota.headroom = min(localQuota.headroom, localQuota.allocated-localQuota.used)
+			n.mu.Unlock()
+
+			elapsed += n.currentRefreshInterval()
+			n.refreshQuotas()
+		}
+		return refreshes, n.currentRefreshInterval()
+	}
+
+	busy, busyInterval := simulate(80)
+	idle, idleInterval := simulate(0)
+	if busy <= idle {
+		t.Fatalf("busy node refreshed %d times and idle node %d times, want the busy node more often", busy, idle)
+	}
+	if busyInterval != adaptive.MinInterval || idleInterval != adaptive.MaxInterval {
+		t.Fatalf("intervals settled at %v (busy) and %v (idle), want the bounds %v and %v", busyInterval, idleInterval, adaptive.MinInterval, adaptive.MaxInterval)
+	}
+
+	// A moderately loaded node keeps its interval
+	if _, interval := simulate(30); interval != 200*time.Millisecond {
+		t.Fatalf("moderate node interval = %v, want it unchanged at 200ms", interval)
+	}
+}
+
+func TestFallbackModesDuringCentralOutage(t *testing.T) {
+	tests := []struct {
+		mode     FallbackMode
+		admitted int64 // of the 100 allocated, how much is admitted during the outage
+	}{
+		{FallbackOpen, 500},
+		{FallbackDegraded, 30},
+		{FallbackClosed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			t.Parallel()
+			client := &fakeClient{}
+			client.setRequestQuota(func(common.QuotaRequest) (common.QuotaResponse, error) {
+				return common.QuotaResponse{}, errors.New("central unreachable")
+			})
+			n := newTestNode(t, client, NodeConfig{FallbackMode: tt.mode, DegradedFraction: 0.3}, map[int]int64{1: 100})
+			if status := n.GetStatus(); status.Fallback != "" {
+				t.Fatalf("fallback = %q before any failure, want none", status.Fallback)
+			}
+
+			n.refreshQuotas()
+			if status := n.GetStatus(); status.Fallback != tt.mode.String() {
+				t.Fatalf("fallback = %q, want %q", status.Fallback, tt.mode)
+			}
+
+			if tt.admitted > 0 {
+				if _, err := n.HandleRequest(request(map[int]int64{1: tt.admitted})); err != nil {
+					t.Fatalf("request for %d in %s mode: %v", tt.admitted, tt.mode, err)
+				}
+			}
+			if tt.mode == FallbackOpen {
+				return
+			}
+			if _, err := n.HandleRequest(request(map[int]int64{1: 1})); !errors.Is(err, common.ErrQuotaExceeded) {
+				t.Fatalf("request beyond the %s limit: err = %v, want ErrQuotaExceeded", tt.mode, err)
+			}
+		})
+	}
+}
+
+func TestRefreshDropsProfileCentralDoesNotKnow(t *testing.T) {
+	client := &fakeClient{}
+	client.setRequestQuota(func(req common.QuotaRequest) (common.QuotaResponse, error) {
+		resp := common.QuotaResponse{RequestID: req.RequestID}
+		for _, quota := range req.Quotas {
+			q := common.ProfileQuotaResponse{ProfileID: quota.ProfileID}
+			if quota.ProfileID == 2 {
+				q.NotFound = true
+			}
+			resp.Quotas = append(resp.Quotas, q)
+		}
+		return resp, nil
+	})
+	n := newTestNode(t, client, NodeConfig{}, map[int]int64{1: 50, 2: 50})
+
+	n.refreshQuotas()
+
+	if got := n.Profiles(); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("profiles after refresh = %v, want only the exhausted-but-known profile 1", got)
+	}
+	if _, err := n.HandleRequest(request(map[int]int64{2: 1})); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Fatalf("request for the dropped profile = %v, want a not configured error", err)
+	}
+
+	n.refreshQuotas()
+	sent := client.sentRequests()
+	if last := sent[len(sent)-1]; len(last.Quotas) != 1 || last.Quotas[0].ProfileID != 1 {
+		t.Fatalf("next refresh requested %+v, want only profile 1", last.Quotas)
+	}
+}
+
+func TestHandleRequestPartialGrant(t *testing.T) {
+	n := newTestNode(t, &fakeClient{}, NodeConfig{}, map[int]int64{1: 10})
+	partial := func(required int64) common.Request {
+		req := request(map[int]int64{1: required})
+		req.Quotas[1] = common.ProfileQuota{ProfileID: 1, Required: required, PartialAllowed: true}
+		return req
+	}
+
+	steps := []struct {
+		name    string
+		req     common.Request
+		granted int64
+		err     error
+		used    int64
+	}{
+		{"all-or-nothing shortfall", request(map[int]int64{1: 12}), 0, common.ErrQuotaExceeded, 0},
+		{"full grant", partial(6), 6, nil, 6},
+		{"partial grant", partial(6), 4, nil, 10},
+		{"nothing left", partial(1), 0, common.ErrQuotaExceeded, 10},
+	}
+	for _, step := range steps {
+		resp, err := n.HandleRequest(step.req)
+		if !errors.Is(err, step.err) {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.err)
+		}
+		if err == nil && resp.Granted[1] != step.granted {
+			t.Errorf("%s: granted = %d, want %d", step.name, resp.Granted[1], step.granted)
+		}
+		if used := n.localQuotas[1].used; used != step.used {
+			t.Errorf("%s: used = %d, want %d", step.name, used, step.used)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"throttle_control/internal/central"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// recordedSpan a finished span as seen by spanRecorder
+type recordedSpan struct {
+	name     string
+	traceID  string
+	spanID   string
+	parentID string
+}
+
+type spanContextKey struct{}
+
+// spanRecorder an in-memory common.Tracer that propagates W3C traceparent headers and records ended spans
+type spanRecorder struct {
+	mu     sync.Mutex
+	nextID int
+	ended  []recordedSpan
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string) (context.Context, common.Span) {
+	r.mu.Lock()
+	r.nextID++
+	span := &recorderSpan{recorder: r, recordedSpan: recordedSpan{name: name, spanID: fmt.Sprintf("%016x", r.nextID)}}
+	r.mu.Unlock()
+
+	if parent, ok := ctx.Value(spanContextKey{}).(recordedSpan); ok {
+		span.traceID, span.parentID = parent.traceID, parent.spanID
+	} else {
+		span.traceID = fmt.Sprintf("%032x", r.nextID)
+	}
+	return context.WithValue(ctx, spanContextKey{}, span.recordedSpan), span
+}
+
+func (r *spanRecorder) Inject(ctx context.Context, header http.Header) {
+	if current, ok := ctx.Value(spanContextKey{}).(recordedSpan); ok {
+		header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", current.traceID, current.spanID))
+	}
+}
+
+func (r *spanRecorder) Extract(ctx context.Context, header http.Header) context.Context {
+	var remote recordedSpan
+	if _, err := fmt.Sscanf(header.Get("traceparent"), "00-%32s-%16s-01", &remote.traceID, &remote.spanID); err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, remote)
+}
+
+// find returns the ended span with the given name
+func (r *spanRecorder) find(name string) (recordedSpan, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, span := range r.ended {
+		if span.name == name {
+			return span, true
+		}
+	}
+	return recordedSpan{}, false
+}
+
+type recorderSpan struct {
+	recordedSpan
+	recorder *spanRecorder
+}
+
+func (s *recorderSpan) SetAttribute(string, any) {}
+
+func (s *recorderSpan) End() {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.ended = append(s.recorder.ended, s.recordedSpan)
+}
+
+func TestTraceContextPropagatesFromClientToServer(t *testing.T) {
+	recorder := &spanRecorder{}
+	addr := freeAddr(t)
+	server := central.NewServer(&central.ServerConfig{
+		Port:            addr,
+		RefreshInterval: time.Hour,
+		ProfileConfigs:  map[int]central.ProfileConfig{1: {TotalQuota: 100}},
+		Tracer:          recorder,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	go server.Start()
+
+	client := NewCentralClient("http://"+addr, "node-1", WithTracer(recorder))
+	quotas := []common.ProfileQuota{{ProfileID: 1, Required: 10}}
+
+	ctx, parent := recorder.Start(context.Background(), "node.check")
+	// Wait for the server to listen
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if _, err = client.CheckQuotaContext(ctx, quotas); err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	parent.End()
+	if err != nil {
+		t.Fatalf("CheckQuotaContext: %v", err)
+	}
+
+	caller, ok := recorder.find("node.check")
+	if !ok {
+		t.Fatal("client span node.check was not recorded")
+	}
+	child, ok := recorder.find("quota.check")
+	if !ok {
+		t.Fatal("server span quota.check was not recorded")
+	}
+	if child.traceID != caller.traceID {
+		t.Fatalf("quota.check trace ID = %s, want the client's %s", child.traceID, caller.traceID)
+	}
+	if child.parentID != caller.spanID {
+		t.Fatalf("quota.check parent = %q, want the client span %s", child.parentID, caller.spanID)
+	}
+}
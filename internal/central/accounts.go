@@ -0,0 +1,54 @@
+package central
+
+import "sort"
+
+// AccountUsage 计费账户在各 profile 上累计获得的配额，用于按账户计量计费
+// 累计值不随刷新窗口清零，归还的配额也不扣减
+type AccountUsage struct {
+	AccountID string          `json:"account_id"`
+	Total     int64           `json:"total"`
+	Profiles  []ProfileAmount `json:"profiles"`
+}
+
+// ProfileAmount 单个 profile 的配额数量
+type ProfileAmount struct {
+	ProfileID int   `json:"profile_id"`
+	Amount    int64 `json:"amount"`
+}
+
+// recordAccountGrantLocked 把一次分配计入请求的计费账户；调用方必须持有锁
+func (qm *QuotaManager) recordAccountGrantLocked(accountID string, profileID int, granted int64) {
+	if accountID == "" || granted <= 0 {
+		return
+	}
+	usage, exists := qm.accountUsage[accountID]
+	if !exists {
+		usage = make(map[int]int64)
+		qm.accountUsage[accountID] = usage
+	}
+	usage[profileID] += granted
+}
+
+// AccountUsage 返回计费账户的累计用量，账户没有任何分配记录时返回 false
+func (qm *QuotaManager) AccountUsage(accountID string) (AccountUsage, bool) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	usage, exists := qm.accountUsage[accountID]
+	if !exists {
+		return AccountUsage{}, false
+	}
+
+	result := AccountUsage{
+		AccountID: accountID,
+		Profiles:  make([]ProfileAmount, 0, len(usage)),
+	}
+	for profileID, amount := range usage {
+		result.Total += amount
+		result.Profiles = append(result.Profiles, ProfileAmount{ProfileID: profileID, Amount: amount})
+	}
+	sort.Slice(result.Profiles, func(i, j int) bool {
+		return result.Profiles[i].ProfileID < result.Profiles[j].ProfileID
+	})
+	return result, true
+}
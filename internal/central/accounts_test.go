@@ -0,0 +1,46 @@
+package central
+
+import (
+	"net/http"
+	"testing"
+	"throttle_control/internal/common"
+)
+
+func TestAccountUsageAttributesGrantsPerAccount(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+
+	for _, grant := range []struct {
+		account string
+		amount  int64
+	}{{"acct-a", 10}, {"acct-b", 25}, {"acct-a", 5}} {
+		req := quotaRequest("node-1", 1, grant.amount)
+		req.AccountID = grant.account
+		rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", req)
+		var resp common.QuotaResponse
+		decodeBody(t, rec, &resp)
+		if got := granted(t, resp); got != grant.amount {
+			t.Fatalf("%s granted %d, want %d", grant.account, got, grant.amount)
+		}
+	}
+	// 没有账户的请求不计入任何账户
+	serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 7))
+
+	for account, want := range map[string]int64{"acct-a": 15, "acct-b": 25} {
+		rec := serve(t, handler, http.MethodGet, "/api/v1/accounts/"+account+"/usage", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s usage status = %d, body %s", account, rec.Code, rec.Body)
+		}
+		var usage AccountUsage
+		decodeBody(t, rec, &usage)
+		if usage.AccountID != account || usage.Total != want {
+			t.Errorf("%s usage = %+v, want total %d", account, usage, want)
+		}
+		if len(usage.Profiles) != 1 || usage.Profiles[0] != (ProfileAmount{ProfileID: 1, Amount: want}) {
+			t.Errorf("%s per-profile usage = %+v, want %d on profile 1", account, usage.Profiles, want)
+		}
+	}
+
+	if rec := serve(t, handler, http.MethodGet, "/api/v1/accounts/acct-unknown/usage", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown account status = %d, want 404", rec.Code)
+	}
+}
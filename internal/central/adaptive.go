@@ -0,0 +1,67 @@
+package central
+
+import (
+	"throttle_control/internal/common"
+	"throttle_control/internal/ratelimit"
+	"time"
+)
+
+// AdaptiveRateConfig 根据后端延迟自动调整 profile 速率的 AIMD 控制器配置
+// 节点上报的延迟（或 CPU）超过阈值时有效速率按比例下降，恢复正常后逐步加回 RateLimit
+type AdaptiveRateConfig struct {
+	TargetLatency  time.Duration `json:"target_latency"`  // 节点上报的 profile 延迟超过该值视为过载
+	MaxCPU         float64       `json:"max_cpu"`         // 可选，未上报延迟时节点 CPU 超过该值视为过载，0 表示不使用
+	DecreaseFactor float64       `json:"decrease_factor"` // 过载时有效速率乘以该系数，默认 0.5
+	IncreaseStep   int64         `json:"increase_step"`   // 正常时每次上报增加的速率，默认 1
+	MinRate        int64         `json:"min_rate"`        // 有效速率下限，默认 1
+}
+
+// rateLimit 返回当前生效的 profile 级别速率参数，启用自适应时使用调整后的速率
+func (pm *ProfileManager) rateLimit() ratelimit.Limit {
+	limit := pm.config.profileRateLimit()
+	if pm.config.Adaptive != nil && pm.effectiveRate > 0 {
+		limit.Rate = min(pm.effectiveRate, limit.Rate)
+	}
+	return limit
+}
+
+// effectiveRateLimit 返回当前生效的每秒请求数
+func (pm *ProfileManager) effectiveRateLimit() int64 {
+	return pm.rateLimit().Rate
+}
+
+// adjustRatesLocked 根据节点上报的信号调整各 profile 的有效速率（加性增、乘性减）
+func (qm *QuotaManager) adjustRatesLocked(status common.NodeStatus) {
+	for profileID, profileMgr := range qm.profiles {
+		adaptive := profileMgr.config.Adaptive
+		if adaptive == nil {
+			continue
+		}
+
+		var overloaded bool
+		if latency, reported := status.ProfileLatency[profileID]; reported {
+			overloaded = adaptive.TargetLatency > 0 && latency > adaptive.TargetLatency
+		} else if adaptive.MaxCPU > 0 {
+			overloaded = status.CPUUsage > adaptive.MaxCPU
+		} else {
+			continue
+		}
+
+		profileMgr.effectiveRate = adaptive.next(profileMgr.effectiveRateLimit(), profileMgr.config.RateLimit, overloaded)
+	}
+}
+
+// next 计算下一次的有效速率，结果在 [MinRate, maxRate] 范围内
+func (c *AdaptiveRateConfig) next(current, maxRate int64, overloaded bool) int64 {
+	decrease := c.DecreaseFactor
+	if decrease <= 0 || decrease >= 1 {
+		decrease = 0.5
+	}
+	step := max(c.IncreaseStep, 1)
+	minRate := min(max(c.MinRate, 1), maxRate)
+
+	if overloaded {
+		return max(int64(float64(current)*decrease), minRate)
+	}
+	return min(current+step, maxRate)
+}
@@ -0,0 +1,48 @@
+package central
+
+import (
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestSustainedHighLatencyLowersEffectiveRate(t *testing.T) {
+	config := ProfileConfig{
+		TotalQuota:        1000,
+		RateLimit:         100,
+		Burst:             100,
+		Window:            time.Second,
+		RateControlMethod: common.RateControlTokenBucket,
+		Adaptive:          &AdaptiveRateConfig{TargetLatency: 200 * time.Millisecond, IncreaseStep: 10, MinRate: 10},
+	}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config})
+
+	report := func(latency time.Duration) {
+		qm.UpdateNodeStatus(common.NodeStatus{
+			NodeID:         "node-1",
+			State:          common.StateOnline,
+			ProfileLatency: map[int]time.Duration{1: latency},
+		})
+	}
+	effectiveRate := func() int64 {
+		status := qm.GetProfilesStatus([]int{1})
+		profile := status["profiles"].(map[string]interface{})["profile_1"].(map[string]interface{})
+		return profile["effective_rate_limit"].(int64)
+	}
+
+	want := []int64{50, 25, 12, 10, 10}
+	for i, rate := range want {
+		report(time.Second)
+		if got := effectiveRate(); got != rate {
+			t.Fatalf("after %d slow reports effective rate = %d, want %d", i+1, got, rate)
+		}
+	}
+
+	// 延迟恢复后逐步加回，最多回到配置的 RateLimit
+	for i := 0; i < 20; i++ {
+		report(50 * time.Millisecond)
+	}
+	if got := effectiveRate(); got != 100 {
+		t.Fatalf("effective rate after recovery = %d, want the configured 100", got)
+	}
+}
@@ -0,0 +1,198 @@
+package central
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// NodeAllocation profile 配额在节点之间的分配方式
+type NodeAllocation int
+
+const (
+	// NodeAllocationShared 所有节点共用 profile 的剩余配额，先到先得（默认）
+	NodeAllocationShared NodeAllocation = iota
+	// NodeAllocationEqual 每个活跃节点最多获得有效总配额的平均份额，避免单个节点耗尽配额
+	NodeAllocationEqual
+	// NodeAllocationWeighted 每个节点的份额与其最近的需求（请求的 Required 之和）成正比
+	// 按比例无法整除的余数分给小数部分最大的节点，相同时分给节点 ID 较小的节点
+	NodeAllocationWeighted
+)
+
+func (a NodeAllocation) String() string {
+	switch a {
+	case NodeAllocationEqual:
+		return "equal"
+	case NodeAllocationWeighted:
+		return "weighted"
+	default:
+		return "shared"
+	}
+}
+
+// AllocationExplanation 节点上限的组成，用于在状态中说明节点为什么得到这个上限
+type AllocationExplanation struct {
+	Mode         string  `json:"mode"`                    // profile 的分配方式
+	BaseShare    int64   `json:"base_share"`              // 按分配方式计算的份额，shared 方式为有效总配额
+	WeightFactor float64 `json:"weight_factor,omitempty"` // weighted 方式下节点需求占总需求的比例
+	NodeCap      int64   `json:"node_cap,omitempty"`      // 生效的 MaxQuotaPerNode 上限（含转交的额外上限），未限制时为 0
+	HandedOff    int64   `json:"handed_off,omitempty"`    // 本窗口内从下线节点转交来的额外上限
+	Limit        int64   `json:"limit"`                   // 最终上限，-1 表示不限制
+}
+
+// WithMaxQuotaPerNode 设置每个节点在一个刷新窗口内从单个 profile 获得的配额上限，0 表示不限制
+func WithMaxQuotaPerNode(limit int64) QuotaOption {
+	return func(qm *QuotaManager) {
+		qm.maxQuotaPerNode = max(limit, 0)
+	}
+}
+
+// nodeLimitLocked 返回节点在本窗口内从 profile 最多能获得的配额总量，-1 表示不限制
+// required 为节点正在请求、尚未计入需求的数量；调用方必须持有锁
+func (qm *QuotaManager) nodeLimitLocked(profileMgr *ProfileManager, nodeID string, required int64, now time.Time) int64 {
+	return qm.explainNodeLimitLocked(profileMgr, nodeID, required, now).Limit
+}
+
+// explainNodeLimitLocked 计算节点上限并记录各组成部分；调用方必须持有锁
+func (qm *QuotaManager) explainNodeLimitLocked(profileMgr *ProfileManager, nodeID string, required int64, now time.Time) AllocationExplanation {
+	explanation := AllocationExplanation{
+		Mode:      profileMgr.config.NodeAllocation.String(),
+		BaseShare: profileMgr.effectiveQuota(now),
+		Limit:     -1,
+	}
+	switch profileMgr.config.NodeAllocation {
+	case NodeAllocationEqual:
+		explanation.BaseShare = qm.equalShareLocked(profileMgr, nodeID, now)
+		explanation.Limit = explanation.BaseShare
+	case NodeAllocationWeighted:
+		if nodeDemand, totalDemand := demandLocked(profileMgr, nodeID, required); totalDemand > 0 {
+			explanation.WeightFactor = float64(nodeDemand) / float64(totalDemand)
+		}
+		explanation.BaseShare = computeNodeShare(profileMgr, nodeID, required, now)
+		explanation.Limit = explanation.BaseShare
+	}
+	if qm.maxQuotaPerNode > 0 {
+		explanation.HandedOff = profileMgr.nodeAllowance[nodeID]
+		if nodeCap := qm.maxQuotaPerNode + explanation.HandedOff; explanation.Limit < 0 || nodeCap < explanation.Limit {
+			explanation.NodeCap = nodeCap
+			explanation.Limit = nodeCap
+		}
+	}
+	return explanation
+}
+
+// nodeRemainingLocked 返回节点在 profile 中还能获得的配额，-1 表示不限制
+func (qm *QuotaManager) nodeRemainingLocked(profileMgr *ProfileManager, nodeID string, required int64, now time.Time) int64 {
+	limit := qm.nodeLimitLocked(profileMgr, nodeID, required, now)
+	if limit < 0 {
+		return -1
+	}
+	return max(limit-profileMgr.nodeUsed[nodeID], 0)
+}
+
+// equalShareLocked 有效总配额在活跃节点（包括请求节点本身）之间的平均份额
+// 余数分给按节点 ID 排序靠前的节点，保证所有份额之和等于总配额
+func (qm *QuotaManager) equalShareLocked(profileMgr *ProfileManager, nodeID string, now time.Time) int64 {
+	nodes := append(qm.activeNodesLocked(profileMgr, nodeID), nodeID)
+	total := profileMgr.effectiveQuota(now)
+	share := total / int64(len(nodes))
+
+	// activeNodesLocked 已排序，请求节点按 ID 插入后的位置决定是否分到余数
+	var rank int64
+	for _, other := range nodes[:len(nodes)-1] {
+		if other < nodeID {
+			rank++
+		}
+	}
+	if rank < total%int64(len(nodes)) {
+		share++
+	}
+	return share
+}
+
+// computeNodeShare 按需求加权计算节点的份额：有效总配额 × 节点需求 / 所有节点需求
+// 需求为上一个窗口和当前窗口内请求的 Required 之和，required 为本次请求的数量
+// 取整后剩下的配额按最大余数法逐个分配，余数相同时节点 ID 较小的优先，
+// 相同的输入总是得到相同的分配，所有份额之和等于总配额
+func computeNodeShare(profileMgr *ProfileManager, nodeID string, required int64, now time.Time) int64 {
+	total := profileMgr.effectiveQuota(now)
+	demands := nodeDemandsLocked(profileMgr, nodeID, required)
+	var totalDemand int64
+	for _, demand := range demands {
+		totalDemand += demand
+	}
+	if totalDemand <= 0 || total <= 0 {
+		return max(total, 0)
+	}
+
+	type portion struct {
+		nodeID    string
+		share     int64
+		remainder uint64
+	}
+	portions := make([]portion, 0, len(demands))
+	leftover := total
+	for node, demand := range demands {
+		// total × demand 可能超出 int64，使用 128 位乘除；demand <= totalDemand 保证商不溢出
+		hi, lo := bits.Mul64(uint64(total), uint64(max(demand, 0)))
+		share, remainder := bits.Div64(hi, lo, uint64(totalDemand))
+		portions = append(portions, portion{nodeID: node, share: int64(share), remainder: remainder})
+		leftover -= int64(share)
+	}
+	sort.Slice(portions, func(i, j int) bool {
+		if portions[i].remainder != portions[j].remainder {
+			return portions[i].remainder > portions[j].remainder
+		}
+		return portions[i].nodeID < portions[j].nodeID
+	})
+
+	for i, p := range portions {
+		if p.nodeID != nodeID {
+			continue
+		}
+		if int64(i) < leftover {
+			return p.share + 1
+		}
+		return p.share
+	}
+	return 0
+}
+
+// nodeDemandsLocked 返回每个节点上一个窗口和当前窗口的需求之和，请求节点包含本次请求的 required
+func nodeDemandsLocked(profileMgr *ProfileManager, nodeID string, required int64) map[string]int64 {
+	demands := make(map[string]int64, len(profileMgr.nodeDemand)+1)
+	for node, demand := range profileMgr.lastNodeDemand {
+		demands[node] += demand
+	}
+	for node, demand := range profileMgr.nodeDemand {
+		demands[node] += demand
+	}
+	demands[nodeID] += required
+	return demands
+}
+
+// demandLocked 返回节点的需求和所有节点的需求之和，均包含本次请求的 required
+func demandLocked(profileMgr *ProfileManager, nodeID string, required int64) (nodeDemand, totalDemand int64) {
+	demands := nodeDemandsLocked(profileMgr, nodeID, required)
+	for _, demand := range demands {
+		totalDemand += demand
+	}
+	return demands[nodeID], totalDemand
+}
+
+// nodeStatusLocked 返回 profile 中每个节点的用量、上限和上限的组成，用于状态展示
+func (qm *QuotaManager) nodeStatusLocked(profileMgr *ProfileManager, now time.Time) map[string]interface{} {
+	nodes := make(map[string]interface{}, len(profileMgr.nodeUsed))
+	for nodeID, used := range profileMgr.nodeUsed {
+		explanation := qm.explainNodeLimitLocked(profileMgr, nodeID, 0, now)
+		nodeStatus := map[string]interface{}{
+			"used_quota": used,
+			"allocation": explanation,
+		}
+		if explanation.Limit >= 0 {
+			nodeStatus["limit"] = explanation.Limit
+		}
+		nodes[nodeID] = nodeStatus
+	}
+	return nodes
+}
@@ -0,0 +1,120 @@
+package central
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestComputeNodeShareFollowsSkewedDemand(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	profileMgr := newProfileManager(1, ProfileConfig{TotalQuota: 1000, NodeAllocation: NodeAllocationWeighted})
+
+	profileMgr.nodeDemand["node-b"] = 100
+	if got := computeNodeShare(profileMgr, "node-a", 900, now); got != 900 {
+		t.Errorf("node-a share = %d, want 900 for 900 of 1000 demand", got)
+	}
+	profileMgr.nodeDemand = map[string]int64{"node-a": 900}
+	if got := computeNodeShare(profileMgr, "node-b", 100, now); got != 100 {
+		t.Errorf("node-b share = %d, want 100 for 100 of 1000 demand", got)
+	}
+
+	// 上一个窗口的需求同样计入
+	profileMgr.nodeDemand = map[string]int64{}
+	profileMgr.lastNodeDemand = map[string]int64{"node-b": 300}
+	if got := computeNodeShare(profileMgr, "node-a", 100, now); got != 250 {
+		t.Errorf("node-a share = %d, want 250 with 100 of 400 demand", got)
+	}
+}
+
+func TestWeightedAllocationSplitsBySkewedDemand(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 1000, NodeAllocation: NodeAllocationWeighted}})
+	registerNodes(qm, "node-a", "node-b")
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-b", 1, 100))); got != 100 {
+		t.Fatalf("node-b granted %d, want 100", got)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-a", 1, 900))); got != 900 {
+		t.Fatalf("node-a granted %d, want 900", got)
+	}
+	// 需求已经按 900/100 分完了整个预算，再多要也没有了
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-b", 1, 100))); got != 0 {
+		t.Fatalf("node-b granted %d more, want 0", got)
+	}
+}
+
+// allocationOf 从 GetQuotaStatus 中取出节点的分配说明
+func allocationOf(t *testing.T, qm *QuotaManager, profileID int, nodeID string) AllocationExplanation {
+	t.Helper()
+	profiles := qm.GetQuotaStatus()["profiles"].(map[string]interface{})
+	profile := profiles[fmt.Sprintf("profile_%d", profileID)].(map[string]interface{})
+	node, exists := profile["nodes"].(map[string]interface{})[nodeID]
+	if !exists {
+		t.Fatalf("profile %d status has no node %s", profileID, nodeID)
+	}
+	return node.(map[string]interface{})["allocation"].(AllocationExplanation)
+}
+
+func TestAllocationExplanationShowsWeightedShare(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 1000, NodeAllocation: NodeAllocationWeighted}})
+	registerNodes(qm, "node-a", "node-b")
+	qm.CheckQuota(quotaRequest("node-b", 1, 100))
+	qm.CheckQuota(quotaRequest("node-a", 1, 900))
+
+	got := allocationOf(t, qm, 1, "node-a")
+	want := AllocationExplanation{Mode: "weighted", BaseShare: 900, WeightFactor: 0.9, Limit: 900}
+	if got != want {
+		t.Fatalf("node-a allocation = %+v, want %+v", got, want)
+	}
+}
+
+func TestAllocationExplanationSumsCapAndHandedOffShare(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, WithMaxQuotaPerNode(30))
+	registerNodes(qm, "node-a", "node-b", "node-c")
+	for _, nodeID := range []string{"node-a", "node-b", "node-c"} {
+		qm.CheckQuota(quotaRequest(nodeID, 1, 30))
+	}
+	if _, err := qm.Handoff("node-c"); err != nil {
+		t.Fatalf("Handoff: %v", err)
+	}
+
+	// 节点上限由自身的 MaxQuotaPerNode 和下线节点转交来的份额组成
+	got := allocationOf(t, qm, 1, "node-a")
+	if got.HandedOff != 15 || got.NodeCap != 30+got.HandedOff || got.Limit != got.NodeCap {
+		t.Fatalf("node-a allocation = %+v, want the cap of 30 plus 15 handed off as its limit", got)
+	}
+	if got.Mode != "shared" || got.BaseShare != 100 {
+		t.Fatalf("node-a allocation = %+v, want the shared base of the whole 100", got)
+	}
+}
+
+func TestComputeNodeShareBreaksEqualWeightTiesByNodeID(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		total int64
+		want  map[string]int64
+	}{
+		{1000, map[string]int64{"node-a": 334, "node-b": 333, "node-c": 333}},
+		{11, map[string]int64{"node-a": 4, "node-b": 4, "node-c": 3}},
+	}
+
+	for _, tt := range tests {
+		// 每一轮都是全新的管理器，map 的遍历顺序各不相同，分配结果必须保持一致
+		for round := 0; round < 20; round++ {
+			profileMgr := newProfileManager(1, ProfileConfig{TotalQuota: tt.total, NodeAllocation: NodeAllocationWeighted})
+			profileMgr.nodeDemand = map[string]int64{"node-c": 5, "node-a": 5, "node-b": 5}
+
+			var sum int64
+			for nodeID, want := range tt.want {
+				got := computeNodeShare(profileMgr, nodeID, 0, now)
+				if got != want {
+					t.Fatalf("total %d round %d: %s share = %d, want %d", tt.total, round, nodeID, got, want)
+				}
+				sum += got
+			}
+			if sum != tt.total {
+				t.Fatalf("total %d: shares sum to %d, want the whole total", tt.total, sum)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package central
+
+import (
+	"fmt"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// quotaBoost 临时增加的配额，在 until 之前有效
+type quotaBoost struct {
+	extra int64
+	until time.Time
+}
+
+// BoostProfile 在 until 之前临时增加 profile 的有效总配额（例如促销期间）
+// 多次调用的增量相互叠加，各自按自己的截止时间失效；截止后有效配额回到基础值，
+// 过期记录在刷新时清理。返回当前叠加后的增量总和
+func (qm *QuotaManager) BoostProfile(profileID int, extra int64, until time.Time) (int64, error) {
+	if extra <= 0 {
+		return 0, fmt.Errorf("%w: boost must be positive", common.ErrInvalidRequest)
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	now := qm.now()
+	if !until.After(now) {
+		return 0, fmt.Errorf("%w: boost deadline must be in the future", common.ErrInvalidRequest)
+	}
+
+	profileMgr, exists := qm.getProfileLocked(profileID)
+	if !exists {
+		return 0, common.ErrProfileNotFound
+	}
+
+	profileMgr.boosts = append(profileMgr.boosts, quotaBoost{extra: extra, until: until})
+	qm.recordUsage(profileMgr)
+	qm.notifyQuotaFreedLocked(profileID)
+	return profileMgr.boostAt(now), nil
+}
+
+// effectiveQuota profile 在 now 时刻可分配的总预算（基础配额加上有效的临时增量）
+func (pm *ProfileManager) effectiveQuota(now time.Time) int64 {
+	return pm.totalQuota + pm.boostAt(now)
+}
+
+// boostAt 返回 now 时刻仍然有效的临时增量总和
+func (pm *ProfileManager) boostAt(now time.Time) int64 {
+	var extra int64
+	for _, boost := range pm.boosts {
+		if now.Before(boost.until) {
+			extra += boost.extra
+		}
+	}
+	return extra
+}
+
+// pruneBoosts 清理已过期的临时增量
+func (pm *ProfileManager) pruneBoosts(now time.Time) {
+	active := pm.boosts[:0]
+	for _, boost := range pm.boosts {
+		if now.Before(boost.until) {
+			active = append(active, boost)
+		}
+	}
+	pm.boosts = active
+}
@@ -0,0 +1,83 @@
+package central
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestBoostRaisesQuotaUntilDeadline(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, withClock(clock))
+
+	if _, err := qm.BoostProfile(1, 50, clock.Now().Add(30*time.Minute)); err != nil {
+		t.Fatalf("BoostProfile: %v", err)
+	}
+	// 增量相互叠加，各自按自己的截止时间失效
+	total, err := qm.BoostProfile(1, 25, clock.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("BoostProfile: %v", err)
+	}
+	if total != 75 {
+		t.Fatalf("stacked boost = %d, want 75", total)
+	}
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 175))); got != 175 {
+		t.Fatalf("granted during both boosts = %d, want 175", got)
+	}
+
+	clock.Advance(20 * time.Minute)
+	qm.refresh()
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 200))); got != 150 {
+		t.Fatalf("granted after the shorter boost expired = %d, want 150", got)
+	}
+
+	clock.Advance(20 * time.Minute)
+	qm.refresh()
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 200))); got != 100 {
+		t.Fatalf("granted after all boosts expired = %d, want the base 100", got)
+	}
+	if boosts := len(qm.profiles[1].boosts); boosts != 0 {
+		t.Fatalf("%d expired boosts kept after refresh", boosts)
+	}
+}
+
+func TestBoostRejectsInvalidInput(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, withClock(clock))
+
+	if _, err := qm.BoostProfile(1, 0, clock.Now().Add(time.Minute)); !errors.Is(err, common.ErrInvalidRequest) {
+		t.Fatalf("zero boost error = %v, want ErrInvalidRequest", err)
+	}
+	if _, err := qm.BoostProfile(1, 10, clock.Now()); !errors.Is(err, common.ErrInvalidRequest) {
+		t.Fatalf("past deadline error = %v, want ErrInvalidRequest", err)
+	}
+	if _, err := qm.BoostProfile(2, 10, clock.Now().Add(time.Minute)); !errors.Is(err, common.ErrProfileNotFound) {
+		t.Fatalf("unknown profile error = %v, want ErrProfileNotFound", err)
+	}
+}
+
+func TestGrantFromBoostQuotaCarriesWarning(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, withClock(clock))
+	if _, err := qm.BoostProfile(1, 50, clock.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("BoostProfile: %v", err)
+	}
+
+	// 基础配额内的分配不带任何提示
+	resp := qm.CheckQuota(quotaRequest("node-1", 1, 80))
+	if got := granted(t, resp); got != 80 || len(resp.Warnings) != 0 {
+		t.Fatalf("normal grant = %d with warnings %v, want 80 and none", got, resp.Warnings)
+	}
+
+	resp = qm.CheckQuota(quotaRequest("node-1", 1, 40))
+	if got := granted(t, resp); got != 40 {
+		t.Fatalf("boosted grant = %d, want 40", got)
+	}
+	want := []common.Warning{{Code: common.WarningBoostQuota, ProfileID: 1, Message: "grant drew on temporary boost quota"}}
+	if !reflect.DeepEqual(resp.Warnings, want) {
+		t.Fatalf("boosted grant warnings = %+v, want %+v", resp.Warnings, want)
+	}
+}
@@ -0,0 +1,29 @@
+package central
+
+import (
+	"math"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// secondsPerDay 一天的秒数
+const secondsPerDay = 24 * 60 * 60
+
+// ProfileConfigFromBudget 根据每天的请求预算推导 profile 配置
+// RateLimit 为 perDay/86400 四舍五入（至少 1），Burst 为 RateLimit*burstFactor 向上取整（至少 1），
+// Window 为 1 秒，TotalQuota 为 perDay，适用于刷新周期为一天的部署
+func ProfileConfigFromBudget(perDay int64, burstFactor float64, method common.RateControlMethod) ProfileConfig {
+	rate := max(int64(math.Round(float64(perDay)/secondsPerDay)), 1)
+	burst := max(int64(math.Ceil(float64(rate)*burstFactor)), 1)
+
+	config := ProfileConfig{
+		TotalQuota:        perDay,
+		RateLimit:         rate,
+		Burst:             burst,
+		RateControlMethod: method,
+	}
+	if method != common.RateControlNone {
+		config.Window = time.Second
+	}
+	return config
+}
@@ -0,0 +1,46 @@
+package central
+
+import (
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestProfileConfigFromBudgetDerivesRate(t *testing.T) {
+	config := ProfileConfigFromBudget(1_000_000, 2, common.RateControlTokenBucket)
+	// 1000000 / 86400 ≈ 11.57，四舍五入为 12
+	if config.TotalQuota != 1_000_000 || config.RateLimit != 12 || config.Burst != 24 || config.Window != time.Second {
+		t.Fatalf("config = %+v, want total 1000000, rate 12, burst 24, window 1s", config)
+	}
+
+	// 每天不足一次每秒的预算仍至少允许每秒一次
+	if config := ProfileConfigFromBudget(1000, 1, common.RateControlFixedWindow); config.RateLimit != 1 || config.Burst != 1 {
+		t.Fatalf("low budget config = %+v, want rate and burst of 1", config)
+	}
+	if config := ProfileConfigFromBudget(1000, 1, common.RateControlNone); config.Window != 0 {
+		t.Fatalf("window without rate control = %v, want 0", config.Window)
+	}
+}
+
+func TestProfileConfigFromBudgetAdmitsBudgetOverADay(t *testing.T) {
+	const perDay = 2 * 86400
+	config := ProfileConfigFromBudget(perDay, 1.5, common.RateControlTokenBucket)
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock), WithLogger(discardLogger()))
+
+	// 每秒发送两倍于速率的请求，持续模拟的一天
+	var admitted int64
+	for second := 0; second < 86400; second++ {
+		for i := 0; i < 4; i++ {
+			admitted += granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 1)))
+		}
+		clock.Advance(time.Second)
+	}
+
+	if admitted > perDay {
+		t.Fatalf("admitted %d, more than the daily budget %d", admitted, perDay)
+	}
+	if admitted < perDay*99/100 {
+		t.Fatalf("admitted %d, want approximately the daily budget %d", admitted, perDay)
+	}
+}
@@ -0,0 +1,71 @@
+package central
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// errInvalidContinuation 续取令牌无效或与请求不匹配
+var errInvalidContinuation = errors.New("invalid continuation token")
+
+// continuation 续取令牌内容：单次请求超过 MaxPerRequest 时剩余待分配的数量
+type continuation struct {
+	ProfileID int    `json:"p"`
+	NodeID    string `json:"n"`
+	Remaining int64  `json:"r"`
+}
+
+// newTokenKey 生成令牌签名密钥，令牌只在本实例生命周期内有效
+func newTokenKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("generate continuation token key: " + err.Error())
+	}
+	return key
+}
+
+// encodeContinuation 编码并签名续取令牌
+func (qm *QuotaManager) encodeContinuation(c continuation) string {
+	payload, _ := json.Marshal(c)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(qm.signToken(encoded))
+}
+
+// decodeContinuation 校验签名并解码续取令牌，令牌必须属于同一 profile 和节点
+func (qm *QuotaManager) decodeContinuation(token string, profileID int, nodeID string) (continuation, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return continuation{}, errInvalidContinuation
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, qm.signToken(encoded)) {
+		return continuation{}, errInvalidContinuation
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return continuation{}, errInvalidContinuation
+	}
+
+	var c continuation
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return continuation{}, errInvalidContinuation
+	}
+	if c.ProfileID != profileID || c.NodeID != nodeID || c.Remaining <= 0 {
+		return continuation{}, errInvalidContinuation
+	}
+	return c, nil
+}
+
+// signToken 计算令牌签名
+func (qm *QuotaManager) signToken(encoded string) []byte {
+	h := hmac.New(sha256.New, qm.tokenKey)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
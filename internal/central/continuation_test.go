@@ -0,0 +1,60 @@
+package central
+
+import (
+	"testing"
+	"throttle_control/internal/common"
+)
+
+// continueRequest 携带续取令牌的请求
+func continueRequest(nodeID string, profileID int, token string) common.QuotaRequest {
+	return common.QuotaRequest{
+		NodeID: nodeID,
+		Quotas: []common.ProfileQuota{{ProfileID: profileID, ContinuationToken: token}},
+	}
+}
+
+func TestContinuationTokenYieldsNextChunk(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 1000, MaxPerRequest: 100}})
+
+	resp := qm.CheckQuota(quotaRequest("node-1", 1, 250))
+	quota := resp.Quotas[0]
+	if quota.Granted != 100 || quota.ContinuationToken == "" {
+		t.Fatalf("first response = %+v, want 100 granted with a token", quota)
+	}
+	if len(resp.Warnings) != 0 {
+		t.Errorf("warnings = %v, a capped grant is not a partial grant", resp.Warnings)
+	}
+
+	chunks := []int64{100}
+	token := quota.ContinuationToken
+	for token != "" {
+		quota = qm.CheckQuota(continueRequest("node-1", 1, token)).Quotas[0]
+		chunks = append(chunks, quota.Granted)
+		token = quota.ContinuationToken
+	}
+	if len(chunks) != 3 || chunks[1] != 100 || chunks[2] != 50 {
+		t.Errorf("chunks = %v, want [100 100 50]", chunks)
+	}
+	if used := qm.profiles[1].usedQuota; used != 250 {
+		t.Errorf("used = %d, want the full 250 drawn in chunks", used)
+	}
+}
+
+func TestContinuationTokenBoundToProfileAndNode(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{
+		1: {TotalQuota: 1000, MaxPerRequest: 100},
+		2: {TotalQuota: 1000, MaxPerRequest: 100},
+	})
+	token := qm.CheckQuota(quotaRequest("node-1", 1, 250)).Quotas[0].ContinuationToken
+
+	for name, req := range map[string]common.QuotaRequest{
+		"other node":    continueRequest("node-2", 1, token),
+		"other profile": continueRequest("node-1", 2, token),
+		"tampered":      continueRequest("node-1", 1, token+"x"),
+	} {
+		quota := qm.CheckQuota(req).Quotas[0]
+		if quota.Granted != 0 || quota.Reason == "" {
+			t.Errorf("%s: response = %+v, want a denial with a reason", name, quota)
+		}
+	}
+}
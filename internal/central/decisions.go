@@ -0,0 +1,123 @@
+package central
+
+import (
+	"sync"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// DecisionRecord 一次 profile 配额决策的完整记录，用于排查客户端报告的误限流
+type DecisionRecord struct {
+	RecordedAt time.Time                   `json:"recorded_at"`
+	RequestID  string                      `json:"request_id"`
+	NodeID     string                      `json:"node_id"`
+	AccountID  string                      `json:"account_id,omitempty"`
+	Request    common.ProfileQuota         `json:"request"`
+	State      *ProfileState               `json:"state,omitempty"` // 决策前的 profile 状态，profile 未加载时为空
+	Decision   common.ProfileQuotaResponse `json:"decision"`
+	Reason     string                      `json:"reason"`
+}
+
+// WithDecisionRecorder 启用决策记录，最多保留最近 capacity 条
+// 每条记录包含 profile 状态快照，开销高于普通日志，只应在排查问题时短期开启
+func WithDecisionRecorder(capacity int) QuotaOption {
+	return func(qm *QuotaManager) {
+		if capacity > 0 {
+			qm.decisions = &decisionRecorder{records: make([]DecisionRecord, capacity)}
+		}
+	}
+}
+
+// decisionRecorder 固定容量的环形缓冲区
+type decisionRecorder struct {
+	mu      sync.Mutex
+	records []DecisionRecord
+	next    int
+	full    bool
+}
+
+// add 追加一条记录，缓冲区满时覆盖最旧的记录
+func (r *decisionRecorder) add(record DecisionRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[r.next] = record
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// find 按时间顺序返回满足条件的记录
+func (r *decisionRecorder) find(match func(DecisionRecord) bool) []DecisionRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start, count := 0, r.next
+	if r.full {
+		start, count = r.next, len(r.records)
+	}
+
+	var found []DecisionRecord
+	for i := 0; i < count; i++ {
+		record := r.records[(start+i)%len(r.records)]
+		if match(record) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// Decisions 查询记录的决策，requestID 和 nodeID 为空表示不按该字段过滤
+// 未启用决策记录时返回 nil
+func (qm *QuotaManager) Decisions(requestID, nodeID string) []DecisionRecord {
+	if qm.decisions == nil {
+		return nil
+	}
+	return qm.decisions.find(func(record DecisionRecord) bool {
+		return (requestID == "" || record.RequestID == requestID) &&
+			(nodeID == "" || record.NodeID == nodeID)
+	})
+}
+
+// snapshotLocked 记录决策前的 profile 状态，调用方需持有锁
+func (qm *QuotaManager) snapshotLocked(profileID int) *ProfileState {
+	profileMgr, exists := qm.profiles[profileID]
+	if !exists {
+		return nil
+	}
+	state := profileMgr.exportState()
+	return &state
+}
+
+// recordDecisions 记录一次请求中各 profile 的决策，responses 与 req.Quotas 一一对应
+func (qm *QuotaManager) recordDecisions(req common.QuotaRequest, states []*ProfileState, responses []common.ProfileQuotaResponse, now time.Time) {
+	for i, resp := range responses {
+		qm.decisions.add(DecisionRecord{
+			RecordedAt: now,
+			RequestID:  req.RequestID,
+			NodeID:     req.NodeID,
+			AccountID:  req.AccountID,
+			Request:    req.Quotas[i],
+			State:      states[i],
+			Decision:   resp,
+			Reason:     decisionReason(resp),
+		})
+	}
+}
+
+// decisionReason 决策原因
+func decisionReason(resp common.ProfileQuotaResponse) string {
+	switch {
+	case resp.Reason != "":
+		return resp.Reason
+	case resp.RateLimited:
+		return denyReasonRateLimited
+	case resp.Granted == 0:
+		return denyReasonExhausted
+	case resp.Granted < resp.Required:
+		return "partially granted"
+	default:
+		return "granted"
+	}
+}
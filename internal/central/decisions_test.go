@@ -0,0 +1,69 @@
+package central
+
+import (
+	"net/http"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// identifiedRequest 带 RequestID 的单 profile 配额请求
+func identifiedRequest(requestID, nodeID string, profileID int, required int64) common.QuotaRequest {
+	req := quotaRequest(nodeID, profileID, required)
+	req.RequestID = requestID
+	return req
+}
+
+func TestDecisionRecordedWithProducingState(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: fixedWindow(1, time.Minute)}, withClock(clock), WithDecisionRecorder(2), WithLogger(discardLogger()))
+
+	granted(t, qm.CheckQuota(identifiedRequest("req-1", "node-1", 1, 10)))
+	qm.CheckQuota(identifiedRequest("req-2", "node-2", 1, 10))
+
+	records := qm.Decisions("req-2", "")
+	if len(records) != 1 {
+		t.Fatalf("got %d records for req-2, want 1", len(records))
+	}
+	record := records[0]
+	if record.NodeID != "node-2" || record.Reason != denyReasonRateLimited || !record.Decision.RateLimited {
+		t.Fatalf("record = %+v, want node-2 rate limited", record)
+	}
+	// 快照是决策前的状态：窗口内已有 req-1 的一次请求和它的 10 个配额
+	if record.State == nil || record.State.Rate.RequestCount != 1 || record.State.UsedQuota != 10 {
+		t.Fatalf("state = %+v, want the window already holding req-1", record.State)
+	}
+
+	if records := qm.Decisions("", "node-1"); len(records) != 1 || records[0].RequestID != "req-1" {
+		t.Fatalf("records for node-1 = %+v, want req-1", records)
+	}
+
+	// 容量为 2，第三条记录覆盖最旧的 req-1
+	qm.CheckQuota(identifiedRequest("req-3", "node-1", 1, 10))
+	if records := qm.Decisions("req-1", ""); len(records) != 0 {
+		t.Fatalf("req-1 still recorded after the ring wrapped: %+v", records)
+	}
+	if records := qm.Decisions("", ""); len(records) != 2 || records[0].RequestID != "req-2" || records[1].RequestID != "req-3" {
+		t.Fatalf("records = %+v, want req-2 and req-3 in order", records)
+	}
+}
+
+func TestDecisionsEndpoint(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs:       map[int]ProfileConfig{1: {TotalQuota: 100}},
+		DecisionRecorderSize: 10,
+	})
+	serve(t, handler, http.MethodPost, "/api/v1/quota/check", identifiedRequest("req-1", "node-1", 1, 10))
+
+	rec := serve(t, handler, http.MethodGet, "/api/v1/debug/decisions?request_id=req-1", nil)
+	var records []DecisionRecord
+	decodeBody(t, rec, &records)
+	if len(records) != 1 || records[0].Decision.Granted != 10 || records[0].Reason != "granted" {
+		t.Fatalf("records = %+v, want the granted req-1", records)
+	}
+
+	_, disabled := newTestServer(t, &ServerConfig{})
+	if rec := serve(t, disabled, http.MethodGet, "/api/v1/debug/decisions", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("status with recording disabled = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package central
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// EffectiveConfig 当前实际生效的配置：启动配置叠加运行时修改（刷新周期、日志采样率、冻结状态、profile 变更）
+// RefreshFunc、Validator 等函数字段和续取令牌签名密钥不会出现在结果中
+type EffectiveConfig struct {
+	Port                 string                            `json:"port"`
+	LogSampleRate        int64                             `json:"log_sample_rate"`
+	AllowEmptyProfiles   bool                              `json:"allow_empty_profiles"`
+	AllowAnonymous       bool                              `json:"allow_anonymous"`
+	UnknownProfilePolicy UnknownProfilePolicy              `json:"unknown_profile_policy"`
+	Idempotency          IdempotencyConfig                 `json:"idempotency"`
+	RefreshGuard         string                            `json:"refresh_guard"`
+	MaxStatusStaleness   string                            `json:"max_status_staleness"`
+	MaxQuotaPerNode      int64                             `json:"max_quota_per_node"`
+	DecisionRecorderSize int                               `json:"decision_recorder_size"`
+	StrictProfiles       bool                              `json:"strict_profiles"`
+	NodeStaleAfter       string                            `json:"node_stale_after"`
+	ScrapeRateLimit      int64                             `json:"scrape_rate_limit"`
+	TLS                  bool                              `json:"tls"`
+	ClientCertRequired   bool                              `json:"client_cert_required"`
+	ReadOnly             bool                              `json:"read_only"`
+	PrimaryURL           string                            `json:"primary_url,omitempty"`
+	SnapshotPath         string                            `json:"snapshot_path,omitempty"`
+	MetricsSink          string                            `json:"metrics_sink"`          // 指标输出的实现类型
+	QuotaStore           string                            `json:"quota_store,omitempty"` // 共享用量存储的实现类型
+	Manager              EffectiveManagerConfig            `json:"manager"`
+	Namespaces           map[string]EffectiveManagerConfig `json:"namespaces,omitempty"`
+}
+
+// EffectiveManagerConfig 单个配额管理器（默认或某个命名空间）实际生效的配置
+type EffectiveManagerConfig struct {
+	RefreshInterval string                   `json:"refresh_interval"`
+	ProfileProvider string                   `json:"profile_provider"` // profile 配置来源的实现类型
+	Frozen          bool                     `json:"frozen"`
+	FreezeMode      FreezeMode               `json:"freeze_mode"`
+	Profiles        map[string]ProfileConfig `json:"profiles"`
+}
+
+// EffectiveProfileConfigs 返回所有 profile 当前生效的配置
+// 已加载的 profile 使用内存中的配置（包含运行时修改），尚未加载的从 provider 读取
+func (qm *QuotaManager) EffectiveProfileConfigs() (map[int]ProfileConfig, error) {
+	profileIDs, err := qm.provider.ListProfiles()
+	if err != nil {
+		return nil, fmt.Errorf("list profiles failed: %w", err)
+	}
+
+	configs := qm.GetProfiles()
+	for _, profileID := range profileIDs {
+		if _, loaded := configs[profileID]; loaded {
+			continue
+		}
+		config, err := qm.provider.GetProfile(profileID)
+		if err != nil {
+			return nil, fmt.Errorf("get profile %d failed: %w", profileID, err)
+		}
+		configs[profileID] = config
+	}
+	return configs, nil
+}
+
+// effectiveManagerConfig 汇总配额管理器当前生效的配置
+func effectiveManagerConfig(qm *QuotaManager) (EffectiveManagerConfig, error) {
+	configs, err := qm.EffectiveProfileConfigs()
+	if err != nil {
+		return EffectiveManagerConfig{}, err
+	}
+
+	frozen, mode := qm.Frozen()
+	effective := EffectiveManagerConfig{
+		RefreshInterval: qm.RefreshInterval().String(),
+		ProfileProvider: fmt.Sprintf("%T", qm.provider),
+		Frozen:          frozen,
+		FreezeMode:      mode,
+		Profiles:        make(map[string]ProfileConfig, len(configs)),
+	}
+	for profileID, config := range configs {
+		effective.Profiles[strconv.Itoa(profileID)] = config
+	}
+	return effective, nil
+}
+
+// effectiveConfig 汇总服务器当前生效的配置
+func (s *Server) effectiveConfig() (EffectiveConfig, error) {
+	manager, err := effectiveManagerConfig(s.quotaManager)
+	if err != nil {
+		return EffectiveConfig{}, err
+	}
+
+	effective := EffectiveConfig{
+		Port:                 s.config.Port,
+		LogSampleRate:        s.logSampleRate.Load(),
+		AllowEmptyProfiles:   s.config.AllowEmptyProfiles,
+		AllowAnonymous:       s.config.AllowAnonymous,
+		UnknownProfilePolicy: s.config.UnknownProfilePolicy,
+		Idempotency:          s.config.Idempotency,
+		RefreshGuard:         s.config.RefreshGuard.String(),
+		MaxStatusStaleness:   s.config.MaxStatusStaleness.String(),
+		MaxQuotaPerNode:      s.config.MaxQuotaPerNode,
+		DecisionRecorderSize: s.config.DecisionRecorderSize,
+		StrictProfiles:       s.config.StrictProfiles,
+		NodeStaleAfter:       s.config.NodeStaleAfter.String(),
+		ScrapeRateLimit:      s.config.ScrapeRateLimit,
+		TLS:                  s.config.TLSCertFile != "",
+		ClientCertRequired:   s.config.ClientCAFile != "",
+		ReadOnly:             s.config.ReadOnly,
+		PrimaryURL:           s.config.PrimaryURL,
+		SnapshotPath:         s.config.SnapshotPath,
+		MetricsSink:          fmt.Sprintf("%T", s.metrics),
+		Manager:              manager,
+	}
+	if s.config.QuotaStore != nil {
+		effective.QuotaStore = fmt.Sprintf("%T", s.config.QuotaStore)
+	}
+	if len(s.namespaces) > 0 {
+		effective.Namespaces = make(map[string]EffectiveManagerConfig, len(s.namespaces))
+		for namespace, qm := range s.namespaces {
+			nsConfig, err := effectiveManagerConfig(qm)
+			if err != nil {
+				return EffectiveConfig{}, fmt.Errorf("namespace %s: %w", namespace, err)
+			}
+			effective.Namespaces[namespace] = nsConfig
+		}
+	}
+	return effective, nil
+}
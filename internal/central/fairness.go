@@ -0,0 +1,27 @@
+package central
+
+// fairnessLocked 计算 profile 在活跃节点间分配的 Jain 公平性指数
+// 没有拿到配额的活跃节点按零计入，因此被饿死的节点会拉低指数
+func (qm *QuotaManager) fairnessLocked(profileMgr *ProfileManager) float64 {
+	nodeIDs := qm.activeNodesLocked(profileMgr, "")
+	allocations := make([]int64, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		allocations = append(allocations, profileMgr.nodeUsed[nodeID])
+	}
+	return jainFairnessIndex(allocations)
+}
+
+// jainFairnessIndex 计算 Jain 公平性指数 (Σx)² / (n·Σx²)
+// 取值范围 [1/n, 1]，1 表示完全平均；没有节点或全部为零时视为公平
+func jainFairnessIndex(allocations []int64) float64 {
+	var sum, sumSquares float64
+	for _, allocation := range allocations {
+		x := float64(allocation)
+		sum += x
+		sumSquares += x * x
+	}
+	if sumSquares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(allocations)) * sumSquares)
+}
@@ -0,0 +1,50 @@
+package central
+
+import (
+	"math"
+	"testing"
+)
+
+func TestJainFairnessIndex(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations []int64
+		want        float64
+	}{
+		{"no nodes", nil, 1},
+		{"all zero", []int64{0, 0, 0}, 1},
+		{"equal", []int64{50, 50, 50, 50}, 1},
+		{"one node starved", []int64{50, 50, 0, 0}, 0.5},
+		{"one node takes everything", []int64{100, 0, 0, 0}, 0.25},
+		{"skewed", []int64{30, 10}, 0.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jainFairnessIndex(tt.allocations); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("jainFairnessIndex(%v) = %v, want %v", tt.allocations, got, tt.want)
+			}
+		})
+	}
+}
+
+// 已注册但没有拿到配额的活跃节点按零计入
+func TestFairnessCountsStarvedActiveNodes(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	registerNodes(qm, "node-a", "node-b")
+	qm.CheckQuota(quotaRequest("node-a", 1, 40))
+
+	qm.mu.RLock()
+	fairness := qm.fairnessLocked(qm.profiles[1])
+	qm.mu.RUnlock()
+	if math.Abs(fairness-0.5) > 1e-9 {
+		t.Fatalf("fairness = %v, want 0.5 with node-b starved", fairness)
+	}
+
+	qm.CheckQuota(quotaRequest("node-b", 1, 40))
+	qm.mu.RLock()
+	fairness = qm.fairnessLocked(qm.profiles[1])
+	qm.mu.RUnlock()
+	if math.Abs(fairness-1) > 1e-9 {
+		t.Fatalf("fairness = %v, want 1 once both nodes hold 40", fairness)
+	}
+}
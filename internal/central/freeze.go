@@ -0,0 +1,65 @@
+package central
+
+import "throttle_control/internal/common"
+
+// FreezeMode 冻结期间配额检查的处理方式
+type FreezeMode int
+
+const (
+	FreezeDenyAll  FreezeMode = iota // 拒绝所有请求（默认）
+	FreezeAllowAll                   // 放行所有请求，按请求数量全额授予
+)
+
+// frozenReason 冻结期间拒绝请求时返回的原因
+const frozenReason = "quota consumption is frozen"
+
+// Freeze 冻结配额消耗，用于维护窗口期间保持用量不变
+// 冻结期间 CheckQuota 不修改任何用量和速率状态，按 mode 全部拒绝或全部放行
+func (qm *QuotaManager) Freeze(mode FreezeMode) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.frozen = true
+	qm.freezeMode = mode
+}
+
+// Unfreeze 恢复配额消耗
+func (qm *QuotaManager) Unfreeze() {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.frozen = false
+}
+
+// Frozen 返回是否处于冻结状态及冻结方式
+func (qm *QuotaManager) Frozen() (bool, FreezeMode) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	return qm.frozen, qm.freezeMode
+}
+
+// frozenResponseLocked 冻结期间的配额响应，不修改任何状态
+func (qm *QuotaManager) frozenResponseLocked(req common.QuotaRequest) common.QuotaResponse {
+	responses := make([]common.ProfileQuotaResponse, 0, len(req.Quotas))
+	for _, profileQuota := range req.Quotas {
+		resp := common.ProfileQuotaResponse{
+			ProfileID: profileQuota.ProfileID,
+			Required:  profileQuota.Required,
+		}
+		if qm.freezeMode == FreezeAllowAll {
+			resp.Granted = profileQuota.Required
+		} else {
+			resp.Reason = frozenReason
+			qm.recordDenial(profileQuota.ProfileID, denyReasonFrozen)
+		}
+		responses = append(responses, resp)
+	}
+
+	return common.QuotaResponse{
+		RequestID: req.RequestID,
+		Quotas:    responses,
+		ExpiresAt: qm.now().Add(qm.refreshInterval),
+		Frozen:    true,
+	}
+}
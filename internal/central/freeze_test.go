@@ -0,0 +1,66 @@
+package central
+
+import (
+	"net/http"
+	"testing"
+	"throttle_control/internal/common"
+)
+
+func TestFreezePausesConsumption(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	qm.CheckQuota(quotaRequest("node-1", 1, 30))
+
+	qm.Freeze(FreezeDenyAll)
+	resp := qm.CheckQuota(quotaRequest("node-1", 1, 10))
+	if !resp.Frozen || granted(t, resp) != 0 || resp.Quotas[0].Reason != frozenReason {
+		t.Fatalf("deny-all frozen response = %+v, want frozen denial", resp)
+	}
+
+	qm.Freeze(FreezeAllowAll)
+	resp = qm.CheckQuota(quotaRequest("node-1", 1, 500))
+	if !resp.Frozen || granted(t, resp) != 500 {
+		t.Fatalf("allow-all frozen response = %+v, want the full 500 granted", resp)
+	}
+	if used := qm.profiles[1].usedQuota; used != 30 {
+		t.Fatalf("usedQuota = %d while frozen, want 30 unchanged", used)
+	}
+
+	qm.Unfreeze()
+	resp = qm.CheckQuota(quotaRequest("node-1", 1, 100))
+	if resp.Frozen || granted(t, resp) != 70 {
+		t.Fatalf("response after unfreeze = %+v, want the remaining 70", resp)
+	}
+}
+
+func TestFreezeEndpoint(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+
+	var status struct {
+		Frozen bool   `json:"frozen"`
+		Mode   string `json:"mode"`
+	}
+	rec := serve(t, handler, http.MethodPut, "/api/v1/admin/freeze", map[string]any{"frozen": true, "mode": "deny"})
+	decodeBody(t, rec, &status)
+	if !status.Frozen || status.Mode != "deny" {
+		t.Fatalf("freeze status = %+v, want frozen deny", status)
+	}
+
+	rec = serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 10))
+	var resp common.QuotaResponse
+	decodeBody(t, rec, &resp)
+	if !resp.Frozen || granted(t, resp) != 0 {
+		t.Fatalf("check while frozen = %+v, want frozen denial", resp)
+	}
+
+	serve(t, handler, http.MethodPut, "/api/v1/admin/freeze", map[string]any{"frozen": false})
+	rec = serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 10))
+	resp = common.QuotaResponse{}
+	decodeBody(t, rec, &resp)
+	if resp.Frozen || granted(t, resp) != 10 {
+		t.Fatalf("check after unfreeze = %+v, want 10 granted", resp)
+	}
+
+	if rec := serve(t, handler, http.MethodPut, "/api/v1/admin/freeze", map[string]any{"frozen": true, "mode": "pause"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown mode status = %d, want 400", rec.Code)
+	}
+}
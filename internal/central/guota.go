@@ -1,27 +1,122 @@
 package central
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"throttle_control/internal/common"
+	"throttle_control/internal/ratelimit"
 	"time"
 )
 
 // ProfileConfig 定义每个 profile 的配置
 type ProfileConfig struct {
-	TotalQuota        int64                    // profile 总配额
-	RateLimit         int64                    // 每秒最大请求数
-	Burst             int64                    // 突发请求数
-	Description       string                   // profile 描述
-	Window            time.Duration            // 速率窗口大小
-	RateControlMethod common.RateControlMethod // 速率控制方法
+	TotalQuota        int64                    `json:"total_quota"`           // profile 总配额
+	RateLimit         int64                    `json:"rate_limit"`            // 每秒最大请求数
+	Burst             int64                    `json:"burst"`                 // 突发请求数
+	Description       string                   `json:"description"`           // profile 描述
+	Window            time.Duration            `json:"window"`                // 速率窗口大小
+	RateControlMethod common.RateControlMethod `json:"rate_control_method"`   // 速率控制方法
+	RefreshFunc       BudgetRefreshFunc        `json:"-"`                     // 可选，刷新时从外部预算来源获取总配额
+	PathLimits        []PathRateLimit          `json:"path_limits,omitempty"` // 可选，按 API 方法/路径的子速率限制，按顺序匹配第一个
+	AlignWindow       bool                     `json:"align_window"`          // 速率窗口对齐到时钟边界，使各节点的窗口划分一致
+	MaxPerRequest     int64                    `json:"max_per_request"`       // 单次请求最多分配的配额，0 表示不限制；超出部分通过续取令牌分批获取
+	Validator         RequestValidator         `json:"-"`                     // 可选，自定义准入规则，返回错误时拒绝且不扣减配额
+	MaxDimensions     int                      `json:"max_dimensions"`        // 按具体路径区分（PerPath）的子速率桶数量上限，0 表示不限制
+	DimensionOverflow DimensionOverflow        `json:"dimension_overflow"`    // 按路径区分的子速率桶达到上限后新路径的处理策略
+	Adaptive          *AdaptiveRateConfig      `json:"adaptive,omitempty"`    // 可选，根据后端延迟自动降低速率
+	Labels            map[string]string        `json:"labels,omitempty"`      // 可选，profile 标签（如 tenant、service），用于分组展示
+	NodeAllocation    NodeAllocation           `json:"node_allocation"`       // 配额在节点之间的分配方式
+	StaggerReset      bool                     `json:"stagger_reset"`         // 用量清零时间按 profile ID 错开到刷新周期内，避免共用下游的 profile 同时放量
+	StartupPolicy     StartupPolicy            `json:"startup_policy"`        // 刚加载或速率状态重置后第一个窗口的准入方式
+}
+
+// RequestValidator 自定义准入校验，在配额和速率检查之前调用
+// 返回的错误信息作为拒绝原因返回给客户端
+type RequestValidator func(req common.QuotaRequest, quota common.ProfileQuota) error
+
+// BudgetRefreshFunc 从外部预算来源（如计费系统）获取 profile 的最新总配额
+// resetUsage 为 true 时同时清零已用配额，否则已用配额跨刷新周期累计
+type BudgetRefreshFunc func(profileID int) (totalQuota int64, resetUsage bool, err error)
+
+// budgetUpdate 外部预算刷新结果
+type budgetUpdate struct {
+	totalQuota int64
+	resetUsage bool
 }
 
 // QuotaManager 支持多 profile 的配额管理器
 type QuotaManager struct {
 	mu              sync.RWMutex
-	profiles        map[int]*ProfileManager // 每个 profile 的管理器
+	profiles        map[int]*ProfileManager // 已加载的 profile 管理器
+	provider        ProfileConfigProvider   // profile 配置来源
+	nodes           map[string]*nodeInfo    // 已上报状态的应用节点
 	refreshInterval time.Duration
+	lastRefresh     time.Time                // 上一次刷新时间
+	now             func() time.Time         // 时钟，测试时可替换
+	metrics         MetricsSink              // 指标输出
+	tokenKey        []byte                   // 续取令牌签名密钥
+	checkDuration   time.Duration            // 配额检查处理耗时的滑动平均，用于按截止时间丢弃请求
+	sessions        map[string]*quotaSession // 未关闭的配额会话，按句柄索引
+	sessionTTL      time.Duration            // 会话空闲过期时间
+	idempotency     *idempotencyCache        // 请求去重缓存，未启用时为 nil
+	frozen          bool                     // 维护期间冻结配额消耗
+	freezeMode      FreezeMode               // 冻结期间的处理方式
+	inflight        atomic.Int64             // 正在处理（含等待锁）的配额检查数
+	busyThreshold   int64                    // 同时处理的配额检查数超过该值时提示客户端繁忙，0 表示不提示
+	intervalChanged chan time.Duration       // 通知刷新协程刷新周期已修改
+	refreshGuard    time.Duration            // 刷新期间拒绝配额检查时建议的重试间隔，0 表示不拒绝
+	refreshing      atomic.Bool              // 是否正在刷新
+	maxQuotaPerNode int64                    // 每个节点每个窗口从单个 profile 获得的配额上限，0 表示不限制
+	decisions       *decisionRecorder        // 决策记录，未启用时为 nil
+	quotaFreed      map[int]chan struct{}    // 等待配额的请求的唤醒通道，profile 配额被释放时关闭
+	strictConfig    bool                     // 通过 API 修改 profile 时可疑配置也视为错误
+	accountUsage    map[string]map[int]int64 // 每个计费账户在各 profile 上累计获得的配额
+	store           QuotaStore               // 共享的用量存储，nil 表示只使用进程内计数
+	refreshFeed     refreshFeed              // 刷新事件的订阅者
+	logger          Logger                   // 结构化日志输出
+	invariantPanics bool                     // 违反配额不变量时 panic 而不是记录日志
+}
+
+// defaultBusyThreshold 默认繁忙提示阈值
+const defaultBusyThreshold = 64
+
+// QuotaOption 配额管理器可选配置
+type QuotaOption func(*QuotaManager)
+
+// WithMetricsSink 设置指标输出，默认不输出指标
+func WithMetricsSink(sink MetricsSink) QuotaOption {
+	return func(qm *QuotaManager) {
+		if sink != nil {
+			qm.metrics = sink
+		}
+	}
+}
+
+// WithBusyThreshold 设置繁忙提示阈值：同时处理（含等待锁）的配额检查数超过 n 时，
+// 响应中的 Busy 为 true，客户端可据此更积极地退避
+func WithBusyThreshold(n int64) QuotaOption {
+	return func(qm *QuotaManager) {
+		qm.busyThreshold = max(n, 0)
+	}
+}
+
+// WithRefreshGuard 刷新期间拒绝配额检查，并建议客户端 retryAfter 后重试
+// 仅用于无法原子刷新的后端（刷新过程中可能读到一半新一半旧的状态）；内存中的刷新是原子的，不需要启用
+func WithRefreshGuard(retryAfter time.Duration) QuotaOption {
+	return func(qm *QuotaManager) {
+		qm.refreshGuard = max(retryAfter, 0)
+	}
+}
+
+// WithStrictProfileValidation 通过 API 新增或修改 profile 时，可疑的配置（如设置了 rate_limit 但没有启用速率控制）也以错误拒绝
+// 默认只记录警告日志
+func WithStrictProfileValidation(strict bool) QuotaOption {
+	return func(qm *QuotaManager) {
+		qm.strictConfig = strict
+	}
 }
 
 // ProfileManager 单个 profile 的配额管理器
@@ -30,25 +125,50 @@ type ProfileManager struct {
 	totalQuota     int64
 	usedQuota      int64
 	config         ProfileConfig
-	lastWindowTime time.Time
-	rateTokens     int64
-	requestCount   int64
+	rate           ratelimit.State             // profile 级别的速率状态
+	dimensions     map[string]*ratelimit.State // 子速率限制的状态，按组合键区分
+	nodeUsed       map[string]int64            // 本窗口内每个节点已分配的配额
+	nodeAllowance  map[string]int64            // 本窗口内每个节点从下线节点转交来的额外上限，叠加在 MaxQuotaPerNode 上
+	fairness       float64                     // 上一个窗口结束时各节点分配的公平性指数
+	boosts         []quotaBoost                // 临时增加的配额
+	effectiveRate  int64                       // 自适应控制调整后的速率，0 表示使用 RateLimit
+	nodeDemand     map[string]int64            // 本窗口内每个节点请求的配额之和
+	lastNodeDemand map[string]int64            // 上一个窗口内每个节点请求的配额之和
+	pendingReset   time.Time                   // 启用 StaggerReset 时被推迟的用量清零时间，零值表示没有
+	storeLimit     int64                       // 最近一次写入 QuotaStore 的有效总配额
+	accepted       atomic.Int64                // 累计分配到配额的请求数，刷新时不清零
+	rejected       atomic.Int64                // 累计因速率控制以外的原因被拒绝的请求数
+	rateLimited    atomic.Int64                // 累计被速率控制拒绝的请求数
+	rampStart      time.Time                   // 启用 StartupRamp 时爬坡的开始时间，零值表示还没有请求到达
+	nodeThrottled  map[string]int64            // 本窗口内每个节点被速率控制拒绝的请求数
+	lastThrottled  map[string]int64            // 上一个窗口内每个节点被速率控制拒绝的请求数
 }
 
-// NewQuotaManager 创建配额管理器
-func NewQuotaManager(refreshInterval time.Duration, profileConfigs map[int]ProfileConfig) *QuotaManager {
-	qm := &QuotaManager{
-		profiles:        make(map[int]*ProfileManager),
-		refreshInterval: refreshInterval,
+// RequestCounts profile 自加载以来的请求决策累计数，刷新时不清零
+// 冻结期间的拒绝计入 Rejected，FreezeAllowAll 放行的请求不计入
+type RequestCounts struct {
+	Accepted    int64 `json:"accepted"`
+	Rejected    int64 `json:"rejected"`
+	RateLimited int64 `json:"rate_limited"`
+}
+
+// requestCounts 读取累计的请求决策数，计数器是原子的，不需要持有锁
+func (pm *ProfileManager) requestCounts() RequestCounts {
+	return RequestCounts{
+		Accepted:    pm.accepted.Load(),
+		Rejected:    pm.rejected.Load(),
+		RateLimited: pm.rateLimited.Load(),
 	}
+}
+
+// NewQuotaManager 创建配额管理器，使用静态配置并预加载所有 profile
+func NewQuotaManager(refreshInterval time.Duration, profileConfigs map[int]ProfileConfig, opts ...QuotaOption) *QuotaManager {
+	qm := newQuotaManager(refreshInterval, NewStaticProfileProvider(profileConfigs), opts)
 
 	// 初始化每个 profile
 	for profileID, config := range profileConfigs {
-		qm.profiles[profileID] = &ProfileManager{
-			profileID:  profileID,
-			totalQuota: config.TotalQuota,
-			config:     config,
-		}
+		qm.logProfileDiagnostics(profileID, config)
+		qm.profiles[profileID] = newProfileManager(profileID, config)
 	}
 
 	// 启动周期性更新
@@ -57,115 +177,622 @@ func NewQuotaManager(refreshInterval time.Duration, profileConfigs map[int]Profi
 	return qm
 }
 
+// NewQuotaManagerWithProvider 创建从 provider 读取配置的配额管理器
+// profile 在第一次被请求时才从 provider 加载
+func NewQuotaManagerWithProvider(refreshInterval time.Duration, provider ProfileConfigProvider, opts ...QuotaOption) *QuotaManager {
+	qm := newQuotaManager(refreshInterval, provider, opts)
+
+	// 启动周期性更新
+	go qm.startPeriodicRefresh()
+
+	return qm
+}
+
+func newQuotaManager(refreshInterval time.Duration, provider ProfileConfigProvider, opts []QuotaOption) *QuotaManager {
+	qm := &QuotaManager{
+		profiles:        make(map[int]*ProfileManager),
+		provider:        provider,
+		nodes:           make(map[string]*nodeInfo),
+		refreshInterval: refreshInterval,
+		lastRefresh:     time.Now(),
+		now:             time.Now,
+		metrics:         nopSink{},
+		logger:          slog.Default(),
+		tokenKey:        newTokenKey(),
+		sessions:        make(map[string]*quotaSession),
+		sessionTTL:      defaultSessionTTL,
+		busyThreshold:   defaultBusyThreshold,
+		intervalChanged: make(chan time.Duration, 1),
+		quotaFreed:      make(map[int]chan struct{}),
+		refreshFeed:     refreshFeed{subscribers: make(map[chan RefreshEvent]struct{})},
+		accountUsage:    make(map[string]map[int]int64),
+		invariantPanics: defaultInvariantPanics,
+	}
+
+	for _, opt := range opts {
+		opt(qm)
+	}
+	qm.propagateLogger()
+
+	if qm.idempotency != nil {
+		go qm.startIdempotencyCompactor()
+	}
+
+	return qm
+}
+
+// newProfileManager 根据配置创建 profile 管理器
+func newProfileManager(profileID int, config ProfileConfig) *ProfileManager {
+	return &ProfileManager{
+		profileID:     profileID,
+		totalQuota:    config.TotalQuota,
+		config:        config,
+		dimensions:    make(map[string]*ratelimit.State),
+		nodeUsed:      make(map[string]int64),
+		nodeAllowance: make(map[string]int64),
+		fairness:      1,
+		nodeDemand:    make(map[string]int64),
+	}
+}
+
+// getProfileLocked 获取 profile 管理器，未加载时从 provider 读取配置
+// 调用方必须持有写锁
+func (qm *QuotaManager) getProfileLocked(profileID int) (*ProfileManager, bool) {
+	if profileMgr, exists := qm.profiles[profileID]; exists {
+		qm.applyDueResetLocked(profileMgr, qm.now())
+		return profileMgr, true
+	}
+
+	config, err := qm.provider.GetProfile(profileID)
+	if err != nil {
+		if !errors.Is(err, common.ErrProfileNotFound) {
+			qm.logger.Error("load profile failed", "profile_id", profileID, "error", err)
+		}
+		return nil, false
+	}
+
+	qm.logProfileDiagnostics(profileID, config)
+	profileMgr := newProfileManager(profileID, config)
+	qm.profiles[profileID] = profileMgr
+	return profileMgr, true
+}
+
 // CheckQuota 检查并分配多个 profile 的配额
+// 同时处理中的请求数超过繁忙阈值时在响应中附带 Busy 提示
 func (qm *QuotaManager) CheckQuota(req common.QuotaRequest) common.QuotaResponse {
+	inflight := qm.inflight.Add(1)
+	defer qm.inflight.Add(-1)
+
+	// 非原子刷新期间状态可能不一致，让客户端稍后重试
+	if qm.refreshGuard > 0 && qm.refreshing.Load() {
+		return common.QuotaResponse{
+			RequestID:  req.RequestID,
+			Quotas:     []common.ProfileQuotaResponse{},
+			Refreshing: true,
+		}
+	}
+
+	resp := qm.checkQuota(req)
+	resp.Busy = qm.busyThreshold > 0 && inflight > qm.busyThreshold
+	return resp
+}
+
+// CheckQuotaBatch 按顺序处理多个配额请求，只获取一次锁，返回与 reqs 顺序一致的响应
+// 每个请求的处理与 CheckQuota 相同，前面的请求分配的配额对后面的请求可见
+func (qm *QuotaManager) CheckQuotaBatch(reqs []common.QuotaRequest) []common.QuotaResponse {
+	inflight := qm.inflight.Add(1)
+	defer qm.inflight.Add(-1)
+
+	resps := make([]common.QuotaResponse, len(reqs))
+	if qm.refreshGuard > 0 && qm.refreshing.Load() {
+		for i, req := range reqs {
+			resps[i] = common.QuotaResponse{
+				RequestID:  req.RequestID,
+				Quotas:     []common.ProfileQuotaResponse{},
+				Refreshing: true,
+			}
+		}
+		return resps
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	busy := qm.busyThreshold > 0 && inflight > qm.busyThreshold
+	for i, req := range reqs {
+		resps[i] = qm.checkQuotaLocked(req)
+		resps[i].Busy = busy
+	}
+	return resps
+}
+
+// checkQuota 在锁内完成配额检查和分配
+func (qm *QuotaManager) checkQuota(req common.QuotaRequest) common.QuotaResponse {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
+	return qm.checkQuotaLocked(req)
+}
+
+// checkQuotaLocked 完成单个请求的配额检查和分配，调用方需持有写锁
+func (qm *QuotaManager) checkQuotaLocked(req common.QuotaRequest) common.QuotaResponse {
 	responses := make([]common.ProfileQuotaResponse, 0, len(req.Quotas))
-	now := time.Now()
+	now := qm.now()
+
+	qm.metrics.IncrCounter(metricQuotaChecks, nil, 1)
+
+	if qm.frozen {
+		return qm.frozenResponseLocked(req)
+	}
+
+	// 重复的请求（如超时重试）直接返回首次的响应
+	if qm.idempotency != nil && req.RequestID != "" {
+		if resp, exists := qm.idempotency.get(idempotencyKey(req), now); exists {
+			return resp
+		}
+	}
+
+	// 已经等待锁的时间加上预计处理时间超过客户端截止时间，结果对客户端已无意义，直接丢弃
+	if !req.Deadline.IsZero() && now.Add(qm.checkDuration).After(req.Deadline) {
+		qm.metrics.IncrCounter(metricQuotaShed, nil, 1)
+		return common.QuotaResponse{
+			RequestID:        req.RequestID,
+			Quotas:           responses,
+			DeadlineExceeded: true,
+		}
+	}
+
+	defer func() {
+		elapsed := qm.now().Sub(now)
+		qm.checkDuration += (elapsed - qm.checkDuration) / 8
+		qm.metrics.ObserveHistogram(metricCheckDuration, nil, elapsed.Seconds())
+	}()
 
-	// 处理每个 profile 的请求
-	for _, profileQuota := range req.Quotas {
-		profileMgr, exists := qm.profiles[profileQuota.ProfileID]
+	qm.chargeConsumedLocked(req, now)
+
+	// 处理每个 profile 的请求，优先级高的先分配
+	var states []*ProfileState
+	var warnings []common.Warning
+	order := priorityOrder(req.Quotas)
+	for _, i := range order {
+		profileQuota := req.Quotas[i]
+		if qm.decisions != nil {
+			states = append(states, qm.snapshotLocked(profileQuota.ProfileID))
+		}
+		profileMgr, exists := qm.getProfileLocked(profileQuota.ProfileID)
 		if !exists {
-			// 如果 profile 不存在，返回零配额
+			// 如果 profile 不存在（或已被删除），返回零配额并说明原因
+			qm.recordDenial(profileQuota.ProfileID, denyReasonNotFound)
 			responses = append(responses, common.ProfileQuotaResponse{
 				ProfileID: profileQuota.ProfileID,
 				Granted:   0,
 				Required:  profileQuota.Required,
+				Reason:    common.ErrProfileNotFound.Error(),
+				NotFound:  true,
 			})
 			continue
 		}
 
-		// 全局速率控制
-		elapsed := now.Sub(profileMgr.lastWindowTime)
-		switch profileMgr.config.RateControlMethod {
-		case common.RateControlTokenBucket:
-			// 令牌桶算法
-			if elapsed > profileMgr.config.Window {
-				profileMgr.rateTokens = profileMgr.config.Burst
-				profileMgr.lastWindowTime = now
-			}
-
-			newTokens := int64(elapsed.Seconds() * float64(profileMgr.config.RateLimit))
-			profileMgr.rateTokens = min(profileMgr.rateTokens+newTokens, profileMgr.config.Burst)
+		// 刷新请求中本地配额充足的 profile 只确认存在，不经过准入规则和速率控制
+		if req.Refresh && profileQuota.Required == 0 {
+			responses = append(responses, common.ProfileQuotaResponse{ProfileID: profileQuota.ProfileID})
+			continue
+		}
 
-			if profileMgr.rateTokens < 1 {
+		// 自定义准入规则
+		if validator := profileMgr.config.Validator; validator != nil {
+			if err := validator(req, profileQuota); err != nil {
+				qm.recordDenial(profileQuota.ProfileID, denyReasonRejected)
 				responses = append(responses, common.ProfileQuotaResponse{
-					ProfileID:   profileQuota.ProfileID,
-					Granted:     0,
-					Required:    profileQuota.Required,
-					RateLimited: true,
+					ProfileID: profileQuota.ProfileID,
+					Granted:   0,
+					Required:  profileQuota.Required,
+					Reason:    err.Error(),
 				})
 				continue
 			}
-			profileMgr.rateTokens--
-
-		case common.RateControlFixedWindow:
-			// 固定窗口算法
-			if elapsed > profileMgr.config.Window {
-				profileMgr.requestCount = 0
-				profileMgr.lastWindowTime = now
-			}
+		}
 
-			if profileMgr.requestCount >= profileMgr.config.RateLimit {
+		// 携带续取令牌时，本次请求的数量为令牌中剩余的部分
+		required := profileQuota.Required
+		if profileQuota.ContinuationToken != "" {
+			c, err := qm.decodeContinuation(profileQuota.ContinuationToken, profileQuota.ProfileID, req.NodeID)
+			if err != nil {
+				qm.recordDenial(profileQuota.ProfileID, denyReasonInvalidToken)
 				responses = append(responses, common.ProfileQuotaResponse{
-					ProfileID:   profileQuota.ProfileID,
-					Granted:     0,
-					Required:    profileQuota.Required,
-					RateLimited: true,
+					ProfileID: profileQuota.ProfileID,
+					Granted:   0,
+					Required:  profileQuota.Required,
+					Reason:    err.Error(),
 				})
 				continue
 			}
-			profileMgr.requestCount++
+			required = c.Remaining
+		}
+
+		// 最小可接受量超过单次上限，这个请求永远无法满足
+		if maxPerRequest := profileMgr.config.MaxPerRequest; maxPerRequest > 0 && profileQuota.MinAcceptable > maxPerRequest {
+			qm.recordDenial(profileQuota.ProfileID, denyReasonRejected)
+			responses = append(responses, common.ProfileQuotaResponse{
+				ProfileID: profileQuota.ProfileID,
+				Granted:   0,
+				Required:  required,
+				Reason:    fmt.Sprintf("min_acceptable %d exceeds max_per_request %d", profileQuota.MinAcceptable, maxPerRequest),
+			})
+			continue
+		}
+
+		// 剩余配额不足时先从陈旧、空闲的节点回收未用完的配额
+		if shortfall := required - max(profileMgr.effectiveQuota(now)-profileMgr.usedQuota, 0); shortfall > 0 {
+			qm.reclaimLocked(profileMgr, shortfall, req.NodeID)
 		}
 
 		// 计算可用配额
-		remainingQuota := profileMgr.totalQuota - profileMgr.usedQuota
-		grantedQuota := profileQuota.Required
-		if remainingQuota < profileQuota.Required {
+		remainingQuota := max(profileMgr.effectiveQuota(now)-profileMgr.usedQuota, 0)
+		nodeLimited := false
+		if nodeRemaining := qm.nodeRemainingLocked(profileMgr, req.NodeID, required, now); nodeRemaining >= 0 && nodeRemaining < remainingQuota {
+			// 节点已用完自己的份额
+			remainingQuota = nodeRemaining
+			nodeLimited = true
+		}
+
+		// 速率控制；配额已经不可能满足时不消耗速率许可，留给能够分配的请求
+		exhausted := remainingQuota == 0 || remainingQuota < profileQuota.MinAcceptable
+		if !exhausted && !profileMgr.allowRate(profileQuota, required, now, qm.metrics) {
+			qm.recordDenial(profileQuota.ProfileID, denyReasonRateLimited)
+			profileMgr.recordThrottledLocked(req.NodeID)
+			retryAfter := profileMgr.rateRetryAfter(profileQuota, required, now)
+			qm.logger.Warn("quota request rate limited",
+				"profile_id", profileQuota.ProfileID, "node_id", req.NodeID, "request_id", req.RequestID, "retry_after", retryAfter)
+			responses = append(responses, common.ProfileQuotaResponse{
+				ProfileID:   profileQuota.ProfileID,
+				Granted:     0,
+				Required:    required,
+				RateLimited: true,
+				RetryAfter:  retryAfter,
+			})
+			continue
+		}
+
+		profileMgr.nodeDemand[req.NodeID] += required
+
+		// 单次分配不超过 MaxPerRequest
+		grantedQuota := required
+		if maxPerRequest := profileMgr.config.MaxPerRequest; maxPerRequest > 0 && grantedQuota > maxPerRequest {
+			grantedQuota = maxPerRequest
+		}
+		capped := grantedQuota < required
+		if remainingQuota < grantedQuota {
 			grantedQuota = remainingQuota
 		}
+		if grantedQuota < profileQuota.MinAcceptable {
+			// 无法满足最小可接受量，不分配也不扣减
+			grantedQuota = 0
+		}
+		if consumed := qm.consumeLocked(profileMgr, req.NodeID, grantedQuota, now); consumed < profileQuota.MinAcceptable {
+			// 共享存储中其他实例已经用掉了配额
+			qm.releaseLocked(profileMgr, req.NodeID, consumed)
+			grantedQuota = 0
+		} else {
+			grantedQuota = consumed
+		}
 
 		// 更新配额信息
+		usedBefore := profileMgr.usedQuota
 		if grantedQuota > 0 {
 			profileMgr.usedQuota += grantedQuota
+			profileMgr.nodeUsed[req.NodeID] += grantedQuota
 		}
+		qm.checkGrantInvariantLocked(profileMgr, now, usedBefore, grantedQuota)
+		qm.recordGrant(profileMgr, grantedQuota)
+		qm.recordAccountGrantLocked(req.AccountID, profileQuota.ProfileID, grantedQuota)
 
-		responses = append(responses, common.ProfileQuotaResponse{
+		resp := common.ProfileQuotaResponse{
 			ProfileID: profileQuota.ProfileID,
 			Granted:   grantedQuota,
-			Required:  profileQuota.Required,
-		})
+			Required:  required,
+		}
+		if capped {
+			// 超过单次上限，剩余部分需要携带令牌再次请求，并再次经过速率控制
+			resp.ContinuationToken = qm.encodeContinuation(continuation{
+				ProfileID: profileQuota.ProfileID,
+				NodeID:    req.NodeID,
+				Remaining: required - grantedQuota,
+			})
+		}
+		responses = append(responses, resp)
+		if grantedQuota > 0 {
+			warnings = append(warnings, grantWarnings(profileMgr, resp, capped, nodeLimited)...)
+		}
 	}
+	responses = inRequestOrder(responses, order)
+	states = inRequestOrder(states, order)
 
-	return common.QuotaResponse{
+	resp := common.QuotaResponse{
 		RequestID: req.RequestID,
 		Quotas:    responses,
-		ExpiresAt: time.Now().Add(qm.refreshInterval),
+		ExpiresAt: now.Add(qm.refreshInterval),
+		Warnings:  warnings,
+	}
+	if qm.idempotency != nil && req.RequestID != "" {
+		qm.idempotency.put(idempotencyKey(req), resp, now)
+	}
+	if qm.decisions != nil {
+		qm.recordDecisions(req, states, responses, now)
 	}
+	return resp
+}
+
+// chargeConsumedLocked 把节点报告的分配之外已经发生的消耗（如中心节点不可用期间动用的应急配额）计入 profile 用量
+// 消耗已经发生，即使超过剩余配额也全部计入本窗口；共享存储中最多记到剩余配额为止。未知的 profile 忽略
+// 调用方必须持有写锁
+func (qm *QuotaManager) chargeConsumedLocked(req common.QuotaRequest, now time.Time) {
+	for profileID, amount := range req.Consumed {
+		if amount <= 0 {
+			continue
+		}
+		profileMgr, exists := qm.getProfileLocked(profileID)
+		if !exists {
+			continue
+		}
+		qm.consumeLocked(profileMgr, req.NodeID, amount, now)
+		profileMgr.usedQuota += amount
+		profileMgr.nodeUsed[req.NodeID] += amount
+		qm.recordUsage(profileMgr)
+	}
+}
+
+// grantWarnings 一次成功分配需要提示客户端的情况；调用方必须持有锁
+// 超过 MaxPerRequest 的部分通过续取令牌获取，不视为部分分配
+func grantWarnings(profileMgr *ProfileManager, resp common.ProfileQuotaResponse, capped, nodeLimited bool) []common.Warning {
+	var warnings []common.Warning
+	if resp.Granted < resp.Required && !capped {
+		warning := common.Warning{
+			Code:      common.WarningPartialGrant,
+			ProfileID: resp.ProfileID,
+			Message:   fmt.Sprintf("granted %d of %d, profile quota is nearly exhausted", resp.Granted, resp.Required),
+		}
+		if nodeLimited {
+			warning.Code = common.WarningNodeShareLimited
+			warning.Message = fmt.Sprintf("granted %d of %d, limited by this node's share of the profile", resp.Granted, resp.Required)
+		}
+		warnings = append(warnings, warning)
+	}
+	if profileMgr.usedQuota > profileMgr.totalQuota {
+		warnings = append(warnings, common.Warning{
+			Code:      common.WarningBoostQuota,
+			ProfileID: resp.ProfileID,
+			Message:   "grant drew on temporary boost quota",
+		})
+	}
+	return warnings
+}
+
+// recordGrant 记录一次分配的指标，分配为零视为配额耗尽
+func (qm *QuotaManager) recordGrant(profileMgr *ProfileManager, granted int64) {
+	if granted > 0 {
+		profileMgr.accepted.Add(1)
+		qm.metrics.IncrCounter(metricQuotaGrants, profileLabels(profileMgr.profileID), 1)
+	} else {
+		qm.recordDenial(profileMgr.profileID, denyReasonExhausted)
+	}
+	qm.recordUsage(profileMgr)
+}
+
+// recordDenial 记录一次拒绝的指标和 profile 的拒绝计数；调用方至少持有读锁
+func (qm *QuotaManager) recordDenial(profileID int, reason string) {
+	if profileMgr, exists := qm.profiles[profileID]; exists {
+		if reason == denyReasonRateLimited {
+			profileMgr.rateLimited.Add(1)
+		} else {
+			profileMgr.rejected.Add(1)
+		}
+	}
+	labels := profileLabels(profileID)
+	labels["reason"] = reason
+	qm.metrics.IncrCounter(metricQuotaDenials, labels, 1)
+}
+
+// recordUsage 更新 profile 用量仪表
+func (qm *QuotaManager) recordUsage(profileMgr *ProfileManager) {
+	labels := profileLabels(profileMgr.profileID)
+	qm.metrics.SetGauge(metricProfileUsed, labels, float64(profileMgr.usedQuota))
+	qm.metrics.SetGauge(metricProfileAvailable, labels, float64(max(profileMgr.effectiveQuota(qm.now())-profileMgr.usedQuota, 0)))
 }
 
 // startPeriodicRefresh 开始周期性刷新
 func (qm *QuotaManager) startPeriodicRefresh() {
-	ticker := time.NewTicker(qm.refreshInterval)
+	interval := qm.RefreshInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	resetTimer := time.NewTimer(interval)
+	defer resetTimer.Stop()
 
-	for range ticker.C {
-		qm.refresh()
+	for {
+		select {
+		case <-ticker.C:
+			qm.refresh()
+		case <-resetTimer.C:
+			qm.applyDueResets()
+		case interval := <-qm.intervalChanged:
+			ticker.Reset(interval)
+		}
+		resetTimer.Reset(qm.untilNextReset())
+	}
+}
+
+// 刷新周期的允许范围
+const (
+	minRefreshInterval = time.Second
+	maxRefreshInterval = 24 * time.Hour
+)
+
+// RefreshInterval 返回当前刷新周期
+func (qm *QuotaManager) RefreshInterval() time.Duration {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	return qm.refreshInterval
+}
+
+// SetRefreshInterval 在运行时修改刷新周期（例如故障期间缩短周期以更快回收配额）
+// 新周期从修改时开始计时，不影响已有的用量和速率状态
+func (qm *QuotaManager) SetRefreshInterval(interval time.Duration) error {
+	if interval < minRefreshInterval || interval > maxRefreshInterval {
+		return fmt.Errorf("%w: refresh interval must be between %v and %v", common.ErrInvalidRequest, minRefreshInterval, maxRefreshInterval)
+	}
+
+	qm.mu.Lock()
+	qm.refreshInterval = interval
+	qm.mu.Unlock()
+
+	// 只保留最新的修改，刷新协程取到的总是最后一次设置的值
+	for {
+		select {
+		case qm.intervalChanged <- interval:
+			return nil
+		default:
+		}
+		select {
+		case <-qm.intervalChanged:
+		default:
+		}
 	}
 }
 
 // refresh 刷新所有 profile 的配额
 func (qm *QuotaManager) refresh() {
+	if qm.refreshGuard > 0 {
+		qm.refreshing.Store(true)
+		defer qm.refreshing.Store(false)
+	}
+
+	started := qm.now()
+
+	// 在锁外从 provider 重新读取配置、从外部来源获取预算，避免慢速调用阻塞配额检查
+	configs, removed := qm.reloadConfigs()
+	budgets, failed := qm.fetchBudgets(configs)
+
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
-	// 刷新每个 profile 的配额
+	event := RefreshEvent{StartedAt: started, Profiles: make(map[int]ProfileRefreshEvent, len(qm.profiles))}
+	defer func() {
+		event.Duration = qm.now().Sub(started)
+		qm.publishRefreshEvent(event)
+	}()
+
+	for _, profileID := range removed {
+		delete(qm.profiles, profileID)
+	}
+	for profileID, config := range configs {
+		if profileMgr, exists := qm.profiles[profileID]; exists {
+			profileMgr.setConfig(config)
+			if config.RefreshFunc == nil {
+				profileMgr.totalQuota = config.TotalQuota
+			}
+		}
+	}
+
+	// 在清零之前记录本窗口的分配公平性
 	for _, profileMgr := range qm.profiles {
-		profileMgr.usedQuota = 0
+		profileMgr.fairness = qm.fairnessLocked(profileMgr)
+		qm.metrics.SetGauge(metricProfileFairness, profileLabels(profileMgr.profileID), profileMgr.fairness)
 	}
+
+	// 过期会话在清零前归还剩余配额
+	qm.expireSessionsLocked(qm.now())
+
+	// 刷新每个 profile 的配额
+	qm.lastRefresh = qm.now()
+	for profileID, profileMgr := range qm.profiles {
+		profileMgr.pruneBoosts(qm.lastRefresh)
+		profileMgr.lastNodeDemand, profileMgr.nodeDemand = profileMgr.nodeDemand, make(map[string]int64)
+		profileMgr.lastThrottled, profileMgr.nodeThrottled = profileMgr.nodeThrottled, nil
+		profileEvent := ProfileRefreshEvent{Consumed: profileMgr.usedQuota}
+		event.Profiles[profileID] = profileEvent
+		if failed[profileID] {
+			// 外部预算获取失败，保留原有预算和用量
+			continue
+		}
+		if budget, exists := budgets[profileID]; exists {
+			profileMgr.totalQuota = budget.totalQuota
+			if !budget.resetUsage {
+				continue
+			}
+		}
+		if profileMgr.config.StaggerReset {
+			qm.scheduleResetLocked(profileMgr)
+			continue
+		}
+		profileEvent.Reclaimed = qm.reclaimableLocked(profileMgr)
+		profileEvent.Reset = true
+		event.Profiles[profileID] = profileEvent
+		qm.resetUsageLocked(profileMgr)
+	}
+
+	for profileID, profileMgr := range qm.profiles {
+		qm.recordUsage(profileMgr)
+		qm.notifyQuotaFreedLocked(profileID)
+	}
+}
+
+// fetchBudgets 调用配置了 RefreshFunc 的 profile 获取最新预算，configs 为刚重新加载的配置
+// 出错的 profile 记录日志并通过 failed 返回
+func (qm *QuotaManager) fetchBudgets(configs map[int]ProfileConfig) (budgets map[int]budgetUpdate, failed map[int]bool) {
+	refreshFuncs := make(map[int]BudgetRefreshFunc)
+	qm.mu.RLock()
+	for profileID, profileMgr := range qm.profiles {
+		refreshFuncs[profileID] = profileMgr.config.RefreshFunc
+	}
+	qm.mu.RUnlock()
+	for profileID, config := range configs {
+		refreshFuncs[profileID] = config.RefreshFunc
+	}
+
+	budgets = make(map[int]budgetUpdate)
+	failed = make(map[int]bool)
+	for profileID, refreshFunc := range refreshFuncs {
+		if refreshFunc == nil {
+			continue
+		}
+		totalQuota, resetUsage, err := refreshFunc(profileID)
+		if err != nil {
+			qm.logger.Error("refresh budget failed", "profile_id", profileID, "error", err)
+			failed[profileID] = true
+			continue
+		}
+		budgets[profileID] = budgetUpdate{totalQuota: totalQuota, resetUsage: resetUsage}
+	}
+
+	return budgets, failed
+}
+
+// reloadConfigs 从 provider 重新读取已加载 profile 的配置
+// 读取失败的 profile 保留原有配置，已从 provider 删除的 profile 通过 removed 返回
+func (qm *QuotaManager) reloadConfigs() (configs map[int]ProfileConfig, removed []int) {
+	qm.mu.RLock()
+	profileIDs := make([]int, 0, len(qm.profiles))
+	for profileID := range qm.profiles {
+		profileIDs = append(profileIDs, profileID)
+	}
+	qm.mu.RUnlock()
+
+	configs = make(map[int]ProfileConfig, len(profileIDs))
+	for _, profileID := range profileIDs {
+		config, err := qm.provider.GetProfile(profileID)
+		if err != nil {
+			if errors.Is(err, common.ErrProfileNotFound) {
+				removed = append(removed, profileID)
+			} else {
+				qm.logger.Error("reload profile failed", "profile_id", profileID, "error", err)
+			}
+			continue
+		}
+		configs[profileID] = config
+	}
+
+	return configs, removed
 }
 
 // GetQuotaStatus 获取所有 profile 的配额状态
@@ -176,17 +803,109 @@ func (qm *QuotaManager) GetQuotaStatus() map[string]interface{} {
 	status := make(map[string]interface{})
 	profiles := make(map[string]interface{})
 
+	now := qm.now()
 	for profileID, profileMgr := range qm.profiles {
-		profileStatus := map[string]interface{}{
-			"total_quota": profileMgr.totalQuota,
-			"used_quota":  profileMgr.usedQuota,
-			"available":   profileMgr.totalQuota - profileMgr.usedQuota,
-			"nodes":       make(map[string]interface{}),
+		profiles[fmt.Sprintf("profile_%d", profileID)] = qm.profileStatusLocked(profileMgr, now)
+	}
+
+	status["profiles"] = profiles
+	return status
+}
+
+// LoadQuotaStatus 获取所有 profile 的配额状态，包括 provider 中尚未加载的 profile
+// 读取 provider 失败时返回错误
+func (qm *QuotaManager) LoadQuotaStatus() (map[string]interface{}, error) {
+	profileIDs, err := qm.provider.ListProfiles()
+	if err != nil {
+		return nil, fmt.Errorf("list profiles failed: %w", err)
+	}
+
+	status := qm.GetQuotaStatus()
+	profiles := status["profiles"].(map[string]interface{})
+	for _, profileID := range profileIDs {
+		key := fmt.Sprintf("profile_%d", profileID)
+		if _, loaded := profiles[key]; loaded {
+			continue
+		}
+		config, err := qm.provider.GetProfile(profileID)
+		if err != nil {
+			return nil, fmt.Errorf("get profile %d failed: %w", profileID, err)
+		}
+		// 尚未加载的 profile 还没有任何用量
+		profiles[key] = map[string]interface{}{
+			"total_quota": config.TotalQuota,
+			"used_quota":  int64(0),
+			"available":   config.TotalQuota,
 		}
+	}
+	return status, nil
+}
+
+// GetProfilesStatus 只获取指定 profile 的配额状态
+// 未知（或尚未加载）的 profile 不出现在 profiles 中，而是列在 unknown 里
+func (qm *QuotaManager) GetProfilesStatus(ids []int) map[string]interface{} {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	status := make(map[string]interface{})
+	profiles := make(map[string]interface{})
+	unknown := make([]int, 0)
 
-		profiles[fmt.Sprintf("profile_%d", profileID)] = profileStatus
+	now := qm.now()
+	for _, profileID := range ids {
+		profileMgr, exists := qm.profiles[profileID]
+		if !exists {
+			unknown = append(unknown, profileID)
+			continue
+		}
+		profiles[fmt.Sprintf("profile_%d", profileID)] = qm.profileStatusLocked(profileMgr, now)
 	}
 
 	status["profiles"] = profiles
+	status["unknown"] = unknown
 	return status
 }
+
+// ungroupedLabel 缺少分组标签的 profile 所在的分组
+const ungroupedLabel = "ungrouped"
+
+// GetGroupedStatus 获取所有 profile 的配额状态，按标签 label 的取值分组
+// 没有该标签的 profile 放在 "ungrouped" 分组中
+func (qm *QuotaManager) GetGroupedStatus(label string) map[string]interface{} {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	groups := make(map[string]map[string]interface{})
+	now := qm.now()
+	for profileID, profileMgr := range qm.profiles {
+		group, exists := profileMgr.config.Labels[label]
+		if !exists {
+			group = ungroupedLabel
+		}
+		if groups[group] == nil {
+			groups[group] = make(map[string]interface{})
+		}
+		groups[group][fmt.Sprintf("profile_%d", profileID)] = qm.profileStatusLocked(profileMgr, now)
+	}
+
+	return map[string]interface{}{
+		"group_by": label,
+		"groups":   groups,
+	}
+}
+
+// profileStatusLocked 单个 profile 的状态，调用方需持有锁
+func (qm *QuotaManager) profileStatusLocked(profileMgr *ProfileManager, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"total_quota": profileMgr.totalQuota,
+		"boost":       profileMgr.boostAt(now),
+		"used_quota":  profileMgr.usedQuota,
+		"available":   profileMgr.effectiveQuota(now) - profileMgr.usedQuota,
+		"nodes":       qm.nodeStatusLocked(profileMgr, now),
+		"fairness":    qm.fairnessLocked(profileMgr),
+		// 上一个完整窗口的公平性，当前窗口刚开始时更有参考价值
+		"last_window_fairness": profileMgr.fairness,
+		"effective_rate_limit": profileMgr.effectiveRateLimit(),
+		"requests":             profileMgr.requestCounts(),
+	}
+}
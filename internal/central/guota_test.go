@@ -0,0 +1,361 @@
+package central
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// withClock 使用指定时钟，在刷新协程启动前生效
+func withClock(clock *fakeClock) QuotaOption {
+	return func(qm *QuotaManager) {
+		qm.now = clock.Now
+		qm.lastRefresh = clock.Now()
+	}
+}
+
+// testRefreshInterval 测试使用的刷新周期，足够长使周期刷新不会在测试期间触发，刷新由测试直接调用 refresh
+const testRefreshInterval = time.Hour
+
+// discardLogger 丢弃所有输出的日志，用于预期会出错的测试
+func discardLogger() Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// quotaRequest 构造单个 profile 的配额请求
+func quotaRequest(nodeID string, profileID int, required int64) common.QuotaRequest {
+	return common.QuotaRequest{
+		NodeID: nodeID,
+		Quotas: []common.ProfileQuota{{ProfileID: profileID, Required: required}},
+	}
+}
+
+// granted 返回单个 profile 请求的分配量
+func granted(t *testing.T, resp common.QuotaResponse) int64 {
+	t.Helper()
+	if len(resp.Quotas) != 1 {
+		t.Fatalf("got %d quota responses, want 1", len(resp.Quotas))
+	}
+	return resp.Quotas[0].Granted
+}
+
+func TestCheckQuotaGrantsUntilExhausted(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 60))); got != 60 {
+		t.Fatalf("first grant = %d, want 60", got)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 60))); got != 40 {
+		t.Fatalf("second grant = %d, want the remaining 40", got)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 1))); got != 0 {
+		t.Fatalf("grant after exhaustion = %d, want 0", got)
+	}
+
+	qm.refresh()
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 100))); got != 100 {
+		t.Fatalf("grant after refresh = %d, want 100", got)
+	}
+}
+
+func TestRefreshFuncUpdatesBudget(t *testing.T) {
+	var budget atomic.Int64
+	budget.Store(100)
+	var resetUsage atomic.Bool
+	refreshFunc := func(int) (int64, bool, error) {
+		return budget.Load(), resetUsage.Load(), nil
+	}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100, RefreshFunc: refreshFunc}})
+	qm.CheckQuota(quotaRequest("node-1", 1, 80))
+
+	// 预算提高但不清零用量：已用的 80 跨刷新保留
+	budget.Store(150)
+	qm.refresh()
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 100))); got != 70 {
+		t.Fatalf("granted = %d after budget rose to 150 without reset, want 70", got)
+	}
+
+	// 要求清零时用量归零，按新预算分配
+	budget.Store(200)
+	resetUsage.Store(true)
+	qm.refresh()
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 500))); got != 200 {
+		t.Fatalf("granted = %d after budget 200 with reset, want 200", got)
+	}
+}
+
+func TestRefreshFuncErrorKeepsPriorBudget(t *testing.T) {
+	var fail atomic.Bool
+	refreshFunc := func(int) (int64, bool, error) {
+		if fail.Load() {
+			return 0, false, errors.New("billing unavailable")
+		}
+		return 100, true, nil
+	}
+	logger := &capturingLogger{}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 10, RefreshFunc: refreshFunc}}, WithLogger(logger))
+	qm.refresh()
+	qm.CheckQuota(quotaRequest("node-1", 1, 30))
+
+	fail.Store(true)
+	qm.refresh()
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 500))); got != 70 {
+		t.Errorf("granted = %d after a failed budget refresh, want the prior budget's remaining 70", got)
+	}
+	if len(logger.find("ERROR", "refresh budget failed")) != 1 {
+		t.Error("failed budget refresh was not logged")
+	}
+}
+
+func TestMinAcceptableGrant(t *testing.T) {
+	minRequest := func(required, minAcceptable int64) common.QuotaRequest {
+		return common.QuotaRequest{
+			NodeID: "node-1",
+			Quotas: []common.ProfileQuota{{ProfileID: 1, Required: required, MinAcceptable: minAcceptable}},
+		}
+	}
+
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	qm.CheckQuota(quotaRequest("node-1", 1, 70))
+	if got := granted(t, qm.CheckQuota(minRequest(80, 50))); got != 0 {
+		t.Errorf("granted = %d with 30 available and min 50, want 0", got)
+	}
+	if used := qm.profiles[1].usedQuota; used != 70 {
+		t.Errorf("used = %d after a refused request, want it unchanged at 70", used)
+	}
+
+	qm = NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	qm.CheckQuota(quotaRequest("node-1", 1, 40))
+	if got := granted(t, qm.CheckQuota(minRequest(80, 50))); got != 60 {
+		t.Errorf("granted = %d with 60 available and min 50, want all 60", got)
+	}
+
+	qm = NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	if got := granted(t, qm.CheckQuota(minRequest(55, 50))); got != 55 {
+		t.Errorf("granted = %d with 100 available, want the required 55", got)
+	}
+}
+
+// 节点报告的应急消耗计入 profile 用量，即使超过剩余配额
+func TestCheckQuotaChargesReportedConsumption(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+
+	req := quotaRequest("node-1", 1, 10)
+	req.Consumed = map[int]int64{1: 30, 99: 5}
+	if got := granted(t, qm.CheckQuota(req)); got != 10 {
+		t.Fatalf("granted = %d, want 10", got)
+	}
+
+	pm := qm.profiles[1]
+	if pm.usedQuota != 40 || pm.nodeUsed["node-1"] != 40 {
+		t.Fatalf("usedQuota = %d, nodeUsed = %d, want 40 and 40", pm.usedQuota, pm.nodeUsed["node-1"])
+	}
+
+	req = quotaRequest("node-1", 1, 10)
+	req.Consumed = map[int]int64{1: 80}
+	if got := granted(t, qm.CheckQuota(req)); got != 0 {
+		t.Fatalf("granted after overdraw = %d, want 0", got)
+	}
+	if pm.usedQuota != 120 {
+		t.Fatalf("usedQuota = %d, want the full 120 charged", pm.usedQuota)
+	}
+}
+
+func TestValidatorRejectionDoesNotDebitQuota(t *testing.T) {
+	errBlocked := errors.New("tenant blocked")
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{
+		1: {
+			TotalQuota: 100,
+			Validator: func(req common.QuotaRequest, _ common.ProfileQuota) error {
+				if req.NodeID == "blocked" {
+					return errBlocked
+				}
+				return nil
+			},
+		},
+	})
+
+	resp := qm.CheckQuota(quotaRequest("blocked", 1, 10))
+	if got := granted(t, resp); got != 0 {
+		t.Fatalf("granted = %d, want 0", got)
+	}
+	if reason := resp.Quotas[0].Reason; reason != errBlocked.Error() {
+		t.Fatalf("reason = %q, want %q", reason, errBlocked.Error())
+	}
+	if used := qm.profiles[1].usedQuota; used != 0 {
+		t.Fatalf("usedQuota = %d after rejection, want 0", used)
+	}
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 100))); got != 100 {
+		t.Fatalf("granted to an accepted node = %d, want the full 100", got)
+	}
+}
+
+// 持有锁期间到达的请求在拿到锁时已超过截止时间，直接丢弃且不扣减配额
+func TestTightDeadlineShedUnderHeldLock(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+
+	qm.mu.Lock()
+	done := make(chan common.QuotaResponse, 1)
+	go func() {
+		req := quotaRequest("node-1", 1, 10)
+		req.Deadline = time.Now().Add(20 * time.Millisecond)
+		done <- qm.CheckQuota(req)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	released := time.Now()
+	qm.mu.Unlock()
+
+	resp := <-done
+	if !resp.DeadlineExceeded {
+		t.Fatalf("response = %+v, want DeadlineExceeded", resp)
+	}
+	if elapsed := time.Since(released); elapsed > 20*time.Millisecond {
+		t.Errorf("shed took %v after the lock was released", elapsed)
+	}
+	if used := qm.profiles[1].usedQuota; used != 0 {
+		t.Fatalf("usedQuota = %d after shedding, want 0", used)
+	}
+
+	req := quotaRequest("node-1", 1, 10)
+	req.Deadline = time.Now().Add(time.Second)
+	if got := granted(t, qm.CheckQuota(req)); got != 10 {
+		t.Fatalf("granted with a loose deadline = %d, want 10", got)
+	}
+}
+
+// 同时等待锁的请求数超过阈值时响应带有繁忙提示，空闲时没有
+func TestBusyHintUnderConcurrency(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, WithBusyThreshold(2))
+
+	const concurrent = 5
+	qm.mu.Lock()
+	resps := make(chan common.QuotaResponse, concurrent)
+	for i := 0; i < concurrent; i++ {
+		go func() { resps <- qm.CheckQuota(quotaRequest("node-1", 1, 1)) }()
+	}
+	for qm.inflight.Load() < concurrent {
+		time.Sleep(time.Millisecond)
+	}
+	qm.mu.Unlock()
+
+	var busy int
+	for i := 0; i < concurrent; i++ {
+		if resp := <-resps; resp.Busy {
+			busy++
+			if granted(t, resp) != 1 {
+				t.Fatalf("busy response = %+v, want the grant still served", resp)
+			}
+		}
+	}
+	if busy != concurrent-2 {
+		t.Fatalf("%d busy responses, want %d above the threshold", busy, concurrent-2)
+	}
+
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); resp.Busy {
+		t.Fatal("lone request marked busy")
+	}
+}
+
+func TestSetRefreshIntervalChangesCadence(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	events, cancel := qm.SubscribeRefreshEvents()
+	defer cancel()
+
+	for _, interval := range []time.Duration{0, 500 * time.Millisecond, 25 * time.Hour} {
+		if err := qm.SetRefreshInterval(interval); !errors.Is(err, common.ErrInvalidRequest) {
+			t.Fatalf("SetRefreshInterval(%v) error = %v, want ErrInvalidRequest", interval, err)
+		}
+	}
+	if got := qm.RefreshInterval(); got != testRefreshInterval {
+		t.Fatalf("interval after rejected updates = %v, want %v", got, testRefreshInterval)
+	}
+
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 100)))
+	if err := qm.SetRefreshInterval(minRefreshInterval); err != nil {
+		t.Fatalf("SetRefreshInterval: %v", err)
+	}
+
+	// 原周期为一小时，缩短后应在新周期内完成一次刷新并清零用量
+	select {
+	case <-events:
+	case <-time.After(3 * minRefreshInterval):
+		t.Fatal("no refresh within the shortened interval")
+	}
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 100)); granted(t, resp) != 100 {
+		t.Fatalf("after refresh = %+v, want usage reset", resp)
+	}
+}
+
+func TestCheckQuotaDistinguishesNotFoundFromExhausted(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 10}, 2: {TotalQuota: 0}}, WithLogger(discardLogger()))
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 10)))
+
+	for _, profileID := range []int{1, 2} {
+		q := qm.CheckQuota(quotaRequest("node-1", profileID, 5)).Quotas[0]
+		if q.Granted != 0 || q.NotFound {
+			t.Errorf("profile %d without quota = %+v, want no grant and found", profileID, q)
+		}
+	}
+
+	q := qm.CheckQuota(quotaRequest("node-1", 3, 5)).Quotas[0]
+	if !q.NotFound || q.Granted != 0 || q.Reason != common.ErrProfileNotFound.Error() {
+		t.Fatalf("unknown profile = %+v, want not found", q)
+	}
+}
+
+func TestRequestCountersAccumulateAcrossRefreshes(t *testing.T) {
+	clock := newFakeClock()
+	config := fixedWindow(3, time.Minute)
+	config.TotalQuota = 5
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock), WithLogger(discardLogger()))
+
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 2)))
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 3)))
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 1))); got != 0 {
+		t.Fatalf("granted %d from an exhausted profile", got)
+	}
+
+	// 计数是累计值，刷新不清零
+	clock.Advance(testRefreshInterval)
+	qm.refresh()
+	for i := 0; i < 3; i++ {
+		granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 1)))
+	}
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+		t.Fatal("fourth request in the window admitted, want rate limited")
+	}
+
+	status := qm.GetQuotaStatus()["profiles"].(map[string]interface{})["profile_1"].(map[string]interface{})
+	want := RequestCounts{Accepted: 5, Rejected: 1, RateLimited: 1}
+	if got := status["requests"]; got != want {
+		t.Fatalf("request counts = %+v, want %+v", got, want)
+	}
+}
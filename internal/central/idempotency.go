@@ -0,0 +1,128 @@
+package central
+
+import (
+	"container/list"
+	"sync"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// IdempotencyConfig 配额请求去重缓存配置
+// 同一节点重复发送相同 RequestID 的请求（例如超时重试）时直接返回首次的响应，不重复扣减配额
+type IdempotencyConfig struct {
+	TTL             time.Duration // 响应缓存时间，0 表示不启用去重
+	MaxEntries      int           // 缓存条目上限，超出时淘汰最久未使用的条目；0 表示不限制
+	CompactInterval time.Duration // 后台清理过期条目的周期，默认等于 TTL
+}
+
+// WithIdempotency 启用基于 RequestID 的请求去重
+func WithIdempotency(config IdempotencyConfig) QuotaOption {
+	return func(qm *QuotaManager) {
+		if config.TTL <= 0 {
+			return
+		}
+		if config.CompactInterval <= 0 {
+			config.CompactInterval = config.TTL
+		}
+		qm.idempotency = newIdempotencyCache(config)
+	}
+}
+
+// idempotencyEntry 缓存的响应
+type idempotencyEntry struct {
+	key       string
+	resp      common.QuotaResponse
+	expiresAt time.Time
+}
+
+// idempotencyCache 带 TTL 和容量上限的 LRU 响应缓存
+// 使用独立的锁，后台清理不会阻塞配额检查
+type idempotencyCache struct {
+	config IdempotencyConfig
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // 前端为最近使用的条目
+}
+
+func newIdempotencyCache(config IdempotencyConfig) *idempotencyCache {
+	return &idempotencyCache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// idempotencyKey 去重键，RequestID 只在同一节点内唯一
+func idempotencyKey(req common.QuotaRequest) string {
+	return req.NodeID + "/" + req.RequestID
+}
+
+// get 返回未过期的缓存响应
+func (c *idempotencyCache) get(key string, now time.Time) (common.QuotaResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		return common.QuotaResponse{}, false
+	}
+	entry := elem.Value.(*idempotencyEntry)
+	if now.After(entry.expiresAt) {
+		c.removeLocked(elem)
+		return common.QuotaResponse{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.resp, true
+}
+
+// put 缓存响应，超过容量上限时淘汰最久未使用的条目
+func (c *idempotencyCache) put(key string, resp common.QuotaResponse, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		c.removeLocked(elem)
+	}
+	c.entries[key] = c.order.PushFront(&idempotencyEntry{
+		key:       key,
+		resp:      resp,
+		expiresAt: now.Add(c.config.TTL),
+	})
+
+	for c.config.MaxEntries > 0 && c.order.Len() > c.config.MaxEntries {
+		c.removeLocked(c.order.Back())
+	}
+}
+
+// compact 清理所有过期条目，返回清理后的条目数
+func (c *idempotencyCache) compact(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.order.Back(); elem != nil; {
+		prev := elem.Prev()
+		if now.After(elem.Value.(*idempotencyEntry).expiresAt) {
+			c.removeLocked(elem)
+		}
+		elem = prev
+	}
+	return c.order.Len()
+}
+
+func (c *idempotencyCache) removeLocked(elem *list.Element) {
+	delete(c.entries, elem.Value.(*idempotencyEntry).key)
+	c.order.Remove(elem)
+}
+
+// startIdempotencyCompactor 周期性清理过期的去重条目并更新缓存大小指标
+// 仅靠读取时的过期检查无法回收不再被访问的条目
+func (qm *QuotaManager) startIdempotencyCompactor() {
+	ticker := time.NewTicker(qm.idempotency.config.CompactInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		size := qm.idempotency.compact(qm.now())
+		qm.metrics.SetGauge(metricIdempotencyCacheSize, nil, float64(size))
+	}
+}
@@ -0,0 +1,67 @@
+package central
+
+import (
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestIdempotencyCompactSweepsExpiredEntries(t *testing.T) {
+	cache := newIdempotencyCache(IdempotencyConfig{TTL: time.Minute})
+	start := newFakeClock().Now()
+
+	cache.put("node-1/a", common.QuotaResponse{RequestID: "a"}, start)
+	cache.put("node-1/b", common.QuotaResponse{RequestID: "b"}, start.Add(30*time.Second))
+
+	if size := cache.compact(start.Add(45 * time.Second)); size != 2 {
+		t.Fatalf("size before expiry = %d, want 2", size)
+	}
+	if size := cache.compact(start.Add(75 * time.Second)); size != 1 {
+		t.Fatalf("size after the first entry expired = %d, want 1", size)
+	}
+	if _, exists := cache.entries["node-1/a"]; exists {
+		t.Fatal("expired entry still cached after compaction")
+	}
+	if _, ok := cache.get("node-1/b", start.Add(75*time.Second)); !ok {
+		t.Fatal("unexpired entry swept")
+	}
+}
+
+func TestIdempotencyMaxEntriesEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newIdempotencyCache(IdempotencyConfig{TTL: time.Minute, MaxEntries: 2})
+	now := newFakeClock().Now()
+
+	cache.put("node-1/a", common.QuotaResponse{RequestID: "a"}, now)
+	cache.put("node-1/b", common.QuotaResponse{RequestID: "b"}, now)
+	cache.get("node-1/a", now)
+	cache.put("node-1/c", common.QuotaResponse{RequestID: "c"}, now)
+
+	if cache.order.Len() != 2 {
+		t.Fatalf("size = %d, want the cap of 2", cache.order.Len())
+	}
+	if _, ok := cache.get("node-1/b", now); ok {
+		t.Fatal("least recently used entry b kept past the cap")
+	}
+	for _, key := range []string{"node-1/a", "node-1/c"} {
+		if _, ok := cache.get(key, now); !ok {
+			t.Fatalf("entry %s evicted, want kept", key)
+		}
+	}
+}
+
+// 重试的请求直接返回首次的响应，不重复扣减配额
+func TestIdempotentRetryDoesNotDebitTwice(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}},
+		WithIdempotency(IdempotencyConfig{TTL: time.Minute}))
+
+	req := quotaRequest("node-1", 1, 30)
+	req.RequestID = "retry-1"
+	for i := 0; i < 3; i++ {
+		if got := granted(t, qm.CheckQuota(req)); got != 30 {
+			t.Fatalf("attempt %d granted %d, want 30", i, got)
+		}
+	}
+	if used := qm.profiles[1].usedQuota; used != 30 {
+		t.Fatalf("usedQuota = %d after retries, want 30", used)
+	}
+}
@@ -0,0 +1,40 @@
+package central
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithInvariantPanics 违反配额不变量时直接 panic 而不是记录错误日志，用于测试中尽早暴露记账错误
+// 默认只记录日志；使用 -tags quotadebug 构建时默认 panic
+func WithInvariantPanics(panics bool) QuotaOption {
+	return func(qm *QuotaManager) {
+		qm.invariantPanics = panics
+	}
+}
+
+// checkGrantInvariantLocked 校验一次分配之后 profile 的已用配额没有超过有效预算，违反时按配置 panic 或记录日志
+// usedBefore 为分配前的已用配额；调用方必须持有写锁
+func (qm *QuotaManager) checkGrantInvariantLocked(pm *ProfileManager, now time.Time, usedBefore, granted int64) {
+	err := pm.grantInvariantError(now, usedBefore, granted)
+	if err == nil {
+		return
+	}
+	if qm.invariantPanics {
+		panic("quota invariant violated: " + err.Error())
+	}
+	qm.logger.Error("quota invariant violated", "profile_id", pm.profileID, "error", err)
+}
+
+// grantInvariantError 返回一次分配违反的配额不变量，没有违反时返回 nil
+// 预算被调低导致的既有超额不视为违反
+func (pm *ProfileManager) grantInvariantError(now time.Time, usedBefore, granted int64) error {
+	if granted < 0 {
+		return fmt.Errorf("profile %d granted negative quota %d", pm.profileID, granted)
+	}
+	if pm.usedQuota > usedBefore && pm.usedQuota > pm.effectiveQuota(now) {
+		return fmt.Errorf("profile %d over-granted: used %d exceeds effective quota %d",
+			pm.profileID, pm.usedQuota, pm.effectiveQuota(now))
+	}
+	return nil
+}
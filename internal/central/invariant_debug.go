@@ -0,0 +1,6 @@
+//go:build quotadebug
+
+package central
+
+// defaultInvariantPanics 使用 -tags quotadebug 构建时，违反配额不变量默认直接 panic
+const defaultInvariantPanics = true
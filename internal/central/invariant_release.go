@@ -0,0 +1,6 @@
+//go:build !quotadebug
+
+package central
+
+// defaultInvariantPanics 违反配额不变量时默认只记录日志，测试可通过 WithInvariantPanics 启用 panic
+const defaultInvariantPanics = false
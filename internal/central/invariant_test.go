@@ -0,0 +1,56 @@
+package central
+
+import (
+	"strings"
+	"testing"
+)
+
+// overGrant 模拟有缺陷的分配：不检查剩余配额直接记账
+func overGrant(qm *QuotaManager, profileID int, amount int64) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	profileMgr := qm.profiles[profileID]
+	usedBefore := profileMgr.usedQuota
+	profileMgr.usedQuota += amount
+	qm.checkGrantInvariantLocked(profileMgr, qm.now(), usedBefore, amount)
+}
+
+func TestBuggyAllocationTripsInvariant(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, WithInvariantPanics(true))
+	qm.CheckQuota(quotaRequest("node-1", 1, 90))
+
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			t.Fatal("over-grant did not trip the invariant")
+		}
+		if message, _ := recovered.(string); !strings.Contains(message, "over-granted") {
+			t.Errorf("panic = %v, want an over-grant violation", recovered)
+		}
+	}()
+	overGrant(qm, 1, 20)
+}
+
+func TestInvariantViolationLoggedWithoutPanics(t *testing.T) {
+	logger := &capturingLogger{}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, WithLogger(logger), WithInvariantPanics(false))
+
+	overGrant(qm, 1, 150)
+
+	entries := logger.find("ERROR", "quota invariant violated")
+	if len(entries) != 1 || entries[0].args["profile_id"] != 1 {
+		t.Fatalf("logged %+v, want one violation for profile 1", entries)
+	}
+}
+
+func TestCorrectAllocationsKeepInvariant(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, WithInvariantPanics(true))
+
+	for i := 0; i < 20; i++ {
+		qm.CheckQuota(quotaRequest("node-1", 1, 7))
+	}
+	if used := qm.profiles[1].usedQuota; used != 100 {
+		t.Errorf("used = %d, want exactly the total 100", used)
+	}
+}
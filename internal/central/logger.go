@@ -0,0 +1,61 @@
+package central
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// Logger 分级的结构化日志接口，args 为交替的键和值（如 "profile_id", 1）
+// *slog.Logger 直接实现该接口，默认使用 slog.Default()
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// *slog.Logger 实现 Logger
+var _ Logger = (*slog.Logger)(nil)
+
+// WithLogger 设置配额管理器的日志输出，为空时使用 slog.Default()
+func WithLogger(logger Logger) QuotaOption {
+	return func(qm *QuotaManager) {
+		if logger != nil {
+			qm.logger = logger
+		}
+	}
+}
+
+// loggerSetter 由配额管理器设置日志输出的组件，如 MetricsSink 和 QuotaStore 的实现
+type loggerSetter interface {
+	setLogger(logger Logger)
+}
+
+// propagateLogger 把配额管理器的日志输出设置给指标输出和用量存储
+// 多个管理器共享同一个组件时，组件使用最后设置的日志输出
+func (qm *QuotaManager) propagateLogger() {
+	for _, component := range []any{qm.metrics, qm.store} {
+		if setter, ok := component.(loggerSetter); ok {
+			setter.setLogger(qm.logger)
+		}
+	}
+}
+
+// swappableLogger 可以在使用中替换的日志输出，零值使用 slog.Default()
+// 用于在后台 goroutine 中记录日志、构造后才由配额管理器设置日志输出的组件
+type swappableLogger struct {
+	current atomic.Pointer[Logger]
+}
+
+func (l *swappableLogger) load() Logger {
+	if logger := l.current.Load(); logger != nil {
+		return *logger
+	}
+	return slog.Default()
+}
+
+func (l *swappableLogger) store(logger Logger) {
+	if logger != nil {
+		l.current.Store(&logger)
+	}
+}
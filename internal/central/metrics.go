@@ -0,0 +1,276 @@
+package central
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 配额指标名称
+const (
+	metricQuotaChecks          = "throttle_quota_checks_total"
+	metricQuotaGrants          = "throttle_quota_grants_total"
+	metricQuotaDenials         = "throttle_quota_denials_total"
+	metricProfileUsed          = "throttle_profile_used_quota"
+	metricProfileAvailable     = "throttle_profile_available_quota"
+	metricCheckDuration        = "throttle_quota_check_duration_seconds"
+	metricProfileFairness      = "throttle_profile_fairness_index"
+	metricQuotaShed            = "throttle_quota_checks_shed_total"
+	metricDimensionEvictions   = "throttle_rate_dimension_evictions_total"
+	metricIdempotencyCacheSize = "throttle_idempotency_cache_entries"
+	metricRefreshes            = "throttle_refreshes_total"
+	metricRefreshDuration      = "throttle_refresh_duration_seconds"
+	metricWindowConsumed       = "throttle_profile_window_consumed_quota"
+	metricQuotaReclaimed       = "throttle_profile_reclaimed_quota_total"
+)
+
+// 拒绝原因，作为 reason 标签
+const (
+	denyReasonExhausted    = "exhausted"
+	denyReasonRateLimited  = "rate_limited"
+	denyReasonNotFound     = "not_found"
+	denyReasonInvalidToken = "invalid_token"
+	denyReasonRejected     = "rejected"
+	denyReasonFrozen       = "frozen"
+)
+
+// metricHelp 指标说明，Prometheus 注册时使用
+var metricHelp = map[string]string{
+	metricQuotaChecks:          "Total number of quota check requests.",
+	metricQuotaGrants:          "Total number of profile quota requests granted a non-zero amount.",
+	metricQuotaDenials:         "Total number of profile quota requests denied, by reason.",
+	metricProfileUsed:          "Quota used by the profile in the current window.",
+	metricProfileAvailable:     "Quota still available to the profile in the current window.",
+	metricCheckDuration:        "Time spent processing a quota check.",
+	metricProfileFairness:      "Jain's fairness index of the profile's allocation across active nodes.",
+	metricQuotaShed:            "Total number of quota checks shed because they could not finish before the client deadline.",
+	metricDimensionEvictions:   "Total number of idle rate sub-buckets evicted because the profile reached MaxDimensions.",
+	metricIdempotencyCacheSize: "Number of entries in the quota request idempotency cache.",
+	metricRefreshes:            "Total number of periodic quota refreshes.",
+	metricRefreshDuration:      "Time spent performing a periodic quota refresh.",
+	metricWindowConsumed:       "Quota consumed by the profile in the last completed refresh window.",
+	metricQuotaReclaimed:       "Total quota reclaimed at refresh from offline nodes and nodes that did not use their share.",
+}
+
+// MetricsSink 指标输出接口，使配额指标与具体监控后端解耦
+// 实现必须是并发安全的，且不应阻塞（调用时可能持有配额管理器的锁）
+type MetricsSink interface {
+	IncrCounter(name string, labels map[string]string, delta float64)
+	SetGauge(name string, labels map[string]string, value float64)
+	ObserveHistogram(name string, labels map[string]string, value float64)
+}
+
+// nopSink 不输出任何指标，是默认实现
+type nopSink struct{}
+
+func (nopSink) IncrCounter(string, map[string]string, float64)      {}
+func (nopSink) SetGauge(string, map[string]string, float64)         {}
+func (nopSink) ObserveHistogram(string, map[string]string, float64) {}
+
+// profileLabels profile 维度的标签
+func profileLabels(profileID int) map[string]string {
+	return map[string]string{"profile": strconv.Itoa(profileID)}
+}
+
+// sortedLabelNames 返回排序后的标签名
+func sortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PrometheusSink 将指标注册到 Prometheus
+// 每个指标在第一次使用时按当时的标签名创建，之后同名指标必须使用相同的标签名
+type PrometheusSink struct {
+	registerer prometheus.Registerer
+	gatherer   prometheus.Gatherer
+
+	mu         sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]*prometheus.GaugeVec
+	histograms map[string]*prometheus.HistogramVec
+	logger     swappableLogger
+}
+
+// NewPrometheusSink 创建 Prometheus 指标输出，registerer 为空时使用默认注册表
+// registerer 同时实现 prometheus.Gatherer（如 *prometheus.Registry）时 Handler 从它导出指标，否则从默认注册表导出
+func NewPrometheusSink(registerer prometheus.Registerer) *PrometheusSink {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	gatherer, ok := registerer.(prometheus.Gatherer)
+	if !ok {
+		gatherer = prometheus.DefaultGatherer
+	}
+	return &PrometheusSink{
+		registerer: registerer,
+		gatherer:   gatherer,
+		counters:   make(map[string]*prometheus.CounterVec),
+		gauges:     make(map[string]*prometheus.GaugeVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+	}
+}
+
+// Handler 以 Prometheus 文本格式导出指标的 HTTP 处理器
+func (s *PrometheusSink) Handler() http.Handler {
+	return promhttp.HandlerFor(s.gatherer, promhttp.HandlerOpts{})
+}
+
+// IncrCounter 增加计数器
+func (s *PrometheusSink) IncrCounter(name string, labels map[string]string, delta float64) {
+	s.mu.Lock()
+	vec, exists := s.counters[name]
+	if !exists {
+		vec = prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: metricHelp[name]}, sortedLabelNames(labels))
+		s.register(name, vec)
+		s.counters[name] = vec
+	}
+	s.mu.Unlock()
+
+	if counter, err := vec.GetMetricWith(labels); err == nil {
+		counter.Add(delta)
+	}
+}
+
+// SetGauge 设置仪表值
+func (s *PrometheusSink) SetGauge(name string, labels map[string]string, value float64) {
+	s.mu.Lock()
+	vec, exists := s.gauges[name]
+	if !exists {
+		vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: metricHelp[name]}, sortedLabelNames(labels))
+		s.register(name, vec)
+		s.gauges[name] = vec
+	}
+	s.mu.Unlock()
+
+	if gauge, err := vec.GetMetricWith(labels); err == nil {
+		gauge.Set(value)
+	}
+}
+
+// ObserveHistogram 记录直方图观测值
+func (s *PrometheusSink) ObserveHistogram(name string, labels map[string]string, value float64) {
+	s.mu.Lock()
+	vec, exists := s.histograms[name]
+	if !exists {
+		vec = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: metricHelp[name]}, sortedLabelNames(labels))
+		s.register(name, vec)
+		s.histograms[name] = vec
+	}
+	s.mu.Unlock()
+
+	if histogram, err := vec.GetMetricWith(labels); err == nil {
+		histogram.Observe(value)
+	}
+}
+
+// register 注册指标，失败时记录日志（指标仍可使用，只是不会被导出）
+func (s *PrometheusSink) register(name string, collector prometheus.Collector) {
+	if err := s.registerer.Register(collector); err != nil {
+		s.logger.load().Error("register metric failed", "metric", name, "error", err)
+	}
+}
+
+func (s *PrometheusSink) setLogger(logger Logger) {
+	s.logger.store(logger)
+}
+
+// StatsDSink 通过 UDP 将指标推送到 StatsD，标签以 DogStatsD 格式附加
+// 发送在后台进行，缓冲区满时丢弃指标，不会阻塞调用方
+type StatsDSink struct {
+	conn    net.Conn
+	prefix  string
+	packets chan string
+	done    chan struct{}
+	logger  swappableLogger
+}
+
+// NewStatsDSink 创建 StatsD 指标输出，addr 形如 "127.0.0.1:8125"
+func NewStatsDSink(addr, prefix string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial statsd failed: %w", err)
+	}
+
+	s := &StatsDSink{
+		conn:    conn,
+		prefix:  prefix,
+		packets: make(chan string, 1024),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+
+	return s, nil
+}
+
+// IncrCounter 增加计数器
+func (s *StatsDSink) IncrCounter(name string, labels map[string]string, delta float64) {
+	s.send(name, labels, delta, "c")
+}
+
+// SetGauge 设置仪表值
+func (s *StatsDSink) SetGauge(name string, labels map[string]string, value float64) {
+	s.send(name, labels, value, "g")
+}
+
+// ObserveHistogram 记录直方图观测值
+func (s *StatsDSink) ObserveHistogram(name string, labels map[string]string, value float64) {
+	s.send(name, labels, value, "h")
+}
+
+// Close 停止发送并关闭连接，关闭后不能再使用
+func (s *StatsDSink) Close() error {
+	close(s.packets)
+	<-s.done
+	return s.conn.Close()
+}
+
+// send 格式化指标并放入发送队列
+func (s *StatsDSink) send(name string, labels map[string]string, value float64, kind string) {
+	var b strings.Builder
+	b.WriteString(s.prefix)
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(kind)
+	for i, label := range sortedLabelNames(labels) {
+		if i == 0 {
+			b.WriteString("|#")
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(label)
+		b.WriteByte(':')
+		b.WriteString(labels[label])
+	}
+
+	select {
+	case s.packets <- b.String():
+	default:
+	}
+}
+
+// run 后台发送指标
+func (s *StatsDSink) run() {
+	defer close(s.done)
+	for packet := range s.packets {
+		if _, err := s.conn.Write([]byte(packet)); err != nil {
+			s.logger.load().Error("send statsd metric failed", "error", err)
+		}
+	}
+}
+
+func (s *StatsDSink) setLogger(logger Logger) {
+	s.logger.store(logger)
+}
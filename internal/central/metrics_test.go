@@ -0,0 +1,182 @@
+package central
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricRecord 一次被捕获的指标调用
+type metricRecord struct {
+	kind   string
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// capturingSink 把指标记录在内存中的 MetricsSink
+type capturingSink struct {
+	mu      sync.Mutex
+	records []metricRecord
+}
+
+func (s *capturingSink) IncrCounter(name string, labels map[string]string, delta float64) {
+	s.record("counter", name, labels, delta)
+}
+
+func (s *capturingSink) SetGauge(name string, labels map[string]string, value float64) {
+	s.record("gauge", name, labels, value)
+}
+
+func (s *capturingSink) ObserveHistogram(name string, labels map[string]string, value float64) {
+	s.record("histogram", name, labels, value)
+}
+
+func (s *capturingSink) record(kind, name string, labels map[string]string, value float64) {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, metricRecord{kind: kind, name: name, labels: copied, value: value})
+}
+
+// counter 返回标签包含 labels 的计数器增量之和
+func (s *capturingSink) counter(name string, labels map[string]string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total float64
+	for _, r := range s.records {
+		if r.kind == "counter" && r.name == name && hasLabels(r.labels, labels) {
+			total += r.value
+		}
+	}
+	return total
+}
+
+// gauge 返回标签包含 labels 的仪表最后一次的值
+func (s *capturingSink) gauge(name string, labels map[string]string) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.records) - 1; i >= 0; i-- {
+		if r := s.records[i]; r.kind == "gauge" && r.name == name && hasLabels(r.labels, labels) {
+			return r.value, true
+		}
+	}
+	return 0, false
+}
+
+func hasLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMetricsEmittedOnGrantAndDenial(t *testing.T) {
+	sink := &capturingSink{}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, WithMetricsSink(sink))
+
+	qm.CheckQuota(quotaRequest("node-1", 1, 100))
+	qm.CheckQuota(quotaRequest("node-1", 1, 10))
+
+	profile := map[string]string{"profile": "1"}
+	if got := sink.counter(metricQuotaChecks, nil); got != 2 {
+		t.Errorf("%s = %v, want 2", metricQuotaChecks, got)
+	}
+	if got := sink.counter(metricQuotaGrants, profile); got != 1 {
+		t.Errorf("%s = %v, want 1", metricQuotaGrants, got)
+	}
+	if got := sink.counter(metricQuotaDenials, map[string]string{"profile": "1", "reason": denyReasonExhausted}); got != 1 {
+		t.Errorf("%s{reason=exhausted} = %v, want 1", metricQuotaDenials, got)
+	}
+	if used, ok := sink.gauge(metricProfileUsed, profile); !ok || used != 100 {
+		t.Errorf("%s = %v, %v, want 100", metricProfileUsed, used, ok)
+	}
+	if available, ok := sink.gauge(metricProfileAvailable, profile); !ok || available != 0 {
+		t.Errorf("%s = %v, %v, want 0", metricProfileAvailable, available, ok)
+	}
+}
+
+func TestStatsDSinkFormatsPackets(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink, err := NewStatsDSink(listener.LocalAddr().String(), "app.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	sink.IncrCounter(metricQuotaDenials, map[string]string{"reason": "exhausted", "profile": "1"}, 1)
+
+	buf := make([]byte, 512)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read packet: %v", err)
+	}
+	want := "app.throttle_quota_denials_total:1|c|#profile:1,reason:exhausted"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("packet = %q, want %q", got, want)
+	}
+}
+
+func TestMetricsEndpointExposesQuotaMetrics(t *testing.T) {
+	config := fixedWindow(2, time.Minute)
+	config.TotalQuota = 100
+	_, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: config}})
+
+	// 窗口内放行两次，第三次被速率控制拒绝
+	for i := 0; i < 3; i++ {
+		serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 5))
+	}
+
+	rec := serve(t, handler, http.MethodGet, "/metrics", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"throttle_quota_checks_total 3",
+		`throttle_quota_grants_total{profile="1"} 2`,
+		`throttle_quota_denials_total{profile="1",reason="rate_limited"} 1`,
+		`throttle_profile_used_quota{profile="1"} 10`,
+		`throttle_profile_available_quota{profile="1"} 90`,
+		"# TYPE throttle_quota_check_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape is missing %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("scrape:\n%s", body)
+	}
+}
+
+func TestPrometheusSinkLogsRegistrationFailureThroughManagerLogger(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	// 同名但类型不同的指标已经注册，配额管理器的注册会失败
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: metricQuotaGrants, Help: "conflicting"}))
+
+	logger := &capturingLogger{}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}},
+		WithMetricsSink(NewPrometheusSink(registry)), WithLogger(logger))
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 10)))
+
+	entries := logger.find("ERROR", "register metric failed")
+	if len(entries) != 1 || entries[0].args["metric"] != metricQuotaGrants {
+		t.Fatalf("registration failure logs = %+v, want one error for %s", entries, metricQuotaGrants)
+	}
+}
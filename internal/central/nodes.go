@@ -0,0 +1,313 @@
+package central
+
+import (
+	"sort"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// nodeInfo 中心节点记录的应用节点信息
+type nodeInfo struct {
+	nodeID      string
+	state       common.NodeState
+	lastSeen    time.Time
+	quotaLeft   int64
+	cpuUsage    float64
+	memoryUsage float64
+}
+
+// UpdateNodeStatus 记录应用节点上报的状态
+func (qm *QuotaManager) UpdateNodeStatus(status common.NodeStatus) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	node, exists := qm.nodes[status.NodeID]
+	if !exists {
+		node = &nodeInfo{nodeID: status.NodeID}
+		qm.nodes[status.NodeID] = node
+	}
+
+	node.state = status.State
+	node.lastSeen = status.LastSeen
+	if node.lastSeen.IsZero() {
+		node.lastSeen = time.Now()
+	}
+	node.quotaLeft = status.QuotaLeft
+	node.cpuUsage = status.CPUUsage
+	node.memoryUsage = status.MemoryUsage
+
+	qm.adjustRatesLocked(status)
+}
+
+// FleetHealth 所有已注册节点的健康汇总
+type FleetHealth struct {
+	Total  int            `json:"total"`
+	States map[string]int `json:"states"` // 按节点上报的状态计数
+	Stale  []StaleNode    `json:"stale"`  // 超过阈值未上报状态的节点，按节点 ID 排序
+}
+
+// StaleNode 超过阈值未上报状态的节点
+type StaleNode struct {
+	NodeID   string    `json:"node_id"`
+	State    string    `json:"state"` // 最后一次上报的状态
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// FleetHealth 汇总已注册节点的状态，staleAfter 内没有上报状态的节点列为陈旧节点
+func (qm *QuotaManager) FleetHealth(staleAfter time.Duration) FleetHealth {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	now := qm.now()
+	health := FleetHealth{
+		Total:  len(qm.nodes),
+		States: make(map[string]int),
+		Stale:  make([]StaleNode, 0),
+	}
+	for nodeID, node := range qm.nodes {
+		health.States[node.state.String()]++
+		if now.Sub(node.lastSeen) > staleAfter {
+			health.Stale = append(health.Stale, StaleNode{
+				NodeID:   nodeID,
+				State:    node.state.String(),
+				LastSeen: node.lastSeen,
+			})
+		}
+	}
+	sort.Slice(health.Stale, func(i, j int) bool {
+		return health.Stale[i].NodeID < health.Stale[j].NodeID
+	})
+	return health
+}
+
+// Handoff 将下线节点本窗口内的配额立即转交给其余活跃节点：配额归还给 profile，
+// 同时按转交的数量提高接收节点的 MaxQuotaPerNode 上限，使它们能够在本窗口内用上这部分配额
+// 返回每个 profile 转交的配额数量；没有活跃节点时配额只归还给 profile
+func (qm *QuotaManager) Handoff(nodeID string) (map[int]int64, error) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if _, registered := qm.nodes[nodeID]; !registered && !qm.hasAllocationLocked(nodeID) {
+		return nil, common.ErrNodeNotFound
+	}
+
+	handedOff := make(map[int]int64)
+	for profileID, profileMgr := range qm.profiles {
+		share, exists := profileMgr.nodeUsed[nodeID]
+		if !exists {
+			continue
+		}
+		delete(profileMgr.nodeUsed, nodeID)
+		delete(profileMgr.nodeAllowance, nodeID)
+		// 下线节点不再参与按需求加权的份额计算
+		delete(profileMgr.nodeDemand, nodeID)
+		delete(profileMgr.lastNodeDemand, nodeID)
+		handedOff[profileID] = share
+
+		profileMgr.usedQuota -= share
+		qm.releaseLocked(profileMgr, nodeID, share)
+		for recipient, amount := range splitHandoff(share, qm.activeNodesLocked(profileMgr, nodeID)) {
+			profileMgr.nodeAllowance[recipient] += amount
+		}
+		qm.recordUsage(profileMgr)
+		qm.notifyQuotaFreedLocked(profileID)
+	}
+
+	delete(qm.nodes, nodeID)
+	return handedOff, nil
+}
+
+// splitHandoff 把下线节点的配额平均分给接收节点，余数按节点 ID 顺序分给前面的节点
+// recipients 必须已排序；为空时返回 nil
+func splitHandoff(share int64, recipients []string) map[string]int64 {
+	if len(recipients) == 0 {
+		return nil
+	}
+	per := share / int64(len(recipients))
+	extra := share % int64(len(recipients))
+	amounts := make(map[string]int64, len(recipients))
+	for i, recipient := range recipients {
+		amount := per
+		if int64(i) < extra {
+			amount++
+		}
+		amounts[recipient] = amount
+	}
+	return amounts
+}
+
+// NodeRemovalProjection 模拟节点下线（Handoff）后各 profile 的配额分布
+type NodeRemovalProjection struct {
+	NodeID   string                           `json:"node_id"`
+	Profiles map[int]ProfileRemovalProjection `json:"profiles"`
+}
+
+// ProfileRemovalProjection 单个 profile 在节点下线后的配额分布
+type ProfileRemovalProjection struct {
+	HandedOff int64            `json:"handed_off"` // 下线节点持有、将被转交的配额
+	Released  int64            `json:"released"`   // 归还给 profile 的配额，与 Handoff 相同，总是等于 HandedOff
+	NodeUsed  map[string]int64 `json:"node_used"`  // 其余各节点本窗口内的已分配配额，转交不改变已分配量
+	Allowance map[string]int64 `json:"allowance"`  // 转交后各接收节点在 MaxQuotaPerNode 之外额外可用的配额；没有活跃节点时为空
+}
+
+// SimulateNodeRemoval 计算 Handoff(nodeID) 会产生的配额分布，不修改任何状态
+func (qm *QuotaManager) SimulateNodeRemoval(nodeID string) (NodeRemovalProjection, error) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	if _, registered := qm.nodes[nodeID]; !registered && !qm.hasAllocationLocked(nodeID) {
+		return NodeRemovalProjection{}, common.ErrNodeNotFound
+	}
+
+	projection := NodeRemovalProjection{
+		NodeID:   nodeID,
+		Profiles: make(map[int]ProfileRemovalProjection),
+	}
+	for profileID, profileMgr := range qm.profiles {
+		share, exists := profileMgr.nodeUsed[nodeID]
+		if !exists {
+			continue
+		}
+
+		profile := ProfileRemovalProjection{
+			HandedOff: share,
+			Released:  share,
+			NodeUsed:  make(map[string]int64, len(profileMgr.nodeUsed)),
+			Allowance: make(map[string]int64, len(profileMgr.nodeAllowance)),
+		}
+		for other, used := range profileMgr.nodeUsed {
+			if other != nodeID {
+				profile.NodeUsed[other] = used
+			}
+		}
+		for other, allowance := range profileMgr.nodeAllowance {
+			if other != nodeID {
+				profile.Allowance[other] = allowance
+			}
+		}
+		for recipient, amount := range splitHandoff(share, qm.activeNodesLocked(profileMgr, nodeID)) {
+			profile.Allowance[recipient] += amount
+		}
+		projection.Profiles[profileID] = profile
+	}
+	return projection, nil
+}
+
+// Release 归还节点未使用的配额，unused 为 profileID 到归还数量的映射
+// 每个 profile 最多归还该节点本窗口内获得的配额，返回实际归还的数量
+func (qm *QuotaManager) Release(nodeID string, unused map[int]int64) map[int]int64 {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	released := make(map[int]int64)
+	for profileID, amount := range unused {
+		profileMgr, exists := qm.profiles[profileID]
+		if !exists || amount <= 0 {
+			continue
+		}
+
+		amount = min(amount, profileMgr.nodeUsed[nodeID])
+		if amount <= 0 {
+			continue
+		}
+		profileMgr.nodeUsed[nodeID] -= amount
+		if profileMgr.nodeUsed[nodeID] == 0 {
+			delete(profileMgr.nodeUsed, nodeID)
+		}
+		profileMgr.usedQuota -= amount
+		qm.releaseLocked(profileMgr, nodeID, amount)
+		released[profileID] = amount
+		qm.recordUsage(profileMgr)
+		qm.notifyQuotaFreedLocked(profileID)
+	}
+	return released
+}
+
+// hasAllocationLocked 判断节点在任一 profile 中是否持有配额
+func (qm *QuotaManager) hasAllocationLocked(nodeID string) bool {
+	for _, profileMgr := range qm.profiles {
+		if _, exists := profileMgr.nodeUsed[nodeID]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// activeNodesLocked 返回 profile 的活跃节点（按节点 ID 排序）
+// 活跃节点包括在线的已注册节点和本窗口内持有配额且未离线的节点
+func (qm *QuotaManager) activeNodesLocked(profileMgr *ProfileManager, exclude string) []string {
+	active := make(map[string]struct{})
+	for nodeID, node := range qm.nodes {
+		if node.state == common.StateOnline {
+			active[nodeID] = struct{}{}
+		}
+	}
+	for nodeID := range profileMgr.nodeUsed {
+		if node, registered := qm.nodes[nodeID]; registered && node.state == common.StateOffline {
+			continue
+		}
+		active[nodeID] = struct{}{}
+	}
+	delete(active, exclude)
+
+	nodeIDs := make([]string, 0, len(active))
+	for nodeID := range active {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+	return nodeIDs
+}
+
+// RateLimitedNode 最近被速率控制拒绝过的节点
+type RateLimitedNode struct {
+	NodeID        string        `json:"node_id"`
+	RateLimited   int64         `json:"rate_limited"`    // 上一个窗口和当前窗口内被速率控制拒绝的请求数
+	RatePerSecond float64       `json:"rate_per_second"` // 按统计时长折算的每秒拒绝数
+	Profiles      map[int]int64 `json:"profiles"`        // 按 profile 的拒绝数
+}
+
+// recordThrottledLocked 记录节点的一次速率控制拒绝；调用方必须持有写锁
+func (pm *ProfileManager) recordThrottledLocked(nodeID string) {
+	if pm.nodeThrottled == nil {
+		pm.nodeThrottled = make(map[string]int64)
+	}
+	pm.nodeThrottled[nodeID]++
+}
+
+// RateLimitedNodes 返回上一个窗口和当前窗口内被速率控制拒绝过的节点，按拒绝数从多到少排序，相同时按节点 ID
+// 统计时长为上一个窗口加上当前窗口已经过去的时间
+func (qm *QuotaManager) RateLimitedNodes() []RateLimitedNode {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	byNode := make(map[string]*RateLimitedNode)
+	for profileID, profileMgr := range qm.profiles {
+		for _, counts := range []map[string]int64{profileMgr.lastThrottled, profileMgr.nodeThrottled} {
+			for nodeID, count := range counts {
+				node, exists := byNode[nodeID]
+				if !exists {
+					node = &RateLimitedNode{NodeID: nodeID, Profiles: make(map[int]int64)}
+					byNode[nodeID] = node
+				}
+				node.RateLimited += count
+				node.Profiles[profileID] += count
+			}
+		}
+	}
+
+	span := qm.now().Sub(qm.lastRefresh) + qm.refreshInterval
+	nodes := make([]RateLimitedNode, 0, len(byNode))
+	for _, node := range byNode {
+		if span > 0 {
+			node.RatePerSecond = float64(node.RateLimited) / span.Seconds()
+		}
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].RateLimited != nodes[j].RateLimited {
+			return nodes[i].RateLimited > nodes[j].RateLimited
+		}
+		return nodes[i].NodeID < nodes[j].NodeID
+	})
+	return nodes
+}
@@ -0,0 +1,222 @@
+package central
+
+import (
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// registerNodes 把节点注册为在线
+func registerNodes(qm *QuotaManager, nodeIDs ...string) {
+	for _, nodeID := range nodeIDs {
+		qm.UpdateNodeStatus(common.NodeStatus{NodeID: nodeID, State: common.StateOnline, LastSeen: qm.now()})
+	}
+}
+
+func TestHandoffRedistributesDrainedShareUnderNodeCap(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, WithMaxQuotaPerNode(30))
+	registerNodes(qm, "node-a", "node-b", "node-c")
+	for _, nodeID := range []string{"node-a", "node-b", "node-c"} {
+		if got := granted(t, qm.CheckQuota(quotaRequest(nodeID, 1, 30))); got != 30 {
+			t.Fatalf("%s granted %d, want 30", nodeID, got)
+		}
+	}
+
+	handedOff, err := qm.Handoff("node-c")
+	if err != nil {
+		t.Fatalf("Handoff: %v", err)
+	}
+	if handedOff[1] != 30 {
+		t.Fatalf("handed off %v, want 30 of profile 1", handedOff)
+	}
+
+	var total int64
+	for _, nodeID := range []string{"node-a", "node-b"} {
+		extra := granted(t, qm.CheckQuota(quotaRequest(nodeID, 1, 100)))
+		if extra != 15 {
+			t.Errorf("%s granted %d more after handoff, want its half of the drained 30", nodeID, extra)
+		}
+		total += 30 + extra
+	}
+	if total != 90 {
+		t.Errorf("remaining nodes hold %d, want their own 60 plus the drained node's 30", total)
+	}
+}
+
+func TestHandoffRedistributesDrainedShareUnderEqualAllocation(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 90, NodeAllocation: NodeAllocationEqual}})
+	registerNodes(qm, "node-a", "node-b", "node-c")
+	for _, nodeID := range []string{"node-a", "node-b", "node-c"} {
+		qm.CheckQuota(quotaRequest(nodeID, 1, 30))
+	}
+
+	if _, err := qm.Handoff("node-c"); err != nil {
+		t.Fatalf("Handoff: %v", err)
+	}
+
+	for _, nodeID := range []string{"node-a", "node-b"} {
+		if got := granted(t, qm.CheckQuota(quotaRequest(nodeID, 1, 100))); got != 15 {
+			t.Errorf("%s granted %d after handoff, want 15 (equal share grows to 45)", nodeID, got)
+		}
+	}
+}
+
+func TestHandoffWithoutRecipientsReleasesQuota(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	qm.CheckQuota(quotaRequest("node-a", 1, 40))
+
+	if _, err := qm.Handoff("node-a"); err != nil {
+		t.Fatalf("Handoff: %v", err)
+	}
+	if used := qm.profiles[1].usedQuota; used != 0 {
+		t.Errorf("used quota = %d after handoff with no other nodes, want 0", used)
+	}
+	if _, err := qm.Handoff("node-unknown"); err != common.ErrNodeNotFound {
+		t.Errorf("Handoff of an unknown node = %v, want ErrNodeNotFound", err)
+	}
+}
+
+func TestNodeCapLimitsCompetingNodes(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, WithMaxQuotaPerNode(40))
+	registerNodes(qm, "node-a", "node-b")
+
+	// 两个节点交替请求超过整个 profile 的数量，谁都不能超过自己的上限
+	totals := map[string]int64{}
+	for i := 0; i < 3; i++ {
+		for _, nodeID := range []string{"node-a", "node-b"} {
+			totals[nodeID] += granted(t, qm.CheckQuota(quotaRequest(nodeID, 1, 100)))
+		}
+	}
+	for _, nodeID := range []string{"node-a", "node-b"} {
+		if totals[nodeID] != 40 {
+			t.Errorf("%s granted %d in total, want its cap of 40", nodeID, totals[nodeID])
+		}
+	}
+
+	profile := qm.GetQuotaStatus()["profiles"].(map[string]interface{})["profile_1"].(map[string]interface{})
+	nodes := profile["nodes"].(map[string]interface{})
+	for _, nodeID := range []string{"node-a", "node-b"} {
+		node := nodes[nodeID].(map[string]interface{})
+		if node["used_quota"] != int64(40) || node["limit"] != int64(40) {
+			t.Errorf("%s status = %v, want used 40 of limit 40", nodeID, node)
+		}
+	}
+}
+
+func TestSimulateNodeRemovalMatchesHandoff(t *testing.T) {
+	profiles := map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 50}}
+	qm := NewQuotaManager(testRefreshInterval, profiles, WithMaxQuotaPerNode(40))
+	registerNodes(qm, "node-a", "node-b", "node-c")
+	for nodeID, amount := range map[string]int64{"node-a": 20, "node-b": 30, "node-c": 31} {
+		granted(t, qm.CheckQuota(quotaRequest(nodeID, 1, amount)))
+	}
+	granted(t, qm.CheckQuota(quotaRequest("node-c", 2, 10)))
+
+	projection, err := qm.SimulateNodeRemoval("node-c")
+	if err != nil {
+		t.Fatalf("SimulateNodeRemoval: %v", err)
+	}
+	if used := qm.profiles[1].usedQuota; used != 81 || qm.profiles[1].nodeUsed["node-c"] != 31 {
+		t.Fatalf("simulation changed state: usedQuota %d, node-c used %d", used, qm.profiles[1].nodeUsed["node-c"])
+	}
+
+	usedBefore := map[int]int64{1: qm.profiles[1].usedQuota, 2: qm.profiles[2].usedQuota}
+	handedOff, err := qm.Handoff("node-c")
+	if err != nil {
+		t.Fatalf("Handoff: %v", err)
+	}
+
+	if len(projection.Profiles) != len(handedOff) {
+		t.Fatalf("projection covers %d profiles, Handoff moved %d", len(projection.Profiles), len(handedOff))
+	}
+	for profileID, projected := range projection.Profiles {
+		profileMgr := qm.profiles[profileID]
+		if projected.HandedOff != handedOff[profileID] {
+			t.Errorf("profile %d: projected handed off %d, Handoff moved %d", profileID, projected.HandedOff, handedOff[profileID])
+		}
+		if released := usedBefore[profileID] - profileMgr.usedQuota; projected.Released != released {
+			t.Errorf("profile %d: projected released %d, Handoff released %d", profileID, projected.Released, released)
+		}
+		if !reflect.DeepEqual(projected.NodeUsed, profileMgr.nodeUsed) {
+			t.Errorf("profile %d: projected node used %v, Handoff left %v", profileID, projected.NodeUsed, profileMgr.nodeUsed)
+		}
+		if !reflect.DeepEqual(projected.Allowance, profileMgr.nodeAllowance) {
+			t.Errorf("profile %d: projected allowance %v, Handoff granted %v", profileID, projected.Allowance, profileMgr.nodeAllowance)
+		}
+	}
+
+	want := map[string]int64{"node-a": 16, "node-b": 15}
+	if got := projection.Profiles[1].Allowance; !reflect.DeepEqual(got, want) {
+		t.Errorf("profile 1 allowance = %v, want the 31 split %v", got, want)
+	}
+}
+
+func TestSimulateNodeRemovalWithoutRecipients(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	registerNodes(qm, "node-a")
+	granted(t, qm.CheckQuota(quotaRequest("node-a", 1, 40)))
+
+	projection, err := qm.SimulateNodeRemoval("node-a")
+	if err != nil {
+		t.Fatalf("SimulateNodeRemoval: %v", err)
+	}
+	if got := projection.Profiles[1]; got.Released != 40 || len(got.Allowance) != 0 || len(got.NodeUsed) != 0 {
+		t.Fatalf("projection = %+v, want all 40 released with no recipients", got)
+	}
+	if _, err := qm.SimulateNodeRemoval("node-unknown"); err != common.ErrNodeNotFound {
+		t.Fatalf("SimulateNodeRemoval(unknown) = %v, want ErrNodeNotFound", err)
+	}
+}
+
+func TestRateLimitedNodesListsOverdrivingNode(t *testing.T) {
+	clock := newFakeClock()
+	s, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{
+		1: fixedWindow(5, time.Minute),
+		2: fixedWindow(2, time.Minute),
+		3: {TotalQuota: 1000},
+	}})
+	withClock(clock)(s.quotaManager)
+
+	send := func(nodeID string, profileID, n int) {
+		for i := 0; i < n; i++ {
+			s.quotaManager.CheckQuota(quotaRequest(nodeID, profileID, 1))
+		}
+	}
+	send("node-hot", 1, 20)
+	send("node-warm", 2, 4)
+	send("node-cool", 3, 50)
+
+	rec := serve(t, handler, http.MethodGet, "/api/v1/nodes/rate-limited", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var nodes []RateLimitedNode
+	decodeBody(t, rec, &nodes)
+	if len(nodes) != 2 {
+		t.Fatalf("got %d rate limited nodes %+v, want node-hot and node-warm", len(nodes), nodes)
+	}
+	if got := nodes[0]; got.NodeID != "node-hot" || got.RateLimited != 15 || !reflect.DeepEqual(got.Profiles, map[int]int64{1: 15}) {
+		t.Errorf("first node = %+v, want node-hot with 15 on profile 1", got)
+	}
+	if got := nodes[1]; got.NodeID != "node-warm" || got.RateLimited != 2 || !reflect.DeepEqual(got.Profiles, map[int]int64{2: 2}) {
+		t.Errorf("second node = %+v, want node-warm with 2 on profile 2", got)
+	}
+	if want := 15 / testRefreshInterval.Seconds(); math.Abs(nodes[0].RatePerSecond-want) > 1e-9 {
+		t.Errorf("node-hot rate = %v/s, want %v/s", nodes[0].RatePerSecond, want)
+	}
+
+	// 计数保留一个窗口，之后不再列出
+	clock.Advance(testRefreshInterval)
+	s.quotaManager.refresh()
+	if nodes := s.quotaManager.RateLimitedNodes(); len(nodes) != 2 || nodes[0].RateLimited != 15 {
+		t.Fatalf("after one refresh = %+v, want the previous window still counted", nodes)
+	}
+	clock.Advance(testRefreshInterval)
+	s.quotaManager.refresh()
+	if nodes := s.quotaManager.RateLimitedNodes(); len(nodes) != 0 {
+		t.Fatalf("after two refreshes = %+v, want none", nodes)
+	}
+}
@@ -0,0 +1,31 @@
+package central
+
+import (
+	"sort"
+	"throttle_control/internal/common"
+)
+
+// priorityOrder 返回请求中 profile 配额的处理顺序（下标）：Priority 高的在前，相同时保持请求中的顺序
+func priorityOrder(quotas []common.ProfileQuota) []int {
+	order := make([]int, len(quotas))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return quotas[order[a]].Priority > quotas[order[b]].Priority
+	})
+	return order
+}
+
+// inRequestOrder 把按 order 处理得到的结果恢复为请求中的顺序，使响应与 req.Quotas 一一对应
+// processed 为空（例如未记录决策状态）时原样返回
+func inRequestOrder[T any](processed []T, order []int) []T {
+	if len(processed) == 0 {
+		return processed
+	}
+	restored := make([]T, len(processed))
+	for k, i := range order {
+		restored[i] = processed[k]
+	}
+	return restored
+}
@@ -0,0 +1,60 @@
+package central
+
+import (
+	"reflect"
+	"testing"
+	"throttle_control/internal/common"
+)
+
+func TestPriorityOrderIsStable(t *testing.T) {
+	quotas := []common.ProfileQuota{
+		{ProfileID: 1, Priority: 0},
+		{ProfileID: 2, Priority: 5},
+		{ProfileID: 3, Priority: 0},
+		{ProfileID: 4, Priority: 5},
+		{ProfileID: 5, Priority: -1},
+	}
+	// 优先级相同时保持请求中的顺序
+	if got, want := priorityOrder(quotas), []int{1, 3, 0, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("priorityOrder = %v, want %v", got, want)
+	}
+}
+
+func TestCheckQuotaGrantsHigherPriorityFirst(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 10}})
+
+	// 剩余 10 个配额，两个请求各要 8 个：排在后面的高优先级请求先分配
+	resp := qm.CheckQuota(common.QuotaRequest{
+		NodeID: "node-1",
+		Quotas: []common.ProfileQuota{
+			{ProfileID: 1, Required: 8, Priority: 0},
+			{ProfileID: 1, Required: 8, Priority: 10},
+		},
+	})
+	if len(resp.Quotas) != 2 {
+		t.Fatalf("got %d quota responses, want 2", len(resp.Quotas))
+	}
+	// 响应与请求一一对应
+	low, high := resp.Quotas[0], resp.Quotas[1]
+	if high.Granted != 8 {
+		t.Errorf("high priority granted = %d, want 8", high.Granted)
+	}
+	if low.Granted != 2 {
+		t.Errorf("low priority granted = %d, want the remaining 2", low.Granted)
+	}
+}
+
+func TestCheckQuotaEqualPriorityKeepsRequestOrder(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 10}})
+
+	resp := qm.CheckQuota(common.QuotaRequest{
+		NodeID: "node-1",
+		Quotas: []common.ProfileQuota{
+			{ProfileID: 1, Required: 8, Priority: 3},
+			{ProfileID: 1, Required: 8, Priority: 3},
+		},
+	})
+	if resp.Quotas[0].Granted != 8 || resp.Quotas[1].Granted != 2 {
+		t.Fatalf("granted = %d, %d, want 8, 2", resp.Quotas[0].Granted, resp.Quotas[1].Granted)
+	}
+}
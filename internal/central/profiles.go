@@ -0,0 +1,456 @@
+package central
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"throttle_control/internal/common"
+	"throttle_control/internal/ratelimit"
+	"time"
+)
+
+// CreateProfile 新增 profile，ID 已存在时返回 common.ErrProfileExists
+func (qm *QuotaManager) CreateProfile(profileID int, config ProfileConfig) error {
+	if err := validateProfileConfig(config, qm.strictConfig); err != nil {
+		return err
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if _, exists := qm.getProfileLocked(profileID); exists {
+		return common.ErrProfileExists
+	}
+
+	if err := qm.persistProfileLocked(profileID, config); err != nil {
+		return err
+	}
+	qm.logProfileDiagnostics(profileID, config)
+	qm.profiles[profileID] = newProfileManager(profileID, config)
+	return nil
+}
+
+// GetProfiles 返回所有已加载 profile 的当前配置（包含运行时修改）
+// 使用按需加载的 provider 时尚未被请求过的 profile 不在结果中，需要完整列表时使用 EffectiveProfileConfigs
+func (qm *QuotaManager) GetProfiles() map[int]ProfileConfig {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	configs := make(map[int]ProfileConfig, len(qm.profiles))
+	for profileID, profileMgr := range qm.profiles {
+		configs[profileID] = profileMgr.config
+	}
+	return configs
+}
+
+// PutProfile 新增或替换 profile 配置（幂等）
+// 替换时保留运行时的已用配额和速率状态（速率控制方法改变时除外），新增时使用全新状态
+func (qm *QuotaManager) PutProfile(profileID int, config ProfileConfig) (created bool, err error) {
+	if err := validateProfileConfig(config, qm.strictConfig); err != nil {
+		return false, err
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	// 先确认是否存在再写回 provider，否则刚写入的配置会被当作已有的 profile 加载
+	profileMgr, exists := qm.getProfileLocked(profileID)
+	if err := qm.persistProfileLocked(profileID, config); err != nil {
+		return false, err
+	}
+	qm.logProfileDiagnostics(profileID, config)
+
+	if !exists {
+		qm.profiles[profileID] = newProfileManager(profileID, config)
+		return true, nil
+	}
+
+	profileMgr.setConfig(config)
+	profileMgr.totalQuota = config.TotalQuota
+	return false, nil
+}
+
+// UpdateProfile 在运行时替换 profile 配置，立即生效；profile 不存在时以全新状态创建
+// 保留已用配额，速率控制方法改变时速率窗口重新开始
+func (qm *QuotaManager) UpdateProfile(profileID int, config ProfileConfig) error {
+	_, err := qm.PutProfile(profileID, config)
+	return err
+}
+
+// ProfilePatch profile 速率参数的部分修改，为空的字段保持不变
+type ProfilePatch struct {
+	RateLimit         *int64                    `json:"rate_limit,omitempty"`
+	Burst             *int64                    `json:"burst,omitempty"`
+	Window            *time.Duration            `json:"window,omitempty"`
+	RateControlMethod *common.RateControlMethod `json:"rate_control_method,omitempty"`
+}
+
+// PatchProfile 立即修改已有 profile 的速率参数，不影响配额和用量
+// 令牌数超过新的 burst 时截断到 burst；速率控制方法改变时速率状态重新开始
+func (qm *QuotaManager) PatchProfile(profileID int, patch ProfilePatch) (ProfileConfig, error) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	profileMgr, exists := qm.getProfileLocked(profileID)
+	if !exists {
+		return ProfileConfig{}, common.ErrProfileNotFound
+	}
+
+	config := profileMgr.config
+	if patch.RateLimit != nil {
+		config.RateLimit = *patch.RateLimit
+	}
+	if patch.Burst != nil {
+		config.Burst = *patch.Burst
+	}
+	if patch.Window != nil {
+		config.Window = *patch.Window
+	}
+	if patch.RateControlMethod != nil {
+		config.RateControlMethod = *patch.RateControlMethod
+	}
+	if err := validateProfileConfig(config, qm.strictConfig); err != nil {
+		return ProfileConfig{}, err
+	}
+	if err := qm.persistProfileLocked(profileID, config); err != nil {
+		return ProfileConfig{}, err
+	}
+	qm.logProfileDiagnostics(profileID, config)
+
+	profileMgr.setConfig(config)
+	return config, nil
+}
+
+// setConfig 替换已加载 profile 的配置，保留已用配额
+// 速率控制方法改变时速率窗口和令牌重新开始，否则令牌数截断到新的 burst
+func (pm *ProfileManager) setConfig(config ProfileConfig) {
+	if config.RateControlMethod != pm.config.RateControlMethod {
+		pm.rate = ratelimit.State{}
+		pm.rampStart = time.Time{}
+	} else {
+		pm.rate.Tokens = min(pm.rate.Tokens, config.Burst)
+	}
+	pm.config = config
+}
+
+// RemoveProfile 删除 profile 及其运行时状态，之后的配额检查把它视为不存在的 profile
+// 配置同时从 provider 中删除，否则下次加载会重新出现；provider 不可写时返回 errors.ErrUnsupported
+func (qm *QuotaManager) RemoveProfile(profileID int) error {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if _, exists := qm.getProfileLocked(profileID); !exists {
+		return common.ErrProfileNotFound
+	}
+
+	writer, ok := qm.provider.(ProfileConfigWriter)
+	if !ok {
+		return fmt.Errorf("%w: profile provider %T is read-only", errors.ErrUnsupported, qm.provider)
+	}
+	if err := writer.DeleteProfile(profileID); err != nil {
+		return fmt.Errorf("delete profile %d failed: %w", profileID, err)
+	}
+
+	delete(qm.profiles, profileID)
+	// 唤醒等待该 profile 的请求，让它们看到 profile 已不存在
+	qm.notifyQuotaFreedLocked(profileID)
+	return nil
+}
+
+// ReplaceProfiles 原子地替换全部 profile 配置，用于整体切换配置（蓝绿发布）
+// 先校验整个集合，任何一个配置无效都不做修改；然后在同一把锁内完成替换：
+// 新旧集合都存在的 profile 保留已用配额和速率状态，不在新集合中的 profile 被移除
+func (qm *QuotaManager) ReplaceProfiles(configs map[int]ProfileConfig) error {
+	for profileID, config := range configs {
+		if err := validateProfileConfig(config, qm.strictConfig); err != nil {
+			return fmt.Errorf("profile %d: %w", profileID, err)
+		}
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if err := qm.persistProfilesLocked(configs); err != nil {
+		return err
+	}
+
+	profiles := make(map[int]*ProfileManager, len(configs))
+	for profileID, config := range configs {
+		qm.logProfileDiagnostics(profileID, config)
+		profileMgr, exists := qm.profiles[profileID]
+		if !exists {
+			profiles[profileID] = newProfileManager(profileID, config)
+			continue
+		}
+		profileMgr.setConfig(config)
+		profileMgr.totalQuota = config.TotalQuota
+		profiles[profileID] = profileMgr
+	}
+	for profileID := range qm.profiles {
+		if _, kept := profiles[profileID]; !kept {
+			// 唤醒等待被移除 profile 的请求，让它们看到 profile 已不存在
+			qm.notifyQuotaFreedLocked(profileID)
+		}
+	}
+	qm.profiles = profiles
+	return nil
+}
+
+// ProfileImportError 批量导入中导致整个导入被放弃的 profile
+type ProfileImportError struct {
+	ProfileID int
+	Err       error
+}
+
+func (e *ProfileImportError) Error() string {
+	return fmt.Sprintf("profile %d: %v", e.ProfileID, e.Err)
+}
+
+func (e *ProfileImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportProfiles 批量新增或替换 profile 配置，要么全部生效，要么全部不生效
+// 先按 profile ID 顺序校验全部配置，第一个无效的配置以 *ProfileImportError 返回；
+// 写回 provider 中途失败时已写入的 profile 恢复为原配置。替换的 profile 保留已用配额和速率状态
+func (qm *QuotaManager) ImportProfiles(configs map[int]ProfileConfig) error {
+	profileIDs := make([]int, 0, len(configs))
+	for profileID := range configs {
+		profileIDs = append(profileIDs, profileID)
+	}
+	sort.Ints(profileIDs)
+
+	for _, profileID := range profileIDs {
+		if err := validateProfileConfig(configs[profileID], qm.strictConfig); err != nil {
+			return &ProfileImportError{ProfileID: profileID, Err: err}
+		}
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if err := qm.persistImportLocked(profileIDs, configs); err != nil {
+		return err
+	}
+
+	for _, profileID := range profileIDs {
+		config := configs[profileID]
+		qm.logProfileDiagnostics(profileID, config)
+		profileMgr, exists := qm.getProfileLocked(profileID)
+		if !exists {
+			qm.profiles[profileID] = newProfileManager(profileID, config)
+			continue
+		}
+		profileMgr.setConfig(config)
+		profileMgr.totalQuota = config.TotalQuota
+	}
+	return nil
+}
+
+// persistImportLocked 把导入的配置写回可写的 provider，失败时把已写入的 profile 恢复原状
+func (qm *QuotaManager) persistImportLocked(profileIDs []int, configs map[int]ProfileConfig) error {
+	writer, ok := qm.provider.(ProfileConfigWriter)
+	if !ok {
+		return nil
+	}
+
+	written := make(map[int]previousProfile, len(profileIDs))
+	for _, profileID := range profileIDs {
+		prev, err := qm.previousProfileLocked(profileID)
+		if err != nil {
+			qm.rollbackProfilesLocked(writer, written)
+			return &ProfileImportError{ProfileID: profileID, Err: err}
+		}
+		if err := writer.SetProfile(profileID, configs[profileID]); err != nil {
+			qm.rollbackProfilesLocked(writer, written)
+			return &ProfileImportError{ProfileID: profileID, Err: fmt.Errorf("persist failed: %w", err)}
+		}
+		written[profileID] = prev
+	}
+	return nil
+}
+
+// previousProfile 写回 provider 之前 profile 的配置，写回失败时据此恢复
+type previousProfile struct {
+	config ProfileConfig
+	exists bool
+}
+
+// previousProfileLocked 读取 provider 中 profile 当前的配置，不存在不算错误
+func (qm *QuotaManager) previousProfileLocked(profileID int) (previousProfile, error) {
+	config, err := qm.provider.GetProfile(profileID)
+	if errors.Is(err, common.ErrProfileNotFound) {
+		return previousProfile{}, nil
+	}
+	if err != nil {
+		return previousProfile{}, err
+	}
+	return previousProfile{config: config, exists: true}, nil
+}
+
+// rollbackProfilesLocked 把已写入 provider 的 profile 恢复为写入之前的配置，原本不存在的删除
+func (qm *QuotaManager) rollbackProfilesLocked(writer ProfileConfigWriter, written map[int]previousProfile) {
+	for profileID, prev := range written {
+		var err error
+		if prev.exists {
+			err = writer.SetProfile(profileID, prev.config)
+		} else {
+			err = writer.DeleteProfile(profileID)
+		}
+		if err != nil {
+			qm.logger.Error("rollback of profile after failed write failed", "profile_id", profileID, "error", err)
+		}
+	}
+}
+
+// UnknownProfiles 返回请求中引用的不存在的 profile ID
+func (qm *QuotaManager) UnknownProfiles(req common.QuotaRequest) []int {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	var unknown []int
+	for _, profileQuota := range req.Quotas {
+		if _, exists := qm.getProfileLocked(profileQuota.ProfileID); !exists {
+			unknown = append(unknown, profileQuota.ProfileID)
+		}
+	}
+	return unknown
+}
+
+// persistProfileLocked 将运行时修改写回可写的 provider
+// provider 不可写时修改只保存在内存中，下次刷新会被 provider 中的配置覆盖
+func (qm *QuotaManager) persistProfileLocked(profileID int, config ProfileConfig) error {
+	writer, ok := qm.provider.(ProfileConfigWriter)
+	if !ok {
+		return nil
+	}
+	if err := writer.SetProfile(profileID, config); err != nil {
+		return fmt.Errorf("persist profile %d failed: %w", profileID, err)
+	}
+	return nil
+}
+
+// persistProfilesLocked 将整个配置集合写回可写的 provider，并删除不在集合中的 profile
+// 中途失败时已删除和已写入的 profile 恢复原状，provider 保持替换之前的配置集合
+func (qm *QuotaManager) persistProfilesLocked(configs map[int]ProfileConfig) error {
+	writer, ok := qm.provider.(ProfileConfigWriter)
+	if !ok {
+		return nil
+	}
+
+	existing, err := qm.provider.ListProfiles()
+	if err != nil {
+		return fmt.Errorf("list profiles failed: %w", err)
+	}
+
+	written := make(map[int]previousProfile, len(existing)+len(configs))
+	for _, profileID := range existing {
+		if _, keep := configs[profileID]; keep {
+			continue
+		}
+		prev, err := qm.previousProfileLocked(profileID)
+		if err != nil {
+			qm.rollbackProfilesLocked(writer, written)
+			return fmt.Errorf("read profile %d failed: %w", profileID, err)
+		}
+		if err := writer.DeleteProfile(profileID); err != nil {
+			qm.rollbackProfilesLocked(writer, written)
+			return fmt.Errorf("delete profile %d failed: %w", profileID, err)
+		}
+		written[profileID] = prev
+	}
+	for profileID, config := range configs {
+		prev, err := qm.previousProfileLocked(profileID)
+		if err != nil {
+			qm.rollbackProfilesLocked(writer, written)
+			return fmt.Errorf("read profile %d failed: %w", profileID, err)
+		}
+		if err := writer.SetProfile(profileID, config); err != nil {
+			qm.rollbackProfilesLocked(writer, written)
+			return fmt.Errorf("persist profile %d failed: %w", profileID, err)
+		}
+		written[profileID] = prev
+	}
+	return nil
+}
+
+// validateProfileConfig 校验 profile 配置
+// strict 为 true 时可疑的配置（diagnoseProfileConfig 的 warnings）同样视为错误
+func validateProfileConfig(config ProfileConfig, strict bool) error {
+	if config.TotalQuota < 0 {
+		return fmt.Errorf("%w: total_quota must be non-negative", common.ErrInvalidRequest)
+	}
+	if config.RateLimit < 0 || config.Burst < 0 {
+		return fmt.Errorf("%w: rate_limit and burst must be non-negative", common.ErrInvalidRequest)
+	}
+	if config.Adaptive != nil && config.Adaptive.TargetLatency <= 0 && config.Adaptive.MaxCPU <= 0 {
+		return fmt.Errorf("%w: adaptive rate control needs target_latency or max_cpu", common.ErrInvalidRequest)
+	}
+	if config.MaxDimensions < 0 {
+		return fmt.Errorf("%w: max_dimensions must be non-negative", common.ErrInvalidRequest)
+	}
+	if config.RateControlMethod != common.RateControlNone && config.Window <= 0 {
+		return fmt.Errorf("%w: window must be positive when rate control is enabled", common.ErrInvalidRequest)
+	}
+	problems, warnings := diagnoseProfileConfig(config)
+	if strict {
+		problems = append(problems, warnings...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", common.ErrInvalidRequest, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// diagnoseProfileConfig 检查字段之间的组合是否合理
+// problems 为会导致 profile 拒绝所有请求的配置，warnings 为不会生效或可疑的配置
+func diagnoseProfileConfig(config ProfileConfig) (problems, warnings []string) {
+	switch config.RateControlMethod {
+	case common.RateControlFixedWindow, common.RateControlSlidingWindow, common.RateControlSlidingCost:
+		if config.RateLimit == 0 {
+			problems = append(problems, "rate_limit is 0 with window rate control, every request will be rate limited")
+		}
+	case common.RateControlGCRA:
+		if config.RateLimit == 0 {
+			problems = append(problems, "rate_limit is 0 with gcra rate control, every request will be rate limited")
+		}
+	case common.RateControlTokenBucket:
+		if config.Burst == 0 {
+			problems = append(problems, "burst is 0 with token bucket rate control, every request will be rate limited")
+		} else if config.RateLimit == 0 {
+			warnings = append(warnings, "rate_limit is 0 with token bucket rate control, tokens are never refilled after the initial burst")
+		}
+	case common.RateControlNone:
+		if config.RateLimit > 0 || config.Burst > 0 || config.Window > 0 {
+			warnings = append(warnings, "rate_limit, burst or window is set but rate_control_method is none, rate limiting is disabled")
+		}
+		if config.StartupPolicy == StartupRamp {
+			warnings = append(warnings, "startup_policy is ramp but rate_control_method is none, the ramp has no effect")
+		}
+	}
+	for _, pathLimit := range config.PathLimits {
+		if pathLimit.RateControlMethod != common.RateControlNone && pathLimit.RateLimit == 0 && pathLimit.Burst == 0 {
+			problems = append(problems, fmt.Sprintf("path limit %q allows no requests", pathLimit.key()))
+		}
+	}
+
+	if config.TotalQuota == 0 && config.RefreshFunc == nil {
+		warnings = append(warnings, "total_quota is 0, nothing will be granted until the profile is boosted")
+	}
+	if config.MaxPerRequest > 0 && config.MaxPerRequest > config.TotalQuota && config.RefreshFunc == nil {
+		warnings = append(warnings, "max_per_request exceeds total_quota and has no effect")
+	}
+	return problems, warnings
+}
+
+// logProfileDiagnostics 记录 profile 配置的组合问题，用于无法返回错误的加载路径
+func (qm *QuotaManager) logProfileDiagnostics(profileID int, config ProfileConfig) {
+	problems, warnings := diagnoseProfileConfig(config)
+	for _, problem := range problems {
+		qm.logger.Error("profile can never be satisfied", "profile_id", profileID, "problem", problem)
+	}
+	for _, warning := range warnings {
+		qm.logger.Warn("suspicious profile configuration", "profile_id", profileID, "warning", warning)
+	}
+}
@@ -0,0 +1,520 @@
+package central
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestPutProfileCreatesThenUpdates(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+
+	created, err := qm.PutProfile(2, ProfileConfig{TotalQuota: 50})
+	if err != nil || !created {
+		t.Fatalf("PutProfile(new) = %v, %v, want created", created, err)
+	}
+	qm.CheckQuota(quotaRequest("node-1", 2, 20))
+
+	created, err = qm.PutProfile(2, ProfileConfig{TotalQuota: 80})
+	if err != nil || created {
+		t.Fatalf("PutProfile(existing) = %v, %v, want updated", created, err)
+	}
+	// 更新保留已用的 20
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 2, 100))); got != 60 {
+		t.Errorf("granted = %d after update, want 60 of the new 80 with 20 used", got)
+	}
+}
+
+func TestPutProfileEndpoint(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+
+	var body struct {
+		ProfileID int  `json:"profile_id"`
+		Created   bool `json:"created"`
+	}
+	rec := serve(t, handler, http.MethodPut, "/api/v1/profiles/2", ProfileConfig{TotalQuota: 50})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT new profile status = %d, body %s", rec.Code, rec.Body)
+	}
+	decodeBody(t, rec, &body)
+	if !body.Created || body.ProfileID != 2 {
+		t.Errorf("PUT new profile body = %+v, want created profile 2", body)
+	}
+
+	rec = serve(t, handler, http.MethodPut, "/api/v1/profiles/2", ProfileConfig{TotalQuota: 70})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT existing profile status = %d, want 200 rather than a conflict", rec.Code)
+	}
+	decodeBody(t, rec, &body)
+	if body.Created {
+		t.Error("PUT existing profile reported created")
+	}
+	if got := s.quotaManager.GetProfiles()[2].TotalQuota; got != 70 {
+		t.Errorf("total quota = %d after PUT, want 70", got)
+	}
+
+	if rec := serve(t, handler, http.MethodPut, "/api/v1/profiles/2", ProfileConfig{TotalQuota: -1}); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT invalid config status = %d, want 400", rec.Code)
+	}
+}
+
+func TestCreateProfileEndpoint(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+
+	rec := serve(t, handler, http.MethodPost, "/api/v1/profiles", profileEntry{ProfileID: 2, ProfileConfig: ProfileConfig{TotalQuota: 50}})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST status = %d, want 201", rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("POST Content-Type = %q, want application/json", contentType)
+	}
+
+	rec = serve(t, handler, http.MethodPost, "/api/v1/profiles", profileEntry{ProfileID: 2, ProfileConfig: ProfileConfig{TotalQuota: 50}})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("POST duplicate status = %d, want 409", rec.Code)
+	}
+}
+
+// 整体替换写回 provider 中途失败时，provider 和内存中的配置都保持替换之前的状态
+func TestReplaceProfilesRollsBackFailedPersist(t *testing.T) {
+	provider := &writableMockProvider{
+		mockProvider: newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 50}}),
+		failSet:      map[int]bool{3: true},
+	}
+	qm := NewQuotaManagerWithProvider(testRefreshInterval, provider)
+	qm.CheckQuota(quotaRequest("node-1", 2, 10))
+
+	err := qm.ReplaceProfiles(map[int]ProfileConfig{1: {TotalQuota: 200}, 3: {TotalQuota: 30}})
+	if err == nil {
+		t.Fatal("ReplaceProfiles succeeded, want the persist failure")
+	}
+
+	want := map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 50}}
+	if got := provider.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("provider after rollback = %v, want %v", got, want)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 2, 100))); got != 40 {
+		t.Fatalf("profile 2 granted %d after failed swap, want the remaining 40", got)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 200))); got != 100 {
+		t.Fatalf("profile 1 granted %d after failed swap, want its original 100", got)
+	}
+}
+
+// 整体替换保留新旧集合都有的 profile 的用量，移除的 profile 上等待配额的请求立即返回 profile 不存在
+func TestReplaceProfilesSwapsAndWakesWaiters(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 50}})
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 30)))
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 2, 50)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := waitInBackground(qm, ctx, quotaRequest("node-2", 2, 10))
+	time.Sleep(50 * time.Millisecond)
+
+	if err := qm.ReplaceProfiles(map[int]ProfileConfig{1: {TotalQuota: 200}, 3: {TotalQuota: 30}}); err != nil {
+		t.Fatalf("ReplaceProfiles: %v", err)
+	}
+
+	select {
+	case result := <-results:
+		if result.err != nil || !result.resp.Quotas[0].NotFound {
+			t.Fatalf("WaitQuota = %+v, %v, want profile not found", result.resp, result.err)
+		}
+		if result.elapsed > time.Second {
+			t.Fatalf("WaitQuota returned after %v, want promptly after the swap", result.elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("swap did not wake the request waiting on the removed profile")
+	}
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 200))); got != 170 {
+		t.Fatalf("profile 1 granted %d after the swap, want 170 with its usage kept", got)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 3, 30))); got != 30 {
+		t.Fatalf("new profile 3 granted %d, want 30", got)
+	}
+}
+
+func TestDiagnoseUnsatisfiableProfileConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ProfileConfig
+		problem string
+		warning string
+	}{
+		{
+			name:    "window rate control with zero rate",
+			config:  ProfileConfig{TotalQuota: 100, RateControlMethod: common.RateControlFixedWindow, Window: time.Second},
+			problem: "rate_limit is 0 with window rate control, every request will be rate limited",
+		},
+		{
+			name:    "token bucket with zero burst",
+			config:  ProfileConfig{TotalQuota: 100, RateLimit: 10, RateControlMethod: common.RateControlTokenBucket, Window: time.Second},
+			problem: "burst is 0 with token bucket rate control, every request will be rate limited",
+		},
+		{
+			name:    "token bucket never refilled",
+			config:  ProfileConfig{TotalQuota: 100, Burst: 10, RateControlMethod: common.RateControlTokenBucket, Window: time.Second},
+			warning: "rate_limit is 0 with token bucket rate control, tokens are never refilled after the initial burst",
+		},
+		{
+			name: "path limit allowing nothing",
+			config: ProfileConfig{TotalQuota: 100, PathLimits: []PathRateLimit{
+				{PathPattern: "/orders/*", Window: time.Second, RateControlMethod: common.RateControlFixedWindow},
+			}},
+			problem: `path limit " /orders/*" allows no requests`,
+		},
+		{
+			name:    "rate settings without a method",
+			config:  ProfileConfig{TotalQuota: 100, RateLimit: 10},
+			warning: "rate_limit, burst or window is set but rate_control_method is none, rate limiting is disabled",
+		},
+		{
+			name:    "zero total quota",
+			config:  ProfileConfig{},
+			warning: "total_quota is 0, nothing will be granted until the profile is boosted",
+		},
+		{
+			name:    "max per request above total quota",
+			config:  ProfileConfig{TotalQuota: 100, MaxPerRequest: 200},
+			warning: "max_per_request exceeds total_quota and has no effect",
+		},
+		{
+			name:   "consistent",
+			config: ProfileConfig{TotalQuota: 100, RateLimit: 10, Burst: 10, Window: time.Second, RateControlMethod: common.RateControlTokenBucket},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, warnings := diagnoseProfileConfig(tt.config)
+			if !diagnosed(problems, tt.problem) || !diagnosed(warnings, tt.warning) {
+				t.Fatalf("diagnoseProfileConfig = problems %q, warnings %q; want problem %q, warning %q",
+					problems, warnings, tt.problem, tt.warning)
+			}
+
+			err := validateProfileConfig(tt.config, false)
+			if (tt.problem != "") != (err != nil) {
+				t.Fatalf("validateProfileConfig = %v, want an error only for problems", err)
+			}
+			if err := validateProfileConfig(tt.config, true); (tt.problem != "" || tt.warning != "") != (err != nil) {
+				t.Fatalf("strict validateProfileConfig = %v, want an error for problems and warnings", err)
+			}
+		})
+	}
+}
+
+// diagnosed 判断诊断结果恰好是 want（want 为空时没有任何诊断）
+func diagnosed(got []string, want string) bool {
+	if want == "" {
+		return len(got) == 0
+	}
+	return len(got) == 1 && got[0] == want
+}
+
+// 构造时无法返回错误，问题配置记录为错误日志；更新时直接拒绝
+func TestUnsatisfiableProfileDiagnosedAtConstructionAndUpdate(t *testing.T) {
+	logger := &capturingLogger{}
+	bad := ProfileConfig{TotalQuota: 100, RateControlMethod: common.RateControlSlidingWindow, Window: time.Second}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: bad}, WithLogger(logger))
+
+	entries := logger.find("ERROR", "profile can never be satisfied")
+	if len(entries) != 1 || entries[0].args["profile_id"] != 1 {
+		t.Fatalf("construction diagnostics = %+v, want one error for profile 1", entries)
+	}
+
+	if _, err := qm.PutProfile(2, bad); !errors.Is(err, common.ErrInvalidRequest) {
+		t.Fatalf("PutProfile(unsatisfiable) = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestMismatchedRateConfigDiagnosed(t *testing.T) {
+	const unused = "rate_limit, burst or window is set but rate_control_method is none, rate limiting is disabled"
+	for name, config := range map[string]ProfileConfig{
+		"window without a method": {TotalQuota: 100, Window: time.Second},
+		"burst without a method":  {TotalQuota: 100, Burst: 5},
+		"all rate fields":         {TotalQuota: 100, RateLimit: 10, Burst: 10, Window: time.Second},
+	} {
+		if _, warnings := diagnoseProfileConfig(config); !diagnosed(warnings, unused) {
+			t.Errorf("%s: warnings = %q, want %q", name, warnings, unused)
+		}
+	}
+
+	// 反过来，启用了速率控制却缺少对应的字段
+	if err := validateProfileConfig(ProfileConfig{TotalQuota: 100, RateLimit: 10, RateControlMethod: common.RateControlFixedWindow}, false); !errors.Is(err, common.ErrInvalidRequest) {
+		t.Errorf("fixed window without a window: err = %v, want ErrInvalidRequest", err)
+	}
+	if err := validateProfileConfig(ProfileConfig{TotalQuota: 100, Window: time.Second, RateControlMethod: common.RateControlTokenBucket}, false); !errors.Is(err, common.ErrInvalidRequest) {
+		t.Errorf("token bucket without rate or burst: err = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestMismatchedRateConfigWarnsOrRejectsOnUpdate(t *testing.T) {
+	mismatched := ProfileConfig{TotalQuota: 100, RateLimit: 10, Window: time.Second}
+
+	logger := &capturingLogger{}
+	_, lenient := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}, Logger: logger})
+	if rec := serve(t, lenient, http.MethodPut, "/api/v1/profiles/2", mismatched); rec.Code != http.StatusOK {
+		t.Fatalf("lenient PUT status = %d, want 200", rec.Code)
+	}
+	entries := logger.find("WARN", "suspicious profile configuration")
+	if len(entries) != 1 || entries[0].args["profile_id"] != 2 {
+		t.Fatalf("warnings = %+v, want one for profile 2", entries)
+	}
+
+	_, strict := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}, StrictProfiles: true})
+	if rec := serve(t, strict, http.MethodPut, "/api/v1/profiles/2", mismatched); rec.Code != http.StatusBadRequest {
+		t.Fatalf("strict PUT status = %d, want 400", rec.Code)
+	}
+}
+
+func TestProfileImportWithInvalidEntryChangesNothing(t *testing.T) {
+	provider := &writableMockProvider{
+		mockProvider: newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 100}}),
+	}
+	server, handler := newTestServer(t, &ServerConfig{ProfileProvider: provider})
+
+	entries := []map[string]any{
+		{"profile_id": 1, "total_quota": 500},
+		{"profile_id": 2, "total_quota": 50},
+		{"profile_id": 3, "total_quota": -1},
+		{"profile_id": 4, "total_quota": 10},
+	}
+	rec := serve(t, handler, http.MethodPost, "/api/v1/profiles/import", entries)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("import status = %d, want 400", rec.Code)
+	}
+	var body struct {
+		Error     string `json:"error"`
+		ProfileID int    `json:"profile_id"`
+	}
+	decodeBody(t, rec, &body)
+	if body.ProfileID != 3 || body.Error == "" {
+		t.Fatalf("import error = %+v, want profile 3 reported with a reason", body)
+	}
+
+	want := map[int]ProfileConfig{1: {TotalQuota: 100}}
+	if got := provider.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("provider after failed import = %v, want %v", got, want)
+	}
+	if got := granted(t, server.quotaManager.CheckQuota(quotaRequest("node-1", 1, 500))); got != 100 {
+		t.Fatalf("profile 1 granted %d after failed import, want its original 100", got)
+	}
+	for _, profileID := range []int{2, 4} {
+		if resp := server.quotaManager.CheckQuota(quotaRequest("node-1", profileID, 10)); !resp.Quotas[0].NotFound {
+			t.Errorf("profile %d exists after failed import, want not found", profileID)
+		}
+	}
+}
+
+func TestImportProfilesRollsBackFailedPersist(t *testing.T) {
+	provider := &writableMockProvider{
+		mockProvider: newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 100}}),
+		failSet:      map[int]bool{3: true},
+	}
+	qm := NewQuotaManagerWithProvider(testRefreshInterval, provider)
+
+	err := qm.ImportProfiles(map[int]ProfileConfig{1: {TotalQuota: 500}, 2: {TotalQuota: 50}, 3: {TotalQuota: 30}})
+	var importErr *ProfileImportError
+	if !errors.As(err, &importErr) || importErr.ProfileID != 3 {
+		t.Fatalf("ImportProfiles = %v, want a *ProfileImportError for profile 3", err)
+	}
+
+	want := map[int]ProfileConfig{1: {TotalQuota: 100}}
+	if got := provider.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("provider after rollback = %v, want %v", got, want)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 500))); got != 100 {
+		t.Fatalf("profile 1 granted %d after failed import, want its original 100", got)
+	}
+}
+
+func TestListProfilesJSONShape(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{
+		2: {TotalQuota: 50, Description: "batch"},
+		1: {TotalQuota: 100, RateLimit: 10, Burst: 20, Window: time.Second, RateControlMethod: common.RateControlTokenBucket, Description: "api"},
+	}})
+
+	rec := serve(t, handler, http.MethodGet, "/api/v1/profiles", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var entries []map[string]any
+	decodeBody(t, rec, &entries)
+	if len(entries) != 2 {
+		t.Fatalf("got %d profiles, want 2", len(entries))
+	}
+
+	want := map[string]any{
+		"profile_id":          1.0,
+		"total_quota":         100.0,
+		"rate_limit":          10.0,
+		"burst":               20.0,
+		"window":              float64(time.Second),
+		"rate_control_method": "token_bucket",
+		"description":         "api",
+	}
+	for key, value := range want {
+		if entries[0][key] != value {
+			t.Errorf("profiles[0].%s = %v, want %v", key, entries[0][key], value)
+		}
+	}
+	if entries[1]["profile_id"] != 2.0 || entries[1]["rate_control_method"] != "none" {
+		t.Errorf("profiles[1] = %v, want profile 2 with method none", entries[1])
+	}
+}
+
+func TestPatchBurstClampsTokensWithoutTouchingQuota(t *testing.T) {
+	clock := newFakeClock()
+	s, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{
+		1: {TotalQuota: 100, RateLimit: 10, Burst: 20, Window: time.Second, RateControlMethod: common.RateControlTokenBucket},
+	}})
+	withClock(clock)(s.quotaManager)
+	granted(t, s.quotaManager.CheckQuota(quotaRequest("node-1", 1, 30)))
+	if tokens := s.quotaManager.profiles[1].rate.Tokens; tokens != 19 {
+		t.Fatalf("tokens before patch = %d, want 19", tokens)
+	}
+
+	rec := serve(t, handler, http.MethodPatch, "/api/v1/profiles/1", map[string]any{"burst": 5})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	profile := s.quotaManager.profiles[1]
+	if profile.rate.Tokens != 5 {
+		t.Errorf("tokens after patch = %d, want clamped to the new burst 5", profile.rate.Tokens)
+	}
+	if profile.config.Burst != 5 || profile.config.RateLimit != 10 || profile.config.Window != time.Second {
+		t.Errorf("config after patch = %+v, want only burst changed", profile.config)
+	}
+	if profile.usedQuota != 30 || profile.totalQuota != 100 {
+		t.Errorf("quota after patch = %d/%d, want 30/100 untouched", profile.usedQuota, profile.totalQuota)
+	}
+
+	if rec := serve(t, handler, http.MethodPatch, "/api/v1/profiles/1", map[string]any{"total_quota": 500}); rec.Code != http.StatusBadRequest {
+		t.Errorf("patching total_quota status = %d, want 400", rec.Code)
+	}
+	if rec := serve(t, handler, http.MethodPatch, "/api/v1/profiles/9", map[string]any{"burst": 5}); rec.Code != http.StatusNotFound {
+		t.Errorf("patching an unknown profile status = %d, want 404", rec.Code)
+	}
+}
+
+func TestUpdateProfileHotSwapsConfig(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: fixedWindow(2, time.Minute)}, withClock(clock), WithLogger(discardLogger()))
+	qm.CheckQuota(quotaRequest("node-1", 1, 300))
+	qm.CheckQuota(quotaRequest("node-1", 1, 100))
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+		t.Fatal("third request admitted, want the 2-per-minute window exhausted")
+	}
+
+	// 同一种速率控制方法：保留用量和窗口，新的速率立即生效
+	if err := qm.UpdateProfile(1, ProfileConfig{TotalQuota: 1000, RateLimit: 3, Window: time.Minute, RateControlMethod: common.RateControlFixedWindow}); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if used := qm.profiles[1].usedQuota; used != 400 {
+		t.Fatalf("usedQuota after update = %d, want the preserved 400", used)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 50))); got != 50 {
+		t.Fatalf("granted %d under the raised rate limit, want 50", got)
+	}
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+		t.Fatal("fourth request admitted, want the existing window kept")
+	}
+
+	// 改变速率控制方法：窗口重新开始，用量仍然保留
+	if err := qm.UpdateProfile(1, ProfileConfig{TotalQuota: 500, RateLimit: 5, Burst: 5, Window: time.Minute, RateControlMethod: common.RateControlTokenBucket}); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if rate := qm.profiles[1].rate; rate.RequestCount != 0 || !rate.LastWindowTime.IsZero() {
+		t.Fatalf("rate state after method change = %+v, want a fresh window", rate)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 100))); got != 50 {
+		t.Fatalf("granted %d after shrinking the quota, want the remaining 50 of 500 with 450 used", got)
+	}
+
+	// 新的 profile ID 创建全新状态
+	if err := qm.UpdateProfile(2, ProfileConfig{TotalQuota: 30}); err != nil {
+		t.Fatalf("UpdateProfile(new): %v", err)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 2, 100))); got != 30 {
+		t.Fatalf("new profile granted %d, want its full 30", got)
+	}
+}
+
+func TestUpdateProfileRejectsInvalidConfig(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+
+	invalid := map[string]ProfileConfig{
+		"negative total quota": {TotalQuota: -1},
+		"negative rate limit":  {TotalQuota: 100, RateLimit: -1, Window: time.Second, RateControlMethod: common.RateControlFixedWindow},
+		"negative burst":       {TotalQuota: 100, RateLimit: 1, Burst: -1, Window: time.Second, RateControlMethod: common.RateControlTokenBucket},
+		"zero window":          {TotalQuota: 100, RateLimit: 1, Burst: 1, RateControlMethod: common.RateControlTokenBucket},
+	}
+	for name, config := range invalid {
+		if err := qm.UpdateProfile(1, config); !errors.Is(err, common.ErrInvalidRequest) {
+			t.Errorf("%s: UpdateProfile = %v, want ErrInvalidRequest", name, err)
+		}
+	}
+	if got := qm.GetProfiles()[1]; got.TotalQuota != 100 || got.RateControlMethod != common.RateControlNone {
+		t.Fatalf("profile after rejected updates = %+v, want the original config", got)
+	}
+}
+
+func TestRemoveActiveProfile(t *testing.T) {
+	provider := &writableMockProvider{
+		mockProvider: newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 1000}, 2: {TotalQuota: 100}}),
+	}
+	s, handler := newTestServer(t, &ServerConfig{ProfileProvider: provider})
+	granted(t, s.quotaManager.CheckQuota(quotaRequest("node-1", 1, 10)))
+
+	// 删除期间并发的配额检查要么正常分配，要么报告 profile 不存在
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q := s.quotaManager.CheckQuota(quotaRequest("node-1", 1, 5)).Quotas[0]
+			if !q.NotFound && q.Granted != 5 {
+				t.Errorf("concurrent check = %+v, want a full grant or not found", q)
+			}
+		}()
+	}
+	rec := serve(t, handler, http.MethodDelete, "/api/v1/profiles/1", nil)
+	wg.Wait()
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	q := s.quotaManager.CheckQuota(quotaRequest("node-1", 1, 5)).Quotas[0]
+	if !q.NotFound || q.Granted != 0 || q.Reason != common.ErrProfileNotFound.Error() {
+		t.Fatalf("check after removal = %+v, want profile not found", q)
+	}
+	if _, exists := provider.snapshot()[1]; exists {
+		t.Fatal("profile 1 still in the provider, it would be loaded again")
+	}
+	if got := granted(t, s.quotaManager.CheckQuota(quotaRequest("node-1", 2, 5))); got != 5 {
+		t.Fatalf("profile 2 granted %d after removing profile 1, want 5", got)
+	}
+	if rec := serve(t, handler, http.MethodDelete, "/api/v1/profiles/1", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("second DELETE status = %d, want 404", rec.Code)
+	}
+	if err := s.quotaManager.RemoveProfile(1); !errors.Is(err, common.ErrProfileNotFound) {
+		t.Fatalf("RemoveProfile(removed) = %v, want ErrProfileNotFound", err)
+	}
+}
+
+func TestRemoveProfileFromReadOnlyProvider(t *testing.T) {
+	qm := NewQuotaManagerWithProvider(testRefreshInterval, newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 100}}))
+	if err := qm.RemoveProfile(1); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("RemoveProfile = %v, want errors.ErrUnsupported", err)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 5))); got != 5 {
+		t.Fatalf("granted %d after a refused removal, want 5", got)
+	}
+}
@@ -0,0 +1,150 @@
+package central
+
+import (
+	"math"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// GetProjectedAvailability 预测 horizon 时间内 profile 最多能获得的配额
+// 结果为当前剩余配额加上 horizon 内每次刷新恢复的 TotalQuota，
+// 并受速率限制约束：每个刷新周期的配额至少需要一次速率许可才能取得，
+// 因此速率许可数少于周期数时只计算最早的若干个周期
+func (qm *QuotaManager) GetProjectedAvailability(profileID int, horizon time.Duration) int64 {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	profileMgr, exists := qm.getProfileLocked(profileID)
+	if !exists || horizon < 0 {
+		return 0
+	}
+
+	now := qm.now()
+	segments := []int64{max(profileMgr.effectiveQuota(now)-profileMgr.usedQuota, 0)}
+	next := qm.nextRefresh(now)
+	for i := int64(0); i < qm.refreshesWithin(now, horizon); i++ {
+		refreshAt := next.Add(time.Duration(i) * qm.refreshInterval)
+		segments = append(segments, profileMgr.effectiveQuota(refreshAt))
+	}
+
+	admissions := profileMgr.rateAdmissions(now, horizon)
+
+	var projected int64
+	for i, segment := range segments {
+		if int64(i) >= admissions {
+			break
+		}
+		projected += segment
+	}
+	return projected
+}
+
+// refreshesWithin 计算 (now, now+horizon] 内发生的刷新次数
+func (qm *QuotaManager) refreshesWithin(now time.Time, horizon time.Duration) int64 {
+	if qm.refreshInterval <= 0 {
+		return 0
+	}
+
+	next := qm.nextRefresh(now)
+	end := now.Add(horizon)
+	if next.After(end) {
+		return 0
+	}
+	return 1 + int64(end.Sub(next)/qm.refreshInterval)
+}
+
+// nextRefresh 返回 now 之后的下一次刷新时间
+func (qm *QuotaManager) nextRefresh(now time.Time) time.Time {
+	next := qm.lastRefresh.Add(qm.refreshInterval)
+	if qm.refreshInterval <= 0 {
+		return next
+	}
+	for !next.After(now) {
+		next = next.Add(qm.refreshInterval)
+	}
+	return next
+}
+
+// rateAdmissions 在不修改状态的情况下估算 horizon 内允许的请求次数
+// 未启用速率控制时返回 math.MaxInt64
+func (pm *ProfileManager) rateAdmissions(now time.Time, horizon time.Duration) int64 {
+	limit := pm.rateLimit()
+	state := pm.rate
+	elapsed := now.Sub(state.LastWindowTime)
+
+	switch limit.Method {
+	case common.RateControlTokenBucket:
+		tokens := state.Tokens
+		if elapsed > limit.Window {
+			tokens = limit.Burst
+		}
+		tokens = min(tokens+int64(elapsed.Seconds()*float64(limit.Rate)), limit.Burst)
+		return tokens + int64(horizon.Seconds()*float64(limit.Rate))
+
+	case common.RateControlFixedWindow:
+		if limit.Window <= 0 {
+			return 0
+		}
+		current := limit.Rate - state.RequestCount
+		start, expired := state.Window(limit, now)
+		if expired {
+			current = limit.Rate
+		}
+		windowEnd := start.Add(limit.Window)
+		admissions := max(current, 0)
+		if end := now.Add(horizon); end.After(windowEnd) {
+			windows := 1 + int64(end.Sub(windowEnd)/limit.Window)
+			admissions += windows * limit.Rate
+		}
+		return admissions
+
+	case common.RateControlSlidingWindow, common.RateControlSlidingCost:
+		if limit.Window <= 0 {
+			return 0
+		}
+		// 按当前估算的剩余加上之后每个窗口的全部许可估算；成本限流下每个请求成本至少为 1，结果为上限
+		state.Slide(limit, now)
+		admissions := max(limit.Rate-int64(math.Ceil(state.SlidingCount(limit, now))), 0)
+		windows := int64(horizon / limit.Window)
+		return admissions + windows*limit.Rate
+
+	case common.RateControlGCRA:
+		// 当前可立即放行的突发加上之后按固定间隔匀速放行的许可
+		remaining, _, ok := state.GCRARemaining(limit, now)
+		if !ok {
+			return 0
+		}
+		return remaining + int64(horizon)*limit.Rate/int64(limit.Window)
+
+	default:
+		return math.MaxInt64
+	}
+}
+
+// CanSatisfy 不消耗配额地检查计划中的所有 profile 当前是否都能满足
+// plan 为 profileID 到所需配额的映射；不能全部满足时返回每个 profile 的缺口
+// 未知 profile 的缺口为全部所需配额
+func (qm *QuotaManager) CanSatisfy(plan map[int]int64) (bool, map[int]int64) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	shortfall := make(map[int]int64)
+	for profileID, required := range plan {
+		var remaining int64
+		if profileMgr, exists := qm.profiles[profileID]; exists {
+			remaining = max(profileMgr.effectiveQuota(qm.now())-profileMgr.usedQuota, 0)
+		} else if config, err := qm.provider.GetProfile(profileID); err == nil {
+			// 尚未加载的 profile 还没有任何用量
+			remaining = config.TotalQuota
+		}
+
+		if required > remaining {
+			shortfall[profileID] = required - remaining
+		}
+	}
+
+	if len(shortfall) > 0 {
+		return false, shortfall
+	}
+	return true, nil
+}
@@ -0,0 +1,94 @@
+package central
+
+import (
+	"net/http"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestProjectedAvailabilityAcrossRefreshBoundary(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(time.Minute, map[int]ProfileConfig{1: {TotalQuota: 100}}, withClock(clock))
+	qm.CheckQuota(quotaRequest("node-1", 1, 40))
+	clock.Advance(30 * time.Second)
+
+	tests := []struct {
+		horizon time.Duration
+		want    int64
+	}{
+		{horizon: 20 * time.Second, want: 60},  // 下一次刷新之前只有当前剩余
+		{horizon: 30 * time.Second, want: 160}, // 刚好包含下一次刷新
+		{horizon: 45 * time.Second, want: 160},
+		{horizon: 95 * time.Second, want: 260}, // 跨过两次刷新
+	}
+	for _, tt := range tests {
+		if got := qm.GetProjectedAvailability(1, tt.horizon); got != tt.want {
+			t.Errorf("GetProjectedAvailability(1, %v) = %d, want %d", tt.horizon, got, tt.want)
+		}
+	}
+	if got := qm.GetProjectedAvailability(2, time.Minute); got != 0 {
+		t.Errorf("projection for an unknown profile = %d, want 0", got)
+	}
+}
+
+func TestProjectedAvailabilityBoundedByRateLimit(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(time.Minute, map[int]ProfileConfig{1: {
+		TotalQuota:        100,
+		RateLimit:         1,
+		Window:            time.Hour,
+		RateControlMethod: common.RateControlFixedWindow,
+	}}, withClock(clock))
+
+	// 一小时只允许一次请求，之后的刷新周期无法取得配额
+	if got := qm.GetProjectedAvailability(1, 3*time.Minute); got != 100 {
+		t.Errorf("projection = %d, want only the current window's 100", got)
+	}
+}
+
+func TestProjectionEndpoint(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+
+	rec := serve(t, handler, http.MethodGet, "/api/v1/quota/projection?profile_id=1&horizon=90m", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Projected int64 `json:"projected"`
+	}
+	decodeBody(t, rec, &body)
+	if body.Projected != 200 {
+		t.Errorf("projected = %d, want 200 with one hourly refresh in 90m", body.Projected)
+	}
+
+	if rec := serve(t, handler, http.MethodGet, "/api/v1/quota/projection?profile_id=1&horizon=soon", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid horizon status = %d, want 400", rec.Code)
+	}
+}
+
+func TestCanSatisfyReportsShortfall(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{
+		1: {TotalQuota: 100},
+		2: {TotalQuota: 50},
+		3: {TotalQuota: 300},
+	})
+	qm.CheckQuota(quotaRequest("node-1", 3, 150))
+
+	ok, shortfall := qm.CanSatisfy(map[int]int64{1: 100, 2: 50, 3: 200, 4: 10})
+	if ok {
+		t.Fatal("CanSatisfy reported an over-committed plan as satisfiable")
+	}
+	want := map[int]int64{3: 50, 4: 10}
+	if len(shortfall) != len(want) || shortfall[3] != want[3] || shortfall[4] != want[4] {
+		t.Errorf("shortfall = %v, want %v", shortfall, want)
+	}
+
+	ok, shortfall = qm.CanSatisfy(map[int]int64{1: 100, 2: 50, 3: 150})
+	if !ok || shortfall != nil {
+		t.Errorf("CanSatisfy = %v, %v for a plan within remaining quota, want true, nil", ok, shortfall)
+	}
+	if used := qm.profiles[1].usedQuota; used != 0 {
+		t.Errorf("CanSatisfy consumed quota: used = %d", used)
+	}
+}
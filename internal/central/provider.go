@@ -0,0 +1,160 @@
+package central
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// ProfileConfigProvider profile 配置来源
+// 多租户部署可以实现基于数据库的 provider，QuotaManager 按需读取并在每次刷新时重新加载
+type ProfileConfigProvider interface {
+	// GetProfile 获取单个 profile 配置，不存在时返回 common.ErrProfileNotFound
+	GetProfile(profileID int) (ProfileConfig, error)
+	// ListProfiles 列出所有 profile ID
+	ListProfiles() ([]int, error)
+}
+
+// ProfileConfigWriter 可写的配置来源
+// 运行时修改的配置会写回 provider，避免下次刷新重新加载时被旧配置覆盖
+type ProfileConfigWriter interface {
+	SetProfile(profileID int, config ProfileConfig) error
+	DeleteProfile(profileID int) error
+}
+
+// StaticProfileProvider 基于静态 map 的配置提供者，是默认实现
+type StaticProfileProvider struct {
+	mu       sync.RWMutex
+	profiles map[int]ProfileConfig
+}
+
+// NewStaticProfileProvider 创建静态配置提供者
+func NewStaticProfileProvider(profileConfigs map[int]ProfileConfig) *StaticProfileProvider {
+	profiles := make(map[int]ProfileConfig, len(profileConfigs))
+	for profileID, config := range profileConfigs {
+		profiles[profileID] = config
+	}
+	return &StaticProfileProvider{profiles: profiles}
+}
+
+// GetProfile 获取单个 profile 配置
+func (p *StaticProfileProvider) GetProfile(profileID int) (ProfileConfig, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	config, exists := p.profiles[profileID]
+	if !exists {
+		return ProfileConfig{}, common.ErrProfileNotFound
+	}
+	return config, nil
+}
+
+// ListProfiles 列出所有 profile ID
+func (p *StaticProfileProvider) ListProfiles() ([]int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	profileIDs := make([]int, 0, len(p.profiles))
+	for profileID := range p.profiles {
+		profileIDs = append(profileIDs, profileID)
+	}
+	sort.Ints(profileIDs)
+	return profileIDs, nil
+}
+
+// SetProfile 新增或替换 profile 配置
+func (p *StaticProfileProvider) SetProfile(profileID int, config ProfileConfig) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.profiles[profileID] = config
+	return nil
+}
+
+// DeleteProfile 删除 profile 配置
+func (p *StaticProfileProvider) DeleteProfile(profileID int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.profiles, profileID)
+	return nil
+}
+
+// CachedProfileProvider 为慢速 provider（如数据库）增加缓存，缓存过期后重新加载
+type CachedProfileProvider struct {
+	backend ProfileConfigProvider
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	entries  map[int]cachedProfile
+	list     []int
+	listedAt time.Time
+}
+
+type cachedProfile struct {
+	config   ProfileConfig
+	err      error
+	loadedAt time.Time
+}
+
+// NewCachedProfileProvider 创建带缓存的配置提供者
+func NewCachedProfileProvider(backend ProfileConfigProvider, ttl time.Duration) *CachedProfileProvider {
+	return &CachedProfileProvider{
+		backend: backend,
+		ttl:     ttl,
+		entries: make(map[int]cachedProfile),
+	}
+}
+
+// GetProfile 获取单个 profile 配置，缓存未过期时不访问后端
+// 后端出错时若有旧缓存则继续使用旧配置
+func (p *CachedProfileProvider) GetProfile(profileID int) (ProfileConfig, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, exists := p.entries[profileID]
+	if exists && time.Since(entry.loadedAt) < p.ttl {
+		return entry.config, entry.err
+	}
+
+	config, err := p.backend.GetProfile(profileID)
+	if err != nil && exists && entry.err == nil && !errors.Is(err, common.ErrProfileNotFound) {
+		return entry.config, nil
+	}
+
+	p.entries[profileID] = cachedProfile{config: config, err: err, loadedAt: time.Now()}
+	return config, err
+}
+
+// ListProfiles 列出所有 profile ID
+func (p *CachedProfileProvider) ListProfiles() ([]int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.list != nil && time.Since(p.listedAt) < p.ttl {
+		return p.list, nil
+	}
+
+	profileIDs, err := p.backend.ListProfiles()
+	if err != nil {
+		if p.list != nil {
+			return p.list, nil
+		}
+		return nil, err
+	}
+
+	p.list = profileIDs
+	p.listedAt = time.Now()
+	return profileIDs, nil
+}
+
+// Invalidate 清空缓存，下次读取时从后端重新加载
+func (p *CachedProfileProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.entries = make(map[int]cachedProfile)
+	p.list = nil
+}
@@ -0,0 +1,144 @@
+package central
+
+import (
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+	"throttle_control/internal/common"
+)
+
+// mockProvider 记录每个 profile 被读取次数的配置来源
+type mockProvider struct {
+	mu       sync.Mutex
+	profiles map[int]ProfileConfig
+	gets     map[int]int
+	err      error
+}
+
+func newMockProvider(profiles map[int]ProfileConfig) *mockProvider {
+	return &mockProvider{profiles: profiles, gets: make(map[int]int)}
+}
+
+func (p *mockProvider) GetProfile(profileID int) (ProfileConfig, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.gets[profileID]++
+	if p.err != nil {
+		return ProfileConfig{}, p.err
+	}
+	config, exists := p.profiles[profileID]
+	if !exists {
+		return ProfileConfig{}, common.ErrProfileNotFound
+	}
+	return config, nil
+}
+
+func (p *mockProvider) ListProfiles() ([]int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	profileIDs := make([]int, 0, len(p.profiles))
+	for profileID := range p.profiles {
+		profileIDs = append(profileIDs, profileID)
+	}
+	return profileIDs, p.err
+}
+
+func (p *mockProvider) getCount(profileID int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.gets[profileID]
+}
+
+// writableMockProvider 可写的 mockProvider，写入 failSet 中的 profile 时失败
+type writableMockProvider struct {
+	*mockProvider
+	failSet map[int]bool
+}
+
+func (p *writableMockProvider) SetProfile(profileID int, config ProfileConfig) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failSet[profileID] {
+		return errors.New("provider write failed")
+	}
+	p.profiles[profileID] = config
+	return nil
+}
+
+func (p *writableMockProvider) DeleteProfile(profileID int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.profiles, profileID)
+	return nil
+}
+
+// snapshot 返回 provider 当前保存的配置
+func (p *writableMockProvider) snapshot() map[int]ProfileConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maps.Clone(p.profiles)
+}
+
+func TestManagerLoadsProfilesLazilyFromProvider(t *testing.T) {
+	provider := newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 50}})
+	qm := NewQuotaManagerWithProvider(testRefreshInterval, provider)
+
+	if got := provider.getCount(1); got != 0 {
+		t.Fatalf("profile 1 read %d times before any request, want 0", got)
+	}
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 30))); got != 30 {
+		t.Fatalf("granted = %d, want 30", got)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 80))); got != 70 {
+		t.Fatalf("granted = %d, want the remaining 70", got)
+	}
+	if got := provider.getCount(1); got != 1 {
+		t.Errorf("profile 1 read %d times, want 1 (loaded once, then cached)", got)
+	}
+	if got := provider.getCount(2); got != 0 {
+		t.Errorf("profile 2 read %d times without being requested, want 0", got)
+	}
+
+	resp := qm.CheckQuota(quotaRequest("node-1", 3, 10))
+	if !resp.Quotas[0].NotFound || resp.Quotas[0].Granted != 0 {
+		t.Errorf("unknown profile response = %+v, want not found with no grant", resp.Quotas[0])
+	}
+}
+
+func TestManagerProviderErrorDeniesRequest(t *testing.T) {
+	provider := newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 100}})
+	provider.err = errors.New("database unavailable")
+	qm := NewQuotaManagerWithProvider(testRefreshInterval, provider, WithLogger(discardLogger()))
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 10))); got != 0 {
+		t.Fatalf("granted = %d while provider fails, want 0", got)
+	}
+
+	provider.mu.Lock()
+	provider.err = nil
+	provider.mu.Unlock()
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 10))); got != 10 {
+		t.Fatalf("granted = %d after provider recovers, want 10", got)
+	}
+}
+
+func TestManagerReloadsProviderConfigOnRefresh(t *testing.T) {
+	provider := newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 100}})
+	qm := NewQuotaManagerWithProvider(testRefreshInterval, provider)
+	qm.CheckQuota(quotaRequest("node-1", 1, 100))
+
+	provider.mu.Lock()
+	provider.profiles[1] = ProfileConfig{TotalQuota: 300}
+	provider.mu.Unlock()
+	qm.refresh()
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 500))); got != 300 {
+		t.Fatalf("granted = %d after refresh, want the reloaded total 300", got)
+	}
+}
@@ -0,0 +1,275 @@
+package central
+
+import (
+	"math"
+	"path"
+	"strings"
+	"throttle_control/internal/common"
+	"throttle_control/internal/ratelimit"
+	"time"
+)
+
+// PathRateLimit 针对某个 API 方法/路径的子速率限制
+// 同一 profile 下不同路径的请求使用相互独立的速率状态
+type PathRateLimit struct {
+	Method            string                   `json:"method,omitempty"`    // HTTP 方法，空表示任意方法
+	PathPattern       string                   `json:"path_pattern"`        // 路径模式，语法同 path.Match
+	RateLimit         int64                    `json:"rate_limit"`          // 每秒最大请求数
+	Burst             int64                    `json:"burst"`               // 突发请求数
+	Window            time.Duration            `json:"window"`              // 速率窗口大小
+	RateControlMethod common.RateControlMethod `json:"rate_control_method"` // 速率控制方法
+	// PerPath 为 true 时命中模式的每个具体路径（如 /users/* 下的每个用户）使用独立的子桶，
+	// 子桶数量受 ProfileConfig.MaxDimensions 限制；为 false 时命中模式的所有路径共享一个子桶
+	PerPath bool `json:"per_path,omitempty"`
+}
+
+// DimensionOverflow 按路径区分的子速率桶数量达到 MaxDimensions 后新路径的处理策略
+type DimensionOverflow int
+
+const (
+	DimensionOverflowEvict  DimensionOverflow = iota // 淘汰最久未使用的子桶（默认）
+	DimensionOverflowShared                          // 新维度共用一个兜底子桶
+	DimensionOverflowReject                          // 拒绝新维度的请求
+)
+
+// sharedDimensionKey 溢出时同一模式下的新路径共用的兜底子桶
+const sharedDimensionKey = "*"
+
+// profileRateLimit 返回 profile 级别的速率控制参数
+func (c ProfileConfig) profileRateLimit() ratelimit.Limit {
+	return ratelimit.Limit{
+		Method:  c.RateControlMethod,
+		Rate:    c.RateLimit,
+		Burst:   c.Burst,
+		Window:  c.Window,
+		Aligned: c.AlignWindow,
+	}
+}
+
+// rateLimit 返回子速率限制的参数
+func (l PathRateLimit) rateLimit() ratelimit.Limit {
+	return ratelimit.Limit{
+		Method: l.RateControlMethod,
+		Rate:   l.RateLimit,
+		Burst:  l.Burst,
+		Window: l.Window,
+	}
+}
+
+// matches 判断请求的方法和路径是否命中该子限制
+func (l PathRateLimit) matches(method, requestPath string) bool {
+	if l.Method != "" && !strings.EqualFold(l.Method, method) {
+		return false
+	}
+	matched, err := path.Match(l.PathPattern, requestPath)
+	return err == nil && matched
+}
+
+// key 子限制的组合键，用于区分同一 profile 下的速率状态
+func (l PathRateLimit) key() string {
+	return strings.ToUpper(l.Method) + " " + l.PathPattern
+}
+
+// dimensionKey 请求路径对应的子桶键，PerPath 时按具体路径区分
+func (l PathRateLimit) dimensionKey(requestPath string) string {
+	if !l.PerPath {
+		return l.key()
+	}
+	return l.key() + " " + requestPath
+}
+
+// allowRate 检查 profile 级别和路径级别的速率控制，cost 为请求的成本（本次请求的配额数量）
+// 先在状态副本上检查所有限制，全部通过后才提交，被任何一个限制拒绝的请求不消耗其他限制的许可
+func (pm *ProfileManager) allowRate(quota common.ProfileQuota, cost int64, now time.Time, metrics MetricsSink) bool {
+	pm.beginRamp(now)
+	profileState := pm.rate
+	if !profileState.AllowCost(pm.startupLimit(pm.rateLimit(), now), now, cost) {
+		return false
+	}
+
+	pathLimit, matched := pm.matchPathLimit(quota)
+	if !matched {
+		pm.rate = profileState
+		return true
+	}
+	state, ok := pm.dimensionState(pathLimit, quota.Path, now, metrics)
+	if !ok {
+		return false
+	}
+	state.LastUsed = now
+	pathState := *state
+	if !pathState.AllowCost(pathLimit.rateLimit(), now, cost) {
+		return false
+	}
+
+	pm.rate = profileState
+	*state = pathState
+	return true
+}
+
+// matchPathLimit 返回请求命中的第一个子速率限制
+func (pm *ProfileManager) matchPathLimit(quota common.ProfileQuota) (PathRateLimit, bool) {
+	if quota.Path == "" {
+		return PathRateLimit{}, false
+	}
+	for _, pathLimit := range pm.config.PathLimits {
+		if pathLimit.matches(quota.Method, quota.Path) {
+			return pathLimit, true
+		}
+	}
+	return PathRateLimit{}, false
+}
+
+// rateRetryAfter 距请求再次可能通过 profile 及其命中的子速率限制的时间，不修改状态
+func (pm *ProfileManager) rateRetryAfter(quota common.ProfileQuota, cost int64, now time.Time) time.Duration {
+	retryAfter := pm.rate.RetryAfter(pm.startupLimit(pm.rateLimit(), now), now, cost)
+	if pathLimit, matched := pm.matchPathLimit(quota); matched {
+		if state, exists := pm.dimensions[pathLimit.dimensionKey(quota.Path)]; exists {
+			retryAfter = max(retryAfter, state.RetryAfter(pathLimit.rateLimit(), now, cost))
+		}
+	}
+	return retryAfter
+}
+
+// dimensionState 获取请求路径对应的子速率桶，不存在时创建
+// 按具体路径区分的子桶取值来自请求，数量达到 MaxDimensions 时按 DimensionOverflow 处理，
+// 防止路径取值失控导致内存无限增长；按模式共享的子桶数量由配置决定，不计入上限，也不会被淘汰。
+// 拒绝新路径时返回 false
+func (pm *ProfileManager) dimensionState(pathLimit PathRateLimit, requestPath string, now time.Time, metrics MetricsSink) (*ratelimit.State, bool) {
+	key := pathLimit.dimensionKey(requestPath)
+	if state, exists := pm.dimensions[key]; exists {
+		return state, true
+	}
+
+	if maxDimensions := pm.config.MaxDimensions; pathLimit.PerPath && maxDimensions > 0 && pm.perPathDimensions() >= maxDimensions {
+		switch pm.config.DimensionOverflow {
+		case DimensionOverflowShared:
+			// 兜底子桶每个模式一个，不计入上限
+			key = pathLimit.key() + " " + sharedDimensionKey
+			if state, exists := pm.dimensions[key]; exists {
+				return state, true
+			}
+		case DimensionOverflowReject:
+			return nil, false
+		default:
+			pm.evictDimension()
+			metrics.IncrCounter(metricDimensionEvictions, profileLabels(pm.profileID), 1)
+		}
+	}
+
+	state := &ratelimit.State{LastUsed: now}
+	pm.dimensions[key] = state
+	return state, true
+}
+
+// perPathKey 判断子桶是否按具体请求路径区分，按模式共享的子桶和兜底子桶返回 false
+func (pm *ProfileManager) perPathKey(key string) bool {
+	for _, pathLimit := range pm.config.PathLimits {
+		if key == pathLimit.key() || key == pathLimit.key()+" "+sharedDimensionKey {
+			return false
+		}
+	}
+	return true
+}
+
+// perPathDimensions 按具体请求路径区分的子桶数量
+func (pm *ProfileManager) perPathDimensions() int {
+	var count int
+	for key := range pm.dimensions {
+		if pm.perPathKey(key) {
+			count++
+		}
+	}
+	return count
+}
+
+// evictDimension 淘汰最久未使用的按路径区分的子桶，按模式共享的子桶不会被淘汰
+func (pm *ProfileManager) evictDimension() {
+	var oldestKey string
+	var oldest time.Time
+	for key, state := range pm.dimensions {
+		if !pm.perPathKey(key) {
+			continue
+		}
+		if oldestKey == "" || state.LastUsed.Before(oldest) {
+			oldestKey, oldest = key, state.LastUsed
+		}
+	}
+	delete(pm.dimensions, oldestKey)
+}
+
+// RateLimitStatus 速率限制状态，对应标准的 X-RateLimit-* 响应头
+type RateLimitStatus struct {
+	Limit     int64     // 窗口内（或令牌桶容量）允许的请求数
+	Remaining int64     // 当前剩余的请求数
+	Reset     time.Time // 剩余请求数恢复到 Limit 的时间
+}
+
+// RateLimitStatus 返回 profiles 中限制最严格（剩余最少）的 profile 的速率状态
+// 所有 profile 都未启用速率控制或都不存在时返回 false
+func (qm *QuotaManager) RateLimitStatus(profileIDs []int) (RateLimitStatus, bool) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	now := qm.now()
+	var result RateLimitStatus
+	found := false
+	for _, profileID := range profileIDs {
+		profileMgr, exists := qm.profiles[profileID]
+		if !exists {
+			continue
+		}
+		status, ok := profileMgr.rateStatus(now)
+		if !ok {
+			continue
+		}
+		if !found || status.Remaining < result.Remaining {
+			result, found = status, true
+		}
+	}
+	return result, found
+}
+
+// rateStatus 计算 profile 级别速率状态，在状态副本上补充令牌和滑动窗口，不修改状态
+func (pm *ProfileManager) rateStatus(now time.Time) (RateLimitStatus, bool) {
+	limit := pm.rateLimit()
+	state := pm.rate
+
+	switch limit.Method {
+	case common.RateControlTokenBucket:
+		state.Refill(limit, now)
+		remaining := max(state.Tokens, 0)
+		reset := now
+		if missing := limit.Burst - remaining; missing > 0 && limit.Rate > 0 {
+			reset = now.Add(time.Duration(float64(missing) / float64(limit.Rate) * float64(time.Second)))
+		}
+		return RateLimitStatus{Limit: limit.Burst, Remaining: remaining, Reset: reset}, true
+
+	case common.RateControlFixedWindow:
+		start, expired := state.Window(limit, now)
+		remaining := limit.Rate - state.RequestCount
+		if expired {
+			remaining = limit.Rate
+		}
+		return RateLimitStatus{Limit: limit.Rate, Remaining: max(remaining, 0), Reset: start.Add(limit.Window)}, true
+
+	case common.RateControlSlidingWindow, common.RateControlSlidingCost:
+		// 成本限流时 Limit 和 Remaining 为成本预算
+		if limit.Window <= 0 {
+			return RateLimitStatus{}, false
+		}
+		state.Slide(limit, now)
+		remaining := limit.Rate - int64(math.Ceil(state.SlidingCount(limit, now)))
+		return RateLimitStatus{Limit: limit.Rate, Remaining: max(remaining, 0), Reset: state.LastWindowTime.Add(limit.Window)}, true
+
+	case common.RateControlGCRA:
+		remaining, full, ok := state.GCRARemaining(limit, now)
+		if !ok {
+			return RateLimitStatus{}, false
+		}
+		return RateLimitStatus{Limit: max(limit.Burst, 1), Remaining: remaining, Reset: full}, true
+
+	default:
+		return RateLimitStatus{}, false
+	}
+}
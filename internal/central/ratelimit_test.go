@@ -0,0 +1,391 @@
+package central
+
+import (
+	"net/http"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// pathRequest 构造带方法和路径的单个 profile 配额请求
+func pathRequest(profileID int, method, requestPath string) common.QuotaRequest {
+	return common.QuotaRequest{
+		NodeID: "node-1",
+		Quotas: []common.ProfileQuota{{ProfileID: profileID, Required: 1, Method: method, Path: requestPath}},
+	}
+}
+
+// fixedWindow 每 window 最多 rate 次的固定窗口配置
+func fixedWindow(rate int64, window time.Duration) ProfileConfig {
+	return ProfileConfig{
+		TotalQuota:        1000,
+		RateLimit:         rate,
+		Window:            window,
+		RateControlMethod: common.RateControlFixedWindow,
+	}
+}
+
+func TestPathLimitsAreIndependent(t *testing.T) {
+	config := fixedWindow(3, time.Minute)
+	config.PathLimits = []PathRateLimit{
+		{Method: http.MethodGet, PathPattern: "/orders/*", RateLimit: 1, Window: time.Minute, RateControlMethod: common.RateControlFixedWindow},
+		{PathPattern: "/users/*", RateLimit: 1, Window: time.Minute, RateControlMethod: common.RateControlFixedWindow},
+	}
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock))
+
+	steps := []struct {
+		method, path string
+		admitted     bool
+	}{
+		{http.MethodGet, "/orders/1", true},
+		{http.MethodGet, "/orders/2", false}, // 订单路径的许可已用完
+		{http.MethodPost, "/users/1", true},  // 用户路径的状态独立
+		{http.MethodPost, "/users/2", false},
+		{http.MethodPost, "/orders/1", true}, // 方法不匹配，只受 profile 限制
+		{http.MethodGet, "/health", false},   // profile 的 3 次许可已用完
+	}
+	for _, step := range steps {
+		resp := qm.CheckQuota(pathRequest(1, step.method, step.path))
+		if admitted := !resp.Quotas[0].RateLimited; admitted != step.admitted {
+			t.Errorf("%s %s admitted = %v, want %v", step.method, step.path, admitted, step.admitted)
+		}
+	}
+}
+
+func TestPathLimitDenialDoesNotConsumeProfilePermit(t *testing.T) {
+	config := fixedWindow(2, time.Minute)
+	config.PathLimits = []PathRateLimit{
+		{PathPattern: "/orders/*", RateLimit: 1, Window: time.Minute, RateControlMethod: common.RateControlFixedWindow},
+	}
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock))
+
+	qm.CheckQuota(pathRequest(1, http.MethodGet, "/orders/1"))
+	for i := 0; i < 5; i++ {
+		if resp := qm.CheckQuota(pathRequest(1, http.MethodGet, "/orders/2")); !resp.Quotas[0].RateLimited {
+			t.Fatal("second order request was not limited by the path limit")
+		}
+	}
+
+	// 被路径限制拒绝的请求没有消耗 profile 的许可，profile 还剩一次
+	if resp := qm.CheckQuota(pathRequest(1, http.MethodGet, "/users/1")); resp.Quotas[0].RateLimited {
+		t.Error("profile permit was consumed by requests the path limit denied")
+	}
+}
+
+func TestAlignedFixedWindowResetsAtClockBoundary(t *testing.T) {
+	config := fixedWindow(2, time.Second)
+	config.AlignWindow = true
+	clock := newFakeClock()
+	clock.Advance(900 * time.Millisecond)
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock))
+
+	for i := 0; i < 2; i++ {
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); resp.Quotas[0].RateLimited {
+			t.Fatalf("request %d limited within the window", i)
+		}
+	}
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+		t.Fatal("third request in the window was admitted")
+	}
+
+	// 100ms 后到达时钟边界，新窗口开始；非对齐窗口要等到第一次请求后的 1 秒
+	clock.Advance(100 * time.Millisecond)
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); resp.Quotas[0].RateLimited {
+		t.Error("request after the clock boundary was limited")
+	}
+}
+
+// 按路径区分的子桶达到上限时淘汰最久未使用的一个，按模式共享的子桶不计入上限也不会被淘汰
+func TestMaxDimensionsEvictsLeastRecentlyUsedPath(t *testing.T) {
+	clock := newFakeClock()
+	sink := &capturingSink{}
+	config := fixedWindow(100, time.Minute)
+	config.MaxDimensions = 2
+	config.PathLimits = []PathRateLimit{
+		{PathPattern: "/admin/*", RateLimit: 2, Window: time.Minute, RateControlMethod: common.RateControlFixedWindow},
+		{PathPattern: "/users/*", RateLimit: 1, Window: time.Minute, RateControlMethod: common.RateControlFixedWindow, PerPath: true},
+	}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock), WithMetricsSink(sink))
+
+	check := func(requestPath string) bool {
+		t.Helper()
+		clock.Advance(time.Second)
+		return !qm.CheckQuota(pathRequest(1, http.MethodGet, requestPath)).Quotas[0].RateLimited
+	}
+
+	check("/admin/x")
+	check("/users/a")
+	check("/users/b")
+	if check("/users/a") {
+		t.Fatal("second /users/a request allowed, want its own bucket limited")
+	}
+	check("/users/c")
+
+	dimensions := qm.profiles[1].dimensions
+	if _, exists := dimensions[" /users/* /users/b"]; exists {
+		t.Error("least recently used /users/b bucket not evicted")
+	}
+	for _, key := range []string{" /users/* /users/a", " /users/* /users/c", " /admin/*"} {
+		if _, exists := dimensions[key]; !exists {
+			t.Errorf("bucket %q evicted, want kept", key)
+		}
+	}
+	if got := sink.counter(metricDimensionEvictions, profileLabels(1)); got != 1 {
+		t.Errorf("evictions = %v, want 1", got)
+	}
+
+	// 共享子桶保留了已用的许可，没有因为淘汰被重置
+	if !check("/admin/y") {
+		t.Fatal("second /admin request limited, want allowed")
+	}
+	if check("/admin/z") {
+		t.Fatal("third /admin request allowed, want the shared bucket limited")
+	}
+}
+
+// 令牌桶的剩余令牌包含距上次请求补充的部分，查询本身不修改状态
+func TestRateLimitStatusRefillsTokenBucket(t *testing.T) {
+	clock := newFakeClock()
+	config := ProfileConfig{
+		TotalQuota:        1000,
+		RateLimit:         1,
+		Burst:             5,
+		Window:            time.Minute,
+		RateControlMethod: common.RateControlTokenBucket,
+	}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock))
+	for i := 0; i < 5; i++ {
+		qm.CheckQuota(quotaRequest("node-1", 1, 1))
+	}
+
+	clock.Advance(2 * time.Second)
+	before := qm.profiles[1].rate
+	status, ok := qm.RateLimitStatus([]int{1})
+	if !ok {
+		t.Fatal("RateLimitStatus reported no rate control")
+	}
+	if status.Limit != 5 || status.Remaining != 2 {
+		t.Fatalf("status = %+v, want limit 5 with 2 refilled tokens", status)
+	}
+	if want := clock.Now().Add(3 * time.Second); !status.Reset.Equal(want) {
+		t.Errorf("reset = %v, want %v", status.Reset, want)
+	}
+	if after := qm.profiles[1].rate; after != before {
+		t.Fatalf("rate state changed by status query: %+v -> %+v", before, after)
+	}
+}
+
+func TestSlidingWindowPreventsBoundaryBurst(t *testing.T) {
+	// 第一个窗口末尾放满，刚跨过边界后再尽量多发，统计边界附近一个 window 内通过的请求数
+	burstAcrossBoundary := func(method common.RateControlMethod) int {
+		config := fixedWindow(10, time.Second)
+		config.RateControlMethod = method
+		clock := newFakeClock()
+		qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock))
+
+		allowed := 0
+		send := func(n int) {
+			for i := 0; i < n; i++ {
+				if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+					allowed++
+				}
+			}
+		}
+		send(1)
+		clock.Advance(900 * time.Millisecond)
+		send(9)
+		clock.Advance(200 * time.Millisecond)
+		send(20)
+		return allowed
+	}
+
+	// 固定窗口在 [0.9s, 1.1s] 内放行了 2 倍的速率
+	if got := burstAcrossBoundary(common.RateControlFixedWindow); got != 20 {
+		t.Fatalf("fixed window allowed %d, want the 2x boundary burst of 20", got)
+	}
+	// 滑动窗口在 1.1s 时上一窗口还计入 90%，[0.1s, 1.1s] 内最多 10 次
+	if got := burstAcrossBoundary(common.RateControlSlidingWindow); got != 11 {
+		t.Fatalf("sliding window allowed %d, want 11 (10 + 1 after the boundary)", got)
+	}
+}
+
+func TestExhaustedQuotaDoesNotConsumeRateTokens(t *testing.T) {
+	config := ProfileConfig{TotalQuota: 5, RateLimit: 1, Burst: 10, Window: time.Minute, RateControlMethod: common.RateControlTokenBucket}
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock))
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 5))); got != 5 {
+		t.Fatalf("granted %d, want the whole quota of 5", got)
+	}
+	for i := 0; i < 20; i++ {
+		resp := qm.CheckQuota(quotaRequest("node-1", 1, 1))
+		if resp.Quotas[0].Granted != 0 || resp.Quotas[0].RateLimited {
+			t.Fatalf("exhausted request %d = %+v, want a quota denial rather than a rate limit", i, resp.Quotas[0])
+		}
+	}
+
+	// 配额耗尽后的拒绝没有消耗令牌，桶里还剩第一次请求后的 9 个
+	if tokens := qm.profiles[1].rate.Tokens; tokens != 9 {
+		t.Fatalf("rate tokens = %d, want 9", tokens)
+	}
+}
+
+func TestRetryAfterBoundsPerMethod(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ProfileConfig
+		required int64
+		elapsed  time.Duration // 用完许可后、被限制的请求之前经过的时间
+		min, max time.Duration
+	}{
+		{
+			name:     "token bucket",
+			config:   ProfileConfig{TotalQuota: 1000, RateLimit: 10, Burst: 10, Window: time.Second, RateControlMethod: common.RateControlTokenBucket},
+			required: 1,
+			min:      90 * time.Millisecond,
+			max:      100*time.Millisecond + time.Millisecond,
+		},
+		{
+			name:     "fixed window",
+			config:   fixedWindow(2, 10*time.Second),
+			required: 1,
+			elapsed:  3 * time.Second,
+			min:      7 * time.Second,
+			max:      7*time.Second + time.Millisecond,
+		},
+		{
+			name:     "sliding window",
+			config:   ProfileConfig{TotalQuota: 1000, RateLimit: 2, Window: 10 * time.Second, RateControlMethod: common.RateControlSlidingWindow},
+			required: 1,
+			elapsed:  3 * time.Second,
+			min:      7 * time.Second,
+			max:      7*time.Second + time.Millisecond,
+		},
+		{
+			name:     "sliding cost",
+			config:   ProfileConfig{TotalQuota: 1000, RateLimit: 10, Window: 10 * time.Second, RateControlMethod: common.RateControlSlidingCost},
+			required: 5,
+			elapsed:  3 * time.Second,
+			// 窗口结束后上一窗口的成本 10 还要衰减一半，才能留出本次的 5
+			min: 12 * time.Second,
+			max: 12*time.Second + time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: tt.config}, withClock(clock), WithLogger(discardLogger()))
+
+			var limited common.ProfileQuotaResponse
+			for i := 0; i < 100; i++ {
+				resp := qm.CheckQuota(quotaRequest("node-1", 1, tt.required))
+				if resp.Quotas[0].RateLimited {
+					if i == 0 {
+						t.Fatal("first request rate limited")
+					}
+					clock.Advance(tt.elapsed)
+					limited = qm.CheckQuota(quotaRequest("node-1", 1, tt.required)).Quotas[0]
+					break
+				}
+			}
+			if !limited.RateLimited {
+				t.Fatalf("request after %v = %+v, want rate limited", tt.elapsed, limited)
+			}
+			if limited.RetryAfter < tt.min || limited.RetryAfter > tt.max {
+				t.Fatalf("RetryAfter = %v, want within [%v, %v]", limited.RetryAfter, tt.min, tt.max)
+			}
+
+			// 按建议的时间重试即可通过
+			clock.Advance(limited.RetryAfter)
+			if resp := qm.CheckQuota(quotaRequest("node-1", 1, tt.required)); resp.Quotas[0].RateLimited {
+				t.Fatalf("request after waiting RetryAfter %v still rate limited", limited.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestSlidingCostLimitsByTotalCost(t *testing.T) {
+	config := ProfileConfig{TotalQuota: 100000, RateLimit: 100, Window: 10 * time.Second, RateControlMethod: common.RateControlSlidingCost}
+
+	t.Run("many cheap requests", func(t *testing.T) {
+		qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(newFakeClock()), WithLogger(discardLogger()))
+		for i := 0; i < 100; i++ {
+			if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); resp.Quotas[0].RateLimited {
+				t.Fatalf("cheap request %d rate limited within the cost budget", i+1)
+			}
+		}
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+			t.Fatal("101st cheap request admitted, want the budget of 100 exhausted")
+		}
+	})
+
+	t.Run("few expensive requests", func(t *testing.T) {
+		clock := newFakeClock()
+		qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock), WithLogger(discardLogger()))
+		for i := 0; i < 2; i++ {
+			if resp := qm.CheckQuota(quotaRequest("node-1", 1, 40)); resp.Quotas[0].RateLimited {
+				t.Fatalf("expensive request %d rate limited within the cost budget", i+1)
+			}
+		}
+		// 第三个 40 超出预算，被拒绝且不计入成本，剩余的 20 仍然可用
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 40)); !resp.Quotas[0].RateLimited {
+			t.Fatal("third expensive request admitted, want 120 to exceed the budget of 100")
+		}
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 20)); resp.Quotas[0].RateLimited {
+			t.Fatal("request costing the remaining 20 rate limited")
+		}
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+			t.Fatal("request admitted with the budget fully spent")
+		}
+
+		// 下一个窗口过半时，上一窗口的 100 衰减到 50
+		clock.Advance(15 * time.Second)
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 50)); resp.Quotas[0].RateLimited {
+			t.Fatal("request costing 50 rate limited after half the previous window's cost slid out")
+		}
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+			t.Fatal("request admitted beyond the sliding budget")
+		}
+	})
+}
+
+func TestGCRAProfilePacesRequests(t *testing.T) {
+	clock := newFakeClock()
+	// 每秒 10 个，即每 100ms 一个，最多一次放行 2 个
+	config := ProfileConfig{TotalQuota: 1000, RateLimit: 10, Burst: 2, Window: time.Second, RateControlMethod: common.RateControlGCRA}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock), WithLogger(discardLogger()))
+
+	for i := 0; i < 2; i++ {
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); resp.Quotas[0].RateLimited {
+			t.Fatalf("burst request %d rate limited", i+1)
+		}
+	}
+	resp := qm.CheckQuota(quotaRequest("node-1", 1, 1))
+	if !resp.Quotas[0].RateLimited {
+		t.Fatal("request beyond the burst admitted")
+	}
+	if resp.Quotas[0].RetryAfter != 100*time.Millisecond {
+		t.Fatalf("retry after = %v, want one emission interval", resp.Quotas[0].RetryAfter)
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	status, ok := qm.RateLimitStatus([]int{1})
+	if !ok {
+		t.Fatal("RateLimitStatus reported no rate control")
+	}
+	if status.Limit != 2 || status.Remaining != 1 {
+		t.Fatalf("status = %+v, want limit 2 with 1 permit available", status)
+	}
+	if want := clock.Now().Add(100 * time.Millisecond); !status.Reset.Equal(want) {
+		t.Errorf("reset = %v, want %v", status.Reset, want)
+	}
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); resp.Quotas[0].RateLimited {
+		t.Fatal("request rate limited after the emission interval")
+	}
+	if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+		t.Fatal("second request admitted within one interval")
+	}
+}
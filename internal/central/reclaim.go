@@ -0,0 +1,119 @@
+package central
+
+import (
+	"sort"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// ReclaimQuota 从持有 profile 配额的节点回收最多 needed 的配额，归还给 profile 供重新分配
+// 按节点的陈旧程度排序：最久未上报状态的节点最先被回收，
+// 同样陈旧时优先回收利用率低（剩余配额占比高）的节点，尽量不影响活跃节点。
+// 每个节点最多回收 nodeReclaimableLocked 的数量，从未上报状态的节点不回收。
+// 分配时剩余配额不足会自动回收，也可以由运维手动触发。返回每个节点被回收的数量
+func (qm *QuotaManager) ReclaimQuota(profileID int, needed int64) (map[string]int64, error) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	profileMgr, exists := qm.getProfileLocked(profileID)
+	if !exists {
+		return nil, common.ErrProfileNotFound
+	}
+	return qm.reclaimLocked(profileMgr, needed, ""), nil
+}
+
+// reclaimLocked 按回收顺序从 exclude 以外的节点回收最多 needed 的配额，调用方必须持有写锁
+// 回收的部分同时从节点上报的剩余配额中扣除，在节点下次上报之前不会被重复回收
+func (qm *QuotaManager) reclaimLocked(profileMgr *ProfileManager, needed int64, exclude string) map[string]int64 {
+	reclaimed := make(map[string]int64)
+	for _, nodeID := range qm.reclaimOrderLocked(profileMgr) {
+		if needed <= 0 {
+			break
+		}
+		if nodeID == exclude {
+			continue
+		}
+
+		amount := min(qm.nodeReclaimableLocked(profileMgr, nodeID), needed)
+		if amount <= 0 {
+			continue
+		}
+
+		profileMgr.nodeUsed[nodeID] -= amount
+		if profileMgr.nodeUsed[nodeID] == 0 {
+			delete(profileMgr.nodeUsed, nodeID)
+		}
+		if node := qm.nodes[nodeID]; node.state != common.StateOffline {
+			node.quotaLeft -= amount
+		}
+		profileMgr.usedQuota -= amount
+		qm.releaseLocked(profileMgr, nodeID, amount)
+		reclaimed[nodeID] = amount
+		needed -= amount
+	}
+
+	if len(reclaimed) > 0 {
+		qm.recordUsage(profileMgr)
+		qm.notifyQuotaFreedLocked(profileMgr.profileID)
+	}
+	return reclaimed
+}
+
+// nodeReclaimableLocked 节点在 profile 中可以被回收的配额，调用方必须持有锁
+// 离线节点的全部份额都可以回收；在线节点上报的剩余配额是所有 profile 的合计，
+// 按节点在各 profile 中持有的份额比例折算到本 profile，且不超过节点在本 profile 中的份额；
+// 从未上报状态的节点无从判断是否用完，不回收
+func (qm *QuotaManager) nodeReclaimableLocked(profileMgr *ProfileManager, nodeID string) int64 {
+	used := profileMgr.nodeUsed[nodeID]
+	node, registered := qm.nodes[nodeID]
+	switch {
+	case !registered || used <= 0:
+		return 0
+	case node.state == common.StateOffline:
+		return used
+	}
+
+	quotaLeft := max(node.quotaLeft, 0)
+	var nodeTotal int64
+	for _, pm := range qm.profiles {
+		nodeTotal += max(pm.nodeUsed[nodeID], 0)
+	}
+	if nodeTotal <= 0 {
+		return 0
+	}
+	return min(int64(float64(quotaLeft)*float64(used)/float64(nodeTotal)), used)
+}
+
+// reclaimOrderLocked 返回持有 profile 配额的节点，按回收优先级排序
+func (qm *QuotaManager) reclaimOrderLocked(profileMgr *ProfileManager) []string {
+	nodeIDs := make([]string, 0, len(profileMgr.nodeUsed))
+	for nodeID := range profileMgr.nodeUsed {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+
+	lastSeen := func(nodeID string) time.Time {
+		if node, registered := qm.nodes[nodeID]; registered {
+			return node.lastSeen
+		}
+		return time.Time{}
+	}
+	idleRatio := func(nodeID string) float64 {
+		used := profileMgr.nodeUsed[nodeID]
+		if used <= 0 {
+			return 1
+		}
+		return float64(qm.nodeReclaimableLocked(profileMgr, nodeID)) / float64(used)
+	}
+
+	sort.Slice(nodeIDs, func(i, j int) bool {
+		a, b := nodeIDs[i], nodeIDs[j]
+		if seenA, seenB := lastSeen(a), lastSeen(b); !seenA.Equal(seenB) {
+			return seenA.Before(seenB)
+		}
+		if idleA, idleB := idleRatio(a), idleRatio(b); idleA != idleB {
+			return idleA > idleB
+		}
+		return a < b
+	})
+	return nodeIDs
+}
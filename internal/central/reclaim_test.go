@@ -0,0 +1,74 @@
+package central
+
+import (
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// reportStatus 以 lastSeen 和剩余配额上报节点状态
+func reportStatus(qm *QuotaManager, nodeID string, lastSeen time.Time, quotaLeft int64) {
+	qm.UpdateNodeStatus(common.NodeStatus{NodeID: nodeID, State: common.StateOnline, LastSeen: lastSeen, QuotaLeft: quotaLeft})
+}
+
+func TestReclaimPrefersStalerNode(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, withClock(clock))
+	qm.CheckQuota(quotaRequest("node-stale", 1, 40))
+	qm.CheckQuota(quotaRequest("node-active", 1, 40))
+	reportStatus(qm, "node-stale", clock.Now().Add(-10*time.Minute), 30)
+	reportStatus(qm, "node-active", clock.Now(), 30)
+
+	reclaimed, err := qm.ReclaimQuota(1, 20)
+	if err != nil {
+		t.Fatalf("ReclaimQuota: %v", err)
+	}
+	if reclaimed["node-stale"] != 20 || reclaimed["node-active"] != 0 {
+		t.Fatalf("reclaimed = %v, want all 20 from node-stale", reclaimed)
+	}
+
+	// node-stale 只剩 10 未用完，其余从活跃节点回收
+	reclaimed, _ = qm.ReclaimQuota(1, 20)
+	if reclaimed["node-stale"] != 10 || reclaimed["node-active"] != 10 {
+		t.Fatalf("second reclaim = %v, want 10 from each node", reclaimed)
+	}
+	if used := qm.profiles[1].usedQuota; used != 40 {
+		t.Fatalf("usedQuota = %d, want 40 after reclaiming 40", used)
+	}
+}
+
+// 节点上报的剩余配额是所有 profile 的合计，按持有份额折算到单个 profile
+func TestReclaimApportionsNodeWideQuotaLeft(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 100}})
+	qm.CheckQuota(common.QuotaRequest{
+		NodeID: "node-a",
+		Quotas: []common.ProfileQuota{{ProfileID: 1, Required: 60}, {ProfileID: 2, Required: 20}},
+	})
+	reportStatus(qm, "node-a", time.Now(), 40)
+
+	reclaimed, _ := qm.ReclaimQuota(1, 100)
+	if reclaimed["node-a"] != 30 {
+		t.Fatalf("reclaimed = %v, want 30 (three quarters of the 40 left)", reclaimed)
+	}
+}
+
+func TestAllocationReclaimsFromIdleNodes(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}}, withClock(clock))
+	qm.CheckQuota(quotaRequest("node-unreported", 1, 10))
+	qm.CheckQuota(quotaRequest("node-a", 1, 90))
+	reportStatus(qm, "node-a", clock.Now().Add(-time.Minute), 60)
+
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-b", 1, 50))); got != 50 {
+		t.Fatalf("granted = %d, want 50 reclaimed from node-a's unused quota", got)
+	}
+	pm := qm.profiles[1]
+	if pm.nodeUsed["node-a"] != 40 || pm.usedQuota != 100 {
+		t.Fatalf("node-a holds %d, usedQuota %d, want 40 and 100", pm.nodeUsed["node-a"], pm.usedQuota)
+	}
+
+	// 已回收的部分不会被重复回收，未上报状态的节点不回收
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-b", 1, 50))); got != 10 {
+		t.Fatalf("granted = %d, want only the 10 node-a still reported unused", got)
+	}
+}
@@ -0,0 +1,130 @@
+package central
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RedisEvaler 执行 Lua 脚本的 Redis 客户端
+// 例如 go-redis 可以包装为 client.Eval(ctx, script, keys, args...).Result()
+type RedisEvaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// defaultRedisTimeout 单次 Redis 调用的默认超时
+const defaultRedisTimeout = time.Second
+
+// RedisQuotaStore 基于 Redis 的共享计数存储，所有扣减通过 Lua 脚本原子完成，多个中心实例共享同一份用量
+// 同一个 profile 的键使用相同的 hash tag，可以在 Redis Cluster 中使用
+type RedisQuotaStore struct {
+	client     RedisEvaler
+	prefix     string
+	resetAfter time.Duration // 距上次清零不足该时长的清零请求被忽略
+	timeout    time.Duration
+	logger     swappableLogger
+}
+
+// NewRedisQuotaStore 创建 Redis 存储，prefix 为键前缀，refreshInterval 为各中心实例的刷新周期，
+// 同一周期内各实例的重复清零只生效一次
+func NewRedisQuotaStore(client RedisEvaler, prefix string, refreshInterval time.Duration) *RedisQuotaStore {
+	return &RedisQuotaStore{
+		client:     client,
+		prefix:     prefix,
+		resetAfter: refreshInterval / 2,
+		timeout:    defaultRedisTimeout,
+	}
+}
+
+// KEYS: limit, used, nodes  ARGV: n, node
+const redisConsumeScript = `
+local limit = tonumber(redis.call('GET', KEYS[1]))
+if not limit then return 0 end
+local used = tonumber(redis.call('GET', KEYS[2])) or 0
+local granted = math.min(tonumber(ARGV[1]), limit - used)
+if granted <= 0 then return 0 end
+redis.call('INCRBY', KEYS[2], granted)
+redis.call('HINCRBY', KEYS[3], ARGV[2], granted)
+return granted
+`
+
+// KEYS: used, nodes  ARGV: n, node
+const redisReleaseScript = `
+local used = tonumber(redis.call('GET', KEYS[1])) or 0
+local amount = math.min(tonumber(ARGV[1]), used)
+if amount <= 0 then return 0 end
+redis.call('DECRBY', KEYS[1], amount)
+if redis.call('HINCRBY', KEYS[2], ARGV[2], -amount) <= 0 then
+	redis.call('HDEL', KEYS[2], ARGV[2])
+end
+return amount
+`
+
+// KEYS: used, nodes, reset  ARGV: 去重时长（毫秒），0 表示不去重
+const redisResetScript = `
+if ARGV[1] ~= '0' and not redis.call('SET', KEYS[3], '1', 'NX', 'PX', ARGV[1]) then
+	return 0
+end
+redis.call('DEL', KEYS[1], KEYS[2])
+return 1
+`
+
+// KEYS: limit  ARGV: limit
+const redisSetLimitScript = `return redis.call('SET', KEYS[1], ARGV[1])`
+
+// key 返回 profile 的键，{} 中的部分为 hash tag
+func (s *RedisQuotaStore) key(profileID int, name string) string {
+	return fmt.Sprintf("%s{profile:%d}:%s", s.prefix, profileID, name)
+}
+
+// eval 带超时执行脚本
+func (s *RedisQuotaStore) eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.Eval(ctx, script, keys, args...)
+}
+
+func (s *RedisQuotaStore) SetLimit(profileID int, limit int64) error {
+	_, err := s.eval(redisSetLimitScript, []string{s.key(profileID, "limit")}, limit)
+	return err
+}
+
+func (s *RedisQuotaStore) Consume(profileID int, node string, n int64) (int64, error) {
+	result, err := s.eval(redisConsumeScript,
+		[]string{s.key(profileID, "limit"), s.key(profileID, "used"), s.key(profileID, "nodes")}, n, node)
+	if err != nil {
+		return 0, err
+	}
+	return redisInt(result)
+}
+
+func (s *RedisQuotaStore) Release(profileID int, node string, n int64) error {
+	_, err := s.eval(redisReleaseScript, []string{s.key(profileID, "used"), s.key(profileID, "nodes")}, n, node)
+	return err
+}
+
+func (s *RedisQuotaStore) Reset(profileID int) {
+	keys := []string{s.key(profileID, "used"), s.key(profileID, "nodes"), s.key(profileID, "reset")}
+	if _, err := s.eval(redisResetScript, keys, s.resetAfter.Milliseconds()); err != nil {
+		s.logger.load().Error("redis quota store reset failed", "profile_id", profileID, "error", err)
+	}
+}
+
+func (s *RedisQuotaStore) setLogger(logger Logger) {
+	s.logger.store(logger)
+}
+
+// redisInt 把脚本返回的整数转换为 int64
+func redisInt(result interface{}) (int64, error) {
+	switch v := result.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("unexpected redis result type %T", result)
+	}
+}
@@ -0,0 +1,195 @@
+package central
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis 进程内的 Redis 替身，按 RedisQuotaStore 的脚本在同一份数据上原子地执行对应的命令
+type fakeRedis struct {
+	mu      sync.Mutex
+	strings map[string]int64
+	hashes  map[string]map[string]int64
+	expires map[string]time.Time
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		strings: make(map[string]int64),
+		hashes:  make(map[string]map[string]int64),
+		expires: make(map[string]time.Time),
+	}
+}
+
+func (r *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch script {
+	case redisSetLimitScript:
+		r.strings[keys[0]] = toInt64(args[0])
+		return "OK", nil
+	case redisConsumeScript:
+		limit, exists := r.strings[keys[0]]
+		if !exists {
+			return int64(0), nil
+		}
+		granted := min(toInt64(args[0]), limit-r.strings[keys[1]])
+		if granted <= 0 {
+			return int64(0), nil
+		}
+		r.strings[keys[1]] += granted
+		r.hash(keys[2])[args[1].(string)] += granted
+		return granted, nil
+	case redisReleaseScript:
+		amount := min(toInt64(args[0]), r.strings[keys[0]])
+		if amount <= 0 {
+			return int64(0), nil
+		}
+		r.strings[keys[0]] -= amount
+		nodes := r.hash(keys[1])
+		if nodes[args[1].(string)] -= amount; nodes[args[1].(string)] <= 0 {
+			delete(nodes, args[1].(string))
+		}
+		return amount, nil
+	case redisResetScript:
+		if ttl := toInt64(args[0]); ttl != 0 {
+			if until, exists := r.expires[keys[2]]; exists && time.Now().Before(until) {
+				return int64(0), nil
+			}
+			r.expires[keys[2]] = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+		delete(r.strings, keys[0])
+		delete(r.hashes, keys[1])
+		return int64(1), nil
+	default:
+		return nil, fmt.Errorf("fakeRedis: unknown script")
+	}
+}
+
+// hash 返回 key 对应的 hash，不存在时创建；调用方必须持有锁
+func (r *fakeRedis) hash(key string) map[string]int64 {
+	if _, exists := r.hashes[key]; !exists {
+		r.hashes[key] = make(map[string]int64)
+	}
+	return r.hashes[key]
+}
+
+// used 返回 profile 在 Redis 中记录的用量
+func (r *fakeRedis) used(profileID int) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.strings[fmt.Sprintf("tc:{profile:%d}:used", profileID)]
+}
+
+func toInt64(arg interface{}) int64 {
+	switch v := arg.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	default:
+		panic(fmt.Sprintf("fakeRedis: unexpected argument type %T", arg))
+	}
+}
+
+func TestRedisStoreSharedByTwoManagersDoesNotOverspend(t *testing.T) {
+	redis := newFakeRedis()
+	profiles := map[int]ProfileConfig{1: {TotalQuota: 100}}
+	managers := []*QuotaManager{
+		NewQuotaManager(testRefreshInterval, profiles, WithQuotaStore(NewRedisQuotaStore(redis, "tc:", testRefreshInterval)), WithLogger(discardLogger())),
+		NewQuotaManager(testRefreshInterval, profiles, WithQuotaStore(NewRedisQuotaStore(redis, "tc:", testRefreshInterval)), WithLogger(discardLogger())),
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		total  int64
+		byNode = make(map[string]int64)
+	)
+	for i := 0; i < 50; i++ {
+		for m, qm := range managers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				nodeID := fmt.Sprintf("node-%d", m)
+				resp := qm.CheckQuota(quotaRequest(nodeID, 1, 3))
+				mu.Lock()
+				total += resp.Quotas[0].Granted
+				byNode[nodeID] += resp.Quotas[0].Granted
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+
+	if total != 100 {
+		t.Fatalf("two managers granted %d in total, want exactly the shared 100", total)
+	}
+	if used := redis.used(1); used != 100 {
+		t.Fatalf("redis used = %d, want 100", used)
+	}
+
+	// 一个实例收到的归还可以被另一个实例分配出去
+	returned := min(byNode["node-0"], 10)
+	managers[0].Release("node-0", map[int]int64{1: returned})
+	if got := granted(t, managers[1].CheckQuota(quotaRequest("node-1", 1, 50))); got != returned {
+		t.Fatalf("granted %d after a release on the other manager, want %d", got, returned)
+	}
+}
+
+func TestRedisStoreResetAppliesOncePerRefreshCycle(t *testing.T) {
+	redis := newFakeRedis()
+	store := NewRedisQuotaStore(redis, "tc:", testRefreshInterval)
+	if err := store.SetLimit(1, 100); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Consume(1, "node-1", 60); err != nil || got != 60 {
+		t.Fatalf("Consume = %d, %v, want 60", got, err)
+	}
+
+	store.Reset(1)
+	if used := redis.used(1); used != 0 {
+		t.Fatalf("used after the first reset = %d, want 0", used)
+	}
+
+	// 同一周期内另一个实例的清零不会抹掉新的用量
+	if _, err := store.Consume(1, "node-1", 30); err != nil {
+		t.Fatal(err)
+	}
+	NewRedisQuotaStore(redis, "tc:", testRefreshInterval).Reset(1)
+	if used := redis.used(1); used != 30 {
+		t.Fatalf("used after a duplicate reset = %d, want 30", used)
+	}
+}
+
+// failingRedis 所有调用都失败的 RedisEvaler
+type failingRedis struct{}
+
+func (failingRedis) Eval(context.Context, string, []string, ...interface{}) (interface{}, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRedisStoreLogsThroughManagerLogger(t *testing.T) {
+	logger := &capturingLogger{}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{3: {TotalQuota: 100}},
+		WithQuotaStore(NewRedisQuotaStore(failingRedis{}, "tc:", testRefreshInterval)), WithLogger(logger))
+
+	qm.refresh()
+
+	entries := logger.find("ERROR", "redis quota store reset failed")
+	if len(entries) != 1 || entries[0].args["profile_id"] != 3 {
+		t.Fatalf("reset failure logs = %+v, want one error for profile 3", entries)
+	}
+}
@@ -0,0 +1,134 @@
+package central
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RefreshEvent 一次周期刷新的记录，用于确认刷新按时发生以及每个窗口的消耗
+type RefreshEvent struct {
+	StartedAt time.Time                   `json:"started_at"`
+	Duration  time.Duration               `json:"duration"`
+	Profiles  map[int]ProfileRefreshEvent `json:"profiles"`
+}
+
+// ProfileRefreshEvent 单个 profile 在刷新时的情况
+type ProfileRefreshEvent struct {
+	Consumed  int64 `json:"consumed"`  // 清零前的用量，即本窗口的消耗
+	Reclaimed int64 `json:"reclaimed"` // 清零时从离线节点和未用完份额的节点收回的配额
+	Reset     bool  `json:"reset"`     // 本次刷新是否清零了用量；预算获取失败、预算不要求清零或推迟清零时为 false
+}
+
+// refreshEventBuffer 每个订阅者缓冲的事件数，订阅者读取太慢时丢弃新事件
+const refreshEventBuffer = 16
+
+// refreshFeed 刷新事件的订阅者
+type refreshFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan RefreshEvent]struct{}
+	last        *RefreshEvent
+}
+
+// SubscribeRefreshEvents 订阅刷新事件，返回的 cancel 取消订阅并关闭通道
+// 通道有少量缓冲，订阅者来不及读取时丢弃新事件，不会阻塞刷新
+func (qm *QuotaManager) SubscribeRefreshEvents() (events <-chan RefreshEvent, cancel func()) {
+	ch := make(chan RefreshEvent, refreshEventBuffer)
+	qm.refreshFeed.mu.Lock()
+	qm.refreshFeed.subscribers[ch] = struct{}{}
+	qm.refreshFeed.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			qm.refreshFeed.mu.Lock()
+			delete(qm.refreshFeed.subscribers, ch)
+			qm.refreshFeed.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// LastRefreshEvent 返回最近一次刷新的事件，还没有刷新过时返回 false
+func (qm *QuotaManager) LastRefreshEvent() (RefreshEvent, bool) {
+	qm.refreshFeed.mu.Lock()
+	defer qm.refreshFeed.mu.Unlock()
+
+	if qm.refreshFeed.last == nil {
+		return RefreshEvent{}, false
+	}
+	return *qm.refreshFeed.last, true
+}
+
+// reclaimableLocked 清零时从 profile 收回的配额：离线节点的全部份额，
+// 以及已上报状态的节点未用完的部分（与 ReclaimQuota 的计算一致）；调用方必须持有锁
+func (qm *QuotaManager) reclaimableLocked(profileMgr *ProfileManager) int64 {
+	var reclaimable int64
+	for nodeID := range profileMgr.nodeUsed {
+		reclaimable += qm.nodeReclaimableLocked(profileMgr, nodeID)
+	}
+	return reclaimable
+}
+
+// publishRefreshEvent 输出刷新指标并发送给所有订阅者
+func (qm *QuotaManager) publishRefreshEvent(event RefreshEvent) {
+	qm.metrics.IncrCounter(metricRefreshes, nil, 1)
+	qm.metrics.ObserveHistogram(metricRefreshDuration, nil, event.Duration.Seconds())
+	for profileID, profile := range event.Profiles {
+		labels := profileLabels(profileID)
+		qm.metrics.SetGauge(metricWindowConsumed, labels, float64(profile.Consumed))
+		qm.metrics.IncrCounter(metricQuotaReclaimed, labels, float64(profile.Reclaimed))
+	}
+
+	qm.refreshFeed.mu.Lock()
+	defer qm.refreshFeed.mu.Unlock()
+
+	qm.refreshFeed.last = &event
+	for ch := range qm.refreshFeed.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// 刷新事件流处理器，以 Server-Sent Events 推送每次刷新的 RefreshEvent
+func (s *Server) handleRefreshEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	events, cancel := s.quotaManager.SubscribeRefreshEvents()
+	defer cancel()
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		s.logger.Error("flush refresh event stream failed", "error", err)
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				s.logger.Error("encode refresh event failed", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: refresh\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
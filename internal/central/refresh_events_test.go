@@ -0,0 +1,113 @@
+package central
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestRefreshEventRecordsPreResetUsage(t *testing.T) {
+	clock := newFakeClock()
+	sink := &capturingSink{}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 50}},
+		withClock(clock), WithMetricsSink(sink))
+	events, cancel := qm.SubscribeRefreshEvents()
+	defer cancel()
+
+	reportStatus(qm, "node-a", clock.Now(), 100)
+	granted(t, qm.CheckQuota(quotaRequest("node-a", 1, 40)))
+	granted(t, qm.CheckQuota(quotaRequest("node-b", 1, 20)))
+	qm.UpdateNodeStatus(common.NodeStatus{NodeID: "node-b", State: common.StateOffline, LastSeen: clock.Now()})
+
+	if _, ok := qm.LastRefreshEvent(); ok {
+		t.Fatal("LastRefreshEvent reported an event before any refresh")
+	}
+	clock.Advance(testRefreshInterval)
+	qm.refresh()
+
+	var event RefreshEvent
+	select {
+	case event = <-events:
+	default:
+		t.Fatal("refresh published no event")
+	}
+	if !event.StartedAt.Equal(clock.Now()) {
+		t.Errorf("event started at %v, want %v", event.StartedAt, clock.Now())
+	}
+	if got := event.Profiles[1]; got.Consumed != 60 || !got.Reset || got.Reclaimed < 20 {
+		t.Errorf("profile 1 event = %+v, want 60 consumed, reset, and at least offline node-b's 20 reclaimed", got)
+	}
+	if got := event.Profiles[2]; got.Consumed != 0 || !got.Reset {
+		t.Errorf("profile 2 event = %+v, want nothing consumed", got)
+	}
+	if last, ok := qm.LastRefreshEvent(); !ok || last.Profiles[1].Consumed != 60 {
+		t.Errorf("LastRefreshEvent = %+v, %v, want the published event", last, ok)
+	}
+	if used := qm.profiles[1].usedQuota; used != 0 {
+		t.Errorf("usedQuota after refresh = %d, want 0", used)
+	}
+
+	if got, _ := sink.gauge(metricWindowConsumed, profileLabels(1)); got != 60 {
+		t.Errorf("%s = %v, want 60", metricWindowConsumed, got)
+	}
+	if got := sink.counter(metricRefreshes, nil); got != 1 {
+		t.Errorf("%s = %v, want 1", metricRefreshes, got)
+	}
+	if got := sink.counter(metricQuotaReclaimed, profileLabels(1)); got != float64(event.Profiles[1].Reclaimed) {
+		t.Errorf("%s = %v, want the event's %d", metricQuotaReclaimed, got, event.Profiles[1].Reclaimed)
+	}
+}
+
+func TestRefreshEventStream(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/api/v1/events/refresh")
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	granted(t, s.quotaManager.CheckQuota(quotaRequest("node-1", 1, 30)))
+	// 订阅在响应头发出前完成，此时刷新不会丢失
+	s.quotaManager.refresh()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("event stream ended without a refresh event")
+			}
+			data, found := strings.CutPrefix(line, "data: ")
+			if !found {
+				continue
+			}
+			var event RefreshEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatalf("decode event %q: %v", data, err)
+			}
+			if event.Profiles[1].Consumed != 30 {
+				t.Fatalf("streamed event = %+v, want profile 1 consumed 30", event)
+			}
+			return
+		case <-time.After(2 * time.Second):
+			t.Fatal("no refresh event streamed")
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package central
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultReplicaSyncInterval 只读副本未配置同步周期时从主节点拉取状态的周期
+const defaultReplicaSyncInterval = 5 * time.Second
+
+// readOnlyMiddleware 只读副本只处理查询请求，配额检查、释放、会话和管理类写操作返回 405
+// PUT /api/v1/admin/state 除外，主节点可以通过它把状态推送到副本
+func (s *Server) readOnlyMiddleware(next http.Handler) http.Handler {
+	if !s.config.ReadOnly {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead ||
+			(r.Method == http.MethodPut && r.URL.Path == "/api/v1/admin/state") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", "GET, HEAD")
+		s.responseError(w, "Server is a read-only replica", http.StatusMethodNotAllowed)
+	})
+}
+
+// startReplicaSync 只读副本定期从主节点的 /api/v1/admin/state 拉取状态快照并导入
+// 只同步默认命名空间；未配置 PrimaryURL 时副本只能依靠主节点推送
+func (s *Server) startReplicaSync() {
+	if !s.config.ReadOnly || s.config.PrimaryURL == "" {
+		return
+	}
+
+	interval := s.config.ReplicaSyncInterval
+	if interval <= 0 {
+		interval = defaultReplicaSyncInterval
+	}
+	client := &http.Client{Timeout: interval}
+	url := strings.TrimRight(s.config.PrimaryURL, "/") + "/api/v1/admin/state"
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.syncFromPrimary(client, url); err != nil {
+				s.logger.Error("replica sync failed", "primary", url, "error", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// syncFromPrimary 拉取一次主节点的状态快照并导入
+// 副本缺少的 profile 被跳过，其余 profile 照常导入
+func (s *Server) syncFromPrimary(client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var snapshot StateSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return fmt.Errorf("decode snapshot failed: %w", err)
+	}
+	return s.quotaManager.ImportState(snapshot)
+}
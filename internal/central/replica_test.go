@@ -0,0 +1,55 @@
+package central
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// profileUsed 从 /api/v1/status 的响应中读取 profile 的已用配额
+func profileUsed(t *testing.T, handler http.Handler, profile string) float64 {
+	t.Helper()
+	rec := serve(t, handler, http.MethodGet, "/api/v1/status", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status request = %d, body %s", rec.Code, rec.Body)
+	}
+	var status map[string]map[string]map[string]any
+	decodeBody(t, rec, &status)
+	return status["profiles"][profile]["used_quota"].(float64)
+}
+
+func TestReadOnlyReplicaServesSyncedStatusAndRefusesWrites(t *testing.T) {
+	profiles := map[int]ProfileConfig{1: {TotalQuota: 100}}
+	primary, primaryHandler := newTestServer(t, &ServerConfig{ProfileConfigs: profiles})
+	granted(t, primary.quotaManager.CheckQuota(quotaRequest("node-1", 1, 40)))
+	upstream := httptest.NewServer(primaryHandler)
+	defer upstream.Close()
+
+	replica, handler := newTestServer(t, &ServerConfig{ProfileConfigs: profiles, ReadOnly: true, PrimaryURL: upstream.URL})
+	if err := replica.syncFromPrimary(upstream.Client(), upstream.URL+"/api/v1/admin/state"); err != nil {
+		t.Fatalf("syncFromPrimary: %v", err)
+	}
+	if used := profileUsed(t, handler, "profile_1"); used != 40 {
+		t.Fatalf("replica reports %v used, want the primary's 40", used)
+	}
+
+	for _, target := range []string{"/api/v1/quota/check", "/api/v1/quota/check-batch", "/api/v1/quota/release"} {
+		rec := serve(t, handler, http.MethodPost, target, quotaRequest("node-1", 1, 10))
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("POST %s on the replica = %d (Allow %q), want 405", target, rec.Code, rec.Header().Get("Allow"))
+		}
+	}
+	if used := replica.quotaManager.profiles[1].usedQuota; used != 40 {
+		t.Fatalf("replica used = %d after refused writes, want 40", used)
+	}
+
+	// 主节点也可以把状态推送到副本
+	granted(t, primary.quotaManager.CheckQuota(quotaRequest("node-1", 1, 20)))
+	rec := serve(t, handler, http.MethodPut, "/api/v1/admin/state", primary.quotaManager.ExportState())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("state push status = %d, body %s", rec.Code, rec.Body)
+	}
+	if used := profileUsed(t, handler, "profile_1"); used != 60 {
+		t.Fatalf("replica reports %v used after the push, want 60", used)
+	}
+}
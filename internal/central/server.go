@@ -2,58 +2,287 @@
 package central
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"throttle_control/internal/common"
+	"throttle_control/internal/ratelimit"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Server 中心节点服务器
 type Server struct {
-	quotaManager *QuotaManager
-	config       *ServerConfig
+	quotaManager  *QuotaManager
+	namespaces    map[string]*QuotaManager // 按命名空间隔离的配额管理器
+	statusCache   statusCache              // 后端不可用时返回的状态缓存
+	metrics       MetricsSink              // 配额指标输出，为 PrometheusSink 时通过 /metrics 导出
+	logger        Logger                   // 结构化日志输出
+	tracer        common.Tracer            // 配额检查的追踪，默认不追踪
+	config        *ServerConfig
+	logSampleRate atomic.Int64  // 每 N 个成功请求记录一次日志
+	logCounter    atomic.Uint64 // 成功请求计数，用于采样
+	writeTimeout  time.Duration // 普通请求的写超时，流式处理器通过 withWriteTimeout 覆盖
+
+	scrapeMu   sync.Mutex
+	scrapeRate ratelimit.State // 状态和指标查询的速率状态，与配额速率限制相互独立
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port            string
+	Port                 string
+	RefreshInterval      time.Duration
+	ProfileConfigs       map[int]ProfileConfig
+	ProfileProvider      ProfileConfigProvider      // 可选，设置后忽略 ProfileConfigs
+	LogSampleRate        int64                      // 请求日志采样率，每 N 个 2xx 请求记录一次，<=1 表示全部记录
+	MetricsSink          MetricsSink                // 可选，配额指标输出，如 PrometheusSink 或 StatsDSink；为空时使用独立注册表的 PrometheusSink
+	AllowEmptyProfiles   bool                       // 允许在没有任何 profile 的情况下启动（例如稍后通过 API 加载配置）
+	UnknownProfilePolicy UnknownProfilePolicy       // 请求中包含未知 profile 时的处理策略
+	Namespaces           map[string]NamespaceConfig // 可选，额外的隔离配额命名空间，通过 /api/v1/{namespace}/quota/check 访问
+	Idempotency          IdempotencyConfig          // 可选，按 RequestID 去重配额请求
+	RefreshGuard         time.Duration              // 可选，刷新期间以 503 拒绝配额检查时的 Retry-After，仅用于非原子刷新的后端
+	MaxStatusStaleness   time.Duration              // profile 后端不可用时状态查询最多返回多旧的缓存，0 表示直接报错
+	AllowAnonymous       bool                       // 允许不带 node_id 的配额请求，统一记在 AnonymousNodeID 名下
+	MaxQuotaPerNode      int64                      // 可选，每个节点每个窗口从单个 profile 获得的配额上限（对应 CentralConfig.MaxQuotaPerNode）
+	StrictProfiles       bool                       // 通过 API 修改 profile 时可疑配置也以 400 拒绝，默认只记录警告
+	NodeStaleAfter       time.Duration              // 节点超过多久未上报状态视为陈旧，默认为 defaultStaleRefreshes 个刷新周期
+	ScrapeRateLimit      int64                      // 状态、指标等观测类查询每秒最多处理的请求数，超出时返回 429；0 表示不限制
+	TLSCertFile          string                     // 可选，服务端证书，与 TLSKeyFile 一起设置时使用 HTTPS
+	TLSKeyFile           string                     // 可选，服务端私钥
+	ClientCAFile         string                     // 可选，校验客户端证书的 CA，设置后要求客户端出示证书（mTLS）
+	DecisionRecorderSize int                        // 可选，保留最近多少条配额决策供 /api/v1/debug/decisions 查询，0 表示不记录
+	ReadOnly             bool                       // 只读副本：只提供状态等查询，拒绝配额检查等写操作
+	PrimaryURL           string                     // 只读副本从该主节点同步状态，为空时只接受主节点推送
+	ReplicaSyncInterval  time.Duration              // 只读副本的同步周期，默认 5s
+	SnapshotPath         string                     // 可选，定期把配额状态写入该文件，启动时从中恢复
+	SnapshotInterval     time.Duration              // 写快照的周期，默认 30s
+	QuotaStore           QuotaStore                 // 可选，默认命名空间的共享用量存储，多个中心实例共享时避免重复分配
+	Logger               Logger                     // 可选，服务器和配额管理器的日志输出，默认为 slog.Default()
+	Tracer               common.Tracer              // 可选，从 traceparent 等请求头继续追踪并记录 quota.check span，默认不追踪
+}
+
+// AnonymousNodeID 启用 AllowAnonymous 时，没有 node_id 的请求共用的节点标识
+const AnonymousNodeID = "anonymous"
+
+// NamespaceConfig 单个配额命名空间（例如一个区域）的配置，拥有独立的 profile 和刷新周期
+type NamespaceConfig struct {
 	RefreshInterval time.Duration
 	ProfileConfigs  map[int]ProfileConfig
+	ProfileProvider ProfileConfigProvider // 可选，设置后忽略 ProfileConfigs
 }
 
+// UnknownProfilePolicy 配额请求引用未知 profile 时的处理策略
+type UnknownProfilePolicy int
+
+const (
+	// UnknownProfileLenient 未知 profile 返回零配额，其余 profile 照常处理（默认）
+	UnknownProfileLenient UnknownProfilePolicy = iota
+	// UnknownProfileStrict 整个请求以 400 失败，不处理任何 profile
+	UnknownProfileStrict
+)
+
 // NewServer 创建服务器实例
 func NewServer(config *ServerConfig) *Server {
-	return &Server{
-		quotaManager: NewQuotaManager(config.RefreshInterval, config.ProfileConfigs),
+	metrics := config.MetricsSink
+	if metrics == nil {
+		metrics = NewPrometheusSink(prometheus.NewRegistry())
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	var tracer common.Tracer = common.NoopTracer{}
+	if config.Tracer != nil {
+		tracer = config.Tracer
+	}
+
+	opts := []QuotaOption{
+		WithMetricsSink(metrics),
+		WithLogger(logger),
+		WithIdempotency(config.Idempotency),
+		WithRefreshGuard(config.RefreshGuard),
+		WithMaxQuotaPerNode(config.MaxQuotaPerNode),
+		WithDecisionRecorder(config.DecisionRecorderSize),
+		WithStrictProfileValidation(config.StrictProfiles),
+	}
+
+	// 命名空间的 profile ID 相互独立，共享存储只用于默认命名空间
+	defaultOpts := append(opts[:len(opts):len(opts)], WithQuotaStore(config.QuotaStore))
+
+	s := &Server{
+		quotaManager: newManager(config.RefreshInterval, config.ProfileConfigs, config.ProfileProvider, defaultOpts),
+		namespaces:   make(map[string]*QuotaManager, len(config.Namespaces)),
+		metrics:      metrics,
+		logger:       logger,
+		tracer:       tracer,
 		config:       config,
+		writeTimeout: defaultWriteTimeout,
 	}
+	for namespace, nsConfig := range config.Namespaces {
+		s.namespaces[namespace] = newManager(nsConfig.RefreshInterval, nsConfig.ProfileConfigs, nsConfig.ProfileProvider, opts)
+	}
+	s.logSampleRate.Store(max(config.LogSampleRate, 1))
+	s.restoreSnapshot()
+
+	return s
+}
+
+// newManager 根据静态配置或 provider 创建配额管理器
+func newManager(refreshInterval time.Duration, configs map[int]ProfileConfig, provider ProfileConfigProvider, opts []QuotaOption) *QuotaManager {
+	if provider != nil {
+		return NewQuotaManagerWithProvider(refreshInterval, provider, opts...)
+	}
+	return NewQuotaManager(refreshInterval, configs, opts...)
+}
+
+// managerFor 返回请求路径中命名空间对应的配额管理器，没有命名空间时返回默认管理器
+func (s *Server) managerFor(r *http.Request) (*QuotaManager, bool) {
+	namespace := r.PathValue("namespace")
+	if namespace == "" {
+		return s.quotaManager, true
+	}
+	qm, exists := s.namespaces[namespace]
+	return qm, exists
 }
 
 // Start 启动服务器
 func (s *Server) Start() error {
+	if err := s.checkProfiles(); err != nil {
+		return err
+	}
+
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	server := s.httpServer(tlsConfig)
+
+	s.startReplicaSync()
+	s.startSnapshotWriter()
+
+	if tlsConfig != nil {
+		s.logger.Info("starting TLS server", "addr", s.config.Port, "client_cert_required", s.config.ClientCAFile != "")
+		return server.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	}
+	s.logger.Info("starting server", "addr", s.config.Port)
+	return server.ListenAndServe()
+}
+
+// httpServer 创建监听 Port 的 HTTP 服务器，tlsConfig 为 nil 时不启用 TLS
+func (s *Server) httpServer(tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Addr:         s.config.Port,
+		Handler:      s.handler(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: s.writeTimeout,
+		TLSConfig:    tlsConfig,
+	}
+}
+
+// handler 注册所有路由并应用中间件
+func (s *Server) handler() http.Handler {
 	// 注册路由
 	mux := http.NewServeMux()
 
 	// API路由
 	mux.HandleFunc("/api/v1/quota/check", s.handleQuotaCheck)
+	mux.HandleFunc("/api/v1/{namespace}/quota/check", s.handleQuotaCheck)
+	mux.HandleFunc("/api/v1/quota/check-batch", s.handleQuotaCheckBatch)
+	mux.HandleFunc("/api/v1/{namespace}/quota/check-batch", s.handleQuotaCheckBatch)
+	mux.HandleFunc("/api/v1/quota/projection", s.handleProjection)
 	mux.HandleFunc("/api/v1/status", s.handleNodeStatus)
+	mux.HandleFunc("/api/v1/nodes/handoff", s.handleHandoff)
+	mux.Handle("/api/v1/nodes/rate-limited", s.limitScrapes(http.HandlerFunc(s.handleRateLimitedNodes)))
+	mux.HandleFunc("/api/v1/quota/release", s.handleRelease)
+	mux.HandleFunc("/api/v1/simulate/remove-node", s.handleSimulateNodeRemoval)
+	mux.HandleFunc("/api/v1/profiles", s.handleProfiles)
+	mux.HandleFunc("/api/v1/profiles/import", s.handleProfileImport)
+	mux.HandleFunc("/api/v1/profiles/{id}", s.handleProfile)
+	mux.HandleFunc("/api/v1/profiles/{id}/boost", s.handleProfileBoost)
+	mux.HandleFunc("/api/v1/sessions", s.handleOpenSession)
+	mux.HandleFunc("/api/v1/sessions/{handle}", s.handleCloseSession)
+	mux.HandleFunc("/api/v1/sessions/{handle}/draw", s.handleSessionDraw)
+	mux.HandleFunc("/api/v1/accounts/{id}/usage", s.handleAccountUsage)
+	mux.HandleFunc("/api/v1/admin/log-sampling", s.handleLogSampling)
+	mux.HandleFunc("/api/v1/admin/freeze", s.handleFreeze)
+	mux.HandleFunc("/api/v1/admin/state", s.handleState)
+	mux.Handle("/api/v1/config", s.limitScrapes(http.HandlerFunc(s.handleEffectiveConfig)))
+	mux.HandleFunc("/api/v1/config/refresh-interval", s.handleRefreshInterval)
+	mux.Handle("/api/v1/debug/decisions", s.limitScrapes(http.HandlerFunc(s.handleDecisions)))
+	mux.HandleFunc("/api/v1/events/refresh", s.withWriteTimeout(0, s.handleRefreshEvents))
+	mux.Handle("/api/v1/health/fleet", s.limitScrapes(http.HandlerFunc(s.handleFleetHealth)))
 	mux.HandleFunc("/health", s.handleHealth)
+	if sink, ok := s.metrics.(*PrometheusSink); ok {
+		mux.Handle("/metrics", s.limitScrapes(sink.Handler()))
+	}
 
 	// 应用中间件
-	handler := s.loggingMiddleware(mux)
+	handler := s.readOnlyMiddleware(mux)
+	handler = s.loggingMiddleware(handler)
 	handler = s.recoveryMiddleware(handler)
+	return handler
+}
 
-	server := &http.Server{
-		Addr:         s.config.Port,
-		Handler:      handler,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+// tlsConfig 根据配置的证书构造 TLS 配置，没有配置证书时返回 nil
+// 设置了 ClientCAFile 时要求并校验客户端证书
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if s.config.TLSCertFile == "" && s.config.TLSKeyFile == "" {
+		if s.config.ClientCAFile != "" {
+			return nil, errors.New("client_ca_file requires tls_cert_file and tls_key_file")
+		}
+		return nil, nil
+	}
+	if s.config.TLSCertFile == "" || s.config.TLSKeyFile == "" {
+		return nil, errors.New("tls_cert_file and tls_key_file must be set together")
 	}
 
-	log.Printf("Starting server on %s", s.config.Port)
-	return server.ListenAndServe()
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.config.ClientCAFile != "" {
+		data, err := os.ReadFile(s.config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA file failed: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no valid certificates found in %s", s.config.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// checkProfiles 启动前检查是否配置了 profile
+// 没有 profile 时所有配额检查都会返回零配额，除非显式允许，否则视为配置错误
+func (s *Server) checkProfiles() error {
+	profileIDs, err := s.quotaManager.provider.ListProfiles()
+	if err != nil {
+		return fmt.Errorf("list profiles failed: %w", err)
+	}
+	if len(profileIDs) > 0 {
+		return nil
+	}
+
+	if !s.config.AllowEmptyProfiles {
+		return fmt.Errorf("%w: set AllowEmptyProfiles to start without profiles", common.ErrNoProfiles)
+	}
+	s.logger.Warn("starting with zero profiles configured, all quota checks will be denied until profiles are added")
+	return nil
 }
 
 // 配额检查处理器
@@ -63,8 +292,8 @@ func (s *Server) handleQuotaCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req common.QuotaRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	req, err := decodeQuotaRequest(r)
+	if err != nil {
 		s.responseError(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
@@ -75,14 +304,210 @@ func (s *Server) handleQuotaCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 处理配额请求
-	resp := s.quotaManager.CheckQuota(req)
+	quotaManager, exists := s.managerFor(r)
+	if !exists {
+		s.responseError(w, "Unknown namespace", http.StatusNotFound)
+		return
+	}
+
+	if s.config.UnknownProfilePolicy == UnknownProfileStrict {
+		if unknown := quotaManager.UnknownProfiles(req); len(unknown) > 0 {
+			s.responseError(w, fmt.Sprintf("unknown profiles: %v", unknown), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 处理配额请求，span 以请求头中的追踪上下文为父
+	_, span := s.tracer.Start(s.tracer.Extract(r.Context(), r.Header), "quota.check")
+	span.SetAttribute("node_id", req.NodeID)
+	span.SetAttribute("request_id", req.RequestID)
+	span.SetAttribute("profiles", len(req.Quotas))
+	resp := quotaManager.CheckQuota(req)
+	span.End()
+	if resp.Refreshing {
+		retryAfter := int64(math.Ceil(quotaManager.refreshGuard.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		s.responseError(w, common.ErrRefreshing.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if resp.DeadlineExceeded {
+		s.responseError(w, common.ErrDeadlineExceeded.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.setRateLimitHeaders(w, quotaManager, req)
+	if retryAfter, limited := resp.RetryAfter(); limited {
+		// 所有 profile 都被速率限制，按最早可能恢复的 profile 建议重试时间（向上取整到秒）
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	}
+	if acceptsForm(r) {
+		s.responseForm(w, resp)
+		return
+	}
 	s.responseJSON(w, resp)
 }
 
+// 批量配额检查处理器，接受 QuotaRequest 数组，按相同顺序返回 QuotaResponse 数组
+// 任何一个请求无效时整批以 400 拒绝，不处理任何请求；路径中的命名空间与单个检查相同
+func (s *Server) handleQuotaCheckBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reqs []common.QuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		s.responseError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if len(reqs) == 0 {
+		s.responseError(w, "requests cannot be empty", http.StatusBadRequest)
+		return
+	}
+	for i := range reqs {
+		if err := s.validateQuotaRequest(&reqs[i]); err != nil {
+			s.responseError(w, fmt.Sprintf("request %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	quotaManager, exists := s.managerFor(r)
+	if !exists {
+		s.responseError(w, "Unknown namespace", http.StatusNotFound)
+		return
+	}
+
+	if s.config.UnknownProfilePolicy == UnknownProfileStrict {
+		for i, req := range reqs {
+			if unknown := quotaManager.UnknownProfiles(req); len(unknown) > 0 {
+				s.responseError(w, fmt.Sprintf("request %d: unknown profiles: %v", i, unknown), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	// 处理整批请求，span 以请求头中的追踪上下文为父
+	_, span := s.tracer.Start(s.tracer.Extract(r.Context(), r.Header), "quota.check_batch")
+	span.SetAttribute("requests", len(reqs))
+	resps := quotaManager.CheckQuotaBatch(reqs)
+	span.End()
+	for _, resp := range resps {
+		// 刷新期间整批都没有处理，与单个检查一样以 503 拒绝
+		if resp.Refreshing {
+			retryAfter := int64(math.Ceil(quotaManager.refreshGuard.Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			s.responseError(w, common.ErrRefreshing.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	s.responseJSON(w, resps)
+}
+
+// formContentType 表单编码的 Content-Type，供只能发送表单的旧客户端使用
+const formContentType = "application/x-www-form-urlencoded"
+
+// decodeQuotaRequest 按 Content-Type 解析配额请求
+// 表单编码只支持单个 profile：node_id、profile_id、required，以及可选的 request_id、min_acceptable
+func decodeQuotaRequest(r *http.Request) (common.QuotaRequest, error) {
+	var req common.QuotaRequest
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != formContentType {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		return req, err
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return req, err
+	}
+	profileID, err := strconv.Atoi(r.PostForm.Get("profile_id"))
+	if err != nil {
+		return req, fmt.Errorf("invalid profile_id: %w", err)
+	}
+	required, err := strconv.ParseInt(r.PostForm.Get("required"), 10, 64)
+	if err != nil {
+		return req, fmt.Errorf("invalid required: %w", err)
+	}
+	var minAcceptable int64
+	if value := r.PostForm.Get("min_acceptable"); value != "" {
+		if minAcceptable, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return req, fmt.Errorf("invalid min_acceptable: %w", err)
+		}
+	}
+
+	req.NodeID = r.PostForm.Get("node_id")
+	req.RequestID = r.PostForm.Get("request_id")
+	req.Timestamp = time.Now()
+	req.Quotas = []common.ProfileQuota{{
+		ProfileID:     profileID,
+		Required:      required,
+		MinAcceptable: minAcceptable,
+	}}
+	return req, nil
+}
+
+// acceptsForm 判断客户端是否要求表单编码的响应
+func acceptsForm(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept)); mediaType == formContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// setRateLimitHeaders 设置标准的 X-RateLimit-* 响应头，方便通用客户端自行限速
+// 多 profile 请求以限制最严格的 profile 为准
+func (s *Server) setRateLimitHeaders(w http.ResponseWriter, quotaManager *QuotaManager, req common.QuotaRequest) {
+	profileIDs := make([]int, 0, len(req.Quotas))
+	for _, profileQuota := range req.Quotas {
+		profileIDs = append(profileIDs, profileQuota.ProfileID)
+	}
+
+	status, ok := quotaManager.RateLimitStatus(profileIDs)
+	if !ok {
+		return
+	}
+	// Reset 向上取整到秒，避免客户端在窗口恢复前重试
+	reset := status.Reset.Add(time.Second - 1).Unix()
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(status.Limit, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(status.Remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+}
+
+// 配额预测处理器
+func (s *Server) handleProjection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	profileID, err := strconv.Atoi(query.Get("profile_id"))
+	if err != nil {
+		s.responseError(w, "Invalid profile_id", http.StatusBadRequest)
+		return
+	}
+	horizon, err := time.ParseDuration(query.Get("horizon"))
+	if err != nil || horizon < 0 {
+		s.responseError(w, "Invalid horizon", http.StatusBadRequest)
+		return
+	}
+
+	s.responseJSON(w, map[string]interface{}{
+		"profile_id": profileID,
+		"horizon":    horizon.String(),
+		"projected":  s.quotaManager.GetProjectedAvailability(profileID, horizon),
+	})
+}
+
 // 节点状态处理器
 func (s *Server) handleNodeStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	switch r.Method {
+	case http.MethodGet:
+		s.limitScrapes(http.HandlerFunc(s.handleQuotaStatus)).ServeHTTP(w, r)
+		return
+	case http.MethodPost:
+	default:
 		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -97,6 +522,421 @@ func (s *Server) handleNodeStatus(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// 配额状态查询处理器，GET /api/v1/status?profiles=1,2,5 只返回指定 profile 的状态，
+// GET /api/v1/status?groupBy=tenant 按 profile 标签分组
+func (s *Server) handleQuotaStatus(w http.ResponseWriter, r *http.Request) {
+	if label := r.URL.Query().Get("groupBy"); label != "" {
+		s.responseJSON(w, s.quotaManager.GetGroupedStatus(label))
+		return
+	}
+
+	param := r.URL.Query().Get("profiles")
+	if param == "" {
+		status, err := s.quotaStatus()
+		if err != nil {
+			s.responseError(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		s.responseJSON(w, status)
+		return
+	}
+
+	var profileIDs []int
+	for _, field := range strings.Split(param, ",") {
+		profileID, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			s.responseError(w, "Invalid profiles", http.StatusBadRequest)
+			return
+		}
+		profileIDs = append(profileIDs, profileID)
+	}
+
+	s.responseJSON(w, s.quotaManager.GetProfilesStatus(profileIDs))
+}
+
+// 节点配额转交处理器
+func (s *Server) handleHandoff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		NodeID string `json:"node_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.responseError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.NodeID == "" {
+		s.responseError(w, "node_id is required", http.StatusBadRequest)
+		return
+	}
+
+	handedOff, err := s.quotaManager.Handoff(req.NodeID)
+	if err != nil {
+		s.responseError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	s.responseJSON(w, map[string]interface{}{
+		"node_id":    req.NodeID,
+		"handed_off": handedOff,
+	})
+}
+
+// 节点下线模拟处理器，返回 Handoff 后的配额分布但不做任何修改
+func (s *Server) handleSimulateNodeRemoval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		NodeID string `json:"node_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.responseError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.NodeID == "" {
+		s.responseError(w, "node_id is required", http.StatusBadRequest)
+		return
+	}
+
+	projection, err := s.quotaManager.SimulateNodeRemoval(req.NodeID)
+	if err != nil {
+		s.responseError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.responseJSON(w, projection)
+}
+
+// 配额归还处理器
+func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req common.ReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.responseError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.NodeID == "" {
+		s.responseError(w, "node_id is required", http.StatusBadRequest)
+		return
+	}
+
+	s.responseJSON(w, map[string]interface{}{
+		"node_id":  req.NodeID,
+		"released": s.quotaManager.Release(req.NodeID, req.Unused),
+	})
+}
+
+// profileEntry 带 ID 的 profile 配置，用于 profile 列表、新增和批量导入
+type profileEntry struct {
+	ProfileID int `json:"profile_id"`
+	ProfileConfig
+}
+
+// profile 集合处理器：GET 列出所有 profile，POST 新增 profile
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.listProfiles(w)
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req profileEntry
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.responseError(w, "Invalid profile format", http.StatusBadRequest)
+		return
+	}
+
+	err := s.quotaManager.CreateProfile(req.ProfileID, req.ProfileConfig)
+	switch {
+	case errors.Is(err, common.ErrProfileExists):
+		s.responseError(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, common.ErrInvalidRequest):
+		s.responseError(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		s.responseError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.responseJSONStatus(w, http.StatusCreated, map[string]int{"profile_id": req.ProfileID})
+}
+
+// listProfiles 按 ID 顺序返回所有 profile 的当前配置，包括尚未从 provider 加载的
+func (s *Server) listProfiles(w http.ResponseWriter) {
+	configs, err := s.quotaManager.EffectiveProfileConfigs()
+	if err != nil {
+		s.responseError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	entries := make([]profileEntry, 0, len(configs))
+	for profileID, config := range configs {
+		entries = append(entries, profileEntry{ProfileID: profileID, ProfileConfig: config})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ProfileID < entries[j].ProfileID
+	})
+	s.responseJSON(w, entries)
+}
+
+// profile 批量导入处理器，全部成功或全部不生效
+func (s *Server) handleProfileImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var entries []profileEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		s.responseError(w, "Invalid profile format", http.StatusBadRequest)
+		return
+	}
+	if len(entries) == 0 {
+		s.responseError(w, "profiles cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	configs := make(map[int]ProfileConfig, len(entries))
+	for _, entry := range entries {
+		if _, duplicate := configs[entry.ProfileID]; duplicate {
+			s.responseError(w, fmt.Sprintf("profile %d appears more than once", entry.ProfileID), http.StatusBadRequest)
+			return
+		}
+		configs[entry.ProfileID] = entry.ProfileConfig
+	}
+
+	err := s.quotaManager.ImportProfiles(configs)
+	var importErr *ProfileImportError
+	switch {
+	case errors.As(err, &importErr):
+		status := http.StatusInternalServerError
+		if errors.Is(err, common.ErrInvalidRequest) {
+			status = http.StatusBadRequest
+		}
+		s.responseJSONStatus(w, status, map[string]interface{}{
+			"error":      importErr.Error(),
+			"profile_id": importErr.ProfileID,
+		})
+		return
+	case err != nil:
+		s.responseError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.responseJSON(w, map[string]int{"imported": len(configs)})
+}
+
+// 单个 profile 处理器
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	profileID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.responseError(w, "Invalid profile id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var config ProfileConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			s.responseError(w, "Invalid profile format", http.StatusBadRequest)
+			return
+		}
+
+		created, err := s.quotaManager.PutProfile(profileID, config)
+		if errors.Is(err, common.ErrInvalidRequest) {
+			s.responseError(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			s.responseError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.responseJSON(w, map[string]interface{}{
+			"profile_id": profileID,
+			"created":    created,
+		})
+	case http.MethodPatch:
+		var patch ProfilePatch
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&patch); err != nil {
+			s.responseError(w, fmt.Sprintf("Invalid profile patch: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		config, err := s.quotaManager.PatchProfile(profileID, patch)
+		switch {
+		case errors.Is(err, common.ErrProfileNotFound):
+			s.responseError(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, common.ErrInvalidRequest):
+			s.responseError(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			s.responseError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.responseJSON(w, profileEntry{ProfileID: profileID, ProfileConfig: config})
+	case http.MethodDelete:
+		err := s.quotaManager.RemoveProfile(profileID)
+		switch {
+		case errors.Is(err, common.ErrProfileNotFound):
+			s.responseError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errors.ErrUnsupported):
+			s.responseError(w, err.Error(), http.StatusNotImplemented)
+		case err != nil:
+			s.responseError(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// profile 临时配额处理器，until 和 duration 二选一
+func (s *Server) handleProfileBoost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profileID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.responseError(w, "Invalid profile id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Extra    int64     `json:"extra"`
+		Until    time.Time `json:"until"`
+		Duration string    `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.responseError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			s.responseError(w, "Invalid duration", http.StatusBadRequest)
+			return
+		}
+		req.Until = time.Now().Add(duration)
+	}
+
+	boost, err := s.quotaManager.BoostProfile(profileID, req.Extra, req.Until)
+	switch {
+	case errors.Is(err, common.ErrProfileNotFound):
+		s.responseError(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		s.responseError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.responseJSON(w, map[string]interface{}{
+		"profile_id": profileID,
+		"boost":      boost,
+		"until":      req.Until,
+	})
+}
+
+// 开启配额会话处理器
+func (s *Server) handleOpenSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ProfileID int   `json:"profile_id"`
+		Amount    int64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.responseError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	handle, reserved, err := s.quotaManager.OpenSession(req.ProfileID, req.Amount)
+	switch {
+	case errors.Is(err, common.ErrProfileNotFound):
+		s.responseError(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, common.ErrNoQuota):
+		s.responseError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		s.responseError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.responseJSON(w, map[string]interface{}{
+		"session":  handle,
+		"reserved": reserved,
+	})
+}
+
+// 会话消耗处理器
+func (s *Server) handleSessionDraw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Amount int64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.responseError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	remaining, err := s.quotaManager.Draw(r.PathValue("handle"), req.Amount)
+	switch {
+	case errors.Is(err, common.ErrSessionNotFound):
+		s.responseError(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, common.ErrQuotaExceeded):
+		s.responseError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		s.responseError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.responseJSON(w, map[string]int64{"remaining": remaining})
+}
+
+// 关闭配额会话处理器
+func (s *Server) handleCloseSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	returned, err := s.quotaManager.CloseSession(r.PathValue("handle"))
+	if err != nil {
+		s.responseError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	s.responseJSON(w, map[string]int64{"returned": returned})
+}
+
 // 健康检查处理器
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -111,6 +951,24 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.responseJSON(w, health)
 }
 
+// defaultWriteTimeout 普通请求（如配额检查）的写超时，卡住的请求会在此时间后被切断
+const defaultWriteTimeout = 10 * time.Second
+
+// withWriteTimeout 为单个处理器覆盖服务器的写超时，供 SSE/WebSocket 等长连接使用
+// timeout 为 0 时完全取消写截止时间；流式处理器应在每次写入前按需再次延长
+func (s *Server) withWriteTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var deadline time.Time
+		if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+		if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+			s.logger.Error("set write deadline failed", "error", err)
+		}
+		next(w, r)
+	}
+}
+
 // 日志中间件
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -120,22 +978,269 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 		wrapper := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 		next.ServeHTTP(wrapper, r)
 
-		log.Printf(
-			"Method: %s | Path: %s | Status: %d | Duration: %v",
-			r.Method,
-			r.URL.Path,
-			wrapper.status,
-			time.Since(start),
+		if !s.shouldLogRequest(wrapper.status) {
+			return
+		}
+
+		s.logger.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", wrapper.status,
+			"duration", time.Since(start),
 		)
 	})
 }
 
+// shouldLogRequest 非 2xx 响应总是记录，2xx 响应按采样率记录
+func (s *Server) shouldLogRequest(status int) bool {
+	if status < 200 || status >= 300 {
+		return true
+	}
+	rate := s.logSampleRate.Load()
+	if rate <= 1 {
+		return true
+	}
+	return s.logCounter.Add(1)%uint64(rate) == 0
+}
+
+// defaultStaleRefreshes 未设置 NodeStaleAfter 时，节点超过多少个刷新周期未上报视为陈旧
+const defaultStaleRefreshes = 3
+
+// 节点健康汇总处理器，可通过 stale_after 参数（如 30s）覆盖陈旧阈值
+func (s *Server) handleFleetHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	staleAfter := s.config.NodeStaleAfter
+	if staleAfter <= 0 {
+		staleAfter = defaultStaleRefreshes * s.quotaManager.RefreshInterval()
+	}
+	if value := r.URL.Query().Get("stale_after"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			s.responseError(w, "Invalid stale_after", http.StatusBadRequest)
+			return
+		}
+		staleAfter = parsed
+	}
+
+	s.responseJSON(w, s.quotaManager.FleetHealth(staleAfter))
+}
+
+// 日志采样率管理处理器
+func (s *Server) handleLogSampling(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			SampleRate int64 `json:"sample_rate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.responseError(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if req.SampleRate < 1 {
+			s.responseError(w, "sample_rate must be at least 1", http.StatusBadRequest)
+			return
+		}
+		s.logSampleRate.Store(req.SampleRate)
+	default:
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.responseJSON(w, map[string]int64{"sample_rate": s.logSampleRate.Load()})
+}
+
+// 冻结配额消耗处理器，GET 查询状态，PUT {"frozen": true, "mode": "deny"|"allow"} 修改
+func (s *Server) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Frozen bool   `json:"frozen"`
+			Mode   string `json:"mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.responseError(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if !req.Frozen {
+			s.quotaManager.Unfreeze()
+			break
+		}
+		switch req.Mode {
+		case "", "deny":
+			s.quotaManager.Freeze(FreezeDenyAll)
+		case "allow":
+			s.quotaManager.Freeze(FreezeAllowAll)
+		default:
+			s.responseError(w, "mode must be deny or allow", http.StatusBadRequest)
+			return
+		}
+	default:
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	frozen, mode := s.quotaManager.Frozen()
+	status := map[string]interface{}{"frozen": frozen}
+	if frozen {
+		status["mode"] = "deny"
+		if mode == FreezeAllowAll {
+			status["mode"] = "allow"
+		}
+	}
+	s.responseJSON(w, status)
+}
+
+// 运行时状态迁移处理器，GET 导出快照，PUT 导入快照
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.responseJSON(w, s.quotaManager.ExportState())
+	case http.MethodPut:
+		var snapshot StateSnapshot
+		if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+			s.responseError(w, "Invalid snapshot format", http.StatusBadRequest)
+			return
+		}
+		if err := s.quotaManager.ImportState(snapshot); err != nil {
+			// 其余 profile 已经导入，只报告缺失的部分
+			s.responseError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// 计费账户用量查询处理器
+func (s *Server) handleAccountUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	usage, exists := s.quotaManager.AccountUsage(r.PathValue("id"))
+	if !exists {
+		s.responseError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	s.responseJSON(w, usage)
+}
+
+// 决策记录查询处理器，可按 request_id 和 node_id 过滤
+func (s *Server) handleDecisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.config.DecisionRecorderSize <= 0 {
+		s.responseError(w, "Decision recording is disabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	decisions := s.quotaManager.Decisions(query.Get("request_id"), query.Get("node_id"))
+	if decisions == nil {
+		decisions = []DecisionRecord{}
+	}
+	s.responseJSON(w, decisions)
+}
+
+// 被速率限制的节点查询处理器
+func (s *Server) handleRateLimitedNodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.responseJSON(w, s.quotaManager.RateLimitedNodes())
+}
+
+// 生效配置查询处理器
+func (s *Server) handleEffectiveConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	effective, err := s.effectiveConfig()
+	if err != nil {
+		s.responseError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.responseJSON(w, effective)
+}
+
+// 刷新周期处理器，GET 查询，PUT {"refresh_interval": "30s"} 修改
+func (s *Server) handleRefreshInterval(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			RefreshInterval string `json:"refresh_interval"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.responseError(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		interval, err := time.ParseDuration(req.RefreshInterval)
+		if err != nil {
+			s.responseError(w, "Invalid refresh_interval", http.StatusBadRequest)
+			return
+		}
+		if err := s.quotaManager.SetRefreshInterval(interval); err != nil {
+			s.responseError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		s.responseError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.responseJSON(w, map[string]string{"refresh_interval": s.quotaManager.RefreshInterval().String()})
+}
+
+// limitScrapes 对状态、指标等观测类查询应用独立的速率限制（ScrapeRateLimit），超出时返回 429
+// 这些查询不经过也不消耗任何 profile 的速率许可
+func (s *Server) limitScrapes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowScrape() {
+			w.Header().Set("Retry-After", "1")
+			s.responseError(w, "Too many status requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowScrape 按固定的 1 秒窗口限制观测类查询
+func (s *Server) allowScrape() bool {
+	if s.config.ScrapeRateLimit <= 0 {
+		return true
+	}
+
+	s.scrapeMu.Lock()
+	defer s.scrapeMu.Unlock()
+
+	return s.scrapeRate.Allow(ratelimit.Limit{
+		Method: common.RateControlFixedWindow,
+		Rate:   s.config.ScrapeRateLimit,
+		Window: time.Second,
+	}, time.Now())
+}
+
 // 恢复中间件
 func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered: %v", err)
+				s.logger.Error("panic recovered", "panic", err, "method", r.Method, "path", r.URL.Path)
 				s.responseError(w, "Internal server error", http.StatusInternalServerError)
 			}
 		}()
@@ -146,15 +1251,29 @@ func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
 // 请求验证
 func (s *Server) validateQuotaRequest(req *common.QuotaRequest) error {
 	if req.NodeID == "" {
-		return fmt.Errorf("node_id is required")
+		if !s.config.AllowAnonymous {
+			return fmt.Errorf("node_id is required")
+		}
+		req.NodeID = AnonymousNodeID
 	}
 	if len(req.Quotas) == 0 {
 		return fmt.Errorf("quotas cannot be empty")
 	}
 	for _, q := range req.Quotas {
+		if q.ContinuationToken != "" {
+			// 续取请求的数量由令牌决定
+			continue
+		}
+		if q.Required == 0 && req.Refresh {
+			// 刷新请求中本地配额充足的 profile
+			continue
+		}
 		if q.Required <= 0 {
 			return fmt.Errorf("required quota must be positive")
 		}
+		if q.MinAcceptable < 0 || q.MinAcceptable > q.Required {
+			return fmt.Errorf("min_acceptable must be between 0 and required")
+		}
 	}
 	return nil
 }
@@ -163,11 +1282,43 @@ func (s *Server) validateQuotaRequest(req *common.QuotaRequest) error {
 func (s *Server) responseJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding response: %v", err)
+		s.logger.Error("encode response failed", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
 
+// 非 200 的JSON响应工具，Content-Type 必须在写状态码之前设置
+func (s *Server) responseJSONStatus(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error("encode response failed", "error", err)
+	}
+}
+
+// 表单编码响应工具，只输出第一个 profile 的结果（表单请求只包含一个 profile）
+func (s *Server) responseForm(w http.ResponseWriter, resp common.QuotaResponse) {
+	values := url.Values{}
+	values.Set("request_id", resp.RequestID)
+	values.Set("expires_at", resp.ExpiresAt.Format(time.RFC3339))
+	if len(resp.Quotas) > 0 {
+		quota := resp.Quotas[0]
+		values.Set("profile_id", strconv.Itoa(quota.ProfileID))
+		values.Set("granted", strconv.FormatInt(quota.Granted, 10))
+		values.Set("required", strconv.FormatInt(quota.Required, 10))
+		values.Set("rate_limited", strconv.FormatBool(quota.RateLimited))
+		if quota.Reason != "" {
+			values.Set("reason", quota.Reason)
+		}
+		if quota.NotFound {
+			values.Set("not_found", "true")
+		}
+	}
+
+	w.Header().Set("Content-Type", formContentType)
+	w.Write([]byte(values.Encode()))
+}
+
 // 错误响应工具
 func (s *Server) responseError(w http.ResponseWriter, message string, status int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -185,3 +1336,8 @@ func (rw *responseWriter) WriteHeader(status int) {
 	rw.status = status
 	rw.ResponseWriter.WriteHeader(status)
 }
+
+// Unwrap 暴露底层 ResponseWriter，使 http.ResponseController 能设置截止时间和刷新
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,930 @@
+package central
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// logEntry 一条被捕获的日志
+type logEntry struct {
+	level string
+	msg   string
+	args  map[string]any
+}
+
+// capturingLogger 把日志记录在内存中的 Logger
+type capturingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *capturingLogger) Debug(msg string, args ...any) { l.record("DEBUG", msg, args) }
+func (l *capturingLogger) Info(msg string, args ...any)  { l.record("INFO", msg, args) }
+func (l *capturingLogger) Warn(msg string, args ...any)  { l.record("WARN", msg, args) }
+func (l *capturingLogger) Error(msg string, args ...any) { l.record("ERROR", msg, args) }
+
+func (l *capturingLogger) record(level, msg string, args []any) {
+	entry := logEntry{level: level, msg: msg, args: make(map[string]any)}
+	for i := 0; i+1 < len(args); i += 2 {
+		if key, ok := args[i].(string); ok {
+			entry.args[key] = args[i+1]
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+// find 返回指定级别和消息的日志
+func (l *capturingLogger) find(level, msg string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []logEntry
+	for _, entry := range l.entries {
+		if entry.level == level && entry.msg == msg {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+// newTestServer 创建测试服务器，未设置的刷新周期使用 testRefreshInterval
+func newTestServer(t *testing.T, config *ServerConfig) (*Server, http.Handler) {
+	t.Helper()
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = testRefreshInterval
+	}
+	if config.Logger == nil {
+		config.Logger = discardLogger()
+	}
+	s := NewServer(config)
+	return s, s.handler()
+}
+
+// serve 发送请求并返回响应，body 不为 nil 时以 JSON 编码
+func serve(t *testing.T, handler http.Handler, method, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encode request: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &payload)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeBody 把响应体解码到 v
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+func TestLoggingSamplesSuccessesButLogsAllErrors(t *testing.T) {
+	logger := &capturingLogger{}
+	_, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}},
+		LogSampleRate:  10,
+		Logger:         logger,
+	})
+
+	for i := 0; i < 100; i++ {
+		if rec := serve(t, handler, http.MethodGet, "/health", nil); rec.Code != http.StatusOK {
+			t.Fatalf("health status = %d", rec.Code)
+		}
+	}
+	for i := 0; i < 7; i++ {
+		if rec := serve(t, handler, http.MethodGet, "/api/v1/quota/check", nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status = %d, want 405", rec.Code)
+		}
+	}
+
+	var successes, failures int
+	for _, entry := range logger.find("INFO", "request") {
+		if entry.args["status"] == http.StatusOK {
+			successes++
+		} else {
+			failures++
+		}
+	}
+	if successes != 10 {
+		t.Errorf("logged %d of 100 successful requests, want 10", successes)
+	}
+	if failures != 7 {
+		t.Errorf("logged %d of 7 failed requests, want all", failures)
+	}
+}
+
+func TestLogSamplingAdjustableAtRuntime(t *testing.T) {
+	logger := &capturingLogger{}
+	_, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}},
+		Logger:         logger,
+	})
+
+	rec := serve(t, handler, http.MethodPut, "/api/v1/admin/log-sampling", map[string]int64{"sample_rate": 1000})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set sample rate status = %d", rec.Code)
+	}
+	for i := 0; i < 100; i++ {
+		serve(t, handler, http.MethodGet, "/health", nil)
+	}
+
+	if logged := len(logger.find("INFO", "request")); logged != 0 {
+		t.Errorf("logged %d of 101 successful requests at 1 in 1000, want 0", logged)
+	}
+	if rec := serve(t, handler, http.MethodPut, "/api/v1/admin/log-sampling", map[string]int64{"sample_rate": 0}); rec.Code != http.StatusBadRequest {
+		t.Errorf("sample rate 0 status = %d, want 400", rec.Code)
+	}
+}
+
+func TestEmptyProfilesAtStartup(t *testing.T) {
+	s, _ := newTestServer(t, &ServerConfig{})
+	if err := s.Start(); !errors.Is(err, common.ErrNoProfiles) {
+		t.Errorf("Start() = %v with no profiles and AllowEmptyProfiles unset, want ErrNoProfiles", err)
+	}
+
+	logger := &capturingLogger{}
+	s, _ = newTestServer(t, &ServerConfig{AllowEmptyProfiles: true, Logger: logger})
+	if err := s.checkProfiles(); err != nil {
+		t.Fatalf("checkProfiles with AllowEmptyProfiles: %v", err)
+	}
+	if len(logger.find("WARN", "starting with zero profiles configured, all quota checks will be denied until profiles are added")) != 1 {
+		t.Error("no warning logged for an empty profile set")
+	}
+}
+
+func TestRefreshRequestAcceptsZeroTopUp(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: fixedWindow(1, time.Minute), 2: {TotalQuota: 100}},
+	})
+	req := common.QuotaRequest{
+		NodeID: "node-1",
+		Quotas: []common.ProfileQuota{{ProfileID: 1, Required: 0}, {ProfileID: 2, Required: 40}},
+	}
+
+	// 普通请求的数量必须为正
+	if rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", req); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d for a zero quota outside a refresh, want 400", rec.Code)
+	}
+
+	req.Refresh = true
+	rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var resp common.QuotaResponse
+	decodeBody(t, rec, &resp)
+	if resp.Quotas[0].Granted != 0 || resp.Quotas[0].NotFound || resp.Quotas[1].Granted != 40 {
+		t.Fatalf("refresh response = %+v, want nothing for profile 1 and 40 for profile 2", resp.Quotas)
+	}
+
+	// 不需要补充的 profile 没有消耗速率许可
+	if got := granted(t, s.quotaManager.CheckQuota(quotaRequest("node-1", 1, 1))); got != 1 {
+		t.Fatalf("granted = %d after the refresh, want the rate permit still available", got)
+	}
+}
+
+func TestUnknownProfilePolicy(t *testing.T) {
+	req := common.QuotaRequest{
+		NodeID: "node-1",
+		Quotas: []common.ProfileQuota{{ProfileID: 1, Required: 10}, {ProfileID: 99, Required: 10}},
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		s, handler := newTestServer(t, &ServerConfig{
+			ProfileConfigs:       map[int]ProfileConfig{1: {TotalQuota: 100}},
+			UnknownProfilePolicy: UnknownProfileStrict,
+		})
+		if rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", req); rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", rec.Code)
+		}
+		if used := s.quotaManager.profiles[1].usedQuota; used != 0 {
+			t.Fatalf("usedQuota = %d, want the known profile untouched", used)
+		}
+	})
+
+	t.Run("lenient", func(t *testing.T) {
+		_, handler := newTestServer(t, &ServerConfig{
+			ProfileConfigs:       map[int]ProfileConfig{1: {TotalQuota: 100}},
+			UnknownProfilePolicy: UnknownProfileLenient,
+		})
+		rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		var resp common.QuotaResponse
+		decodeBody(t, rec, &resp)
+		for _, quota := range resp.Quotas {
+			switch quota.ProfileID {
+			case 1:
+				if quota.Granted != 10 {
+					t.Errorf("profile 1 granted = %d, want 10", quota.Granted)
+				}
+			case 99:
+				if quota.Granted != 0 || !quota.NotFound {
+					t.Errorf("profile 99 = %+v, want zero grant marked NotFound", quota)
+				}
+			}
+		}
+		if len(resp.Quotas) != 2 {
+			t.Fatalf("got %d profile responses, want 2", len(resp.Quotas))
+		}
+	})
+}
+
+func TestNamespacesConsumeFromSeparatePools(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}},
+		Namespaces: map[string]NamespaceConfig{
+			"eu": {RefreshInterval: testRefreshInterval, ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 50}}},
+			"us": {RefreshInterval: testRefreshInterval, ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 50}}},
+		},
+	})
+
+	check := func(target string, required int64) int64 {
+		t.Helper()
+		rec := serve(t, handler, http.MethodPost, target, quotaRequest("node-1", 1, required))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status = %d: %s", target, rec.Code, rec.Body.String())
+		}
+		var resp common.QuotaResponse
+		decodeBody(t, rec, &resp)
+		return granted(t, resp)
+	}
+
+	if got := check("/api/v1/eu/quota/check", 50); got != 50 {
+		t.Fatalf("eu granted = %d, want 50", got)
+	}
+	if got := check("/api/v1/eu/quota/check", 1); got != 0 {
+		t.Fatalf("eu granted after exhaustion = %d, want 0", got)
+	}
+	if got := check("/api/v1/us/quota/check", 50); got != 50 {
+		t.Fatalf("us granted = %d, want its own 50", got)
+	}
+	if got := check("/api/v1/quota/check", 100); got != 100 {
+		t.Fatalf("default namespace granted = %d, want its own 100", got)
+	}
+	if used := s.namespaces["eu"].profiles[1].usedQuota; used != 50 {
+		t.Fatalf("eu usedQuota = %d, want 50", used)
+	}
+
+	if rec := serve(t, handler, http.MethodPost, "/api/v1/apac/quota/check", quotaRequest("node-1", 1, 1)); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown namespace status = %d, want 404", rec.Code)
+	}
+}
+
+func TestStatusFilteredByProfiles(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 200}, 3: {TotalQuota: 300}},
+	})
+
+	rec := serve(t, handler, http.MethodGet, "/api/v1/status?profiles=1,3,7", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var status struct {
+		Profiles map[string]json.RawMessage `json:"profiles"`
+		Unknown  []int                      `json:"unknown"`
+	}
+	decodeBody(t, rec, &status)
+
+	if len(status.Profiles) != 2 || status.Profiles["profile_1"] == nil || status.Profiles["profile_3"] == nil {
+		t.Fatalf("profiles = %v, want only profile_1 and profile_3", status.Profiles)
+	}
+	if len(status.Unknown) != 1 || status.Unknown[0] != 7 {
+		t.Fatalf("unknown = %v, want [7]", status.Unknown)
+	}
+
+	if rec := serve(t, handler, http.MethodGet, "/api/v1/status?profiles=1,x", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed filter status = %d, want 400", rec.Code)
+	}
+}
+
+// 流式处理器取消写超时后可以长期保持连接，普通请求仍受写超时限制
+func TestStreamOutlivesWriteTimeoutWhileHungCheckIsCut(t *testing.T) {
+	s, _ := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+	s.writeTimeout = 200 * time.Millisecond
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = s.httpServer(nil)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/events/refresh")
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 卡住的配额检查：持有锁直到超过写超时
+	s.quotaManager.mu.Lock()
+	checkErr := make(chan error, 1)
+	go func() {
+		var body bytes.Buffer
+		json.NewEncoder(&body).Encode(quotaRequest("node-1", 1, 10))
+		resp, err := http.Post(srv.URL+"/api/v1/quota/check", "application/json", &body)
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		checkErr <- err
+	}()
+	time.Sleep(3 * s.writeTimeout)
+	s.quotaManager.mu.Unlock()
+
+	if err := <-checkErr; err == nil {
+		t.Fatal("hung quota check completed after the write timeout, want the connection cut")
+	}
+
+	s.quotaManager.refresh()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read stream after the write timeout: %v", err)
+	}
+	if line != "event: refresh\n" {
+		t.Fatalf("stream line = %q, want a refresh event", line)
+	}
+}
+
+func TestQuotaCheckSetsRateLimitHeaders(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: fixedWindow(3, time.Minute)}})
+
+	rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "3" {
+		t.Errorf("X-RateLimit-Limit = %q, want 3", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "2" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 2", got)
+	}
+	reset, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-RateLimit-Reset: %v", err)
+	}
+	if until := time.Until(time.Unix(reset, 0)); until <= 0 || until > time.Minute+time.Second {
+		t.Errorf("X-RateLimit-Reset %d is %v away, want within the one-minute window", reset, until)
+	}
+}
+
+// serveForm 发送表单编码的请求
+func serveForm(t *testing.T, handler http.Handler, target string, form url.Values, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", formContentType)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFormEncodedCheckMatchesJSON(t *testing.T) {
+	profiles := map[int]ProfileConfig{1: {TotalQuota: 100}}
+	_, jsonHandler := newTestServer(t, &ServerConfig{ProfileConfigs: profiles})
+	_, formHandler := newTestServer(t, &ServerConfig{ProfileConfigs: profiles})
+
+	for _, required := range []int64{60, 60} {
+		rec := serve(t, jsonHandler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, required))
+		var jsonResp common.QuotaResponse
+		decodeBody(t, rec, &jsonResp)
+
+		form := url.Values{"node_id": {"node-1"}, "profile_id": {"1"}, "required": {strconv.FormatInt(required, 10)}}
+		rec = serveForm(t, formHandler, "/api/v1/quota/check", form, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("form status = %d: %s", rec.Code, rec.Body.String())
+		}
+		var formResp common.QuotaResponse
+		decodeBody(t, rec, &formResp)
+
+		if got, want := granted(t, formResp), granted(t, jsonResp); got != want {
+			t.Fatalf("form granted %d, JSON granted %d for the same request", got, want)
+		}
+	}
+
+	form := url.Values{"node_id": {"node-1"}, "profile_id": {"1"}, "required": {"10"}}
+	rec := serveForm(t, formHandler, "/api/v1/quota/check", form, formContentType)
+	if ct := rec.Header().Get("Content-Type"); ct != formContentType {
+		t.Fatalf("Content-Type = %q, want %q", ct, formContentType)
+	}
+	values, err := url.ParseQuery(rec.Body.String())
+	if err != nil {
+		t.Fatalf("parse form response: %v", err)
+	}
+	if values.Get("profile_id") != "1" || values.Get("granted") != "0" {
+		t.Fatalf("form response = %v, want profile 1 granted 0 once exhausted", values)
+	}
+
+	form = url.Values{"node_id": {"node-1"}, "profile_id": {"x"}, "required": {"10"}}
+	if rec := serveForm(t, formHandler, "/api/v1/quota/check", form, ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid form status = %d, want 400", rec.Code)
+	}
+}
+
+// profile 后端不可用时状态从缓存返回并标记 stale，缓存超过 MaxStatusStaleness 后报错
+func TestStatusServedStaleDuringBackendOutage(t *testing.T) {
+	provider := newMockProvider(map[int]ProfileConfig{1: {TotalQuota: 100}})
+	_, handler := newTestServer(t, &ServerConfig{
+		ProfileProvider:    provider,
+		MaxStatusStaleness: 200 * time.Millisecond,
+	})
+
+	var status map[string]any
+	rec := serve(t, handler, http.MethodGet, "/api/v1/status", nil)
+	decodeBody(t, rec, &status)
+	if rec.Code != http.StatusOK || status["stale"] != nil {
+		t.Fatalf("healthy status = %d %v, want fresh status", rec.Code, status)
+	}
+
+	provider.mu.Lock()
+	provider.err = errors.New("backend unavailable")
+	provider.mu.Unlock()
+
+	rec = serve(t, handler, http.MethodGet, "/api/v1/status", nil)
+	status = nil
+	decodeBody(t, rec, &status)
+	if rec.Code != http.StatusOK || status["stale"] != true || status["profiles"] == nil {
+		t.Fatalf("status during outage = %d %v, want cached profiles marked stale", rec.Code, status)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if rec := serve(t, handler, http.MethodGet, "/api/v1/status", nil); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status past max staleness = %d, want 503", rec.Code)
+	}
+}
+
+func TestStatusGroupedByLabel(t *testing.T) {
+	_, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{
+			1: {TotalQuota: 100, Labels: map[string]string{"tenant": "acme"}},
+			2: {TotalQuota: 100, Labels: map[string]string{"tenant": "acme", "service": "search"}},
+			3: {TotalQuota: 100, Labels: map[string]string{"tenant": "globex"}},
+			4: {TotalQuota: 100},
+		},
+	})
+
+	rec := serve(t, handler, http.MethodGet, "/api/v1/status?groupBy=tenant", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var status struct {
+		GroupBy string                                `json:"group_by"`
+		Groups  map[string]map[string]json.RawMessage `json:"groups"`
+	}
+	decodeBody(t, rec, &status)
+
+	want := map[string][]string{
+		"acme":         {"profile_1", "profile_2"},
+		"globex":       {"profile_3"},
+		ungroupedLabel: {"profile_4"},
+	}
+	if status.GroupBy != "tenant" || len(status.Groups) != len(want) {
+		t.Fatalf("grouped status = %s, want groups %v", rec.Body.String(), want)
+	}
+	for group, profiles := range want {
+		if len(status.Groups[group]) != len(profiles) {
+			t.Errorf("group %q has %d profiles, want %v", group, len(status.Groups[group]), profiles)
+		}
+		for _, profile := range profiles {
+			if status.Groups[group][profile] == nil {
+				t.Errorf("group %q missing %s", group, profile)
+			}
+		}
+	}
+}
+
+func TestAnonymousQuotaRequests(t *testing.T) {
+	req := common.QuotaRequest{Quotas: []common.ProfileQuota{{ProfileID: 1, Required: 10}}}
+
+	t.Run("disabled", func(t *testing.T) {
+		_, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+		if rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", req); rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400 without a node_id", rec.Code)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		s, handler := newTestServer(t, &ServerConfig{
+			ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}},
+			AllowAnonymous: true,
+		})
+		rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp common.QuotaResponse
+		decodeBody(t, rec, &resp)
+		if got := granted(t, resp); got != 10 {
+			t.Fatalf("granted = %d, want 10", got)
+		}
+		if used := s.quotaManager.profiles[1].nodeUsed[AnonymousNodeID]; used != 10 {
+			t.Fatalf("anonymous node used = %d, want 10 accounted to %q", used, AnonymousNodeID)
+		}
+	})
+}
+
+func TestRefreshIntervalEndpoint(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{})
+
+	rec := serve(t, handler, http.MethodPut, "/api/v1/config/refresh-interval", map[string]string{"refresh_interval": "30s"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := s.quotaManager.RefreshInterval(); got != 30*time.Second {
+		t.Fatalf("interval = %v, want 30s", got)
+	}
+
+	rec = serve(t, handler, http.MethodGet, "/api/v1/config/refresh-interval", nil)
+	var body map[string]string
+	decodeBody(t, rec, &body)
+	if body["refresh_interval"] != "30s" {
+		t.Fatalf("GET body = %v, want 30s", body)
+	}
+
+	for _, value := range []string{"soon", "100ms", "48h"} {
+		rec = serve(t, handler, http.MethodPut, "/api/v1/config/refresh-interval", map[string]string{"refresh_interval": value})
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("PUT %q status = %d, want 400", value, rec.Code)
+		}
+	}
+	if got := s.quotaManager.RefreshInterval(); got != 30*time.Second {
+		t.Fatalf("interval after invalid updates = %v, want 30s", got)
+	}
+}
+
+func TestRefreshGuardRejectsChecksDuringSlowRefresh(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	s, handler := newTestServer(t, &ServerConfig{
+		RefreshGuard: 2 * time.Second,
+		ProfileConfigs: map[int]ProfileConfig{1: {
+			TotalQuota: 100,
+			RefreshFunc: func(int) (int64, bool, error) {
+				// 模拟慢速的外部预算来源，刷新期间停在这里
+				close(entered)
+				<-release
+				return 100, true, nil
+			},
+		}},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.quotaManager.refresh()
+		close(done)
+	}()
+	<-entered
+
+	rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 10))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status during refresh = %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("Retry-After = %q, want 2", got)
+	}
+
+	close(release)
+	<-done
+	rec = serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 10))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status after refresh = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp common.QuotaResponse
+	decodeBody(t, rec, &resp)
+	granted(t, resp)
+}
+
+func TestEffectiveConfigReflectsRuntimeOverridesAndRedactsSecrets(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}},
+		TLSCertFile:    "/etc/throttle/server.crt",
+		TLSKeyFile:     "/etc/throttle/server.key",
+	})
+
+	// 运行时修改刷新周期、日志采样率、冻结状态和 profile
+	serve(t, handler, http.MethodPut, "/api/v1/config/refresh-interval", map[string]string{"refresh_interval": "30s"})
+	serve(t, handler, http.MethodPut, "/api/v1/admin/log-sampling", map[string]int64{"sample_rate": 7})
+	serve(t, handler, http.MethodPut, "/api/v1/admin/freeze", map[string]any{"frozen": true, "mode": "allow"})
+	if err := s.quotaManager.UpdateProfile(1, ProfileConfig{TotalQuota: 250}); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	rec := serve(t, handler, http.MethodGet, "/api/v1/config", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	raw := rec.Body.String()
+	var effective EffectiveConfig
+	decodeBody(t, rec, &effective)
+
+	if effective.Manager.RefreshInterval != "30s" || effective.LogSampleRate != 7 {
+		t.Errorf("refresh interval %q, sample rate %d, want the runtime values 30s and 7", effective.Manager.RefreshInterval, effective.LogSampleRate)
+	}
+	if !effective.Manager.Frozen || effective.Manager.FreezeMode != FreezeAllowAll {
+		t.Errorf("frozen %v mode %v, want frozen in allow mode", effective.Manager.Frozen, effective.Manager.FreezeMode)
+	}
+	if got := effective.Manager.Profiles["1"].TotalQuota; got != 250 {
+		t.Errorf("profile 1 total quota = %d, want the updated 250", got)
+	}
+
+	// 只说明启用了 TLS，不暴露私钥位置和令牌签名密钥
+	if !effective.TLS {
+		t.Error("TLS not reported as enabled")
+	}
+	if strings.Contains(raw, "server.key") || strings.Contains(raw, "server.crt") {
+		t.Errorf("effective config exposes TLS file paths: %s", raw)
+	}
+	if strings.Contains(strings.ToLower(raw), "token_key") || strings.Contains(raw, base64.StdEncoding.EncodeToString(s.quotaManager.tokenKey)) {
+		t.Errorf("effective config exposes the token signing key: %s", raw)
+	}
+}
+
+func TestQuotaCheckBatch(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}}})
+
+	// 响应顺序与请求一致，按顺序扣减
+	rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check-batch", []common.QuotaRequest{
+		quotaRequest("node-1", 1, 60),
+		quotaRequest("node-2", 1, 60),
+		quotaRequest("node-3", 2, 10),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resps []common.QuotaResponse
+	decodeBody(t, rec, &resps)
+	if len(resps) != 3 {
+		t.Fatalf("got %d responses, want 3", len(resps))
+	}
+	for i, want := range []int64{60, 40, 0} {
+		if got := granted(t, resps[i]); got != want {
+			t.Errorf("response %d granted %d, want %d", i, got, want)
+		}
+	}
+	if !resps[2].Quotas[0].NotFound {
+		t.Errorf("unknown profile response = %+v, want NotFound", resps[2].Quotas[0])
+	}
+
+	// 有一项无效时整批以 400 拒绝，指出是哪一项，有效的项也不扣减
+	s.quotaManager.refresh()
+	invalid := []struct {
+		name string
+		reqs []common.QuotaRequest
+		want string
+	}{
+		{"missing node", []common.QuotaRequest{quotaRequest("node-1", 1, 10), quotaRequest("", 1, 10)}, "request 1: node_id is required"},
+		{"empty quotas", []common.QuotaRequest{{NodeID: "node-1"}, quotaRequest("node-1", 1, 10)}, "request 0: quotas cannot be empty"},
+		{"non-positive required", []common.QuotaRequest{quotaRequest("node-1", 1, 10), quotaRequest("node-2", 1, 0)}, "request 1: required quota must be positive"},
+		{"empty batch", []common.QuotaRequest{}, "requests cannot be empty"},
+	}
+	for _, tt := range invalid {
+		rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check-batch", tt.reqs)
+		var body map[string]string
+		decodeBody(t, rec, &body)
+		if rec.Code != http.StatusBadRequest || body["error"] != tt.want {
+			t.Errorf("%s: status %d error %q, want 400 %q", tt.name, rec.Code, body["error"], tt.want)
+		}
+	}
+	if used := s.quotaManager.profiles[1].usedQuota; used != 0 {
+		t.Fatalf("used = %d after rejected batches, want 0", used)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/quota/check-batch", strings.NewReader(`{"node_id":`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed batch status = %d, want 400", rec.Code)
+	}
+}
+
+func TestQuotaCheckBatchInNamespace(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}},
+		Namespaces: map[string]NamespaceConfig{
+			"eu": {RefreshInterval: testRefreshInterval, ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 50}}},
+		},
+	})
+
+	rec := serve(t, handler, http.MethodPost, "/api/v1/eu/quota/check-batch", []common.QuotaRequest{
+		quotaRequest("node-1", 1, 30),
+		quotaRequest("node-2", 1, 30),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resps []common.QuotaResponse
+	decodeBody(t, rec, &resps)
+	for i, want := range []int64{30, 20} {
+		if got := granted(t, resps[i]); got != want {
+			t.Errorf("response %d granted %d, want %d from the eu pool", i, got, want)
+		}
+	}
+	if used := s.quotaManager.profiles[1].usedQuota; used != 0 {
+		t.Fatalf("default namespace used = %d, want it untouched", used)
+	}
+
+	if rec := serve(t, handler, http.MethodPost, "/api/v1/apac/quota/check-batch", []common.QuotaRequest{quotaRequest("node-1", 1, 1)}); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown namespace status = %d, want 404", rec.Code)
+	}
+}
+
+func TestQuotaCheckBatchRejectedWhileRefreshing(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}},
+		RefreshGuard:   2 * time.Second,
+	})
+	s.quotaManager.refreshing.Store(true)
+
+	rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check-batch", []common.QuotaRequest{quotaRequest("node-1", 1, 10)})
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 like the single check", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("Retry-After = %q, want 2", got)
+	}
+}
+
+// spanNames 记录已结束 span 名称的 common.Tracer
+type spanNames struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (s *spanNames) Start(ctx context.Context, name string) (context.Context, common.Span) {
+	return ctx, namedSpan{s, name}
+}
+
+func (s *spanNames) Inject(context.Context, http.Header) {}
+
+func (s *spanNames) Extract(ctx context.Context, _ http.Header) context.Context {
+	return ctx
+}
+
+type namedSpan struct {
+	recorder *spanNames
+	name     string
+}
+
+func (s namedSpan) SetAttribute(string, any) {}
+
+func (s namedSpan) End() {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.names = append(s.recorder.names, s.name)
+}
+
+func TestQuotaCheckBatchRecordsSpan(t *testing.T) {
+	tracer := &spanNames{}
+	_, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{1: {TotalQuota: 100}},
+		Tracer:         tracer,
+	})
+
+	serve(t, handler, http.MethodPost, "/api/v1/quota/check-batch", []common.QuotaRequest{quotaRequest("node-1", 1, 10)})
+	if len(tracer.names) != 1 || tracer.names[0] != "quota.check_batch" {
+		t.Fatalf("spans = %v, want one quota.check_batch span", tracer.names)
+	}
+}
+
+func TestFleetHealthAggregatesMixedNodeStates(t *testing.T) {
+	s, handler := newTestServer(t, &ServerConfig{NodeStaleAfter: time.Minute})
+	now := time.Now()
+	for _, status := range []common.NodeStatus{
+		{NodeID: "node-a", State: common.StateOnline, LastSeen: now},
+		{NodeID: "node-b", State: common.StateOnline, LastSeen: now.Add(-10 * time.Minute)},
+		{NodeID: "node-c", State: common.StateOffline, LastSeen: now},
+		{NodeID: "node-d", State: common.StateOverloaded, LastSeen: now.Add(-2 * time.Minute)},
+	} {
+		s.quotaManager.UpdateNodeStatus(status)
+	}
+
+	rec := serve(t, handler, http.MethodGet, "/api/v1/health/fleet", nil)
+	var health FleetHealth
+	decodeBody(t, rec, &health)
+	wantStates := map[string]int{
+		common.StateOnline.String():     2,
+		common.StateOffline.String():    1,
+		common.StateOverloaded.String(): 1,
+	}
+	if health.Total != 4 || !reflect.DeepEqual(health.States, wantStates) {
+		t.Fatalf("health = %+v, want 4 nodes with states %v", health, wantStates)
+	}
+	if len(health.Stale) != 2 || health.Stale[0].NodeID != "node-b" || health.Stale[1].NodeID != "node-d" {
+		t.Fatalf("stale nodes = %+v, want node-b and node-d", health.Stale)
+	}
+
+	// stale_after 覆盖配置的阈值
+	rec = serve(t, handler, http.MethodGet, "/api/v1/health/fleet?stale_after=5m", nil)
+	decodeBody(t, rec, &health)
+	if len(health.Stale) != 1 || health.Stale[0].NodeID != "node-b" || health.Stale[0].State != common.StateOnline.String() {
+		t.Fatalf("stale nodes with a 5m threshold = %+v, want only node-b", health.Stale)
+	}
+	if rec := serve(t, handler, http.MethodGet, "/api/v1/health/fleet?stale_after=never", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid stale_after status = %d, want 400", rec.Code)
+	}
+}
+
+func TestScrapeRateLimitIsIndependentOfQuotaChecks(t *testing.T) {
+	config := fixedWindow(100, time.Minute)
+	s, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{1: config}, ScrapeRateLimit: 2})
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		codes = append(codes, serve(t, handler, http.MethodGet, "/api/v1/status", nil).Code)
+	}
+	if !reflect.DeepEqual(codes, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}) {
+		t.Fatalf("status scrape codes = %v, want two 200s then 429", codes)
+	}
+	rec := serve(t, handler, http.MethodGet, "/metrics", nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("metrics scrape status = %d, Retry-After %q, want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// 配额检查不受观测类查询的限制，观测类查询也没有消耗 profile 的速率许可
+	for i := 0; i < 5; i++ {
+		rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 1))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("quota check %d status = %d, want 200 while scrapes are throttled", i, rec.Code)
+		}
+	}
+	if count := s.quotaManager.profiles[1].rate.RequestCount; count != 5 {
+		t.Fatalf("profile rate window count = %d, want only the 5 quota checks", count)
+	}
+}
+
+func TestQuotaCheckSetsRetryAfterWhenAllProfilesRateLimited(t *testing.T) {
+	clock := newFakeClock()
+	s, handler := newTestServer(t, &ServerConfig{ProfileConfigs: map[int]ProfileConfig{
+		1: fixedWindow(1, 5*time.Second),
+		2: {TotalQuota: 1000},
+	}})
+	withClock(clock)(s.quotaManager)
+
+	if rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 1)); rec.Header().Get("Retry-After") != "" {
+		t.Fatalf("admitted request carries Retry-After %q", rec.Header().Get("Retry-After"))
+	}
+	clock.Advance(2500 * time.Millisecond)
+
+	// 还有 profile 未被限制时不设置 Retry-After
+	mixed := quotaRequest("node-1", 1, 1)
+	mixed.Quotas = append(mixed.Quotas, common.ProfileQuota{ProfileID: 2, Required: 1})
+	if rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", mixed); rec.Header().Get("Retry-After") != "" {
+		t.Fatalf("partly limited request carries Retry-After %q", rec.Header().Get("Retry-After"))
+	}
+
+	rec := serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 1, 1))
+	var resp common.QuotaResponse
+	decodeBody(t, rec, &resp)
+	if q := resp.Quotas[0]; !q.RateLimited || q.RetryAfter <= 2*time.Second || q.RetryAfter > 3*time.Second {
+		t.Fatalf("limited profile = %+v, want RetryAfter of about 2.5s", q)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3" {
+		t.Fatalf("Retry-After = %q, want 3 (2.5s rounded up)", got)
+	}
+}
+
+func TestRateLimitedRequestLoggedAtWarnWithProfileID(t *testing.T) {
+	logger := &capturingLogger{}
+	_, handler := newTestServer(t, &ServerConfig{
+		ProfileConfigs: map[int]ProfileConfig{7: fixedWindow(1, time.Minute)},
+		Logger:         logger,
+	})
+
+	serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 7, 1))
+	if entries := logger.find("WARN", "quota request rate limited"); len(entries) != 0 {
+		t.Fatalf("admitted request logged as rate limited: %v", entries)
+	}
+	serve(t, handler, http.MethodPost, "/api/v1/quota/check", quotaRequest("node-1", 7, 1))
+
+	entries := logger.find("WARN", "quota request rate limited")
+	if len(entries) != 1 {
+		t.Fatalf("got %d rate limit warnings, want 1", len(entries))
+	}
+	if got := entries[0].args["profile_id"]; got != 7 {
+		t.Fatalf("rate limit warning profile_id = %v, want 7", got)
+	}
+}
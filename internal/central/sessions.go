@@ -0,0 +1,145 @@
+package central
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// defaultSessionTTL 会话空闲多久后过期
+const defaultSessionTTL = 5 * time.Minute
+
+// quotaSession 一次性预留给客户端的配额，客户端在本地逐步消耗，关闭时归还剩余部分
+type quotaSession struct {
+	profileID int
+	remaining int64     // 尚未消耗的预留配额
+	window    time.Time // 开启时所在刷新窗口的起点，窗口切换后用量已清零，不再归还
+	expiresAt time.Time // 空闲过期时间，每次消耗时顺延
+}
+
+// WithSessionTTL 设置配额会话的空闲过期时间，默认 5 分钟
+func WithSessionTTL(ttl time.Duration) QuotaOption {
+	return func(qm *QuotaManager) {
+		if ttl > 0 {
+			qm.sessionTTL = ttl
+		}
+	}
+}
+
+// OpenSession 为 profile 预留最多 amount 的配额并返回会话句柄
+// 配额不足时只预留剩余部分，返回实际预留的数量；完全没有剩余时返回 common.ErrNoQuota
+func (qm *QuotaManager) OpenSession(profileID int, amount int64) (handle string, reserved int64, err error) {
+	if amount <= 0 {
+		return "", 0, fmt.Errorf("%w: amount must be positive", common.ErrInvalidRequest)
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	now := qm.now()
+	qm.expireSessionsLocked(now)
+
+	profileMgr, exists := qm.getProfileLocked(profileID)
+	if !exists {
+		return "", 0, common.ErrProfileNotFound
+	}
+
+	reserved = min(amount, max(profileMgr.effectiveQuota(now)-profileMgr.usedQuota, 0))
+	reserved = qm.consumeLocked(profileMgr, "", reserved, now)
+	usedBefore := profileMgr.usedQuota
+	profileMgr.usedQuota += reserved
+	qm.checkGrantInvariantLocked(profileMgr, now, usedBefore, reserved)
+	qm.recordGrant(profileMgr, reserved)
+	if reserved == 0 {
+		return "", 0, common.ErrNoQuota
+	}
+
+	handle = newSessionHandle()
+	qm.sessions[handle] = &quotaSession{
+		profileID: profileID,
+		remaining: reserved,
+		window:    qm.lastRefresh,
+		expiresAt: now.Add(qm.sessionTTL),
+	}
+	return handle, reserved, nil
+}
+
+// Draw 从会话中消耗 n 个单位，返回会话剩余的预留配额
+// 剩余不足时不消耗并返回 common.ErrQuotaExceeded
+func (qm *QuotaManager) Draw(handle string, n int64) (int64, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: amount must be positive", common.ErrInvalidRequest)
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	now := qm.now()
+	qm.expireSessionsLocked(now)
+
+	session, exists := qm.sessions[handle]
+	if !exists {
+		return 0, common.ErrSessionNotFound
+	}
+	if n > session.remaining {
+		return session.remaining, common.ErrQuotaExceeded
+	}
+
+	session.remaining -= n
+	session.expiresAt = now.Add(qm.sessionTTL)
+	return session.remaining, nil
+}
+
+// CloseSession 关闭会话并将未消耗的配额归还给 profile，返回归还的数量
+func (qm *QuotaManager) CloseSession(handle string) (int64, error) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.expireSessionsLocked(qm.now())
+
+	session, exists := qm.sessions[handle]
+	if !exists {
+		return 0, common.ErrSessionNotFound
+	}
+	return qm.releaseSessionLocked(handle, session), nil
+}
+
+// expireSessionsLocked 关闭所有已过期的会话，剩余配额同样归还
+func (qm *QuotaManager) expireSessionsLocked(now time.Time) {
+	for handle, session := range qm.sessions {
+		if now.After(session.expiresAt) {
+			qm.releaseSessionLocked(handle, session)
+		}
+	}
+}
+
+// releaseSessionLocked 删除会话并归还剩余配额
+// 会话开启后已经发生过刷新时用量已被清零，此时不再归还，避免把新窗口的用量扣成负数
+func (qm *QuotaManager) releaseSessionLocked(handle string, session *quotaSession) int64 {
+	delete(qm.sessions, handle)
+
+	profileMgr, exists := qm.profiles[session.profileID]
+	if !exists || !session.window.Equal(qm.lastRefresh) {
+		return 0
+	}
+
+	returned := min(session.remaining, profileMgr.usedQuota)
+	profileMgr.usedQuota -= returned
+	qm.releaseLocked(profileMgr, "", returned)
+	qm.recordUsage(profileMgr)
+	if returned > 0 {
+		qm.notifyQuotaFreedLocked(session.profileID)
+	}
+	return returned
+}
+
+// newSessionHandle 生成随机会话句柄
+func newSessionHandle() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("generate session handle: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
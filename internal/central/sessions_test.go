@@ -0,0 +1,60 @@
+package central
+
+import (
+	"errors"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestSessionDrawAndReturnRemainder(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+
+	handle, reserved, err := qm.OpenSession(1, 60)
+	if err != nil || reserved != 60 {
+		t.Fatalf("OpenSession = %d, %v, want 60 reserved", reserved, err)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 100))); got != 40 {
+		t.Fatalf("granted outside the session = %d, want the unreserved 40", got)
+	}
+
+	if remaining, err := qm.Draw(handle, 25); err != nil || remaining != 35 {
+		t.Fatalf("Draw(25) = %d, %v, want 35 remaining", remaining, err)
+	}
+	if remaining, err := qm.Draw(handle, 50); !errors.Is(err, common.ErrQuotaExceeded) || remaining != 35 {
+		t.Fatalf("Draw(50) = %d, %v, want ErrQuotaExceeded with 35 untouched", remaining, err)
+	}
+
+	returned, err := qm.CloseSession(handle)
+	if err != nil || returned != 35 {
+		t.Fatalf("CloseSession = %d, %v, want 35 returned", returned, err)
+	}
+	if used := qm.profiles[1].usedQuota; used != 65 {
+		t.Fatalf("usedQuota after close = %d, want 65 (40 granted + 25 drawn)", used)
+	}
+	if _, err := qm.Draw(handle, 1); !errors.Is(err, common.ErrSessionNotFound) {
+		t.Fatalf("Draw after close = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSessionExpiresAndReturnsRemainder(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}},
+		withClock(clock), WithSessionTTL(time.Minute))
+
+	handle, _, err := qm.OpenSession(1, 50)
+	if err != nil {
+		t.Fatalf("OpenSession: %v", err)
+	}
+	if _, err := qm.Draw(handle, 10); err != nil {
+		t.Fatalf("Draw: %v", err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if _, err := qm.Draw(handle, 1); !errors.Is(err, common.ErrSessionNotFound) {
+		t.Fatalf("Draw after expiry = %v, want ErrSessionNotFound", err)
+	}
+	if used := qm.profiles[1].usedQuota; used != 10 {
+		t.Fatalf("usedQuota after expiry = %d, want only the 10 drawn", used)
+	}
+}
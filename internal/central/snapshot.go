@@ -0,0 +1,107 @@
+package central
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultSnapshotInterval 配置了 SnapshotPath 但没有配置周期时写快照的周期
+const defaultSnapshotInterval = 30 * time.Second
+
+// Snapshot 把所有已加载 profile 的用量、速率窗口和节点用量序列化为 JSON
+func (qm *QuotaManager) Snapshot() ([]byte, error) {
+	return json.Marshal(qm.ExportState())
+}
+
+// Restore 从 Snapshot 的结果恢复状态，语义与 ImportState 相同
+func (qm *QuotaManager) Restore(data []byte) error {
+	var snapshot StateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("decode snapshot failed: %w", err)
+	}
+	return qm.ImportState(snapshot)
+}
+
+// restoreSnapshot 启动时从 SnapshotPath 恢复默认命名空间的状态，避免重启后用量清零导致本窗口超发
+// 文件不存在或快照所在的刷新窗口已经结束时不恢复；恢复失败只记录日志，不影响启动
+func (s *Server) restoreSnapshot() {
+	if s.config.SnapshotPath == "" {
+		return
+	}
+
+	data, err := os.ReadFile(s.config.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("read snapshot failed", "path", s.config.SnapshotPath, "error", err)
+		return
+	}
+
+	var snapshot StateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		s.logger.Error("decode snapshot failed", "path", s.config.SnapshotPath, "error", err)
+		return
+	}
+	if !snapshot.LastRefresh.IsZero() && time.Since(snapshot.LastRefresh) >= s.quotaManager.RefreshInterval() {
+		s.logger.Warn("snapshot is from an expired refresh window, skipping restore",
+			"path", s.config.SnapshotPath, "last_refresh", snapshot.LastRefresh.Format(time.RFC3339))
+		return
+	}
+
+	if err := s.quotaManager.ImportState(snapshot); err != nil {
+		s.logger.Error("restore snapshot partially failed", "path", s.config.SnapshotPath, "error", err)
+		return
+	}
+	s.logger.Info("restored state from snapshot", "profiles", len(snapshot.Profiles), "path", s.config.SnapshotPath)
+}
+
+// startSnapshotWriter 定期把默认命名空间的状态写入 SnapshotPath
+func (s *Server) startSnapshotWriter() {
+	if s.config.SnapshotPath == "" {
+		return
+	}
+
+	interval := s.config.SnapshotInterval
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.writeSnapshot(); err != nil {
+				s.logger.Error("write snapshot failed", "path", s.config.SnapshotPath, "error", err)
+			}
+		}
+	}()
+}
+
+// writeSnapshot 先写临时文件再重命名，保证崩溃时不会留下不完整的快照
+func (s *Server) writeSnapshot() error {
+	data, err := s.quotaManager.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.SnapshotPath), filepath.Base(s.config.SnapshotPath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.config.SnapshotPath)
+}
@@ -0,0 +1,71 @@
+package central
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestoreReconstructsCounters(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: fixedWindow(10, time.Minute)}, withClock(clock))
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 30)))
+	granted(t, qm.CheckQuota(quotaRequest("node-2", 1, 20)))
+
+	data, err := qm.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	// 快照之后的变化在恢复后应当被撤销
+	granted(t, qm.CheckQuota(quotaRequest("node-1", 1, 100)))
+	granted(t, qm.CheckQuota(quotaRequest("node-3", 1, 5)))
+
+	if err := qm.Restore(data); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	profile := qm.profiles[1]
+	if profile.usedQuota != 50 {
+		t.Errorf("restored usedQuota = %d, want 50", profile.usedQuota)
+	}
+	if len(profile.nodeUsed) != 2 || profile.nodeUsed["node-1"] != 30 || profile.nodeUsed["node-2"] != 20 {
+		t.Errorf("restored nodeUsed = %v, want node-1:30 node-2:20", profile.nodeUsed)
+	}
+	if profile.rate.RequestCount != 2 {
+		t.Errorf("restored window request count = %d, want 2", profile.rate.RequestCount)
+	}
+
+	if err := qm.Restore([]byte("{not json")); err == nil {
+		t.Fatal("Restore accepted malformed data")
+	}
+}
+
+func TestNewServerRestoresSnapshotFile(t *testing.T) {
+	profiles := map[int]ProfileConfig{1: {TotalQuota: 100}}
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// 文件不存在时正常启动
+	before, _ := newTestServer(t, &ServerConfig{ProfileConfigs: profiles, SnapshotPath: path})
+	granted(t, before.quotaManager.CheckQuota(quotaRequest("node-1", 1, 40)))
+	if err := before.writeSnapshot(); err != nil {
+		t.Fatalf("writeSnapshot: %v", err)
+	}
+
+	after, _ := newTestServer(t, &ServerConfig{ProfileConfigs: profiles, SnapshotPath: path})
+	if used := after.quotaManager.profiles[1].usedQuota; used != 40 {
+		t.Fatalf("usedQuota after restart = %d, want 40", used)
+	}
+	if got := granted(t, after.quotaManager.CheckQuota(quotaRequest("node-1", 1, 100))); got != 60 {
+		t.Fatalf("granted %d after restart, want the remaining 60", got)
+	}
+
+	// 快照所在的刷新窗口已经结束时不恢复
+	if err := os.WriteFile(path, []byte(`{"last_refresh":"2000-01-01T00:00:00Z","profiles":{"1":{"total_quota":100,"used_quota":90}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stale, _ := newTestServer(t, &ServerConfig{ProfileConfigs: profiles, SnapshotPath: path})
+	if used := stale.quotaManager.profiles[1].usedQuota; used != 0 {
+		t.Fatalf("usedQuota after restoring an expired snapshot = %d, want 0", used)
+	}
+}
@@ -0,0 +1,70 @@
+package central
+
+import (
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+// resetOffset profile 用量清零相对刷新时刻的偏移，由 profile ID 确定性地散列到 [0, interval) 内
+// 各中心实例和每次重启得到的偏移相同
+func resetOffset(profileID int, interval time.Duration) time.Duration {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.Itoa(profileID)))
+	return time.Duration(float64(h.Sum32()) / (1 << 32) * float64(interval))
+}
+
+// scheduleResetLocked 安排启用 StaggerReset 的 profile 在偏移时刻清零用量
+// 上一次安排的清零如果还没执行（例如刷新周期被缩短），先立即执行
+func (qm *QuotaManager) scheduleResetLocked(profileMgr *ProfileManager) {
+	if !profileMgr.pendingReset.IsZero() {
+		qm.resetUsageLocked(profileMgr)
+	}
+	profileMgr.pendingReset = qm.lastRefresh.Add(resetOffset(profileMgr.profileID, qm.refreshInterval))
+}
+
+// applyDueResetLocked 到达偏移时刻时执行被推迟的用量清零，返回是否执行了清零
+func (qm *QuotaManager) applyDueResetLocked(profileMgr *ProfileManager, now time.Time) bool {
+	if profileMgr.pendingReset.IsZero() || now.Before(profileMgr.pendingReset) {
+		return false
+	}
+	qm.resetUsageLocked(profileMgr)
+	qm.recordUsage(profileMgr)
+	qm.notifyQuotaFreedLocked(profileMgr.profileID)
+	return true
+}
+
+// applyDueResets 执行所有已到期的用量清零，由刷新协程在最近的清零时刻调用
+// 配额检查等路径在访问 profile 时也会执行，这里保证状态查询看到的用量及时更新
+func (qm *QuotaManager) applyDueResets() {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	now := qm.now()
+	for _, profileMgr := range qm.profiles {
+		qm.applyDueResetLocked(profileMgr, now)
+	}
+}
+
+// untilNextReset 距最近一次待执行的用量清零的时间，没有待执行的清零时返回刷新周期
+func (qm *QuotaManager) untilNextReset() time.Duration {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	next := qm.refreshInterval
+	now := qm.now()
+	for _, profileMgr := range qm.profiles {
+		if !profileMgr.pendingReset.IsZero() {
+			next = min(next, max(profileMgr.pendingReset.Sub(now), 0))
+		}
+	}
+	return next
+}
+
+// resetUsage 清零本窗口的用量
+func (pm *ProfileManager) resetUsage() {
+	pm.usedQuota = 0
+	clear(pm.nodeUsed)
+	clear(pm.nodeAllowance)
+	pm.pendingReset = time.Time{}
+}
@@ -0,0 +1,57 @@
+package central
+
+import "testing"
+
+func TestResetOffsetIsDeterministicWithinInterval(t *testing.T) {
+	for profileID := 1; profileID <= 100; profileID++ {
+		offset := resetOffset(profileID, testRefreshInterval)
+		if offset < 0 || offset >= testRefreshInterval {
+			t.Fatalf("profile %d offset %v outside [0, %v)", profileID, offset, testRefreshInterval)
+		}
+		if again := resetOffset(profileID, testRefreshInterval); again != offset {
+			t.Fatalf("profile %d offset changed from %v to %v", profileID, offset, again)
+		}
+	}
+}
+
+func TestStaggeredProfilesResetAtDifferentOffsets(t *testing.T) {
+	clock := newFakeClock()
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{
+		1: {TotalQuota: 100, StaggerReset: true},
+		2: {TotalQuota: 100, StaggerReset: true},
+	}, withClock(clock))
+	for _, profileID := range []int{1, 2} {
+		granted(t, qm.CheckQuota(quotaRequest("node-1", profileID, 100)))
+	}
+
+	first, second := 1, 2
+	if resetOffset(second, testRefreshInterval) < resetOffset(first, testRefreshInterval) {
+		first, second = second, first
+	}
+	earlier, later := resetOffset(first, testRefreshInterval), resetOffset(second, testRefreshInterval)
+	if earlier == later {
+		t.Fatalf("profiles 1 and 2 share the reset offset %v", earlier)
+	}
+
+	// 刷新时两个 profile 都不立即清零
+	qm.refresh()
+	for _, profileID := range []int{1, 2} {
+		if got := granted(t, qm.CheckQuota(quotaRequest("node-1", profileID, 1))); got != 0 {
+			t.Fatalf("profile %d granted %d right after the refresh, want its reset deferred", profileID, got)
+		}
+	}
+
+	// 偏移较小的 profile 先清零，另一个还要等到自己的偏移时刻
+	clock.Advance(earlier + (later-earlier)/2)
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", first, 100))); got != 100 {
+		t.Fatalf("profile %d granted %d after its offset %v, want 100", first, got, earlier)
+	}
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", second, 1))); got != 0 {
+		t.Fatalf("profile %d granted %d before its offset %v, want 0", second, got, later)
+	}
+
+	clock.Advance(later - earlier)
+	if got := granted(t, qm.CheckQuota(quotaRequest("node-1", second, 100))); got != 100 {
+		t.Fatalf("profile %d granted %d after its offset %v, want 100", second, got, later)
+	}
+}
@@ -0,0 +1,58 @@
+package central
+
+import (
+	"math"
+	"throttle_control/internal/common"
+	"throttle_control/internal/ratelimit"
+	"time"
+)
+
+// StartupPolicy profile 刚加载（或速率状态被重置）后第一个速率窗口内的准入方式
+type StartupPolicy int
+
+const (
+	// StartupPrefill 速率状态一开始就是满的：令牌桶装满 Burst 个令牌，窗口计数为零（默认）
+	// 启动后的第一批请求可以立即用满整个突发量
+	StartupPrefill StartupPolicy = iota
+	// StartupRamp 从第一个请求开始逐步放开：令牌桶从空桶开始按速率补充，
+	// 固定/滑动窗口的限额在第一个窗口内按经过的时间比例从 1 线性增长到 RateLimit，避免重启后的惊群
+	// 只作用于 profile 级别的速率控制，路径级别的子限制不受影响
+	StartupRamp
+)
+
+func (p StartupPolicy) String() string {
+	switch p {
+	case StartupRamp:
+		return "ramp"
+	default:
+		return "prefill"
+	}
+}
+
+// beginRamp 启用 StartupRamp 时在第一个请求到达时开始爬坡，令牌桶从空桶开始
+func (pm *ProfileManager) beginRamp(now time.Time) {
+	if pm.config.StartupPolicy != StartupRamp || !pm.rampStart.IsZero() {
+		return
+	}
+	pm.rampStart = now
+	if pm.config.RateControlMethod == common.RateControlTokenBucket {
+		pm.rate.Tokens = 0
+		pm.rate.LastWindowTime = now
+	}
+}
+
+// startupLimit 爬坡期间窗口类速率控制的限额：按爬坡开始后经过的时间比例缩小，至少为 1
+// 令牌桶的爬坡由空桶实现，限额不变
+func (pm *ProfileManager) startupLimit(limit ratelimit.Limit, now time.Time) ratelimit.Limit {
+	if pm.config.StartupPolicy != StartupRamp || pm.rampStart.IsZero() ||
+		limit.Method == common.RateControlTokenBucket || limit.Window <= 0 {
+		return limit
+	}
+	elapsed := now.Sub(pm.rampStart)
+	if elapsed >= limit.Window {
+		return limit
+	}
+	ramped := int64(math.Ceil(float64(limit.Rate) * float64(elapsed) / float64(limit.Window)))
+	limit.Rate = min(max(ramped, 1), limit.Rate)
+	return limit
+}
@@ -0,0 +1,65 @@
+package central
+
+import (
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// admitted 连续发送 n 个请求，返回未被速率限制的数量
+func admitted(qm *QuotaManager, n int) int {
+	var count int
+	for i := 0; i < n; i++ {
+		if resp := qm.CheckQuota(quotaRequest("node-1", 1, 1)); !resp.Quotas[0].RateLimited {
+			count++
+		}
+	}
+	return count
+}
+
+func TestStartupPrefillAdmitsFullBurst(t *testing.T) {
+	config := ProfileConfig{TotalQuota: 1000, RateLimit: 10, Burst: 20, Window: time.Second, RateControlMethod: common.RateControlTokenBucket}
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(newFakeClock()), WithLogger(discardLogger()))
+
+	if got := admitted(qm, 30); got != 20 {
+		t.Fatalf("admitted %d of 30 at startup, want the full burst of 20", got)
+	}
+}
+
+func TestStartupRampAdmitsGradually(t *testing.T) {
+	t.Run("token bucket", func(t *testing.T) {
+		clock := newFakeClock()
+		config := ProfileConfig{TotalQuota: 1000, RateLimit: 10, Burst: 20, Window: time.Second,
+			RateControlMethod: common.RateControlTokenBucket, StartupPolicy: StartupRamp}
+		qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock), WithLogger(discardLogger()))
+
+		// 空桶开始，按每秒 10 个的速率补充
+		if got := admitted(qm, 30); got != 0 {
+			t.Fatalf("admitted %d at startup, want an empty bucket", got)
+		}
+		clock.Advance(500 * time.Millisecond)
+		if got := admitted(qm, 30); got != 5 {
+			t.Fatalf("admitted %d after 500ms, want 5 refilled tokens", got)
+		}
+	})
+
+	t.Run("fixed window", func(t *testing.T) {
+		clock := newFakeClock()
+		config := fixedWindow(10, 10*time.Second)
+		config.StartupPolicy = StartupRamp
+		qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: config}, withClock(clock), WithLogger(discardLogger()))
+
+		// 限额从 1 开始，按第一个窗口内经过的时间比例增长
+		if got := admitted(qm, 20); got != 1 {
+			t.Fatalf("admitted %d at startup, want 1", got)
+		}
+		clock.Advance(5 * time.Second)
+		if got := admitted(qm, 20); got != 4 {
+			t.Fatalf("admitted %d halfway through the first window, want 4 more up to half the limit", got)
+		}
+		clock.Advance(6 * time.Second)
+		if got := admitted(qm, 20); got != 10 {
+			t.Fatalf("admitted %d in the second window, want the full limit of 10", got)
+		}
+	})
+}
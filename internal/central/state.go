@@ -0,0 +1,143 @@
+package central
+
+import (
+	"fmt"
+	"sort"
+	"throttle_control/internal/common"
+	"throttle_control/internal/ratelimit"
+	"time"
+)
+
+// StateSnapshot 配额管理器的运行时状态快照，用于升级时把状态实时迁移到新实例
+// 只包含运行时状态，不包含 profile 配置；配置由新实例自己的 provider 提供
+type StateSnapshot struct {
+	TakenAt     time.Time            `json:"taken_at"`
+	LastRefresh time.Time            `json:"last_refresh"`
+	Profiles    map[int]ProfileState `json:"profiles"`
+}
+
+// ProfileState 单个 profile 的运行时状态
+type ProfileState struct {
+	TotalQuota int64                `json:"total_quota"`
+	UsedQuota  int64                `json:"used_quota"`
+	NodeUsed   map[string]int64     `json:"node_used,omitempty"`
+	Rate       RateState            `json:"rate"`
+	Dimensions map[string]RateState `json:"dimensions,omitempty"`
+	Boosts     []BoostState         `json:"boosts,omitempty"`
+}
+
+// RateState 速率控制状态
+type RateState struct {
+	LastWindowTime time.Time `json:"last_window_time"`
+	Tokens         int64     `json:"tokens"`
+	RequestCount   int64     `json:"request_count"`
+	PrevCount      int64     `json:"prev_count,omitempty"`
+}
+
+// BoostState 临时配额增量
+type BoostState struct {
+	Extra int64     `json:"extra"`
+	Until time.Time `json:"until"`
+}
+
+// ExportState 导出所有已加载 profile 的速率和配额状态
+func (qm *QuotaManager) ExportState() StateSnapshot {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	snapshot := StateSnapshot{
+		TakenAt:     qm.now(),
+		LastRefresh: qm.lastRefresh,
+		Profiles:    make(map[int]ProfileState, len(qm.profiles)),
+	}
+	for profileID, profileMgr := range qm.profiles {
+		snapshot.Profiles[profileID] = profileMgr.exportState()
+	}
+	return snapshot
+}
+
+// exportState 导出单个 profile 的运行时状态，调用方需持有锁
+func (pm *ProfileManager) exportState() ProfileState {
+	state := ProfileState{
+		TotalQuota: pm.totalQuota,
+		UsedQuota:  pm.usedQuota,
+		NodeUsed:   make(map[string]int64, len(pm.nodeUsed)),
+		Rate:       exportRateState(&pm.rate),
+		Dimensions: make(map[string]RateState, len(pm.dimensions)),
+	}
+	for nodeID, used := range pm.nodeUsed {
+		state.NodeUsed[nodeID] = used
+	}
+	for key, dimension := range pm.dimensions {
+		state.Dimensions[key] = exportRateState(dimension)
+	}
+	for _, boost := range pm.boosts {
+		state.Boosts = append(state.Boosts, BoostState{Extra: boost.extra, Until: boost.until})
+	}
+	return state
+}
+
+// ImportState 将快照中的状态载入本实例，覆盖对应 profile 的运行时状态
+// 本实例没有配置的 profile 被跳过，并通过 common.ErrProfileNotFound 报告
+func (qm *QuotaManager) ImportState(snapshot StateSnapshot) error {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if !snapshot.LastRefresh.IsZero() {
+		qm.lastRefresh = snapshot.LastRefresh
+	}
+
+	var missing []int
+	for profileID, state := range snapshot.Profiles {
+		profileMgr, exists := qm.getProfileLocked(profileID)
+		if !exists {
+			missing = append(missing, profileID)
+			continue
+		}
+
+		profileMgr.totalQuota = state.TotalQuota
+		profileMgr.usedQuota = state.UsedQuota
+		profileMgr.nodeUsed = make(map[string]int64, len(state.NodeUsed))
+		for nodeID, used := range state.NodeUsed {
+			profileMgr.nodeUsed[nodeID] = used
+		}
+		profileMgr.rate = importRateState(state.Rate)
+		profileMgr.dimensions = make(map[string]*ratelimit.State, len(state.Dimensions))
+		for key, dimension := range state.Dimensions {
+			imported := importRateState(dimension)
+			profileMgr.dimensions[key] = &imported
+		}
+		profileMgr.boosts = nil
+		for _, boost := range state.Boosts {
+			profileMgr.boosts = append(profileMgr.boosts, quotaBoost{extra: boost.Extra, until: boost.Until})
+		}
+		qm.recordUsage(profileMgr)
+	}
+
+	if len(missing) > 0 {
+		sort.Ints(missing)
+		return fmt.Errorf("%w: %v", common.ErrProfileNotFound, missing)
+	}
+	return nil
+}
+
+// exportRateState 导出速率状态
+func exportRateState(rs *ratelimit.State) RateState {
+	return RateState{
+		LastWindowTime: rs.LastWindowTime,
+		Tokens:         rs.Tokens,
+		RequestCount:   rs.RequestCount,
+		PrevCount:      rs.PrevCount,
+	}
+}
+
+// importRateState 由快照恢复速率状态
+func importRateState(state RateState) ratelimit.State {
+	return ratelimit.State{
+		LastWindowTime: state.LastWindowTime,
+		Tokens:         state.Tokens,
+		RequestCount:   state.RequestCount,
+		PrevCount:      state.PrevCount,
+		LastUsed:       state.LastWindowTime,
+	}
+}
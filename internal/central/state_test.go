@@ -0,0 +1,64 @@
+package central
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestExportImportPreservesRateAdmission(t *testing.T) {
+	clock := newFakeClock()
+	config := fixedWindow(3, time.Minute)
+	config.PathLimits = []PathRateLimit{
+		{PathPattern: "/orders/*", RateLimit: 1, Window: time.Minute, RateControlMethod: common.RateControlFixedWindow},
+	}
+	profiles := map[int]ProfileConfig{1: config}
+	source := NewQuotaManager(testRefreshInterval, profiles, withClock(clock))
+	target := NewQuotaManager(testRefreshInterval, profiles, withClock(clock))
+
+	source.CheckQuota(pathRequest(1, http.MethodGet, "/orders/1"))
+	source.CheckQuota(pathRequest(1, http.MethodGet, "/users/1"))
+
+	// 快照经过 JSON 传输到新实例
+	data, err := json.Marshal(source.ExportState())
+	if err != nil {
+		t.Fatalf("marshal snapshot: %v", err)
+	}
+	var snapshot StateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("unmarshal snapshot: %v", err)
+	}
+	if err := target.ImportState(snapshot); err != nil {
+		t.Fatalf("ImportState: %v", err)
+	}
+
+	if used := target.profiles[1].usedQuota; used != 2 {
+		t.Fatalf("imported usedQuota = %d, want 2", used)
+	}
+	if resp := target.CheckQuota(pathRequest(1, http.MethodGet, "/orders/2")); !resp.Quotas[0].RateLimited {
+		t.Fatal("path limit admitted a request its exported state had used up")
+	}
+	if resp := target.CheckQuota(pathRequest(1, http.MethodGet, "/users/2")); resp.Quotas[0].RateLimited {
+		t.Fatal("third profile request rate limited, want the last permit of the window")
+	}
+	if resp := target.CheckQuota(pathRequest(1, http.MethodGet, "/users/3")); !resp.Quotas[0].RateLimited {
+		t.Fatal("fourth profile request admitted, want the imported window exhausted")
+	}
+}
+
+func TestImportStateReportsUnknownProfiles(t *testing.T) {
+	source := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}, 2: {TotalQuota: 100}})
+	target := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	source.CheckQuota(quotaRequest("node-1", 1, 40))
+	source.CheckQuota(quotaRequest("node-1", 2, 40))
+
+	if err := target.ImportState(source.ExportState()); !errors.Is(err, common.ErrProfileNotFound) {
+		t.Fatalf("ImportState = %v, want ErrProfileNotFound for profile 2", err)
+	}
+	if got := granted(t, target.CheckQuota(quotaRequest("node-1", 1, 100))); got != 60 {
+		t.Fatalf("granted after import = %d, want the remaining 60", got)
+	}
+}
@@ -0,0 +1,44 @@
+package central
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// statusCache 最近一次成功获取的配额状态，后端（profile provider）暂时不可用时使用
+type statusCache struct {
+	mu     sync.Mutex
+	status map[string]interface{}
+	at     time.Time
+}
+
+// quotaStatus 获取配额状态，后端出错时返回缓存并标记 stale
+// 缓存超过 MaxStatusStaleness（0 表示不使用缓存）或从未成功获取时返回错误
+func (s *Server) quotaStatus() (map[string]interface{}, error) {
+	status, err := s.quotaManager.LoadQuotaStatus()
+	now := time.Now()
+
+	s.statusCache.mu.Lock()
+	defer s.statusCache.mu.Unlock()
+
+	if err == nil {
+		s.statusCache.status = status
+		s.statusCache.at = now
+		return status, nil
+	}
+
+	cached := s.statusCache.status
+	if cached == nil || s.config.MaxStatusStaleness <= 0 || now.Sub(s.statusCache.at) > s.config.MaxStatusStaleness {
+		return nil, err
+	}
+
+	stale := make(map[string]interface{}, len(cached)+3)
+	for key, value := range cached {
+		stale[key] = value
+	}
+	stale["stale"] = true
+	stale["as_of"] = s.statusCache.at
+	stale["error"] = fmt.Sprintf("serving cached status: %v", err)
+	return stale, nil
+}
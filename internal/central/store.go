@@ -0,0 +1,156 @@
+package central
+
+import (
+	"sync"
+	"time"
+)
+
+// QuotaStore profile 用量的计数存储
+// 多个中心实例共享同一个存储（如 RedisQuotaStore）时，扣减在存储中原子完成，实例之间不会重复分配同一份配额
+// 未配置存储时使用进程内的计数（默认）
+type QuotaStore interface {
+	// SetLimit 设置 profile 在当前窗口内的有效总配额
+	SetLimit(profileID int, limit int64) error
+	// Consume 原子地从 profile 剩余配额中扣减最多 n，返回实际扣减的数量
+	Consume(profileID int, node string, n int64) (granted int64, err error)
+	// Release 归还节点之前获得但未使用的配额
+	Release(profileID int, node string, n int64) error
+	// Reset 清零 profile 本窗口的用量；同一刷新周期内多个实例的重复清零只生效一次
+	Reset(profileID int)
+}
+
+// WithQuotaStore 使用外部存储计数 profile 用量，nil 表示使用进程内计数
+// 存储的调用在管理器的锁内进行，远程存储的延迟会直接影响配额检查的吞吐
+func WithQuotaStore(store QuotaStore) QuotaOption {
+	return func(qm *QuotaManager) {
+		qm.store = store
+	}
+}
+
+// consumeLocked 从 profile 中为节点扣减最多 n 的配额，返回实际获得的数量；调用方必须持有锁
+// 使用存储时以存储的扣减结果为准，存储不可用时拒绝分配
+func (qm *QuotaManager) consumeLocked(profileMgr *ProfileManager, nodeID string, n int64, now time.Time) int64 {
+	if qm.store == nil || n <= 0 {
+		return n
+	}
+
+	if limit := profileMgr.effectiveQuota(now); limit != profileMgr.storeLimit {
+		if err := qm.store.SetLimit(profileMgr.profileID, limit); err != nil {
+			qm.logger.Error("quota store set limit failed", "profile_id", profileMgr.profileID, "error", err)
+			return 0
+		}
+		profileMgr.storeLimit = limit
+	}
+
+	granted, err := qm.store.Consume(profileMgr.profileID, nodeID, n)
+	if err != nil {
+		qm.logger.Error("quota store consume failed", "profile_id", profileMgr.profileID, "error", err)
+		return 0
+	}
+	return min(max(granted, 0), n)
+}
+
+// releaseLocked 把节点归还的配额还给存储；调用方必须持有锁
+func (qm *QuotaManager) releaseLocked(profileMgr *ProfileManager, nodeID string, n int64) {
+	if qm.store == nil || n <= 0 {
+		return
+	}
+	if err := qm.store.Release(profileMgr.profileID, nodeID, n); err != nil {
+		qm.logger.Error("quota store release failed", "profile_id", profileMgr.profileID, "error", err)
+	}
+}
+
+// resetUsageLocked 清零 profile 本窗口的用量，包括存储中的用量；调用方必须持有锁
+func (qm *QuotaManager) resetUsageLocked(profileMgr *ProfileManager) {
+	profileMgr.resetUsage()
+	if qm.store != nil {
+		qm.store.Reset(profileMgr.profileID)
+	}
+}
+
+// MemoryQuotaStore 进程内的共享计数存储，用于同一进程内的多个配额管理器共享 profile 用量
+type MemoryQuotaStore struct {
+	mu         sync.Mutex
+	resetAfter time.Duration // 距上次清零不足该时长的清零请求被忽略
+	profiles   map[int]*storedUsage
+}
+
+// storedUsage 存储中单个 profile 的用量
+type storedUsage struct {
+	limit     int64
+	used      int64
+	nodeUsed  map[string]int64
+	lastReset time.Time
+}
+
+// NewMemoryQuotaStore 创建进程内存储，refreshInterval 为共享它的管理器的刷新周期，
+// 同一周期内的重复清零只生效一次
+func NewMemoryQuotaStore(refreshInterval time.Duration) *MemoryQuotaStore {
+	return &MemoryQuotaStore{
+		resetAfter: refreshInterval / 2,
+		profiles:   make(map[int]*storedUsage),
+	}
+}
+
+// usage 返回 profile 的用量记录，不存在时创建；调用方必须持有锁
+func (s *MemoryQuotaStore) usage(profileID int) *storedUsage {
+	usage, exists := s.profiles[profileID]
+	if !exists {
+		usage = &storedUsage{nodeUsed: make(map[string]int64)}
+		s.profiles[profileID] = usage
+	}
+	return usage
+}
+
+func (s *MemoryQuotaStore) SetLimit(profileID int, limit int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.usage(profileID).limit = limit
+	return nil
+}
+
+func (s *MemoryQuotaStore) Consume(profileID int, node string, n int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := s.usage(profileID)
+	granted := min(n, usage.limit-usage.used)
+	if granted <= 0 {
+		return 0, nil
+	}
+	usage.used += granted
+	usage.nodeUsed[node] += granted
+	return granted, nil
+}
+
+func (s *MemoryQuotaStore) Release(profileID int, node string, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := s.usage(profileID)
+	amount := min(n, usage.used)
+	if amount <= 0 {
+		return nil
+	}
+	usage.used -= amount
+	usage.nodeUsed[node] -= amount
+	if usage.nodeUsed[node] <= 0 {
+		delete(usage.nodeUsed, node)
+	}
+	return nil
+}
+
+func (s *MemoryQuotaStore) Reset(profileID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := s.usage(profileID)
+	now := time.Now()
+	if !usage.lastReset.IsZero() && now.Sub(usage.lastReset) < s.resetAfter {
+		return
+	}
+	usage.used = 0
+	clear(usage.nodeUsed)
+	usage.lastReset = now
+}
@@ -0,0 +1,99 @@
+package central
+
+import (
+	"context"
+	"reflect"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// waitRetryInterval 因速率限制或刷新被拒绝时的重试间隔
+// 速率许可随时间恢复，不会有释放信号，只能定时重试
+const waitRetryInterval = 50 * time.Millisecond
+
+// WaitQuota 阻塞直到请求至少分得一部分配额，或 ctx 结束
+// 配额耗尽时等待同一 profile 的配额被释放（节点归还、会话关闭、回收、窗口清零或刷新）后立即重试，
+// 被唤醒后总是重新检查，唤醒时配额已被其他请求取走则继续等待。
+// 请求被明确拒绝（未知 profile、校验失败、冻结、超过截止时间）时立即返回响应；ctx 结束时返回最后一次的响应和 ctx.Err()
+func (qm *QuotaManager) WaitQuota(ctx context.Context, req common.QuotaRequest) (common.QuotaResponse, error) {
+	for {
+		// 先取得唤醒通道再检查，检查之后发生的释放一定能唤醒本次等待
+		freed, known := qm.quotaFreedChans(req.Quotas)
+		resp := qm.CheckQuota(req)
+		if !known || !shouldWait(resp) {
+			return resp, nil
+		}
+
+		cases := make([]reflect.SelectCase, 0, len(freed)+2)
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+		var retry *time.Timer
+		if resp.Refreshing || anyRateLimited(resp) {
+			retry = time.NewTimer(waitRetryInterval)
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(retry.C)})
+		}
+		for _, ch := range freed {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+		}
+
+		chosen, _, _ := reflect.Select(cases)
+		if retry != nil {
+			retry.Stop()
+		}
+		if chosen == 0 {
+			return resp, ctx.Err()
+		}
+	}
+}
+
+// shouldWait 判断响应是否只是暂时没有配额，值得等待后重试
+func shouldWait(resp common.QuotaResponse) bool {
+	if resp.Refreshing {
+		return true
+	}
+	if resp.Frozen || resp.DeadlineExceeded || len(resp.Quotas) == 0 {
+		return false
+	}
+	for _, quota := range resp.Quotas {
+		if quota.Granted > 0 || quota.Reason != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// anyRateLimited 是否有 profile 因速率限制被拒绝
+func anyRateLimited(resp common.QuotaResponse) bool {
+	for _, quota := range resp.Quotas {
+		if quota.RateLimited {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaFreedChans 返回请求中各 profile 的配额释放通道，任一 profile 不存在时 known 为 false
+func (qm *QuotaManager) quotaFreedChans(quotas []common.ProfileQuota) (freed []chan struct{}, known bool) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	for _, profileQuota := range quotas {
+		if _, exists := qm.getProfileLocked(profileQuota.ProfileID); !exists {
+			return nil, false
+		}
+		ch, exists := qm.quotaFreed[profileQuota.ProfileID]
+		if !exists {
+			ch = make(chan struct{})
+			qm.quotaFreed[profileQuota.ProfileID] = ch
+		}
+		freed = append(freed, ch)
+	}
+	return freed, true
+}
+
+// notifyQuotaFreedLocked 唤醒所有等待 profile 配额的请求
+func (qm *QuotaManager) notifyQuotaFreedLocked(profileID int) {
+	if ch, exists := qm.quotaFreed[profileID]; exists {
+		close(ch)
+		delete(qm.quotaFreed, profileID)
+	}
+}
@@ -0,0 +1,119 @@
+package central
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// waitResult WaitQuota 在后台返回的结果
+type waitResult struct {
+	resp    common.QuotaResponse
+	err     error
+	elapsed time.Duration
+}
+
+// waitInBackground 在后台调用 WaitQuota
+func waitInBackground(qm *QuotaManager, ctx context.Context, req common.QuotaRequest) <-chan waitResult {
+	results := make(chan waitResult, 1)
+	go func() {
+		start := time.Now()
+		resp, err := qm.WaitQuota(ctx, req)
+		results <- waitResult{resp, err, time.Since(start)}
+	}()
+	return results
+}
+
+func TestReleaseUnblocksWaitingRequest(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	granted(t, qm.CheckQuota(quotaRequest("node-a", 1, 100)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := waitInBackground(qm, ctx, quotaRequest("node-b", 1, 10))
+
+	time.Sleep(50 * time.Millisecond)
+	qm.Release("node-a", map[int]int64{1: 30})
+
+	select {
+	case result := <-results:
+		if result.err != nil || granted(t, result.resp) != 10 {
+			t.Fatalf("WaitQuota = %+v, %v, want 10 granted", result.resp, result.err)
+		}
+		if result.elapsed > time.Second {
+			t.Fatalf("WaitQuota returned after %v, want promptly after the release", result.elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("release did not wake the waiting request")
+	}
+}
+
+func TestRefreshUnblocksWaitingRequest(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	granted(t, qm.CheckQuota(quotaRequest("node-a", 1, 100)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := waitInBackground(qm, ctx, quotaRequest("node-b", 1, 10))
+
+	time.Sleep(50 * time.Millisecond)
+	qm.refresh()
+
+	select {
+	case result := <-results:
+		if result.err != nil || granted(t, result.resp) != 10 {
+			t.Fatalf("WaitQuota = %+v, %v, want 10 granted", result.resp, result.err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("refresh did not wake the waiting request")
+	}
+}
+
+func TestWokenWaiterRechecksWhenQuotaTakenByAnother(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+	granted(t, qm.CheckQuota(quotaRequest("node-a", 1, 100)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	first := waitInBackground(qm, ctx, quotaRequest("node-b", 1, 10))
+	second := waitInBackground(qm, ctx, quotaRequest("node-c", 1, 10))
+
+	// 只释放够一个请求的配额，两个等待者都被唤醒，但只有一个能拿到
+	time.Sleep(50 * time.Millisecond)
+	qm.Release("node-a", map[int]int64{1: 10})
+
+	var served, timedOut int
+	for _, results := range []<-chan waitResult{first, second} {
+		result := <-results
+		switch {
+		case result.err == nil && granted(t, result.resp) == 10:
+			served++
+		case errors.Is(result.err, context.DeadlineExceeded) && granted(t, result.resp) == 0:
+			timedOut++
+		default:
+			t.Fatalf("WaitQuota = %+v, %v", result.resp, result.err)
+		}
+	}
+	if served != 1 || timedOut != 1 {
+		t.Fatalf("%d served and %d timed out, want one of each", served, timedOut)
+	}
+	if used := qm.profiles[1].usedQuota; used != 100 {
+		t.Fatalf("used = %d, want 100", used)
+	}
+}
+
+func TestWaitQuotaReturnsImmediatelyForUnknownProfile(t *testing.T) {
+	qm := NewQuotaManager(testRefreshInterval, map[int]ProfileConfig{1: {TotalQuota: 100}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := qm.WaitQuota(ctx, quotaRequest("node-a", 2, 10)); err != nil {
+		t.Fatalf("WaitQuota: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("WaitQuota for an unknown profile blocked for %v", elapsed)
+	}
+}
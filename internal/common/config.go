@@ -1,6 +1,11 @@
 package common
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
 
 // Config 系统配置
 type Config struct {
@@ -49,3 +54,103 @@ func GetDefaultConfig() Config {
 		},
 	}
 }
+
+// LoadConfig 从 JSON 文件加载配置，文件中没有出现的字段保留 GetDefaultConfig 中的默认值，
+// 显式写出的零值（如 "quota_margin": 0）按原样生效
+// 时间字段既可以写成 "5s" 这样的字符串，也可以写成纳秒数
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read config %s: %w", path, err)
+	}
+
+	config := GetDefaultConfig()
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate 检查配置取值是否合法
+func (c Config) Validate() error {
+	if c.Central.Port < 1 || c.Central.Port > 65535 {
+		return fmt.Errorf("central.port must be between 1 and 65535, got %d", c.Central.Port)
+	}
+	if c.Application.Port < 1 || c.Application.Port > 65535 {
+		return fmt.Errorf("application.port must be between 1 and 65535, got %d", c.Application.Port)
+	}
+	if c.Application.QuotaMargin < 0 || c.Application.QuotaMargin > 1 {
+		return fmt.Errorf("application.quota_margin must be between 0 and 1, got %g", c.Application.QuotaMargin)
+	}
+	return nil
+}
+
+// UnmarshalJSON 支持字符串形式的时间字段
+func (c *CentralConfig) UnmarshalJSON(data []byte) error {
+	type plain CentralConfig
+	aux := struct {
+		*plain
+		RefreshInterval  duration `json:"refresh_interval"`
+		OfflineThreshold duration `json:"offline_threshold"`
+		MonitorInterval  duration `json:"monitor_interval"`
+	}{
+		plain:            (*plain)(c),
+		RefreshInterval:  duration(c.RefreshInterval),
+		OfflineThreshold: duration(c.OfflineThreshold),
+		MonitorInterval:  duration(c.MonitorInterval),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	c.RefreshInterval = time.Duration(aux.RefreshInterval)
+	c.OfflineThreshold = time.Duration(aux.OfflineThreshold)
+	c.MonitorInterval = time.Duration(aux.MonitorInterval)
+	return nil
+}
+
+// UnmarshalJSON 支持字符串形式的时间字段
+func (c *ApplicationConfig) UnmarshalJSON(data []byte) error {
+	type plain ApplicationConfig
+	aux := struct {
+		*plain
+		ReportInterval duration `json:"report_interval"`
+		RequestTimeout duration `json:"request_timeout"`
+	}{
+		plain:          (*plain)(c),
+		ReportInterval: duration(c.ReportInterval),
+		RequestTimeout: duration(c.RequestTimeout),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	c.ReportInterval = time.Duration(aux.ReportInterval)
+	c.RequestTimeout = time.Duration(aux.RequestTimeout)
+	return nil
+}
+
+// duration 可从 "5s" 形式的字符串或纳秒数解析的时间间隔
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+		*d = duration(parsed)
+	case float64:
+		*d = duration(time.Duration(v))
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig 把 content 写入临时目录下的配置文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigSampleFile(t *testing.T) {
+	config, err := LoadConfig(filepath.Join("testdata", "config.json"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	defaults := GetDefaultConfig()
+	want := defaults
+	want.Central.Port = 9090
+	want.Central.MaxTotalQuota = 500000
+	want.Central.RefreshInterval = 10 * time.Second
+	want.Central.OfflineThreshold = 30 * time.Second
+	want.Application.QuotaMargin = 0 // 显式写出的零值不会被默认值覆盖
+	want.Application.RequestTimeout = 1500 * time.Millisecond
+	if config != want {
+		t.Fatalf("config = %+v\nwant %+v", config, want)
+	}
+}
+
+func TestLoadConfigEmptyObjectUsesDefaults(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, `{}`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if config != GetDefaultConfig() {
+		t.Fatalf("config = %+v, want the defaults", config)
+	}
+}
+
+func TestLoadConfigRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"malformed json", `{"central": {`, "parse config"},
+		{"wrong type", `{"central": {"port": "http"}}`, "parse config"},
+		{"bad duration", `{"central": {"refresh_interval": "soon"}}`, "invalid duration"},
+		{"port out of range", `{"central": {"port": 70000}}`, "central.port"},
+		{"application port zero", `{"application": {"port": 0}}`, "application.port"},
+		{"margin above one", `{"application": {"quota_margin": 1.5}}`, "quota_margin"},
+		{"negative margin", `{"application": {"quota_margin": -0.1}}`, "quota_margin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("loading a missing file succeeded")
+	}
+}
@@ -3,12 +3,18 @@ package common
 import "errors"
 
 var (
-	ErrNoQuota        = errors.New("no quota available")
-	ErrNodeOffline    = errors.New("node is offline")
-	ErrRequestTimeout = errors.New("request timeout")
-	ErrOverloaded     = errors.New("system overloaded")
-	ErrInvalidRequest = errors.New("invalid request")
-	ErrQuotaExceeded  = errors.New("quota exceeded")
-	ErrNodeNotFound   = errors.New("node not found")
-	ErrRateLimited    = errors.New("rate limited")
+	ErrNoQuota          = errors.New("no quota available")
+	ErrNodeOffline      = errors.New("node is offline")
+	ErrRequestTimeout   = errors.New("request timeout")
+	ErrOverloaded       = errors.New("system overloaded")
+	ErrInvalidRequest   = errors.New("invalid request")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrNodeNotFound     = errors.New("node not found")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrProfileNotFound  = errors.New("profile not found")
+	ErrProfileExists    = errors.New("profile already exists")
+	ErrNoProfiles       = errors.New("no profiles configured")
+	ErrDeadlineExceeded = errors.New("deadline exceeded")
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrRefreshing       = errors.New("quota manager is refreshing")
 )
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer 分布式追踪接口，使追踪与具体实现（如 OpenTelemetry）解耦
+// 实现负责 span 的创建以及追踪上下文在 HTTP 头（如 W3C traceparent）中的传播；
+// 不需要追踪时使用 NoopTracer
+type Tracer interface {
+	// Start 以 ctx 中的 span 为父 span 开始一个新的 span
+	Start(ctx context.Context, name string) (context.Context, Span)
+	// Inject 把 ctx 中的追踪上下文写入请求头
+	Inject(ctx context.Context, header http.Header)
+	// Extract 从请求头读取追踪上下文，返回携带它的 ctx
+	Extract(ctx context.Context, header http.Header) context.Context
+}
+
+// Span 一个进行中的 span
+type Span interface {
+	SetAttribute(key string, value any)
+	End()
+}
+
+// NoopTracer 不记录任何 span，也不传播追踪上下文
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (NoopTracer) Inject(context.Context, http.Header) {}
+
+func (NoopTracer) Extract(ctx context.Context, _ http.Header) context.Context {
+	return ctx
+}
+
+// noopSpan NoopTracer 返回的 span
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) End()                     {}
@@ -2,6 +2,8 @@ package common
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"sync/atomic"
 	"time"
 )
@@ -36,6 +38,34 @@ type Counter struct {
 	Rejected atomic.Int64 `json:"rejected"`
 }
 
+// counterJSON Counter 的 JSON 形式，atomic.Int64 本身不能直接编码为数字
+type counterJSON struct {
+	Total    int64 `json:"total"`
+	Accepted int64 `json:"accepted"`
+	Rejected int64 `json:"rejected"`
+}
+
+// MarshalJSON 编码为 {"total":N,"accepted":N,"rejected":N}
+func (c *Counter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(counterJSON{
+		Total:    c.Total.Load(),
+		Accepted: c.Accepted.Load(),
+		Rejected: c.Rejected.Load(),
+	})
+}
+
+// UnmarshalJSON 从 {"total":N,"accepted":N,"rejected":N} 解码
+func (c *Counter) UnmarshalJSON(data []byte) error {
+	var values counterJSON
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	c.Total.Store(values.Total)
+	c.Accepted.Store(values.Accepted)
+	c.Rejected.Store(values.Rejected)
+	return nil
+}
+
 // NodeStatus 节点状态信息
 type NodeStatus struct {
 	NodeID      string    `json:"node_id"`
@@ -45,6 +75,8 @@ type NodeStatus struct {
 	QuotaLeft   int64     `json:"quota_left"`
 	CPUUsage    float64   `json:"cpu_usage"`
 	MemoryUsage float64   `json:"memory_usage"`
+	// ProfileLatency 节点观测到的各 profile 后端延迟，用于中心节点自适应调整速率
+	ProfileLatency map[int]time.Duration `json:"profile_latency,omitempty"`
 }
 
 // RateControlMethod 速率控制方法
@@ -54,12 +86,72 @@ const (
 	RateControlNone RateControlMethod = iota
 	RateControlTokenBucket
 	RateControlFixedWindow
+	RateControlSlidingWindow
+	// RateControlSlidingCost 按请求成本（Required）的滑动窗口之和限流，RateLimit 为每个窗口的成本预算
+	RateControlSlidingCost
+	// RateControlGCRA 通用信元速率算法：每个窗口匀速放行 RateLimit 次，最多一次放行 Burst 次（为 0 时 1 次）
+	RateControlGCRA
 )
 
+func (m RateControlMethod) String() string {
+	switch m {
+	case RateControlNone:
+		return "none"
+	case RateControlTokenBucket:
+		return "token_bucket"
+	case RateControlFixedWindow:
+		return "fixed_window"
+	case RateControlSlidingWindow:
+		return "sliding_window"
+	case RateControlSlidingCost:
+		return "sliding_cost"
+	case RateControlGCRA:
+		return "gcra"
+	default:
+		return fmt.Sprintf("RateControlMethod(%d)", int(m))
+	}
+}
+
+// MarshalJSON 编码为可读的名称，如 "token_bucket"
+func (m RateControlMethod) MarshalJSON() ([]byte, error) {
+	if m < RateControlNone || m > RateControlGCRA {
+		return nil, fmt.Errorf("unknown rate control method %d", int(m))
+	}
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON 接受名称或整数，兼容旧的整数格式配置
+func (m *RateControlMethod) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var value int
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("rate_control_method must be a name or an integer: %s", data)
+		}
+		name = RateControlMethod(value).String()
+	}
+
+	for method := RateControlNone; method <= RateControlGCRA; method++ {
+		if method.String() == name {
+			*m = method
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown rate control method %s", data)
+}
+
 // ProfileQuota 表示单个 profile 的配额请求
 type ProfileQuota struct {
-	ProfileID int   `json:"profile_id"` // profile 标识
-	Required  int64 `json:"required"`   // 请求配额数量
+	ProfileID         int    `json:"profile_id"`                   // profile 标识
+	Required          int64  `json:"required"`                     // 请求配额数量
+	MinAcceptable     int64  `json:"min_acceptable,omitempty"`     // 可选，可接受的最小分配量，不足时不分配
+	ContinuationToken string `json:"continuation_token,omitempty"` // 可选，上次响应返回的续取令牌，携带时 Required 被忽略
+	Method            string `json:"method,omitempty"`             // 可选，原始请求的 HTTP 方法，用于路径级速率限制
+	Path              string `json:"path,omitempty"`               // 可选，原始请求的路径，用于路径级速率限制
+	// Priority 可选，同一个请求中优先级高的 profile 请求先从剩余配额中分配，优先级相同时按请求中的顺序
+	Priority int `json:"priority,omitempty"`
+	// PartialAllowed 可选，节点本地配额不足时接受部分分配，实际分配量见 Response.Granted；中心节点忽略该字段
+	PartialAllowed bool `json:"partial_allowed,omitempty"`
 }
 
 // ProfileConfig 定义每个 profile 的配置
@@ -78,14 +170,25 @@ type QuotaRequest struct {
 	RequestID string         `json:"request_id"`
 	Quotas    []ProfileQuota `json:"quotas"` // 多个 profile 的配额请求
 	Timestamp time.Time      `json:"timestamp"`
+	Deadline  time.Time      `json:"deadline,omitempty"`   // 客户端愿意等待的最后时间，预计无法在此之前完成时中心节点直接拒绝
+	AccountID string         `json:"account_id,omitempty"` // 可选，计费账户，分配的配额按账户累计
+	// Consumed 可选，节点在分配之外已经消耗的配额（如中心节点不可用期间动用的应急配额），按 profile 计入用量
+	Consumed map[int]int64 `json:"consumed,omitempty"`
+	// Refresh 为 true 时是节点的周期刷新，Required 为补充本地配额所需的数量，本地配额充足的 profile 为 0，只确认 profile 仍然存在
+	Refresh bool `json:"refresh,omitempty"`
 }
 
 // ProfileQuotaResponse 单个 profile 的配额响应
 type ProfileQuotaResponse struct {
-	ProfileID   int
-	Granted     int64
-	Required    int64
-	RateLimited bool
+	ProfileID         int    `json:"profile_id"`
+	Granted           int64  `json:"granted"`
+	Required          int64  `json:"required"`
+	RateLimited       bool   `json:"rate_limited"`
+	ContinuationToken string `json:"continuation_token,omitempty"` // 超过单次上限时返回，携带它再次请求剩余部分
+	Reason            string `json:"reason,omitempty"`             // 被拒绝时的原因
+	NotFound          bool   `json:"not_found,omitempty"`          // profile 不存在（或已被删除），与配额耗尽区分
+	// RetryAfter 被速率限制时距下一次可能通过的时间
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
 }
 
 // QuotaResponse 修改后的配额响应
@@ -93,8 +196,53 @@ type QuotaResponse struct {
 	RequestID string                 `json:"request_id"`
 	Quotas    []ProfileQuotaResponse `json:"quotas"` // 多个 profile 的配额响应
 	ExpiresAt time.Time              `json:"expires_at"`
+	// DeadlineExceeded 为 true 时请求因无法在 Deadline 前完成而被丢弃，未分配任何配额
+	DeadlineExceeded bool `json:"deadline_exceeded,omitempty"`
+	// Frozen 为 true 时中心节点处于维护冻结状态，本次响应没有消耗配额
+	Frozen bool `json:"frozen,omitempty"`
+	// Busy 为 true 时中心节点负载较高，即使分配成功客户端也应放慢请求
+	Busy bool `json:"busy,omitempty"`
+	// Refreshing 为 true 时中心节点正在进行非原子刷新，请求未被处理，应稍后重试
+	Refreshing bool `json:"refreshing,omitempty"`
+	// Warnings 分配成功但客户端应当知道的情况，例如只分到一部分
+	Warnings []Warning `json:"warnings,omitempty"`
+	// Cached 为 true 时响应来自客户端的检查缓存，是中心节点之前的决策而不是本次的分配
+	Cached bool `json:"-"`
+}
+
+// RetryAfter 所有 profile 都被速率限制时，返回最早可以重试的时间；否则返回 false
+func (r *QuotaResponse) RetryAfter() (time.Duration, bool) {
+	if len(r.Quotas) == 0 {
+		return 0, false
+	}
+	retryAfter := time.Duration(-1)
+	for _, quota := range r.Quotas {
+		if !quota.RateLimited {
+			return 0, false
+		}
+		if retryAfter < 0 || quota.RetryAfter < retryAfter {
+			retryAfter = quota.RetryAfter
+		}
+	}
+	return retryAfter, true
 }
 
+// Warning 成功响应附带的提示
+type Warning struct {
+	Code      string `json:"code"` // 见 Warning* 常量
+	ProfileID int    `json:"profile_id"`
+	Message   string `json:"message"`
+}
+
+const (
+	// WarningPartialGrant profile 剩余配额不足，只分配了请求的一部分
+	WarningPartialGrant = "partial_grant"
+	// WarningNodeShareLimited 分配量受节点在 profile 中的份额限制，profile 本身仍有剩余
+	WarningNodeShareLimited = "node_share_limited"
+	// WarningBoostQuota 分配使用了临时增加的配额，增量过期后同样的用量可能被拒绝
+	WarningBoostQuota = "boost_quota"
+)
+
 // Request represents an incoming request to the node
 type Request struct {
 	RequestID string
@@ -106,6 +254,7 @@ type Request struct {
 type Response struct {
 	RequestID string
 	Status    Status
+	Granted   map[int]int64 // amount granted per profile, below Required only for quotas with PartialAllowed
 }
 
 // Status represents request processing status
@@ -125,18 +274,41 @@ type RateLimiter interface {
 // Client interface defines communication with central server
 type Client interface {
 	RequestQuota(ctx context.Context, req QuotaRequest) (QuotaResponse, error)
+	// Handoff asks central to redistribute the node's allocation to the remaining nodes
+	Handoff(ctx context.Context, nodeID string) error
+	// Release returns quota the node was allocated but did not use
+	Release(ctx context.Context, req ReleaseRequest) error
+	// Heartbeat reports the node as online without requesting quota
+	Heartbeat(ctx context.Context, nodeID string) error
+	// Health checks that central is reachable and healthy
+	Health(ctx context.Context) error
+}
+
+// ReleaseRequest 归还节点未使用的配额
+type ReleaseRequest struct {
+	NodeID string        `json:"node_id"`
+	Unused map[int]int64 `json:"unused"` // profileID 到归还数量的映射
 }
 
 // NodeQuotaStatus represents current node quota status
 type NodeQuotaStatus struct {
-	NodeID      string
-	LastRefresh time.Time
-	Quotas      map[int]ProfileStatus
+	NodeID           string
+	LastRefresh      time.Time
+	LastRefreshError string // empty if the last refresh succeeded
+	RefreshSuccesses int64
+	RefreshFailures  int64
+	EmergencyUsed    int64         // emergency reserve spent since central became unreachable
+	RefreshInterval  time.Duration // current refresh interval, which varies with adaptive refresh
+	Fallback         string        // active fallback mode while central is unreachable, empty otherwise
+	Quotas           map[int]ProfileStatus
 }
 
 // ProfileStatus represents status of a profile's quota
 type ProfileStatus struct {
-	Allocated int64
-	Used      int64
-	Available int64
+	Allocated     int64
+	Used          int64
+	Available     int64
+	EmergencyUsed int64
+	Headroom      int64 // lowest Available seen in the current refresh interval
+	LastHeadroom  int64 // lowest Available seen in the last completed refresh interval
 }
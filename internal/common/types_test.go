@@ -0,0 +1,114 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNodeStatusCounterRoundTrip(t *testing.T) {
+	counter := &Counter{}
+	counter.Total.Store(5)
+	counter.Accepted.Store(3)
+	counter.Rejected.Store(2)
+	sent := NodeStatus{NodeID: "node-1", State: StateOnline, Counter: counter, LastSeen: time.Unix(1700000000, 0).UTC(), QuotaLeft: 40}
+
+	data, err := json.Marshal(sent)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// 计数器编码为普通数字
+	if want := `"counter":{"total":5,"accepted":3,"rejected":2}`; !strings.Contains(string(data), want) {
+		t.Fatalf("encoded status %s does not contain %s", data, want)
+	}
+
+	// 接收端解码后得到相同的计数
+	var received NodeStatus
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if received.Counter == nil {
+		t.Fatal("decoded status has no counter")
+	}
+	if received.Counter.Total.Load() != 5 || received.Counter.Accepted.Load() != 3 || received.Counter.Rejected.Load() != 2 {
+		t.Fatalf("decoded counter = %d/%d/%d, want 5/3/2", received.Counter.Total.Load(), received.Counter.Accepted.Load(), received.Counter.Rejected.Load())
+	}
+	if received.NodeID != sent.NodeID || received.QuotaLeft != sent.QuotaLeft || !received.LastSeen.Equal(sent.LastSeen) {
+		t.Fatalf("decoded status = %+v, want %+v", received, sent)
+	}
+}
+
+func TestNodeStatusWithoutCounter(t *testing.T) {
+	data, err := json.Marshal(NodeStatus{NodeID: "node-1"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var received NodeStatus
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if received.Counter != nil {
+		t.Fatalf("decoded counter = %+v, want nil", received.Counter)
+	}
+
+	if err := json.Unmarshal([]byte(`{"counter":{"total":"many"}}`), &received); err == nil {
+		t.Fatal("decoding a non-numeric counter succeeded")
+	}
+}
+
+func TestRateControlMethodJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Method RateControlMethod `json:"method"`
+	}{RateControlSlidingWindow})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(data) != `{"method":"sliding_window"}` {
+		t.Fatalf("marshaled %s, want the method name", data)
+	}
+
+	// 名称和旧的整数格式都可以解析
+	for input, want := range map[string]RateControlMethod{
+		`"token_bucket"`: RateControlTokenBucket,
+		`"none"`:         RateControlNone,
+		`2`:              RateControlFixedWindow,
+	} {
+		var method RateControlMethod
+		if err := json.Unmarshal([]byte(input), &method); err != nil || method != want {
+			t.Errorf("unmarshal %s = %v, %v, want %v", input, method, err, want)
+		}
+	}
+
+	for _, input := range []string{`"leaky_bucket"`, `99`, `true`} {
+		var method RateControlMethod
+		if err := json.Unmarshal([]byte(input), &method); err == nil {
+			t.Errorf("unmarshal %s succeeded, want an error", input)
+		}
+	}
+	if _, err := json.Marshal(RateControlMethod(99)); err == nil {
+		t.Error("marshaling an unknown method succeeded, want an error")
+	}
+}
+
+func TestProfileQuotaResponseNotFoundRoundTrip(t *testing.T) {
+	for _, want := range []ProfileQuotaResponse{
+		{ProfileID: 1, Required: 5, NotFound: true, Reason: "profile not found"},
+		{ProfileID: 2, Required: 5},
+	} {
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		if got := strings.Contains(string(data), `"not_found"`); got != want.NotFound {
+			t.Errorf("%s contains not_found = %v, want %v", data, got, want.NotFound)
+		}
+		var got ProfileQuotaResponse
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if got != want {
+			t.Errorf("round trip = %+v, want %+v", got, want)
+		}
+	}
+}
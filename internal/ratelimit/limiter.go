@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// Limiter 独立使用的速率限制器，按任意字符串键维护相互独立的速率状态
+// 与中心节点的 QuotaManager 使用同一套速率控制实现，不涉及配额、节点和刷新周期
+// 每个键的状态会一直保留，键的取值不受控制时应通过 Reset 清理
+type Limiter struct {
+	mu     sync.Mutex
+	limit  Limit
+	states map[string]*State
+	now    func() time.Time
+}
+
+// New 创建独立的速率限制器，参数含义与中心节点 ProfileConfig 中的同名字段相同：
+// 令牌桶每秒补充 rate 个令牌、最多 burst 个，空闲超过 window 后装满；
+// 固定/滑动窗口每个 window 最多 rate 次；成本滑动窗口每个 window 的成本之和最多为 rate；
+// GCRA 每 window 匀速放行 rate 次，最多一次放行 burst 个
+// method 为 RateControlNone 时不做任何限制
+func New(method common.RateControlMethod, rate, burst int64, window time.Duration) (*Limiter, error) {
+	if method < common.RateControlNone || method > common.RateControlGCRA {
+		return nil, fmt.Errorf("%w: unknown rate control method %d", common.ErrInvalidRequest, int(method))
+	}
+	if rate < 0 || burst < 0 {
+		return nil, fmt.Errorf("%w: rate and burst must be non-negative", common.ErrInvalidRequest)
+	}
+	if method != common.RateControlNone && window <= 0 {
+		return nil, fmt.Errorf("%w: window must be positive when rate control is enabled", common.ErrInvalidRequest)
+	}
+
+	return &Limiter{
+		limit:  Limit{Method: method, Rate: rate, Burst: burst, Window: window},
+		states: make(map[string]*State),
+		now:    time.Now,
+	}, nil
+}
+
+// Allow 判断 key 的一次请求能否通过，通过时消耗一个许可
+func (l *Limiter) Allow(key string) bool {
+	return l.AllowN(key, 1)
+}
+
+// AllowN 判断 key 能否一次消耗 n 个许可（令牌、窗口计数或成本），可以时全部消耗，否则不消耗
+// n <= 0 时总是通过
+func (l *Limiter) AllowN(key string, n int64) bool {
+	if n <= 0 || l.limit.Method == common.RateControlNone {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, exists := l.states[key]
+	if !exists {
+		state = &State{}
+		l.states[key] = state
+	}
+	return state.AllowN(l.limit, l.now(), n)
+}
+
+// Reset 丢弃 key 的速率状态，下一次请求按全新的键处理
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.states, key)
+}
@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newTestLimiter 创建使用 clock 计时的 Limiter
+func newTestLimiter(t *testing.T, clock *fakeClock, method common.RateControlMethod, rate, burst int64, window time.Duration) *Limiter {
+	t.Helper()
+	l, err := New(method, rate, burst, window)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	l.now = clock.Now
+	return l
+}
+
+func TestNewRejectsInvalidParameters(t *testing.T) {
+	cases := []struct {
+		name        string
+		method      common.RateControlMethod
+		rate, burst int64
+		window      time.Duration
+	}{
+		{"unknown method", common.RateControlGCRA + 1, 1, 1, time.Second},
+		{"negative rate", common.RateControlFixedWindow, -1, 0, time.Second},
+		{"negative burst", common.RateControlTokenBucket, 1, -1, time.Second},
+		{"zero window", common.RateControlSlidingWindow, 1, 0, 0},
+	}
+	for _, c := range cases {
+		if _, err := New(c.method, c.rate, c.burst, c.window); !errors.Is(err, common.ErrInvalidRequest) {
+			t.Errorf("%s: err = %v, want ErrInvalidRequest", c.name, err)
+		}
+	}
+
+	// 不限流时窗口可以为零
+	if _, err := New(common.RateControlNone, 0, 0, 0); err != nil {
+		t.Errorf("RateControlNone with zero window: %v", err)
+	}
+}
+
+func TestLimiterAdmissionPerMethod(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		n       int64
+		want    bool
+	}
+	cases := []struct {
+		name        string
+		method      common.RateControlMethod
+		rate, burst int64
+		window      time.Duration
+		steps       []step
+	}{
+		{
+			name:   "none",
+			method: common.RateControlNone,
+			steps:  []step{{0, 1000, true}, {0, 1000, true}},
+		},
+		{
+			name:   "token bucket",
+			method: common.RateControlTokenBucket,
+			rate:   10, burst: 5, window: time.Second,
+			steps: []step{
+				{0, 3, true},
+				{0, 3, false}, // 只剩 2 个令牌，不足时不消耗
+				{0, 2, true},
+				{0, 1, false},
+				{100 * time.Millisecond, 1, true}, // 每 100ms 补充一个令牌
+				{0, 1, false},
+				{2 * time.Second, 5, true}, // 空闲超过窗口后装满
+			},
+		},
+		{
+			name:   "fixed window",
+			method: common.RateControlFixedWindow,
+			rate:   3, window: time.Minute,
+			steps: []step{
+				{0, 1, true},
+				{0, 2, true},
+				{30 * time.Second, 1, false},
+				{31 * time.Second, 3, true}, // 进入新窗口，计数清零
+			},
+		},
+		{
+			name:   "sliding window",
+			method: common.RateControlSlidingWindow,
+			rate:   4, window: time.Second,
+			steps: []step{
+				{0, 4, true},
+				{0, 1, false},
+				// 上一窗口的 4 次按剩余一半计为 2 次，还能通过 2 次
+				{1500 * time.Millisecond, 1, true},
+				{0, 1, true},
+				{0, 1, false},
+			},
+		},
+		{
+			name:   "sliding cost",
+			method: common.RateControlSlidingCost,
+			rate:   10, window: time.Second,
+			steps: []step{
+				{0, 6, true},
+				{0, 5, false}, // 成本之和超过 10
+				{0, 4, true},
+				{0, 1, false},
+				{2 * time.Second, 10, true},
+			},
+		},
+		{
+			name:   "gcra",
+			method: common.RateControlGCRA,
+			rate:   10, burst: 2, window: time.Second,
+			steps: []step{
+				{0, 2, true},
+				{0, 1, false},
+				{50 * time.Millisecond, 1, false}, // 每 100ms 放行一个
+				{50 * time.Millisecond, 1, true},
+				{0, 1, false},
+				{time.Second, 3, false}, // 超过突发容量的请求永远不能一次通过
+				{0, 2, true},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		clock := newFakeClock()
+		l := newTestLimiter(t, clock, c.method, c.rate, c.burst, c.window)
+		for i, s := range c.steps {
+			clock.Advance(s.advance)
+			if got := l.AllowN("client-a", s.n); got != s.want {
+				t.Errorf("%s step %d: AllowN(%d) = %v, want %v", c.name, i, s.n, got, s.want)
+			}
+		}
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(t, clock, common.RateControlFixedWindow, 1, 0, time.Minute)
+
+	if !l.Allow("client-a") {
+		t.Fatal("first request for client-a was denied")
+	}
+	if l.Allow("client-a") {
+		t.Fatal("second request for client-a was admitted")
+	}
+	// 其他键的状态相互独立
+	if !l.Allow("client-b") {
+		t.Fatal("client-b was limited by client-a's requests")
+	}
+
+	// Reset 后按全新的键处理
+	l.Reset("client-a")
+	if !l.Allow("client-a") {
+		t.Fatal("client-a was denied after Reset")
+	}
+}
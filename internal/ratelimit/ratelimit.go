@@ -0,0 +1,281 @@
+// Package ratelimit 速率控制算法（令牌桶、固定窗口、滑动窗口、成本滑动窗口和 GCRA）
+// 中心节点的配额管理和独立使用的 Limiter 共用这套实现，本包不依赖配额、节点和服务端
+package ratelimit
+
+import (
+	"throttle_control/internal/common"
+	"time"
+)
+
+// Limit 速率控制参数
+type Limit struct {
+	Method  common.RateControlMethod
+	Rate    int64
+	Burst   int64
+	Window  time.Duration
+	Aligned bool // 窗口对齐到时钟边界（自 Unix 纪元起的整数倍窗口）
+}
+
+// State 一个速率控制键（如 profile 或 profile+维度）的状态，零值为全新的键
+type State struct {
+	LastWindowTime time.Time // GCRA 中为理论到达时间（TAT）
+	Tokens         int64
+	RequestCount   int64
+	PrevCount      int64     // 滑动窗口：上一个窗口的请求数
+	LastUsed       time.Time // 最近一次使用时间，供调用方淘汰空闲的状态
+}
+
+// Allow 判断当前请求是否通过速率控制，通过时消耗一次许可
+func (rs *State) Allow(limit Limit, now time.Time) bool {
+	return rs.AllowN(limit, now, 1)
+}
+
+// AllowCost 同 Allow，成本限流时按 cost 计入窗口，其他方法只消耗一次许可
+func (rs *State) AllowCost(limit Limit, now time.Time, cost int64) bool {
+	if limit.Method != common.RateControlSlidingCost {
+		cost = 1
+	}
+	return rs.AllowN(limit, now, cost)
+}
+
+// Refill 按距上次补充的时间向令牌桶补充令牌，空闲超过窗口后装满
+func (rs *State) Refill(limit Limit, now time.Time) {
+	elapsed := now.Sub(rs.LastWindowTime)
+	if elapsed > limit.Window {
+		rs.Tokens = limit.Burst
+		rs.LastWindowTime = now
+		elapsed = 0
+	}
+
+	// 补充的令牌只计入一次：补充时间推进到已补充令牌对应的时刻，桶满时不再累积
+	if newTokens := int64(elapsed.Seconds() * float64(limit.Rate)); newTokens > 0 {
+		rs.Tokens += newTokens
+		rs.LastWindowTime = rs.LastWindowTime.Add(time.Duration(float64(newTokens) / float64(limit.Rate) * float64(time.Second)))
+	}
+	if rs.Tokens >= limit.Burst {
+		rs.Tokens = limit.Burst
+		rs.LastWindowTime = now
+	}
+}
+
+// AllowN 判断能否一次消耗 n 个许可（令牌、窗口计数或成本），可以时全部消耗，否则不消耗
+func (rs *State) AllowN(limit Limit, now time.Time, n int64) bool {
+	switch limit.Method {
+	case common.RateControlTokenBucket:
+		// 令牌桶算法
+		rs.Refill(limit, now)
+		if rs.Tokens < n {
+			return false
+		}
+		rs.Tokens -= n
+
+	case common.RateControlFixedWindow:
+		// 固定窗口算法
+		if start, expired := rs.Window(limit, now); expired {
+			rs.RequestCount = 0
+			rs.LastWindowTime = start
+		}
+
+		if rs.RequestCount+n > limit.Rate {
+			return false
+		}
+		rs.RequestCount += n
+
+	case common.RateControlSlidingWindow:
+		// 滑动窗口算法：上一窗口的计数按仍落在滑动区间内的比例计入
+		rs.Slide(limit, now)
+		if rs.SlidingCount(limit, now)+float64(n-1) >= float64(limit.Rate) {
+			return false
+		}
+		rs.RequestCount += n
+
+	case common.RateControlSlidingCost:
+		// 成本滑动窗口：窗口内的成本之和加上本次成本不能超过预算
+		rs.Slide(limit, now)
+		if rs.SlidingCount(limit, now)+float64(n) > float64(limit.Rate) {
+			return false
+		}
+		rs.RequestCount += n
+
+	case common.RateControlGCRA:
+		// GCRA：许可按固定间隔匀速放行，理论到达时间最多领先 now 一个突发容量
+		interval, ok := limit.emissionInterval()
+		if !ok {
+			return false
+		}
+		tat := rs.LastWindowTime
+		if tat.Before(now) {
+			tat = now
+		}
+		next := tat.Add(time.Duration(n) * interval)
+		if next.Sub(now) > limit.gcraCapacity(interval) {
+			return false
+		}
+		rs.LastWindowTime = next
+	}
+
+	return true
+}
+
+// emissionInterval GCRA 中相邻两个许可的间隔（每 Window 放行 Rate 个），Rate 或 Window 不为正时返回 false
+func (l Limit) emissionInterval() (time.Duration, bool) {
+	if l.Rate <= 0 || l.Window <= 0 {
+		return 0, false
+	}
+	return max(l.Window/time.Duration(l.Rate), 1), true
+}
+
+// GCRARemaining GCRA 当前还能立即放行的许可数，以及突发容量完全恢复的时间
+// 非 GCRA 或参数无效时 ok 为 false
+func (rs *State) GCRARemaining(limit Limit, now time.Time) (remaining int64, full time.Time, ok bool) {
+	interval, ok := limit.emissionInterval()
+	if !ok || limit.Method != common.RateControlGCRA {
+		return 0, time.Time{}, false
+	}
+	tat := rs.LastWindowTime
+	if tat.Before(now) {
+		tat = now
+	}
+	remaining = int64((limit.gcraCapacity(interval) - tat.Sub(now)) / interval)
+	return max(remaining, 0), tat, true
+}
+
+// gcraCapacity GCRA 的突发容量：最多一次放行 Burst 个许可，Burst 为 0 时为 1 个
+func (l Limit) gcraCapacity(interval time.Duration) time.Duration {
+	return time.Duration(max(l.Burst, 1)) * interval
+}
+
+// Slide 将滑动窗口推进到 now 所在的窗口
+// 跨过一个窗口时当前计数成为上一窗口计数，跨过两个及以上窗口时全部清零
+func (rs *State) Slide(limit Limit, now time.Time) {
+	if limit.Window <= 0 {
+		return
+	}
+
+	start := rs.LastWindowTime
+	switch {
+	case limit.Aligned:
+		start = alignedWindowStart(now, limit.Window)
+	case rs.LastWindowTime.IsZero():
+		start = now
+	default:
+		if passed := now.Sub(rs.LastWindowTime) / limit.Window; passed > 0 {
+			start = rs.LastWindowTime.Add(passed * limit.Window)
+		}
+	}
+
+	switch passed := start.Sub(rs.LastWindowTime) / limit.Window; {
+	case rs.LastWindowTime.IsZero() || passed >= 2:
+		rs.PrevCount = 0
+		rs.RequestCount = 0
+	case passed == 1:
+		rs.PrevCount = rs.RequestCount
+		rs.RequestCount = 0
+	}
+	rs.LastWindowTime = start
+}
+
+// SlidingCount 估算截至 now 的一个完整窗口内的请求数，调用前需先 Slide
+func (rs *State) SlidingCount(limit Limit, now time.Time) float64 {
+	elapsed := float64(now.Sub(rs.LastWindowTime)) / float64(limit.Window)
+	return float64(rs.PrevCount)*(1-min(max(elapsed, 0), 1)) + float64(rs.RequestCount)
+}
+
+// Window 返回 now 所在窗口的起始时间，以及记录的窗口是否已经过期
+// 对齐模式下窗口边界由时钟决定，同一时刻在任何节点上得到相同的窗口
+func (rs *State) Window(limit Limit, now time.Time) (start time.Time, expired bool) {
+	if limit.Aligned && limit.Window > 0 {
+		start = alignedWindowStart(now, limit.Window)
+		return start, !start.Equal(rs.LastWindowTime)
+	}
+
+	if now.Sub(rs.LastWindowTime) > limit.Window {
+		return now, true
+	}
+	return rs.LastWindowTime, false
+}
+
+// alignedWindowStart 计算 now 所在的对齐窗口起点
+func alignedWindowStart(now time.Time, window time.Duration) time.Time {
+	offset := time.Duration(now.UnixNano() % int64(window))
+	return now.Add(-offset)
+}
+
+// RetryAfter 距下一次许可可用的时间，当前已有许可时返回 0，不修改状态
+// 成本超过预算、永远无法通过的请求同样返回 0
+func (rs *State) RetryAfter(limit Limit, now time.Time, cost int64) time.Duration {
+	switch limit.Method {
+	case common.RateControlTokenBucket:
+		elapsed := now.Sub(rs.LastWindowTime)
+		if elapsed > limit.Window {
+			return 0
+		}
+		// 与 Allow 相同：令牌按距 LastWindowTime 的时间补充，超过窗口后重新填满
+		if rs.Tokens+int64(elapsed.Seconds()*float64(limit.Rate)) >= 1 {
+			return 0
+		}
+		wait := rs.LastWindowTime.Add(limit.Window).Sub(now) + 1
+		if limit.Rate > 0 {
+			needed := time.Duration(float64(1-rs.Tokens) / float64(limit.Rate) * float64(time.Second))
+			wait = min(wait, max(needed-elapsed, 0)+1)
+		}
+		return wait
+
+	case common.RateControlFixedWindow:
+		start, expired := rs.Window(limit, now)
+		if expired || rs.RequestCount < limit.Rate {
+			return 0
+		}
+		wait := start.Add(limit.Window).Sub(now)
+		if !limit.Aligned {
+			// 非对齐窗口在超过窗口长度后才过期
+			wait++
+		}
+		return wait
+
+	case common.RateControlSlidingWindow, common.RateControlSlidingCost:
+		if limit.Window <= 0 {
+			return 0
+		}
+		state := *rs
+		state.Slide(limit, now)
+		// free 为窗口内计数必须降到的值：计数限流要求低于限额，成本限流要求留出本次成本
+		free := float64(limit.Rate)
+		allowed := state.SlidingCount(limit, now) < free
+		if limit.Method == common.RateControlSlidingCost {
+			if cost > limit.Rate {
+				return 0
+			}
+			free = float64(limit.Rate - cost)
+			allowed = state.SlidingCount(limit, now) <= free
+		}
+		if allowed {
+			return 0
+		}
+		window := float64(limit.Window)
+		end := state.LastWindowTime.Add(limit.Window)
+		if state.RequestCount > 0 && float64(state.RequestCount) >= free {
+			// 当前窗口已满：下一个窗口中本窗口的计数按比例衰减到 free 以下
+			fraction := 1 - free/float64(state.RequestCount)
+			return end.Sub(now) + time.Duration(fraction*window) + 1
+		}
+		if state.PrevCount == 0 {
+			return 0
+		}
+		// 上一窗口的计数衰减到剩余额度以下
+		fraction := 1 - (free-float64(state.RequestCount))/float64(state.PrevCount)
+		return max(state.LastWindowTime.Add(time.Duration(fraction*window)).Sub(now), 0) + 1
+
+	case common.RateControlGCRA:
+		interval, ok := limit.emissionInterval()
+		if !ok {
+			return 0
+		}
+		tat := rs.LastWindowTime
+		if tat.Before(now) {
+			tat = now
+		}
+		return max(tat.Add(interval).Sub(now)-limit.gcraCapacity(interval), 0)
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"throttle_control/internal/common"
+	"time"
+)
+
+func TestAlignedWindowsShareBuckets(t *testing.T) {
+	limit := Limit{Method: common.RateControlSlidingWindow, Rate: 10, Window: time.Second, Aligned: true}
+	second := time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)
+
+	// 两个节点在同一秒内的不同时刻第一次求值
+	var first, other State
+	first.Allow(limit, second.Add(200*time.Millisecond))
+	other.Allow(limit, second.Add(700*time.Millisecond))
+	if !first.LastWindowTime.Equal(second) || !other.LastWindowTime.Equal(second) {
+		t.Fatalf("window starts = %v, %v, want both at %v", first.LastWindowTime, other.LastWindowTime, second)
+	}
+
+	// 跨过秒边界后两者都推进到下一个窗口，上一窗口的计数相同
+	first.Allow(limit, second.Add(1100*time.Millisecond))
+	other.Allow(limit, second.Add(1900*time.Millisecond))
+	if !first.LastWindowTime.Equal(other.LastWindowTime) || first.PrevCount != other.PrevCount {
+		t.Errorf("states diverged: %+v vs %+v", first, other)
+	}
+}
+
+func TestGCRAPacesPermitsEvenly(t *testing.T) {
+	// 每秒 10 个，即每 100ms 一个，最多一次放行 3 个
+	limit := Limit{Method: common.RateControlGCRA, Rate: 10, Burst: 3, Window: time.Second}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var state State
+
+	for i := 0; i < 3; i++ {
+		if !state.Allow(limit, start) {
+			t.Fatalf("burst permit %d denied", i)
+		}
+	}
+	if state.Allow(limit, start) {
+		t.Fatal("permit beyond the burst admitted")
+	}
+	if wait := state.RetryAfter(limit, start, 1); wait != 100*time.Millisecond {
+		t.Fatalf("RetryAfter = %v, want one emission interval", wait)
+	}
+
+	// 突发用完后按间隔匀速放行，不会像令牌桶一样在窗口内集中补充
+	if state.Allow(limit, start.Add(99*time.Millisecond)) {
+		t.Fatal("permit admitted before the emission interval passed")
+	}
+	if !state.Allow(limit, start.Add(100*time.Millisecond)) {
+		t.Fatal("permit denied after the emission interval")
+	}
+	if state.Allow(limit, start.Add(150*time.Millisecond)) {
+		t.Fatal("second permit admitted within one interval")
+	}
+
+	// 空闲足够久后恢复完整的突发，但不会超过
+	later := start.Add(10 * time.Second)
+	if !state.AllowN(limit, later, 3) || state.Allow(limit, later) {
+		t.Fatal("idle state did not recover exactly the burst")
+	}
+}